@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/services"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
 	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthHandler struct {
@@ -16,9 +20,10 @@ type AuthHandler struct {
 	roleService     *userservices.RoleService
 }
 
-func NewAuthHandler(client *mongo.Client, dbName string, userRoleService *userservices.UserRoleService, roleService *userservices.RoleService) *AuthHandler {
+// NewAuthHandlerWith wraps an already built auth service
+func NewAuthHandlerWith(service *services.AuthService, userRoleService *userservices.UserRoleService, roleService *userservices.RoleService) *AuthHandler {
 	return &AuthHandler{
-		service:         services.NewAuthService(client.Database(dbName)),
+		service:         service,
 		userRoleService: userRoleService,
 		roleService:     roleService,
 	}
@@ -49,11 +54,122 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, user, err := h.service.Login(credentials.Email, credentials.Password)
-	if err != nil {
+	result, err := h.service.Login(credentials.Email, credentials.Password, clientOf(c))
+	var locked *services.LockedOutError
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
+	case errors.As(err, &locked):
+		retryAfter := int64(math.Ceil(locked.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed logins; try again later", "retry_after": retryAfter})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if result.Challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":        true,
+			"mfa_token":           result.Challenge.Token,
+			"expires_in":          result.Challenge.ExpiresIn,
+			"enrollment_required": result.Challenge.EnrollmentRequired,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(result))
+}
+
+// loginResponse gives the tokens of a completed login and the user
+func loginResponse(result *services.LoginResult) gin.H {
+	return gin.H{
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_in":    result.Tokens.ExpiresIn,
+		"user":          result.User,
+	}
+}
+
+// refreshRequest carries the refresh token of a session
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tokens, err := h.service.Refresh(req.RefreshToken)
+	if err != nil {
+		respondSessionError(c, err, "Failed to refresh session")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// ListSessions lists the devices the user is signed in on
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	sessions, err := h.service.ListSessions(principal.UserID, principal.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
 
-	c.JSON(http.StatusOK, gin.H{"token": token, "user": user})
+// RevokeSession signs the user out on one device
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID format"})
+		return
+	}
+	if err := h.service.RevokeSession(userID, sessionID); err != nil {
+		respondSessionError(c, err, "Failed to revoke session")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+func clientOf(c *gin.Context) services.Client {
+	return services.Client{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	return principal.UserID, true
+}
+
+func respondSessionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidRefreshToken), errors.Is(err, services.ErrRefreshTokenReused),
+		errors.Is(err, services.ErrMFARequired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
 }
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/keys"
+)
+
+// JWKSHandler publishes the public keys access tokens are verified with
+type JWKSHandler struct {
+	keys *keys.Set
+}
+
+func NewJWKSHandler(signing *keys.Set) *JWKSHandler {
+	return &JWKSHandler{keys: signing}
+}
+
+// Get serves the JWKS. Verifiers may cache it for a few minutes; keys are
+// published before they start signing, so a cached copy knows them in time.
+func (h *JWKSHandler) Get(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS(time.Now()))
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UnlockUser lifts the lockout failed logins put on a user's account
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	if err := h.service.UnlockUser(userID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// UnlockIP lifts the lockout failed logins put on an IP address
+func (h *AuthHandler) UnlockIP(c *gin.Context) {
+	if err := h.service.UnlockIP(c.Param("ip")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock IP address"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "IP address unlocked"})
+}
@@ -6,9 +6,17 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// LogoutHandler handles user logout by instructing the client to delete the JWT
-func LogoutHandler(c *gin.Context) {
-	// For stateless JWT, logout is handled on the client by deleting the token.
-	// Optionally, you can blacklist the token here if you implement token blacklisting.
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully. Please delete your token on the client."})
+// Logout revokes the session of the given refresh token. Its access tokens
+// stay valid until they expire, within minutes.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.Logout(req.RefreshToken); err != nil {
+		respondSessionError(c, err, "Failed to log out")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/services"
+)
+
+// mfaCodeRequest carries a code from the authenticator app, or a recovery code
+type mfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type mfaTokenRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// CompleteLogin exchanges the MFA token of a login and a code for the tokens
+// of the session. If the login enrolled a second factor, the recovery codes
+// of it are included; they are not shown again.
+func (h *AuthHandler) CompleteLogin(c *gin.Context) {
+	var req mfaLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, recoveryCodes, err := h.service.CompleteLogin(req.MFAToken, req.Code, clientOf(c))
+	if err != nil {
+		respondMFAError(c, err, "Failed to complete login")
+		return
+	}
+	response := loginResponse(result)
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// EnrollDuringLogin starts enrolling a second factor for a login that
+// requires one the user does not have yet
+func (h *AuthHandler) EnrollDuringLogin(c *gin.Context) {
+	var req mfaTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	enrollment, err := h.service.EnrollWithChallenge(req.MFAToken)
+	if err != nil {
+		respondMFAError(c, err, "Failed to start enrollment")
+		return
+	}
+	respondEnrollment(c, enrollment)
+}
+
+// StartMFA starts enrolling a second factor for the user
+func (h *AuthHandler) StartMFA(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	enrollment, err := h.service.StartMFA(userID)
+	if err != nil {
+		respondMFAError(c, err, "Failed to start enrollment")
+		return
+	}
+	respondEnrollment(c, enrollment)
+}
+
+// ConfirmMFA turns the enrolled second factor on and returns its recovery codes
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recoveryCodes, err := h.service.ConfirmMFA(userID, req.Code)
+	if err != nil {
+		respondMFAError(c, err, "Failed to confirm two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": recoveryCodes})
+}
+
+// DisableMFA turns the second factor of the user off
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.DisableMFA(userID, req.Code); err != nil {
+		respondMFAError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func respondEnrollment(c *gin.Context, enrollment *services.MFAEnrollment) {
+	c.JSON(http.StatusOK, gin.H{"secret": enrollment.Secret, "otpauth_uri": enrollment.URI})
+}
+
+func respondMFAError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFAToken), errors.Is(err, services.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMFAAlreadyEnabled), errors.Is(err, services.ErrMFANotEnabled),
+		errors.Is(err, services.ErrMFANotEnrolling):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMFARequiredByRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
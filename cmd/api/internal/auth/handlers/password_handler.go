@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/services"
+)
+
+// emailRequest names the account an email is sent to
+type emailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// ForgotPassword emails a password reset link. It answers the same whether
+// or not the email is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req emailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.ForgotPassword(req.Email); err != nil {
+		// Failing only for registered emails would tell them apart
+		log.Printf("Error starting password reset: %v", err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered, a password reset link has been sent to it"})
+}
+
+// ResetPassword sets a new password with the token from the reset email and
+// signs the user out everywhere
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset; log in with the new password"})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/services"
+)
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail confirms the user owns their email address with the token
+// from the verification email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req verifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.VerifyEmail(req.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification sends a new verification link. It answers the same
+// whether or not the email is registered or already verified.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req emailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.ResendVerification(req.Email); err != nil {
+		log.Printf("Error resending email verification: %v", err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered and not verified yet, a verification link has been sent to it"})
+}
@@ -0,0 +1,268 @@
+// Package keys holds the keys access tokens are signed with. Several keys
+// can be configured, each identified by a kid and taking over signing at its
+// not_before time; the one it replaces keeps verifying tokens for an overlap
+// window. Every key not yet retired is published as a JWKS, so other
+// services can verify tokens and learn of upcoming keys before they sign.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms, as named in JWT headers and JWKS
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// minRSABits is the smallest RSA key accepted
+const minRSABits = 2048
+
+// DefaultOverlap is how long a replaced key keeps verifying tokens when
+// JWT_KEY_OVERLAP is unset. It must outlast the access tokens it signed.
+const DefaultOverlap = time.Hour
+
+var (
+	ErrNoKeys      = errors.New("no JWT signing keys configured; set JWT_KEYS_DIR")
+	ErrNoActiveKey = errors.New("no JWT signing key is active yet")
+)
+
+// Key is a private key and when it starts signing
+type Key struct {
+	ID        string
+	Algorithm string
+	NotBefore time.Time
+	private   crypto.Signer
+}
+
+// NewKey wraps an RSA or Ed25519 private key, picking its algorithm
+func NewKey(id string, private crypto.Signer, notBefore time.Time) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("key without a kid")
+	}
+	key := &Key{ID: id, NotBefore: notBefore, private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("key %s: RSA keys need at least %d bits", id, minRSABits)
+		}
+		key.Algorithm = RS256
+	case ed25519.PrivateKey:
+		key.Algorithm = EdDSA
+	default:
+		return nil, fmt.Errorf("key %s: only RSA and Ed25519 keys are supported", id)
+	}
+	return key, nil
+}
+
+// GenerateKey creates a new Ed25519 key, e.g. for tests
+func GenerateKey(id string, notBefore time.Time) (*Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(id, private, notBefore)
+}
+
+// Public returns the public half of the key
+func (k *Key) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// Sign signs claims with this key, naming it in the kid header
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method(), claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.private)
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.Algorithm == RS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// Set is the configured keys, oldest first
+type Set struct {
+	keys    []*Key
+	overlap time.Duration
+}
+
+// NewSet checks that keys have distinct kids and orders them by when they
+// start signing
+func NewSet(keys []*Key, overlap time.Duration) (*Set, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key.ID] {
+			return nil, fmt.Errorf("kid %s is used by more than one key", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	sorted := append([]*Key(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].NotBefore.Before(sorted[j].NotBefore) })
+	return &Set{keys: sorted, overlap: overlap}, nil
+}
+
+// manifest is keys.json in JWT_KEYS_DIR, listing the key files
+// e.g., {"keys": [{"kid": "2026-10", "file": "2026-10.pem", "not_before": "2026-10-01T00:00:00Z"}]}
+type manifest struct {
+	Keys []struct {
+		ID        string    `json:"kid"`
+		File      string    `json:"file"`
+		NotBefore time.Time `json:"not_before"`
+	} `json:"keys"`
+}
+
+// LoadFromEnv loads the keys of JWT_KEYS_DIR, with JWT_KEY_OVERLAP (a Go
+// duration such as "2h") as the overlap. It fails unless a key is active
+// now, so the API does not start without a way to sign tokens.
+func LoadFromEnv() (*Set, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return nil, ErrNoKeys
+	}
+	overlap := DefaultOverlap
+	if raw := os.Getenv("JWT_KEY_OVERLAP"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("JWT_KEY_OVERLAP=%q is not a positive duration", raw)
+		}
+		overlap = d
+	}
+	set, err := Load(dir, overlap)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := set.Signing(time.Now()); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Load reads keys.json in dir and the PKCS#8 PEM private keys it lists
+func Load(dir string, overlap time.Duration) (*Set, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read JWT key manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Join(dir, "keys.json"), err)
+	}
+	keys := make([]*Key, 0, len(m.Keys))
+	for _, entry := range m.Keys {
+		private, err := readPrivateKey(filepath.Join(dir, entry.File))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.ID, err)
+		}
+		key, err := NewKey(entry.ID, private, entry.NotBefore)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewSet(keys, overlap)
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("want a PKCS#8 PEM private key (BEGIN PRIVATE KEY)")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key")
+	}
+	return signer, nil
+}
+
+// Signing returns the key that signs at now: the latest to have started
+func (s *Set) Signing(now time.Time) (*Key, error) {
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if !s.keys[i].NotBefore.After(now) {
+			return s.keys[i], nil
+		}
+	}
+	return nil, ErrNoActiveKey
+}
+
+// Published returns the keys not retired at now, including those that have
+// yet to start signing
+func (s *Set) Published(now time.Time) []*Key {
+	keys := []*Key{}
+	for i, key := range s.keys {
+		if !s.retired(i, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// verifying returns the key with kid if tokens it signed are accepted at
+// now: it has started signing and is not retired
+func (s *Set) verifying(kid string, now time.Time) (*Key, bool) {
+	for i, key := range s.keys {
+		if key.ID == kid {
+			return key, !key.NotBefore.After(now) && !s.retired(i, now)
+		}
+	}
+	return nil, false
+}
+
+// retired tells whether the i-th key was replaced more than the overlap ago
+func (s *Set) retired(i int, now time.Time) bool {
+	if i+1 >= len(s.keys) {
+		return false
+	}
+	return !now.Before(s.keys[i+1].NotBefore.Add(s.overlap))
+}
+
+// Sign signs claims with the key active now
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	key, err := s.Signing(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return key.Sign(claims)
+}
+
+// Parse verifies a token signed by one of the keys and decodes its claims
+func (s *Set) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.verifying(kid, time.Now())
+		if !ok {
+			return nil, fmt.Errorf("unknown or retired signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("key %s does not sign with %s", kid, token.Method.Alg())
+		}
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{RS256, EdDSA}), jwt.WithExpirationRequired())
+}
@@ -1,27 +1,60 @@
 package middleware
 
 import (
-	"context"
-	"fmt"
 	"net/http"
-	"os"
 	"strings"
-	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/keys"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key" // Replace with a strong secret in .env
+// principalKey is the Gin context key AuthMiddleware sets the Principal under
+const principalKey = "principal"
+
+// Principal is the authenticated user of a request
+type Principal struct {
+	UserID      primitive.ObjectID
+	SessionID   primitive.ObjectID // zero for tokens issued before sessions existed
+	UserNumber  string
+	Roles       []string
+	Permissions []string
+}
+
+// HasRole tells whether the principal holds the role called name
+func (p *Principal) HasRole(name string) bool {
+	for _, role := range p.Roles {
+		if role == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentPrincipal returns the principal AuthMiddleware authenticated
+func CurrentPrincipal(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
 	}
+	principal, ok := value.(*Principal)
+	return principal, ok
+}
+
+// RoleResolver tells which roles and permissions a user currently holds
+type RoleResolver interface {
+	Resolve(userID primitive.ObjectID) (roles, permissions []string, err error)
+}
+
+// TokenVersions tells the current token version of a user, e.g. a UserService
+type TokenVersions interface {
+	TokenVersion(userID primitive.ObjectID) (int, error)
+}
 
+// AuthMiddleware accepts access tokens signed by one of signing's keys and
+// not revoked since, and sets the Principal of the request
+func AuthMiddleware(resolver RoleResolver, versions TokenVersions, signing *keys.Set) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -30,115 +63,109 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, http.ErrNotSupported
-			}
-			return []byte(jwtSecret), nil
-		})
-
+		var claims models.AccessClaims
+		token, err := signing.Parse(tokenString, &claims)
 		if err != nil || !token.Valid {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID, ok := claims["sub"].(string)
-			if !ok {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token claims"})
-				return
-			}
-			fmt.Println("User ID from token:", userID)
-			c.Set("userID", userID)
-
-			rolesRaw := claims["roles"]
-			var roles []interface{}
-			switch v := rolesRaw.(type) {
-			case []interface{}:
-				roles = v
-			case nil:
-				roles = []interface{}{}
-			case string:
-				roles = []interface{}{v}
-			default:
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid roles in token claims"})
+		userID, err := primitive.ObjectIDFromHex(claims.Subject)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token claims"})
+			return
+		}
+		principal := &Principal{UserID: userID, UserNumber: claims.UserNumber}
+		if claims.SessionID != "" {
+			if principal.SessionID, err = primitive.ObjectIDFromHex(claims.SessionID); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid session ID in token claims"})
 				return
 			}
-			fmt.Println("Roles from token claims:", roles)
-			c.Set("roles", roles)
-
-			// Optionally fetch user details from the database here if needed for every request
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			client, _ := c.Get("mongoClient") // You might need to set this up in your main function
-			if client != nil {
-				db := client.(*mongo.Client).Database("os.Getenv(\"DB_NAME\")") // Replace with your DB name
-				var user models.User
-				objID, _ := primitive.ObjectIDFromHex(userID)
-				err := db.Collection("users").FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
-				if err == nil {
-					c.Set("user", user)
-				}
-			}
+		}
 
-			// Set user_number in context if available in claims or user struct
-			if userNumber, ok := claims["user_number"].(string); ok {
-				c.Set("user_number", userNumber)
-			} else if user, exists := c.Get("user"); exists {
-				// Try to extract user_number from user struct (map or struct)
-				switch u := user.(type) {
-				case models.User:
-					c.Set("user_number", u.UserNumber)
-				case map[string]interface{}:
-					if un, ok := u["user_number"].(string); ok {
-						c.Set("user_number", un)
-					}
-				}
-			}
+		// A deleted user has no version, so their tokens are refused as well
+		version, err := versions.TokenVersion(userID)
+		if err != nil || claims.TokenVersion < version {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			return
+		}
 
-			c.Next()
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Roles and permissions come from the database rather than the token,
+		// so changing them applies to tokens already issued
+		principal.Roles, principal.Permissions, err = resolver.Resolve(userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve roles"})
+			return
 		}
+		c.Set(principalKey, principal)
+		c.Next()
 	}
 }
 
-func AdminRoleMiddleware() gin.HandlerFunc {
+// RequirePermission lets a request through only when the user holds every
+// one of permissions. It goes after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roles, ok := c.Get("roles")
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
-			return
+		for _, permission := range permissions {
+			if !HasPermission(c, permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing permission " + permission})
+				return
+			}
 		}
+		c.Next()
+	}
+}
 
-		for _, role := range roles.([]interface{}) {
-			if role == "super_admin" || role == "admin" {
+// RequireAnyPermission lets a request through when the user holds at least
+// one of permissions. It goes after AuthMiddleware.
+func RequireAnyPermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, permission := range permissions {
+			if HasPermission(c, permission) {
 				c.Next()
 				return
 			}
 		}
-
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing permission " + strings.Join(permissions, " or ")})
 	}
 }
 
-func WriterRoleMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		roles, ok := c.Get("roles")
-		fmt.Println("Checking writer role middleware", ok, roles)
+// EmailVerifier tells whether a user confirmed owning their email address
+type EmailVerifier interface {
+	IsEmailVerified(userID primitive.ObjectID) (bool, error)
+}
 
+// RequireVerifiedEmail lets a request through only when the user verified
+// their email address. It goes after AuthMiddleware.
+func RequireVerifiedEmail(users EmailVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
 			return
 		}
-
-		for _, role := range roles.([]interface{}) {
-			if role == "writer" || role == "admin" || role == "super_admin" {
-				c.Next()
-				return
-			}
+		verified, err := users.IsEmailVerified(principal.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email verification"})
+			return
 		}
+		if !verified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Verify your email address first"})
+			return
+		}
+		c.Next()
+	}
+}
 
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized"})
+// HasPermission tells whether the authenticated user holds permission
+func HasPermission(c *gin.Context, permission string) bool {
+	principal, ok := CurrentPrincipal(c)
+	if !ok {
+		return false
+	}
+	for _, p := range principal.Permissions {
+		if p == permission {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,17 @@
+package models
+
+import "github.com/golang-jwt/jwt/v5"
+
+// AccessClaims is everything an access token says about its user. The
+// registered claims give the user ID (sub), the token ID (jti) and its
+// lifetime (iat, exp). Roles are informational: authorization resolves them
+// from the database on every request. TokenVersion is the token version of
+// the user at issue; tokens of an older version have been revoked.
+// e.g., {"sub": "64f1...", "sid": "6500...", "jti": "6501...", "roles": ["writer"], "user_number": "123456", "ver": 0, "iat": 1760000000, "exp": 1760000900}
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	SessionID    string   `json:"sid,omitempty"`
+	Roles        []string `json:"roles"`
+	UserNumber   string   `json:"user_number"`
+	TokenVersion int      `json:"ver"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// LoginAttempts counts the recent failed logins of one account or one IP
+// address (login_attempts collection), keyed like "email:ann@example.com" or
+// "ip:203.0.113.7". Logins for the key are refused until BlockedUntil.
+// e.g., {"_id": "email:ann@example.com", "failures": 4, "last_failure_at": ISODate, "blocked_until": ISODate}
+type LoginAttempts struct {
+	Key           string    `bson:"_id"`
+	Failures      int       `bson:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at"`
+	BlockedUntil  time.Time `bson:"blocked_until"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MFA is a user's TOTP second factor (mfa collection), one per user. It is
+// pending until the user confirms it with a first code. LastUsedStep is the
+// time step of the last code accepted, so a code cannot be used twice.
+// e.g., {"user_id": ObjectId, "secret": "JBSWY3DPEHPK3PXP", "confirmed": true, "recovery_hashes": ["2c26b4..."]}
+type MFA struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `bson:"user_id"`
+	Secret         string             `bson:"secret"` // base32, as shown to authenticator apps
+	Confirmed      bool               `bson:"confirmed"`
+	RecoveryHashes []string           `bson:"recovery_hashes"`
+	LastUsedStep   int64              `bson:"last_used_step"`
+	CreatedAt      time.Time          `bson:"created_at"`
+	ConfirmedAt    *time.Time         `bson:"confirmed_at,omitempty"`
+}
+
+// MFAChallenge is handed out by a login that needs a second factor
+// (mfa_challenges collection). Its token is exchanged, with a code, for the
+// session; only its hash is stored, and it allows a few attempts.
+type MFAChallenge struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	TokenHash string             `bson:"token_hash"`
+	Attempts  int                `bson:"attempts"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+}
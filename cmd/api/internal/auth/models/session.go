@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session revocation reasons
+const (
+	RevokedLogout        = "logout"
+	RevokedByUser        = "revoked_by_user"
+	RevokedTokenReuse    = "refresh_token_reuse" // a rotated refresh token was presented again
+	RevokedPasswordReset = "password_reset"
+)
+
+// Session is one login on one device (sessions collection). Its refresh
+// token is rotated on every use; only hashes are stored. PreviousHashes keeps
+// the hashes of rotated tokens, so presenting one again is detected as reuse
+// and revokes the whole session.
+// e.g., {"user_id": ObjectId, "token_hash": "9f86d0...", "user_agent": "Mozilla/5.0 ...", "ip": "203.0.113.7"}
+type Session struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	TokenHash      string             `bson:"token_hash" json:"-"`
+	PreviousHashes []string           `bson:"previous_hashes" json:"-"`
+	UserAgent      string             `bson:"user_agent" json:"user_agent"`
+	IP             string             `bson:"ip" json:"ip"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt     time.Time          `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt      time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt      *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	RevokedReason  string             `bson:"revoked_reason,omitempty" json:"revoked_reason,omitempty"`
+	MFA            bool               `bson:"mfa" json:"mfa"`   // opened with a second factor
+	Current        bool               `bson:"-" json:"current"` // the session of the access token listing it
+}
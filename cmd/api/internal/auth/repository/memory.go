@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memorySessionRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemorySessionRepository keeps sessions in store, for tests
+func NewMemorySessionRepository(store *database.MemoryStore) SessionRepository {
+	return &memorySessionRepository{store: store}
+}
+
+func (r *memorySessionRepository) Insert(ctx context.Context, session *models.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	return r.store.Insert("sessions", session)
+}
+
+func (r *memorySessionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	if err := r.store.FindOne("sessions", bson.M{"_id": id}, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *memorySessionRepository) Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	matched, err := r.store.UpdateOne("sessions", rotateFilter(id, oldHash), rotateUpdate(oldHash, newHash, usedAt, expiresAt))
+	return matched > 0, err
+}
+
+func (r *memorySessionRepository) Revoke(ctx context.Context, id primitive.ObjectID, reason string, at time.Time) (bool, error) {
+	matched, err := r.store.UpdateOne("sessions", revokeFilter(bson.M{"_id": id}), revokeUpdate(reason, at))
+	return matched > 0, err
+}
+
+func (r *memorySessionRepository) RevokeAll(ctx context.Context, userID primitive.ObjectID, reason string, at time.Time) (int64, error) {
+	return r.store.UpdateMany("sessions", revokeFilter(bson.M{"user_id": userID}), revokeUpdate(reason, at))
+}
+
+func (r *memorySessionRepository) ListActive(ctx context.Context, userID primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	sessions := []models.Session{}
+	opts := database.FindOptions{Sort: bson.D{{Key: "last_used_at", Value: -1}}}
+	err := r.store.Find("sessions", activeFilter(userID, now), opts, &sessions)
+	return sessions, err
+}
+
+type memoryPasswordResetRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryPasswordResetRepository keeps password reset tokens in store, for tests
+func NewMemoryPasswordResetRepository(store *database.MemoryStore) PasswordResetRepository {
+	return &memoryPasswordResetRepository{store: store}
+}
+
+func (r *memoryPasswordResetRepository) Insert(ctx context.Context, reset *models.PasswordReset) error {
+	if reset.ID.IsZero() {
+		reset.ID = primitive.NewObjectID()
+	}
+	return r.store.Insert("password_resets", reset)
+}
+
+func (r *memoryPasswordResetRepository) FindByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := r.store.FindOne("password_resets", bson.M{"token_hash": tokenHash}, &reset); err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+func (r *memoryPasswordResetRepository) Use(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	matched, err := r.store.UpdateOne("password_resets", useFilter(bson.M{"_id": id, "expires_at": bson.M{"$gt": at}}), useUpdate(at))
+	return matched > 0, err
+}
+
+func (r *memoryPasswordResetRepository) UseAll(ctx context.Context, userID primitive.ObjectID, at time.Time) error {
+	_, err := r.store.UpdateMany("password_resets", useFilter(bson.M{"user_id": userID}), useUpdate(at))
+	return err
+}
+
+type memoryMFARepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryMFARepository keeps second factors in store, for tests
+func NewMemoryMFARepository(store *database.MemoryStore) MFARepository {
+	return &memoryMFARepository{store: store}
+}
+
+func (r *memoryMFARepository) Insert(ctx context.Context, mfa *models.MFA) error {
+	if mfa.ID.IsZero() {
+		mfa.ID = primitive.NewObjectID()
+	}
+	return r.store.Insert("mfa", mfa)
+}
+
+func (r *memoryMFARepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) (*models.MFA, error) {
+	var mfa models.MFA
+	if err := r.store.FindOne("mfa", bson.M{"user_id": userID}, &mfa); err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+func (r *memoryMFARepository) Confirm(ctx context.Context, userID primitive.ObjectID, step int64, recoveryHashes []string, at time.Time) (bool, error) {
+	matched, err := r.store.UpdateOne("mfa", bson.M{"user_id": userID, "confirmed": false}, confirmUpdate(step, recoveryHashes, at))
+	return matched > 0, err
+}
+
+func (r *memoryMFARepository) UseStep(ctx context.Context, userID primitive.ObjectID, step int64) (bool, error) {
+	matched, err := r.store.UpdateOne("mfa", useStepFilter(userID, step), bson.M{"$set": bson.M{"last_used_step": step}})
+	return matched > 0, err
+}
+
+func (r *memoryMFARepository) UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) (bool, error) {
+	matched, err := r.store.UpdateOne("mfa", bson.M{"user_id": userID, "confirmed": true, "recovery_hashes": hash}, bson.M{"$pull": bson.M{"recovery_hashes": hash}})
+	return matched > 0, err
+}
+
+func (r *memoryMFARepository) Delete(ctx context.Context, userID primitive.ObjectID) error {
+	for {
+		deleted, err := r.store.DeleteOne("mfa", bson.M{"user_id": userID})
+		if err != nil || deleted == 0 {
+			return err
+		}
+	}
+}
+
+type memoryMFAChallengeRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryMFAChallengeRepository keeps MFA challenges in store, for tests
+func NewMemoryMFAChallengeRepository(store *database.MemoryStore) MFAChallengeRepository {
+	return &memoryMFAChallengeRepository{store: store}
+}
+
+func (r *memoryMFAChallengeRepository) Insert(ctx context.Context, challenge *models.MFAChallenge) error {
+	if challenge.ID.IsZero() {
+		challenge.ID = primitive.NewObjectID()
+	}
+	return r.store.Insert("mfa_challenges", challenge)
+}
+
+func (r *memoryMFAChallengeRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	if err := r.store.FindOne("mfa_challenges", bson.M{"_id": id}, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *memoryMFAChallengeRepository) Attempt(ctx context.Context, id primitive.ObjectID, maxAttempts int, now time.Time) (bool, error) {
+	matched, err := r.store.UpdateOne("mfa_challenges", attemptFilter(id, maxAttempts, now), bson.M{"$inc": bson.M{"attempts": 1}})
+	return matched > 0, err
+}
+
+func (r *memoryMFAChallengeRepository) Use(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	matched, err := r.store.UpdateOne("mfa_challenges", useFilter(bson.M{"_id": id}), useUpdate(at))
+	return matched > 0, err
+}
+
+type memoryLoginAttemptRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryLoginAttemptRepository keeps failed login attempts in store, for tests
+func NewMemoryLoginAttemptRepository(store *database.MemoryStore) LoginAttemptRepository {
+	return &memoryLoginAttemptRepository{store: store}
+}
+
+func (r *memoryLoginAttemptRepository) Find(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	var attempts models.LoginAttempts
+	if err := r.store.FindOne("login_attempts", bson.M{"_id": key}, &attempts); err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+func (r *memoryLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error) {
+	if _, err := r.store.UpdateOne("login_attempts", staleFailuresFilter(key, resetBefore), resetFailuresUpdate()); err != nil {
+		return 0, err
+	}
+	matched, err := r.store.UpdateOne("login_attempts", bson.M{"_id": key}, failureUpdate(at))
+	if err != nil {
+		return 0, err
+	}
+	if matched == 0 {
+		err := r.store.Insert("login_attempts", models.LoginAttempts{Key: key, Failures: 1, LastFailureAt: at})
+		if err == database.ErrDuplicateID {
+			// Inserted by a concurrent failure meanwhile
+			_, err = r.store.UpdateOne("login_attempts", bson.M{"_id": key}, failureUpdate(at))
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	attempts, err := r.Find(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return attempts.Failures, nil
+}
+
+func (r *memoryLoginAttemptRepository) Block(ctx context.Context, key string, until time.Time) error {
+	_, err := r.store.UpdateOne("login_attempts", bson.M{"_id": key}, bson.M{"$set": bson.M{"blocked_until": until}})
+	return err
+}
+
+func (r *memoryLoginAttemptRepository) Clear(ctx context.Context, key string) error {
+	_, err := r.store.DeleteOne("login_attempts", bson.M{"_id": key})
+	return err
+}
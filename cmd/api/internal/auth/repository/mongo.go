@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoSessionRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoSessionRepository(db *mongo.Database) SessionRepository {
+	return &mongoSessionRepository{col: db.Collection("sessions")}
+}
+
+func (r *mongoSessionRepository) Insert(ctx context.Context, session *models.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	_, err := r.col.InsertOne(ctx, session)
+	return err
+}
+
+func (r *mongoSessionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *mongoSessionRepository) Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, rotateFilter(id, oldHash), rotateUpdate(oldHash, newHash, usedAt, expiresAt))
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (r *mongoSessionRepository) Revoke(ctx context.Context, id primitive.ObjectID, reason string, at time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, revokeFilter(bson.M{"_id": id}), revokeUpdate(reason, at))
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (r *mongoSessionRepository) RevokeAll(ctx context.Context, userID primitive.ObjectID, reason string, at time.Time) (int64, error) {
+	res, err := r.col.UpdateMany(ctx, revokeFilter(bson.M{"user_id": userID}), revokeUpdate(reason, at))
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func (r *mongoSessionRepository) ListActive(ctx context.Context, userID primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	opts := options.Find().SetSort(bson.M{"last_used_at": -1})
+	cur, err := r.col.Find(ctx, activeFilter(userID, now), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	sessions := []models.Session{}
+	if err := cur.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+type mongoPasswordResetRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoPasswordResetRepository(db *mongo.Database) PasswordResetRepository {
+	return &mongoPasswordResetRepository{col: db.Collection("password_resets")}
+}
+
+func (r *mongoPasswordResetRepository) Insert(ctx context.Context, reset *models.PasswordReset) error {
+	if reset.ID.IsZero() {
+		reset.ID = primitive.NewObjectID()
+	}
+	_, err := r.col.InsertOne(ctx, reset)
+	return err
+}
+
+func (r *mongoPasswordResetRepository) FindByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := r.col.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&reset); err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+func (r *mongoPasswordResetRepository) Use(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, useFilter(bson.M{"_id": id, "expires_at": bson.M{"$gt": at}}), useUpdate(at))
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (r *mongoPasswordResetRepository) UseAll(ctx context.Context, userID primitive.ObjectID, at time.Time) error {
+	_, err := r.col.UpdateMany(ctx, useFilter(bson.M{"user_id": userID}), useUpdate(at))
+	return err
+}
+
+type mongoMFARepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoMFARepository(db *mongo.Database) MFARepository {
+	return &mongoMFARepository{col: db.Collection("mfa")}
+}
+
+func (r *mongoMFARepository) Insert(ctx context.Context, mfa *models.MFA) error {
+	if mfa.ID.IsZero() {
+		mfa.ID = primitive.NewObjectID()
+	}
+	_, err := r.col.InsertOne(ctx, mfa)
+	return err
+}
+
+func (r *mongoMFARepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) (*models.MFA, error) {
+	var mfa models.MFA
+	if err := r.col.FindOne(ctx, bson.M{"user_id": userID}).Decode(&mfa); err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+func (r *mongoMFARepository) Confirm(ctx context.Context, userID primitive.ObjectID, step int64, recoveryHashes []string, at time.Time) (bool, error) {
+	return r.updateMatched(ctx, bson.M{"user_id": userID, "confirmed": false}, confirmUpdate(step, recoveryHashes, at))
+}
+
+func (r *mongoMFARepository) UseStep(ctx context.Context, userID primitive.ObjectID, step int64) (bool, error) {
+	return r.updateMatched(ctx, useStepFilter(userID, step), bson.M{"$set": bson.M{"last_used_step": step}})
+}
+
+func (r *mongoMFARepository) UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) (bool, error) {
+	return r.updateMatched(ctx, bson.M{"user_id": userID, "confirmed": true, "recovery_hashes": hash}, bson.M{"$pull": bson.M{"recovery_hashes": hash}})
+}
+
+func (r *mongoMFARepository) Delete(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (r *mongoMFARepository) updateMatched(ctx context.Context, filter, update bson.M) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+type mongoMFAChallengeRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoMFAChallengeRepository(db *mongo.Database) MFAChallengeRepository {
+	return &mongoMFAChallengeRepository{col: db.Collection("mfa_challenges")}
+}
+
+func (r *mongoMFAChallengeRepository) Insert(ctx context.Context, challenge *models.MFAChallenge) error {
+	if challenge.ID.IsZero() {
+		challenge.ID = primitive.NewObjectID()
+	}
+	_, err := r.col.InsertOne(ctx, challenge)
+	return err
+}
+
+func (r *mongoMFAChallengeRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *mongoMFAChallengeRepository) Attempt(ctx context.Context, id primitive.ObjectID, maxAttempts int, now time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, attemptFilter(id, maxAttempts, now), bson.M{"$inc": bson.M{"attempts": 1}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (r *mongoMFAChallengeRepository) Use(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, useFilter(bson.M{"_id": id}), useUpdate(at))
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+type mongoLoginAttemptRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoLoginAttemptRepository(db *mongo.Database) LoginAttemptRepository {
+	return &mongoLoginAttemptRepository{col: db.Collection("login_attempts")}
+}
+
+func (r *mongoLoginAttemptRepository) Find(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	var attempts models.LoginAttempts
+	if err := r.col.FindOne(ctx, bson.M{"_id": key}).Decode(&attempts); err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+func (r *mongoLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error) {
+	if _, err := r.col.UpdateOne(ctx, staleFailuresFilter(key, resetBefore), resetFailuresUpdate()); err != nil {
+		return 0, err
+	}
+	var attempts models.LoginAttempts
+	err := r.col.FindOneAndUpdate(ctx, bson.M{"_id": key}, failureUpdate(at),
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempts)
+	if err != nil {
+		return 0, err
+	}
+	return attempts.Failures, nil
+}
+
+func (r *mongoLoginAttemptRepository) Block(ctx context.Context, key string, until time.Time) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"blocked_until": until}})
+	return err
+}
+
+func (r *mongoLoginAttemptRepository) Clear(ctx context.Context, key string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func rotateFilter(id primitive.ObjectID, oldHash string) bson.M {
+	return revokeFilter(bson.M{"_id": id, "token_hash": oldHash})
+}
+
+func rotateUpdate(oldHash, newHash string, usedAt, expiresAt time.Time) bson.M {
+	return bson.M{
+		"$set":  bson.M{"token_hash": newHash, "last_used_at": usedAt, "expires_at": expiresAt},
+		"$push": bson.M{"previous_hashes": oldHash},
+	}
+}
+
+// revokeFilter narrows filter to sessions that are not revoked yet
+func revokeFilter(filter bson.M) bson.M {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+func revokeUpdate(reason string, at time.Time) bson.M {
+	return bson.M{"$set": bson.M{"revoked_at": at, "revoked_reason": reason}}
+}
+
+func activeFilter(userID primitive.ObjectID, now time.Time) bson.M {
+	return revokeFilter(bson.M{"user_id": userID, "expires_at": bson.M{"$gt": now}})
+}
+
+// useFilter narrows filter to reset tokens that are not used yet
+func useFilter(filter bson.M) bson.M {
+	filter["used_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+func useUpdate(at time.Time) bson.M {
+	return bson.M{"$set": bson.M{"used_at": at}}
+}
+
+func confirmUpdate(step int64, recoveryHashes []string, at time.Time) bson.M {
+	return bson.M{"$set": bson.M{"confirmed": true, "confirmed_at": at, "last_used_step": step, "recovery_hashes": recoveryHashes}}
+}
+
+func useStepFilter(userID primitive.ObjectID, step int64) bson.M {
+	return bson.M{"user_id": userID, "confirmed": true, "last_used_step": bson.M{"$lt": step}}
+}
+
+func attemptFilter(id primitive.ObjectID, maxAttempts int, now time.Time) bson.M {
+	return useFilter(bson.M{"_id": id, "attempts": bson.M{"$lt": maxAttempts}, "expires_at": bson.M{"$gt": now}})
+}
+
+// staleFailuresFilter matches the attempts of key whose last failure is old
+// enough to be forgotten
+func staleFailuresFilter(key string, resetBefore time.Time) bson.M {
+	return bson.M{"_id": key, "last_failure_at": bson.M{"$lt": resetBefore}}
+}
+
+func resetFailuresUpdate() bson.M {
+	return bson.M{"$set": bson.M{"failures": 0, "blocked_until": time.Time{}}}
+}
+
+func failureUpdate(at time.Time) bson.M {
+	return bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"last_failure_at": at}}
+}
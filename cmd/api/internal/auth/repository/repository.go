@@ -0,0 +1,77 @@
+// Package repository stores login sessions, password reset tokens, second
+// factors and failed login attempts. The MongoDB implementations are used by
+// the API and the in-memory ones by tests; a missing document gives
+// mongo.ErrNoDocuments from both.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SessionRepository stores the sessions collection
+type SessionRepository interface {
+	Insert(ctx context.Context, session *models.Session) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Session, error)
+	// Rotate replaces the refresh token hash of an unrevoked session, only if
+	// it is still oldHash, and reports whether it did
+	Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error)
+	// Revoke revokes a session unless it already is, and reports whether it did
+	Revoke(ctx context.Context, id primitive.ObjectID, reason string, at time.Time) (bool, error)
+	// RevokeAll revokes every session of a user that is not revoked yet
+	RevokeAll(ctx context.Context, userID primitive.ObjectID, reason string, at time.Time) (int64, error)
+	// ListActive returns the unrevoked, unexpired sessions of a user, newest first
+	ListActive(ctx context.Context, userID primitive.ObjectID, now time.Time) ([]models.Session, error)
+}
+
+// PasswordResetRepository stores the password_resets collection
+type PasswordResetRepository interface {
+	Insert(ctx context.Context, reset *models.PasswordReset) error
+	FindByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	// Use marks an unused, unexpired token as used, and reports whether it did
+	Use(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error)
+	// UseAll marks every unused token of a user as used
+	UseAll(ctx context.Context, userID primitive.ObjectID, at time.Time) error
+}
+
+// MFARepository stores the mfa collection, one second factor per user
+type MFARepository interface {
+	Insert(ctx context.Context, mfa *models.MFA) error
+	FindByUserID(ctx context.Context, userID primitive.ObjectID) (*models.MFA, error)
+	// Confirm turns the pending factor of a user on, with the step of the code
+	// confirming it, and reports whether there was one
+	Confirm(ctx context.Context, userID primitive.ObjectID, step int64, recoveryHashes []string, at time.Time) (bool, error)
+	// UseStep records that the code of step was used, unless a code of that
+	// step or a later one already was, and reports whether it did
+	UseStep(ctx context.Context, userID primitive.ObjectID, step int64) (bool, error)
+	// UseRecoveryCode removes a recovery code hash and reports whether the
+	// confirmed factor had it
+	UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) (bool, error)
+	Delete(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// MFAChallengeRepository stores the mfa_challenges collection
+type MFAChallengeRepository interface {
+	Insert(ctx context.Context, challenge *models.MFAChallenge) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.MFAChallenge, error)
+	// Attempt counts an attempt at an unused, unexpired challenge that has
+	// attempts left, and reports whether it did
+	Attempt(ctx context.Context, id primitive.ObjectID, maxAttempts int, now time.Time) (bool, error)
+	// Use marks an unused challenge as used, and reports whether it did
+	Use(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error)
+}
+
+// LoginAttemptRepository stores the login_attempts collection
+type LoginAttemptRepository interface {
+	Find(ctx context.Context, key string) (*models.LoginAttempts, error)
+	// RecordFailure counts a failed login for key at at, starting the count
+	// over if the last failure was before resetBefore, and returns the count
+	RecordFailure(ctx context.Context, key string, at, resetBefore time.Time) (int, error)
+	// Block refuses logins for key until until
+	Block(ctx context.Context, key string, until time.Time) error
+	// Clear forgets the failures of key
+	Clear(ctx context.Context, key string) error
+}
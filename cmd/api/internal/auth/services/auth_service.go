@@ -4,26 +4,98 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"math/rand"
-	"os"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/keys"
+	authmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
+	authrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/mail"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
 	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// accessTokenTTL is how long an access token is accepted. Revoking a session
+// stops its refresh token at once; access tokens already issued for it run
+// out within this time.
+const accessTokenTTL = 15 * time.Minute
+
+// AuthServiceDeps are the stores and services an AuthService works with;
+// see NewAuthServiceWith
+type AuthServiceDeps struct {
+	Users       repository.UserRepository
+	UserRoles   *userservices.UserRoleService
+	RoleService *userservices.RoleService
+	Sessions    authrepository.SessionRepository
+	Resets      authrepository.PasswordResetRepository
+	MFA         authrepository.MFARepository
+	Challenges  authrepository.MFAChallengeRepository
+	Attempts    authrepository.LoginAttemptRepository
+	Mailer      mail.Mailer
+	Keys        *keys.Set // signs access tokens
+	EmailSecret []byte    // signs email verification links
+	// Lockout defaults to DefaultLockoutPolicy when zero
+	Lockout LockoutPolicy
+}
+
 type AuthService struct {
-	userCollection *mongo.Collection
+	users       repository.UserRepository
+	roles       *userservices.RoleResolver
+	sessions    authrepository.SessionRepository
+	resets      authrepository.PasswordResetRepository
+	mfa         authrepository.MFARepository
+	challenges  authrepository.MFAChallengeRepository
+	attempts    authrepository.LoginAttemptRepository
+	lockout     LockoutPolicy
+	mailer      mail.Mailer
+	keys        *keys.Set
+	emailSecret []byte
 }
 
-func NewAuthService(db *mongo.Database) *AuthService {
+// NewAuthService signs access tokens with signing and email verification
+// links with emailSecret; see keys.LoadFromEnv and EmailSecretFromEnv. It
+// resolves roles through the process's role services.
+func NewAuthService(db *mongo.Database, userRoles *userservices.UserRoleService, roles *userservices.RoleService,
+	mailer mail.Mailer, signing *keys.Set, emailSecret []byte) *AuthService {
+	return NewAuthServiceWith(AuthServiceDeps{
+		Users:       repository.NewMongoUserRepository(db),
+		UserRoles:   userRoles,
+		RoleService: roles,
+		Sessions:    authrepository.NewMongoSessionRepository(db),
+		Resets:      authrepository.NewMongoPasswordResetRepository(db),
+		MFA:         authrepository.NewMongoMFARepository(db),
+		Challenges:  authrepository.NewMongoMFAChallengeRepository(db),
+		Attempts:    authrepository.NewMongoLoginAttemptRepository(db),
+		Mailer:      mailer,
+		Keys:        signing,
+		EmailSecret: emailSecret,
+		Lockout:     LockoutPolicyFromEnv(),
+	})
+}
+
+// NewAuthServiceWith builds the service on deps, e.g. in-memory stores in tests
+func NewAuthServiceWith(deps AuthServiceDeps) *AuthService {
+	if deps.Lockout == (LockoutPolicy{}) {
+		deps.Lockout = DefaultLockoutPolicy
+	}
 	return &AuthService{
-		userCollection: db.Collection("users"),
+		users:       deps.Users,
+		roles:       userservices.NewRoleResolver(deps.UserRoles, deps.RoleService),
+		sessions:    deps.Sessions,
+		resets:      deps.Resets,
+		mfa:         deps.MFA,
+		challenges:  deps.Challenges,
+		attempts:    deps.Attempts,
+		lockout:     deps.Lockout,
+		mailer:      deps.Mailer,
+		keys:        deps.Keys,
+		emailSecret: deps.EmailSecret,
 	}
 }
 
@@ -31,8 +103,7 @@ func (s *AuthService) Register(user *models.User, userRoleService *userservices.
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	existingUser := s.userCollection.FindOne(ctx, bson.M{"email": user.Email})
-	if existingUser.Err() == nil {
+	if _, err := s.users.FindByEmail(ctx, user.Email); err == nil {
 		return errors.New("email already exists")
 	}
 
@@ -41,12 +112,12 @@ func (s *AuthService) Register(user *models.User, userRoleService *userservices.
 		return err
 	}
 	user.Password = string(hashedPassword)
+	user.EmailVerified = false
 
 	// Generate random 6-digit user_number
 	user.UserNumber = generateRandomSixDigitNumber()
 
-	res, err := s.userCollection.InsertOne(ctx, user)
-	if err != nil {
+	if err := s.users.Insert(ctx, user); err != nil {
 		return err
 	}
 
@@ -57,77 +128,131 @@ func (s *AuthService) Register(user *models.User, userRoleService *userservices.
 	}
 
 	// Create user_roles document
-	userID := res.InsertedID.(primitive.ObjectID)
 	userRoleDoc := &models.UserRole{
-		UserID: userID,
+		UserID: user.ID,
 		RoleID: userRoleObj.ID,
 	}
 	if err := userRoleService.Create(userRoleDoc); err != nil {
 		return err
 	}
 
+	s.sendVerification(user)
 	return nil
 }
 
-func (s *AuthService) Login(email, password string) (string, *models.User, error) {
+// LoginResult is what a login with the right credentials gives: tokens, or
+// a challenge to answer with a second factor first
+type LoginResult struct {
+	Tokens    *Tokens
+	User      *models.User
+	Challenge *LoginChallenge
+}
+
+// Login checks the credentials and opens a session for client, returning
+// its first access and refresh tokens. Users with two-factor authentication,
+// or with a role requiring it, get a challenge instead; see CompleteLogin.
+//
+// Failed logins slow down and then lock out further ones for the account and
+// for the client's IP address, returning a *LockedOutError. Unknown emails
+// are counted and checked against a dummy password hash like known ones, so
+// neither the answer nor its timing tells whether an email is registered.
+func (s *AuthService) Login(email, password string, client Client) (*LoginResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var user models.User
-	err := s.userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	now := time.Now()
+	account, ip := accountKey(email), ipKey(client.IP)
+	wait, err := s.lockedOut(ctx, now, account, ip)
 	if err != nil {
-		return "", nil, errors.New("invalid email address")
+		return nil, err
+	}
+	if wait > 0 {
+		return nil, &LockedOutError{RetryAfter: wait}
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
-		return "", nil, errors.New("invalid password")
-	}
-
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["sub"] = user.ID.Hex()
-	claims["email"] = user.Email
-	claims["roles"] = []string{} // Initialize roles slice
-	claims["user"] = user
-	claims["user_number"] = user.UserNumber
-	fmt.Println("JWT user_number:", user.UserNumber)
-
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
-	claims["iat"] = time.Now().Unix()
-	// Fetch user roles
-	fmt.Println("user ID for roles:", user.UserNumber)
-	userRoleService := userservices.NewUserRoleService(s.userCollection.Database())
-	roles, err := userRoleService.GetByUserID(user.ID)
-	if err != nil {
-		return "", nil, errors.New("failed to fetch user roles")
-	}
-	var roleNames []string
-	for _, role := range roles {
-		roleService := userservices.NewRoleService(s.userCollection.Database())
-		roleObj, err := roleService.GetByID(role.RoleID)
-		if err != nil {
-			return "", nil, errors.New("failed to fetch user roles")
+	hash := dummyPasswordHash()
+	user, err := s.users.FindByEmail(ctx, email)
+	if err == nil {
+		hash = []byte(user.Password)
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || user == nil {
+		if err := s.recordFailure(ctx, now, account, ip); err != nil {
+			return nil, err
 		}
-		roleNames = append(roleNames, roleObj.Name)
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.attempts.Clear(ctx, account); err != nil {
+		return nil, err
 	}
-	claims["roles"] = roleNames
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key" // Replace with a strong secret in .env
+	challenge, err := s.challengeLogin(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return &LoginResult{Challenge: challenge}, nil
+	}
+	tokens, err := s.signIn(ctx, user, client, false)
+	if err != nil {
+		return nil, err
 	}
+	return &LoginResult{Tokens: tokens, User: user}, nil
+}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+// signIn opens a session for user and issues its first tokens. The password
+// is removed from user and its roles are filled in, for the response.
+func (s *AuthService) signIn(ctx context.Context, user *models.User, client Client, mfa bool) (*Tokens, error) {
+	roleNames, err := s.roles.RoleNames(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	session, refreshToken, err := s.openSession(ctx, user.ID, client, mfa)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+	accessToken, err := s.issueAccessToken(user, roleNames, session.ID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Remove password before returning user
 	user.Password = ""
 	user.Roles = roleNames
 
-	return tokenString, &user, nil
+	return &Tokens{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: int64(accessTokenTTL.Seconds())}, nil
+}
+
+// sendInBackground emails a user without making the request wait, or fail,
+// on the mailer
+func (s *AuthService) sendInBackground(msg mail.Message, userID primitive.ObjectID) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Error sending %q email to user %s: %v", msg.Subject, userID.Hex(), err)
+		}
+	}()
+}
+
+// issueAccessToken signs a short-lived token for a session of user with the
+// active key. It names the user rather than embedding them; GET /api/me
+// returns the profile.
+func (s *AuthService) issueAccessToken(user *models.User, roleNames []string, sessionID primitive.ObjectID) (string, error) {
+	now := time.Now()
+	return s.keys.Sign(authmodels.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.Hex(),
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+		SessionID:    sessionID.Hex(),
+		Roles:        roleNames,
+		UserNumber:   user.UserNumber,
+		TokenVersion: user.TokenVersion,
+	})
 }
 
 // generateRandomSixDigitNumber returns a random 6-digit string
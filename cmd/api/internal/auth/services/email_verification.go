@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/mail"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// emailVerificationTTL is how long a verification link can be used
+const emailVerificationTTL = 48 * time.Hour
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+
+// VerifyEmail marks the email of the user a verification token was sent to
+// as verified. The token is signed over the address it was sent to, so it
+// stops working once the user changes email.
+func (s *AuthService) VerifyEmail(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidVerificationToken
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	idHex, expiresRaw, ok := strings.Cut(string(decoded), ".")
+	if !ok {
+		return ErrInvalidVerificationToken
+	}
+	userID, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	expires, err := strconv.ParseInt(expiresRaw, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err == mongo.ErrNoDocuments {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signVerification(payload, user.Email))) {
+		return ErrInvalidVerificationToken
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return s.users.Update(ctx, user.ID, bson.M{"email_verified": true})
+}
+
+// ResendVerification sends a new verification link to the user with email,
+// if there is one and they are not verified yet. Like ForgotPassword,
+// callers must answer the same either way.
+func (s *AuthService) ResendVerification(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.users.FindByEmail(ctx, email)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		s.sendVerification(user)
+	}
+	return nil
+}
+
+// sendVerification emails a verification link to user in the background
+func (s *AuthService) sendVerification(user *models.User) {
+	msg := verificationMessage(user.Email, s.verificationToken(user, time.Now().Add(emailVerificationTTL)))
+	s.sendInBackground(msg, user.ID)
+}
+
+// verificationToken names the user and the expiry, signed together with the
+// user's email
+func (s *AuthService) verificationToken(user *models.User, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user.ID.Hex() + "." + strconv.FormatInt(expires.Unix(), 10)))
+	return payload + "." + s.signVerification(payload, user.Email)
+}
+
+func (s *AuthService) signVerification(payload, email string) string {
+	mac := hmac.New(sha256.New, s.emailSecret)
+	mac.Write([]byte(payload + "\n" + strings.ToLower(email)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// minEmailSecret is the shortest email verification secret accepted
+const minEmailSecret = 32
+
+// EmailSecretFromEnv returns EMAIL_VERIFICATION_SECRET, failing when
+// it is unset or too short to be safe
+func EmailSecretFromEnv() ([]byte, error) {
+	secret := os.Getenv("EMAIL_VERIFICATION_SECRET")
+	if len(secret) < minEmailSecret {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_SECRET must be set to at least %d characters", minEmailSecret)
+	}
+	return []byte(secret), nil
+}
+
+// verificationMessage links to EMAIL_VERIFICATION_URL when it is set, e.g.
+// a page of the frontend, and gives the bare token otherwise
+func verificationMessage(to, token string) mail.Message {
+	body := "Use this token to verify your email address: " + token
+	if url := os.Getenv("EMAIL_VERIFICATION_URL"); url != "" {
+		body = "Verify your email address here: " + url + "?token=" + token
+	}
+	body += "\n\nThe link expires in 48 hours. You need a verified email address to place and pay for orders."
+	return mail.Message{To: to, Subject: "Verify your email address", Body: body}
+}
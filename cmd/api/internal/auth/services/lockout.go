@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned by Login for an unknown email and for a
+// wrong password alike
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LockedOutError is returned by Login while the account or the IP address
+// is locked out by failed logins
+type LockedOutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedOutError) Error() string {
+	return fmt.Sprintf("too many failed logins; try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Throttle slows down logins for one account or one IP address as they fail.
+// The first Free failures go without delay; each further one doubles the
+// wait before the next attempt, starting at a second, and Max failures lock
+// logins out for the lockout duration, even when Max is not above Free.
+type Throttle struct {
+	Free int
+	Max  int
+}
+
+// delay is how long to refuse logins after the failures-th failure
+func (t Throttle) delay(failures int, lockout time.Duration) time.Duration {
+	if failures >= t.Max {
+		return lockout
+	}
+	if failures <= t.Free {
+		return 0
+	}
+	wait := time.Second << (failures - t.Free - 1)
+	if wait <= 0 || wait > lockout {
+		return lockout
+	}
+	return wait
+}
+
+// LockoutPolicy limits failed logins per account and per IP address. The
+// IP allows more, as many people may share an address. Failures are
+// forgotten once Lockout has passed without another.
+type LockoutPolicy struct {
+	Account Throttle
+	IP      Throttle
+	Lockout time.Duration
+}
+
+// DefaultLockoutPolicy is used when LOGIN_MAX_FAILURES, LOGIN_IP_MAX_FAILURES
+// and LOGIN_LOCKOUT_MINUTES are unset
+var DefaultLockoutPolicy = LockoutPolicy{
+	Account: Throttle{Free: 3, Max: 10},
+	IP:      Throttle{Free: 20, Max: 100},
+	Lockout: 15 * time.Minute,
+}
+
+// LockoutPolicyFromEnv reads the lockout thresholds and duration from the
+// environment, keeping the defaults for what is unset or invalid
+func LockoutPolicyFromEnv() LockoutPolicy {
+	policy := DefaultLockoutPolicy
+	if n, ok := positiveEnv("LOGIN_MAX_FAILURES"); ok {
+		policy.Account.Max = n
+	}
+	if n, ok := positiveEnv("LOGIN_IP_MAX_FAILURES"); ok {
+		policy.IP.Max = n
+	}
+	if n, ok := positiveEnv("LOGIN_LOCKOUT_MINUTES"); ok {
+		policy.Lockout = time.Duration(n) * time.Minute
+	}
+	return policy
+}
+
+func positiveEnv(name string) (int, bool) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("Ignoring %s=%q: not a positive number", name, raw)
+		return 0, false
+	}
+	return n, true
+}
+
+// UnlockUser lets a user locked out by failed logins try again at once
+func (s *AuthService) UnlockUser(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.attempts.Clear(ctx, accountKey(user.Email))
+}
+
+// UnlockIP lets an IP address locked out by failed logins try again at once
+func (s *AuthService) UnlockIP(ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.attempts.Clear(ctx, ipKey(ip))
+}
+
+// lockedOut returns how long logins for any of keys are still refused
+func (s *AuthService) lockedOut(ctx context.Context, now time.Time, keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range keys {
+		attempts, err := s.attempts.Find(ctx, key)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if left := attempts.BlockedUntil.Sub(now); left > wait {
+			wait = left
+		}
+	}
+	return wait, nil
+}
+
+// recordFailure counts a failed login against the account and the IP
+// address, blocking them as their throttles say
+func (s *AuthService) recordFailure(ctx context.Context, now time.Time, account, ip string) error {
+	for _, key := range []struct {
+		name     string
+		throttle Throttle
+	}{{account, s.lockout.Account}, {ip, s.lockout.IP}} {
+		failures, err := s.attempts.RecordFailure(ctx, key.name, now, now.Add(-s.lockout.Lockout))
+		if err != nil {
+			return err
+		}
+		if wait := key.throttle.delay(failures, s.lockout.Lockout); wait > 0 {
+			if err := s.attempts.Block(ctx, key.name, now.Add(wait)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func accountKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// dummyPasswordHash is compared against for unknown emails, so they take
+// as long to reject as wrong passwords
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a password of anyone"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottleDelay(t *testing.T) {
+	lockout := 15 * time.Minute
+	for _, tc := range []struct {
+		name     string
+		throttle Throttle
+		failures int
+		want     time.Duration
+	}{
+		{"free", Throttle{Free: 3, Max: 10}, 3, 0},
+		{"first backoff", Throttle{Free: 3, Max: 10}, 4, time.Second},
+		{"doubles", Throttle{Free: 3, Max: 10}, 6, 4 * time.Second},
+		{"locked out", Throttle{Free: 3, Max: 10}, 10, lockout},
+		{"backoff capped at lockout", Throttle{Free: 0, Max: 100}, 60, lockout},
+		{"max below free", Throttle{Free: 3, Max: 2}, 2, lockout},
+		{"max below free, before max", Throttle{Free: 3, Max: 2}, 1, 0},
+	} {
+		if got := tc.throttle.delay(tc.failures, lockout); got != tc.want {
+			t.Errorf("%s: delay(%d) = %s, want %s", tc.name, tc.failures, got, tc.want)
+		}
+	}
+}
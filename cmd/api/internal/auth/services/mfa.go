@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// mfaChallengeTTL is how long a login can wait for its second factor
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaChallengeAttempts bounds the codes tried against one challenge
+	mfaChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes a confirmed factor gets
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrInvalidMFAToken   = errors.New("invalid or expired MFA token")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolling   = errors.New("start two-factor enrollment first")
+	// ErrMFARequiredByRole is returned when disabling a factor a role of
+	// the user requires
+	ErrMFARequiredByRole = errors.New("a role of yours requires two-factor authentication")
+)
+
+// LoginChallenge is handed out by Login in place of tokens. Its token is
+// answered with a code through CompleteLogin. EnrollmentRequired tells that
+// the user has no second factor yet, although a role requires one, and must
+// enroll with EnrollWithChallenge first.
+type LoginChallenge struct {
+	Token              string
+	ExpiresIn          int64 // seconds until the token expires
+	EnrollmentRequired bool
+}
+
+// MFAEnrollment is what an authenticator app needs to generate codes
+type MFAEnrollment struct {
+	Secret string
+	URI    string // otpauth URI, usually shown as a QR code
+}
+
+// StartMFA begins enrolling a second factor for a user. It is off until
+// confirmed with ConfirmMFA; starting again replaces the pending secret.
+func (s *AuthService) StartMFA(userID primitive.ObjectID) (*MFAEnrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.startMFA(ctx, userID)
+}
+
+// ConfirmMFA turns the pending second factor of a user on with a code from
+// it, returning the recovery codes. They are shown this once; only hashes
+// are kept.
+func (s *AuthService) ConfirmMFA(userID primitive.ObjectID, code string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.confirmMFA(ctx, userID, code)
+}
+
+// DisableMFA turns the second factor of a user off, given a code from it or
+// a recovery code
+func (s *AuthService) DisableMFA(userID primitive.ObjectID, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mfa, err := s.mfa.FindByUserID(ctx, userID)
+	if err == mongo.ErrNoDocuments || (err == nil && !mfa.Confirmed) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	required, err := s.roles.RequiresMFA(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequiredByRole
+	}
+	if err := s.checkCode(ctx, mfa, code); err != nil {
+		return err
+	}
+	return s.mfa.Delete(ctx, userID)
+}
+
+// EnrollWithChallenge starts enrolling a second factor during a login that
+// requires one the user does not have yet. The challenge is then completed
+// with a code from the new factor, which confirms it.
+func (s *AuthService) EnrollWithChallenge(token string) (*MFAEnrollment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	challenge, err := s.attemptChallenge(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.startMFA(ctx, challenge.UserID)
+}
+
+// CompleteLogin answers a login challenge with a TOTP or recovery code and
+// opens the session. When the login enrolled a second factor, the code
+// confirms it and its recovery codes are returned as well.
+func (s *AuthService) CompleteLogin(token, code string, client Client) (*LoginResult, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	challenge, err := s.attemptChallenge(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	mfa, err := s.mfa.FindByUserID(ctx, challenge.UserID)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrMFANotEnrolling
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var recoveryCodes []string
+	if mfa.Confirmed {
+		err = s.checkCode(ctx, mfa, code)
+	} else {
+		recoveryCodes, err = s.confirmMFA(ctx, challenge.UserID, code)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	used, err := s.challenges.Use(ctx, challenge.ID, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !used {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	user, err := s.users.FindByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.signIn(ctx, user, client, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &LoginResult{Tokens: tokens, User: user}, recoveryCodes, nil
+}
+
+// challengeLogin returns a challenge when user must sign in with a second
+// factor, and nil when the password is enough
+func (s *AuthService) challengeLogin(ctx context.Context, userID primitive.ObjectID) (*LoginChallenge, error) {
+	enabled := false
+	mfa, err := s.mfa.FindByUserID(ctx, userID)
+	if err == nil {
+		enabled = mfa.Confirmed
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if !enabled {
+		required, err := s.roles.RequiresMFA(userID)
+		if err != nil || !required {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	challenge := &models.MFAChallenge{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(mfaChallengeTTL),
+	}
+	token, hash, err := newIDToken(challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	challenge.TokenHash = hash
+	if err := s.challenges.Insert(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return &LoginChallenge{Token: token, ExpiresIn: int64(mfaChallengeTTL.Seconds()), EnrollmentRequired: !enabled}, nil
+}
+
+// attemptChallenge loads the challenge of token, counting an attempt at it
+func (s *AuthService) attemptChallenge(ctx context.Context, token string) (*models.MFAChallenge, error) {
+	id, ok := idOfToken(token)
+	if !ok {
+		return nil, ErrInvalidMFAToken
+	}
+	challenge, err := s.challenges.FindByID(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if challenge.TokenHash != hashToken(token) {
+		return nil, ErrInvalidMFAToken
+	}
+	counted, err := s.challenges.Attempt(ctx, id, mfaChallengeAttempts, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		return nil, ErrInvalidMFAToken
+	}
+	return challenge, nil
+}
+
+func (s *AuthService) startMFA(ctx context.Context, userID primitive.ObjectID) (*MFAEnrollment, error) {
+	existing, err := s.mfa.FindByUserID(ctx, userID)
+	if err == nil && existing.Confirmed {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfa.Delete(ctx, userID); err != nil {
+		return nil, err
+	}
+	mfa := &models.MFA{
+		UserID:         userID,
+		Secret:         secret,
+		RecoveryHashes: []string{},
+		CreatedAt:      time.Now(),
+	}
+	if err := s.mfa.Insert(ctx, mfa); err != nil {
+		return nil, err
+	}
+	return &MFAEnrollment{Secret: secret, URI: otpauthURI(secret, user.Email)}, nil
+}
+
+func (s *AuthService) confirmMFA(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	mfa, err := s.mfa.FindByUserID(ctx, userID)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrMFANotEnrolling
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Confirmed {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	step, ok := matchTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	confirmed, err := s.mfa.Confirm(ctx, userID, step, hashes, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		// Confirmed or replaced by another request meanwhile
+		return nil, ErrMFANotEnrolling
+	}
+	return codes, nil
+}
+
+// checkCode accepts a TOTP code of a confirmed factor once, or uses up one
+// of its recovery codes
+func (s *AuthService) checkCode(ctx context.Context, mfa *models.MFA, code string) error {
+	var used bool
+	var err error
+	if step, ok := matchTOTP(mfa.Secret, code, time.Now()); ok {
+		used, err = s.mfa.UseStep(ctx, mfa.UserID, step)
+	} else {
+		used, err = s.mfa.UseRecoveryCode(ctx, mfa.UserID, hashToken(normalizeRecoveryCode(code)))
+	}
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// newRecoveryCode returns a random code like "k7q2m-x3c4a"
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 7)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes, as people type
+// codes in either way
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/mail"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL is how long a password reset link can be used
+const passwordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// ForgotPassword emails a password reset link to the user with email, if
+// there is one. Callers must answer the same either way, so the response
+// does not tell whether an email is registered; the email is sent in the
+// background for the same reason.
+func (s *AuthService) ForgotPassword(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.users.FindByEmail(ctx, email)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	now := time.Now()
+	reset := &models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+	if err := s.resets.Insert(ctx, reset); err != nil {
+		return err
+	}
+
+	s.sendInBackground(passwordResetMessage(user.Email, token), user.ID)
+	return nil
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token and any other outstanding ones of the user stop working, and every
+// session and access token of the user is revoked, signing out whoever knew
+// the old password.
+func (s *AuthService) ResetPassword(token, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reset, err := s.resets.FindByHash(ctx, hashToken(token))
+	if err == mongo.ErrNoDocuments {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	used, err := s.resets.Use(ctx, reset.ID, now)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetToken
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.users.Update(ctx, reset.UserID, bson.M{"password": string(hashed)}); err != nil {
+		return err
+	}
+	if err := s.resets.UseAll(ctx, reset.UserID, now); err != nil {
+		return err
+	}
+	if _, err := s.sessions.RevokeAll(ctx, reset.UserID, models.RevokedPasswordReset, now); err != nil {
+		return err
+	}
+	return s.users.RevokeTokens(ctx, reset.UserID)
+}
+
+// passwordResetMessage links to PASSWORD_RESET_URL when it is set, e.g. the
+// reset page of the frontend, and gives the bare token otherwise
+func passwordResetMessage(to, token string) mail.Message {
+	body := "Use this token to choose a new password: " + token
+	if url := os.Getenv("PASSWORD_RESET_URL"); url != "" {
+		body = "Choose a new password here: " + url + "?token=" + token
+	}
+	body += "\n\nThe link expires in one hour. If you did not ask to reset your password, ignore this email."
+	return mail.Message{To: to, Subject: "Reset your password", Body: body}
+}
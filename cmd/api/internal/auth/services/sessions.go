@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// refreshTokenTTL is how long a session lasts without being used; every
+// refresh extends it
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+	// ErrMFARequired is returned when a role of the user requires a second
+	// factor the session was not opened with
+	ErrMFARequired = errors.New("two-factor authentication is required; log in again")
+)
+
+// Client describes the device a session is opened from
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// Tokens are issued on login and on every refresh. The refresh token can be
+// used once; the next one replaces it.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // seconds until the access token expires
+}
+
+// Refresh exchanges a refresh token for new tokens. Presenting a token that
+// was already exchanged means it leaked: the session is revoked, so neither
+// the thief nor the owner can go on with it. A session opened without a
+// second factor is not refreshed once a role of the user requires one.
+func (s *AuthService) Refresh(refreshToken string) (*Tokens, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, hash, err := s.findSession(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if session.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if hash != session.TokenHash {
+		if containsHash(session.PreviousHashes, hash) {
+			return nil, s.revokeReused(ctx, session.ID, now)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if !now.Before(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.users.FindByID(ctx, session.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !session.MFA {
+		required, err := s.roles.RequiresMFA(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			return nil, ErrMFARequired
+		}
+	}
+
+	next, nextHash, err := newIDToken(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.sessions.Rotate(ctx, session.ID, hash, nextHash, now, now.Add(refreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request exchanged the same token first
+		return nil, s.revokeReused(ctx, session.ID, now)
+	}
+
+	roleNames, err := s.roles.RoleNames(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	accessToken, err := s.issueAccessToken(user, roleNames, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{AccessToken: accessToken, RefreshToken: next, ExpiresIn: int64(accessTokenTTL.Seconds())}, nil
+}
+
+// Logout revokes the session of a refresh token. Logging out of a session
+// that is already revoked succeeds.
+func (s *AuthService) Logout(refreshToken string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, hash, err := s.findSession(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if hash != session.TokenHash && !containsHash(session.PreviousHashes, hash) {
+		return ErrInvalidRefreshToken
+	}
+	_, err = s.sessions.Revoke(ctx, session.ID, models.RevokedLogout, time.Now())
+	return err
+}
+
+// ListSessions returns the active sessions of a user, marking current as such
+func (s *AuthService) ListSessions(userID, current primitive.ObjectID) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := s.sessions.ListActive(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out
+func (s *AuthService) RevokeSession(userID, sessionID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := s.sessions.FindByID(ctx, sessionID)
+	if err == mongo.ErrNoDocuments || (err == nil && session.UserID != userID) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	revoked, err := s.sessions.Revoke(ctx, sessionID, models.RevokedByUser, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// openSession stores a new session for user, telling whether it was opened
+// with a second factor, and returns its refresh token
+func (s *AuthService) openSession(ctx context.Context, userID primitive.ObjectID, client Client, mfa bool) (*models.Session, string, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:             primitive.NewObjectID(),
+		UserID:         userID,
+		PreviousHashes: []string{},
+		UserAgent:      client.UserAgent,
+		IP:             client.IP,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+		ExpiresAt:      now.Add(refreshTokenTTL),
+		MFA:            mfa,
+	}
+	token, hash, err := newIDToken(session.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	session.TokenHash = hash
+	if err := s.sessions.Insert(ctx, session); err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// findSession loads the session a refresh token belongs to, with the token's hash
+func (s *AuthService) findSession(ctx context.Context, refreshToken string) (*models.Session, string, error) {
+	id, ok := idOfToken(refreshToken)
+	if !ok {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	session, err := s.sessions.FindByID(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return session, hashToken(refreshToken), nil
+}
+
+func (s *AuthService) revokeReused(ctx context.Context, sessionID primitive.ObjectID, now time.Time) error {
+	if _, err := s.sessions.Revoke(ctx, sessionID, models.RevokedTokenReuse, now); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// newIDToken returns a random token naming the document it belongs to, e.g.
+// a session, and its hash
+func newIDToken(id primitive.ObjectID) (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token := id.Hex() + "." + base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashToken(token), nil
+}
+
+// idOfToken returns the ID a token from newIDToken names
+func idOfToken(token string) (primitive.ObjectID, bool) {
+	idHex, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(idHex)
+	return id, err == nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func containsHash(hashes []string, hash string) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
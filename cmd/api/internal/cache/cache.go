@@ -0,0 +1,70 @@
+// Package cache keeps values loaded from the database for a while. Writes
+// made through this process call Invalidate, so they apply at once; the TTL
+// bounds how long a change made by another API instance takes to apply.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// loadTimeout bounds each load
+const loadTimeout = 5 * time.Second
+
+// Cache maps keys to values loaded on demand. Values are shared with every
+// caller and must not be modified once returned.
+type Cache[K comparable, V any] struct {
+	ttl  time.Duration
+	load func(ctx context.Context, key K) (V, error)
+
+	mu         sync.Mutex
+	entries    map[K]entry[V]
+	generation int
+}
+
+type entry[V any] struct {
+	value    V
+	loadedAt time.Time
+}
+
+// New builds a cache that loads missing and expired values with load
+func New[K comparable, V any](ttl time.Duration, load func(ctx context.Context, key K) (V, error)) *Cache[K, V] {
+	return &Cache[K, V]{ttl: ttl, load: load, entries: map[K]entry[V]{}}
+}
+
+// Get returns the value of key, loading it when it is missing or expired
+func (c *Cache[K, V]) Get(key K) (V, error) {
+	c.mu.Lock()
+	if cached, ok := c.entries[key]; ok && time.Since(cached.loadedAt) < c.ttl {
+		c.mu.Unlock()
+		return cached.value, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	value, err := c.load(ctx, key)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A write made while loading may not be in value; serve it to this
+	// caller but load again next time
+	if c.generation == generation {
+		c.entries[key] = entry[V]{value: value, loadedAt: time.Now()}
+	}
+	return value, nil
+}
+
+// Invalidate forgets every value
+func (c *Cache[K, V]) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[K]entry[V]{}
+	c.generation++
+}
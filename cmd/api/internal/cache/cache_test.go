@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCacheLoadsOnce(t *testing.T) {
+	loads := 0
+	c := New(time.Minute, func(ctx context.Context, key string) (int, error) {
+		loads++
+		return len(key), nil
+	})
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get("abc"); err != nil || v != 3 {
+			t.Fatalf("Get = %d, %v", v, err)
+		}
+	}
+	if v, _ := c.Get("abcd"); v != 4 {
+		t.Fatalf("Get(abcd) = %d", v)
+	}
+	if loads != 2 {
+		t.Errorf("loaded %d times, want once per key", loads)
+	}
+
+	c.Invalidate()
+	c.Get("abc")
+	if loads != 3 {
+		t.Errorf("loaded %d times, want a reload after Invalidate", loads)
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	loads := 0
+	c := New(time.Nanosecond, func(ctx context.Context, key struct{}) (int, error) {
+		loads++
+		return loads, nil
+	})
+	c.Get(struct{}{})
+	time.Sleep(time.Millisecond)
+	if v, _ := c.Get(struct{}{}); v != 2 {
+		t.Errorf("Get after the TTL = %d, want a reload", v)
+	}
+}
+
+func TestCacheKeepsNoErrors(t *testing.T) {
+	fail := true
+	c := New(time.Minute, func(ctx context.Context, key struct{}) (string, error) {
+		if fail {
+			return "", errors.New("unavailable")
+		}
+		return "loaded", nil
+	})
+	if _, err := c.Get(struct{}{}); err == nil {
+		t.Fatal("Get did not return the load error")
+	}
+	fail = false
+	if v, err := c.Get(struct{}{}); err != nil || v != "loaded" {
+		t.Errorf("Get = %q, %v, want a fresh load", v, err)
+	}
+}
+
+func TestCacheDropsLoadRacingInvalidate(t *testing.T) {
+	var c *Cache[struct{}, int]
+	loads := 0
+	c = New(time.Minute, func(ctx context.Context, key struct{}) (int, error) {
+		loads++
+		if loads == 1 {
+			// A write lands while the first load is in flight
+			c.Invalidate()
+		}
+		return loads, nil
+	})
+	if v, _ := c.Get(struct{}{}); v != 1 {
+		t.Fatalf("first Get = %d, want 1", v)
+	}
+	if v, _ := c.Get(struct{}{}); v != 2 {
+		t.Errorf("second Get = %d, want a reload since the first load may be stale", v)
+	}
+}
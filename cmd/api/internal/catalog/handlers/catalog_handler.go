@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CatalogHandler serves the CRUD endpoints of one lookup catalog. Label names
+// an entry in messages ("Order level") and key is the list field of a
+// paginated response ("order_levels").
+type CatalogHandler[T any, P services.Item[T]] struct {
+	service *services.CatalogService[T, P]
+	label   string
+	key     string
+}
+
+func NewCatalogHandler[T any, P services.Item[T]](service *services.CatalogService[T, P], label, key string) *CatalogHandler[T, P] {
+	return &CatalogHandler[T, P]{service: service, label: label, key: key}
+}
+
+// Create adds an entry; it is active unless "active": false is sent
+func (h *CatalogHandler[T, P]) Create(c *gin.Context) {
+	item := P(new(T))
+	item.CatalogEntry().Active = true
+	if err := c.ShouldBindJSON(item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.Create(item); err != nil {
+		respondCatalogError(c, err, h.label)
+		return
+	}
+	c.JSON(http.StatusCreated, item)
+}
+
+// List returns the active entries in sort order. Without page or page_size
+// every entry is returned as a plain array; with either the response is
+// paginated. include_inactive=true also lists inactive entries.
+func (h *CatalogHandler[T, P]) List(c *gin.Context) {
+	opts := services.ListOptions{IncludeInactive: c.Query("include_inactive") == "true"}
+	paginated := c.Query("page") != "" || c.Query("page_size") != ""
+	if paginated {
+		opts.Page = 1
+		opts.PageSize = 10
+		if p := c.Query("page"); p != "" {
+			fmt.Sscanf(p, "%d", &opts.Page)
+		}
+		if ps := c.Query("page_size"); ps != "" {
+			fmt.Sscanf(ps, "%d", &opts.PageSize)
+		}
+		if opts.Page < 1 {
+			opts.Page = 1
+		}
+		if opts.PageSize < 1 || opts.PageSize > 100 {
+			opts.PageSize = 10
+		}
+	}
+	items, total, err := h.service.List(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !paginated {
+		c.JSON(http.StatusOK, items)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		h.key:       items,
+		"total":     total,
+		"page":      opts.Page,
+		"page_size": opts.PageSize,
+	})
+}
+
+// GetByID returns an entry by its ID or its slug
+func (h *CatalogHandler[T, P]) GetByID(c *gin.Context) {
+	var item P
+	var err error
+	if id, hexErr := primitive.ObjectIDFromHex(c.Param("id")); hexErr == nil {
+		item, err = h.service.GetByID(id)
+	} else {
+		item, err = h.service.GetBySlug(c.Param("id"))
+	}
+	if err != nil {
+		respondCatalogError(c, err, h.label)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// Update changes the fields sent and leaves the others as they are
+func (h *CatalogHandler[T, P]) Update(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item, err := h.service.GetByID(id)
+	if err != nil {
+		respondCatalogError(c, err, h.label)
+		return
+	}
+	if err := json.Unmarshal(body, item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.Update(id, item); err != nil {
+		respondCatalogError(c, err, h.label)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": h.label + " updated"})
+}
+
+// Delete removes an entry, unless orders or other documents still refer to
+// it: then it answers 409 with the number of references
+func (h *CatalogHandler[T, P]) Delete(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.service.Delete(id); err != nil {
+		respondCatalogError(c, err, h.label)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": h.label + " deleted"})
+}
+
+// Archive hides an entry from lists and new orders without touching the
+// orders already referring to it
+func (h *CatalogHandler[T, P]) Archive(c *gin.Context) {
+	h.setActive(c, h.service.Archive, " archived")
+}
+
+// Restore makes an archived entry available again
+func (h *CatalogHandler[T, P]) Restore(c *gin.Context) {
+	h.setActive(c, h.service.Restore, " restored")
+}
+
+func (h *CatalogHandler[T, P]) setActive(c *gin.Context, apply func(primitive.ObjectID) error, done string) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := apply(id); err != nil {
+		respondCatalogError(c, err, h.label)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": h.label + done})
+}
+
+// RespondInUse answers a delete refused because of an *InUseError
+func RespondInUse(c *gin.Context, err error, label string) bool {
+	var inUse *services.InUseError
+	if !errors.As(err, &inUse) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":         label + " is still referenced; archive it instead",
+		"references":    inUse.References,
+		"referenced_by": inUse.ByCollection,
+	})
+	return true
+}
+
+func respondCatalogError(c *gin.Context, err error, label string) {
+	if RespondInUse(c, err, label) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrEntryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": label + " not found"})
+	case errors.Is(err, services.ErrSlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNameRequired), errors.Is(err, services.ErrInvalidSlug):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Entry is the common part of every lookup an order refers to (levels, pages,
+// urgencies, ...). Lookup types embed it inline so their documents and JSON
+// stay flat:
+//
+//	type OrderLevel struct {
+//		models.Entry `bson:",inline"`
+//	}
+//
+// Inactive entries are hidden from clients but still resolve for orders that
+// already use them. Entries are listed by SortOrder, then in creation order.
+// e.g., {"name": "Undergraduate", "slug": "undergraduate", "sort_order": 2, "active": true}
+type Entry struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string             `bson:"name" json:"name" binding:"required"`
+	Description string             `bson:"description" json:"description"`
+	Slug        string             `bson:"slug" json:"slug"`
+	SortOrder   int                `bson:"sort_order" json:"sort_order"`
+	Active      bool               `bson:"active" json:"active"`
+}
+
+// CatalogEntry gives generic code access to the embedded Entry
+func (e *Entry) CatalogEntry() *Entry {
+	return e
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryStore struct {
+	*database.MemoryStore
+}
+
+// NewMemoryStore keeps catalogs in store, for tests
+func NewMemoryStore(store *database.MemoryStore) Store {
+	return memoryStore{MemoryStore: store}
+}
+
+func (s memoryStore) Catalog(collection string) Repository {
+	return memoryRepository{store: s.MemoryStore, collection: collection}
+}
+
+type memoryRepository struct {
+	store      *database.MemoryStore
+	collection string
+}
+
+func (r memoryRepository) Insert(ctx context.Context, entry interface{}) error {
+	return r.store.Insert(r.collection, entry)
+}
+
+func (r memoryRepository) FindOne(ctx context.Context, filter bson.M, out interface{}) error {
+	return r.store.FindOne(r.collection, filter, out)
+}
+
+func (r memoryRepository) Find(ctx context.Context, filter bson.M, page Page, out interface{}) error {
+	opts := database.FindOptions{Sort: catalogOrder, Skip: page.Skip, Limit: page.Limit}
+	return r.store.Find(r.collection, filter, opts, out)
+}
+
+func (r memoryRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.store.Count(r.collection, filter), nil
+}
+
+func (r memoryRepository) Replace(ctx context.Context, id primitive.ObjectID, entry interface{}) (int64, error) {
+	return r.store.ReplaceOne(r.collection, bson.M{"_id": id}, entry)
+}
+
+func (r memoryRepository) Update(ctx context.Context, filter, set bson.M) (int64, error) {
+	return r.store.UpdateMany(r.collection, filter, bson.M{"$set": set})
+}
+
+func (r memoryRepository) Delete(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	return r.store.DeleteOne(r.collection, bson.M{"_id": id})
+}
+
+func (r memoryRepository) Names(ctx context.Context) (map[primitive.ObjectID]string, error) {
+	var entries []nameEntry
+	if err := r.store.Find(r.collection, bson.M{}, database.FindOptions{}, &entries); err != nil {
+		return nil, err
+	}
+	return namesOf(entries), nil
+}
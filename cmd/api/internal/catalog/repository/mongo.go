@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	database.Counter
+	db *mongo.Database
+}
+
+func NewMongoStore(db *mongo.Database) Store {
+	return mongoStore{Counter: database.NewMongoCounter(db), db: db}
+}
+
+func (s mongoStore) Catalog(collection string) Repository {
+	return mongoRepository{col: s.db.Collection(collection)}
+}
+
+type mongoRepository struct {
+	col *mongo.Collection
+}
+
+func (r mongoRepository) Insert(ctx context.Context, entry interface{}) error {
+	_, err := r.col.InsertOne(ctx, entry)
+	return err
+}
+
+func (r mongoRepository) FindOne(ctx context.Context, filter bson.M, out interface{}) error {
+	return r.col.FindOne(ctx, filter).Decode(out)
+}
+
+func (r mongoRepository) Find(ctx context.Context, filter bson.M, page Page, out interface{}) error {
+	opts := options.Find().SetSort(catalogOrder)
+	if page.Skip > 0 {
+		opts.SetSkip(page.Skip)
+	}
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
+	}
+	cur, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	return cur.All(ctx, out)
+}
+
+func (r mongoRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.col.CountDocuments(ctx, filter)
+}
+
+func (r mongoRepository) Replace(ctx context.Context, id primitive.ObjectID, entry interface{}) (int64, error) {
+	res, err := r.col.ReplaceOne(ctx, bson.M{"_id": id}, entry)
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func (r mongoRepository) Update(ctx context.Context, filter, set bson.M) (int64, error) {
+	res, err := r.col.UpdateMany(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func (r mongoRepository) Delete(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (r mongoRepository) Names(ctx context.Context) (map[primitive.ObjectID]string, error) {
+	cur, err := r.col.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var entries []nameEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return namesOf(entries), nil
+}
@@ -0,0 +1,64 @@
+// Package repository stores lookup catalogs (and order types), one
+// collection each. Entries are decoded into the caller's type, as with the
+// MongoDB driver, so a single repository serves every catalog. The MongoDB
+// store is used by the API and the in-memory one by tests; a missing entry
+// gives mongo.ErrNoDocuments from both.
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Page selects part of a listing; a zero Limit returns every entry
+type Page struct {
+	Skip  int64
+	Limit int64
+}
+
+// Repository stores the entries of one catalog collection
+type Repository interface {
+	Insert(ctx context.Context, entry interface{}) error
+	// FindOne decodes the first entry matching filter into out
+	FindOne(ctx context.Context, filter bson.M, out interface{}) error
+	// Find decodes the entries matching filter into out, a pointer to a
+	// slice, by sort order and then creation order
+	Find(ctx context.Context, filter bson.M, page Page, out interface{}) error
+	Count(ctx context.Context, filter bson.M) (int64, error)
+	// Replace stores entry in place of the one with id and returns how many
+	// entries matched
+	Replace(ctx context.Context, id primitive.ObjectID, entry interface{}) (int64, error)
+	// Update sets fields on every entry matching filter and returns how many
+	// matched
+	Update(ctx context.Context, filter, set bson.M) (int64, error)
+	Delete(ctx context.Context, id primitive.ObjectID) (int64, error)
+	// Names maps the ID of every entry to its name
+	Names(ctx context.Context) (map[primitive.ObjectID]string, error)
+}
+
+// Store opens the catalogs of one database and counts the documents of any
+// collection, to find references to an entry
+type Store interface {
+	database.Counter
+	Catalog(collection string) Repository
+}
+
+// catalogOrder lists entries by sort order, then creation order
+var catalogOrder = bson.D{{Key: "sort_order", Value: 1}, {Key: "_id", Value: 1}}
+
+// nameEntry is the part of an entry Names reads
+type nameEntry struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func namesOf(entries []nameEntry) map[primitive.ObjectID]string {
+	names := make(map[primitive.ObjectID]string, len(entries))
+	for _, e := range entries {
+		names[e.ID] = e.Name
+	}
+	return names
+}
@@ -0,0 +1,307 @@
+// Package services holds the one service behind every order lookup catalog
+// (levels, pages, urgencies, styles, languages). A new lookup only needs a
+// type embedding models.Entry and a NewCatalogService call with its collection.
+// Entries are stored through a repository.Store, MongoDB or in-memory.
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/cache"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrEntryNotFound = errors.New("catalog entry not found")
+	ErrNameRequired  = errors.New("name is required")
+	ErrSlugTaken     = errors.New("slug is already used by another entry")
+	ErrInvalidSlug   = errors.New("slug may only contain lower case letters, digits and dashes")
+	ErrEntryArchived = errors.New("catalog entry is archived")
+)
+
+var (
+	slugPattern  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparate = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// nameCacheTTL bounds how long names stay stale after another API instance
+// changed a catalog
+const nameCacheTTL = time.Minute
+
+// Item is implemented by pointers to types embedding models.Entry
+type Item[T any] interface {
+	*T
+	CatalogEntry() *models.Entry
+}
+
+// ListOptions selects a page of a catalog. A zero PageSize returns every entry.
+type ListOptions struct {
+	IncludeInactive bool
+	Page            int
+	PageSize        int
+}
+
+// CatalogService stores one lookup catalog in its own collection
+type CatalogService[T any, P Item[T]] struct {
+	items   repository.Repository
+	counter database.Counter
+	refs    []Reference
+	names   *cache.Cache[struct{}, map[primitive.ObjectID]string]
+}
+
+// NewCatalogService serves the catalog of T stored in collection, e.g.
+// NewCatalogService[models.OrderLevel](db, "order_levels")
+func NewCatalogService[T any, P Item[T]](db *mongo.Database, collection string) *CatalogService[T, P] {
+	return NewCatalogServiceWith[T, P](repository.NewMongoStore(db), collection)
+}
+
+// NewCatalogServiceWith serves the catalog of T stored in collection of store.
+// Names are cached per service, so a process shares one service per catalog.
+func NewCatalogServiceWith[T any, P Item[T]](store repository.Store, collection string) *CatalogService[T, P] {
+	items := store.Catalog(collection)
+	names := cache.New(nameCacheTTL, func(ctx context.Context, _ struct{}) (map[primitive.ObjectID]string, error) {
+		return items.Names(ctx)
+	})
+	return &CatalogService[T, P]{items: items, counter: store, names: names}
+}
+
+// ReferencedBy declares where entries are referenced, so Delete refuses to
+// orphan those documents
+func (s *CatalogService[T, P]) ReferencedBy(refs ...Reference) *CatalogService[T, P] {
+	s.refs = append(s.refs, refs...)
+	return s
+}
+
+// Slugify derives a slug from a name, e.g. "High School" gives "high-school"
+func Slugify(name string) string {
+	return strings.Trim(slugSeparate.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func (s *CatalogService[T, P]) Create(item P) error {
+	entry := item.CatalogEntry()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entry.ID = primitive.NewObjectID()
+	if err := s.prepare(ctx, entry); err != nil {
+		return err
+	}
+	if err := s.items.Insert(ctx, item); err != nil {
+		return err
+	}
+	s.names.Invalidate()
+	return nil
+}
+
+// List returns entries by sort order, then creation order, with the total
+// number of entries matching
+func (s *CatalogService[T, P]) List(opts ListOptions) ([]T, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{}
+	if !opts.IncludeInactive {
+		filter["active"] = bson.M{"$ne": false}
+	}
+	total, err := s.items.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	var page repository.Page
+	if opts.PageSize > 0 {
+		page = repository.Page{Skip: int64((opts.Page - 1) * opts.PageSize), Limit: int64(opts.PageSize)}
+	}
+	items := []T{}
+	if err := s.items.Find(ctx, filter, page, &items); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *CatalogService[T, P]) GetByID(id primitive.ObjectID) (P, error) {
+	return s.findOne(bson.M{"_id": id})
+}
+
+func (s *CatalogService[T, P]) GetBySlug(slug string) (P, error) {
+	return s.findOne(bson.M{"slug": slug})
+}
+
+// Names maps the ID of every entry, archived ones included, to its name. It
+// is served from the service's cache and reloaded with one query after a
+// change; callers must not modify it.
+func (s *CatalogService[T, P]) Names() (map[primitive.ObjectID]string, error) {
+	return s.names.Get(struct{}{})
+}
+
+// Update replaces the entry with item, keeping its ID
+func (s *CatalogService[T, P]) Update(id primitive.ObjectID, item P) error {
+	entry := item.CatalogEntry()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entry.ID = id
+	if err := s.prepare(ctx, entry); err != nil {
+		return err
+	}
+	matched, err := s.items.Replace(ctx, id, item)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEntryNotFound
+	}
+	s.names.Invalidate()
+	return nil
+}
+
+// Delete removes an entry nothing refers to any more. Entries still in use
+// give an *InUseError and should be archived instead.
+func (s *CatalogService[T, P]) Delete(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := DeleteUnreferenced(ctx, s.items, s.counter, id, s.refs); err != nil {
+		return err
+	}
+	s.names.Invalidate()
+	return nil
+}
+
+// Archive hides an entry from lists and from new orders. It still resolves
+// by ID, so existing orders keep showing its name.
+func (s *CatalogService[T, P]) Archive(id primitive.ObjectID) error {
+	return s.setActive(id, false)
+}
+
+// Restore makes an archived entry available again
+func (s *CatalogService[T, P]) Restore(id primitive.ObjectID) error {
+	return s.setActive(id, true)
+}
+
+// RequireActive checks an entry exists and is not archived, giving
+// ErrEntryNotFound or ErrEntryArchived otherwise
+func (s *CatalogService[T, P]) RequireActive(id primitive.ObjectID) error {
+	item, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if !item.CatalogEntry().Active {
+		return ErrEntryArchived
+	}
+	return nil
+}
+
+// Backfill gives entries created before slugs, sort orders and the active
+// flag existed a slug from their name and marks them active. It only touches
+// such entries, so running it on every start is safe.
+func (s *CatalogService[T, P]) Backfill() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := s.items.Update(ctx, bson.M{"active": bson.M{"$exists": false}}, bson.M{"active": true}); err != nil {
+		return err
+	}
+	if _, err := s.items.Update(ctx, bson.M{"sort_order": bson.M{"$exists": false}}, bson.M{"sort_order": 0}); err != nil {
+		return err
+	}
+	var entries []models.Entry
+	noSlug := bson.M{"$or": bson.A{bson.M{"slug": bson.M{"$exists": false}}, bson.M{"slug": ""}}}
+	if err := s.items.Find(ctx, noSlug, repository.Page{}, &entries); err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := s.assignSlug(ctx, &entries[i]); err != nil {
+			return err
+		}
+		if _, err := s.items.Update(ctx, bson.M{"_id": entries[i].ID}, bson.M{"slug": entries[i].Slug}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CatalogService[T, P]) setActive(id primitive.ObjectID, active bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	matched, err := s.items.Update(ctx, bson.M{"_id": id}, bson.M{"active": active})
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+func (s *CatalogService[T, P]) findOne(filter bson.M) (P, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	item := P(new(T))
+	if err := s.items.FindOne(ctx, filter, item); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrEntryNotFound
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+// prepare validates the entry's name and slug before it is stored
+func (s *CatalogService[T, P]) prepare(ctx context.Context, entry *models.Entry) error {
+	entry.Name = strings.TrimSpace(entry.Name)
+	if entry.Name == "" {
+		return ErrNameRequired
+	}
+	entry.Slug = strings.TrimSpace(entry.Slug)
+	if entry.Slug == "" {
+		return s.assignSlug(ctx, entry)
+	}
+	if !slugPattern.MatchString(entry.Slug) {
+		return ErrInvalidSlug
+	}
+	taken, err := s.slugTaken(ctx, entry.Slug, entry.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSlugTaken
+	}
+	return nil
+}
+
+// assignSlug derives a free slug from the entry's name, numbering it when
+// another entry has the same name
+func (s *CatalogService[T, P]) assignSlug(ctx context.Context, entry *models.Entry) error {
+	base := Slugify(entry.Name)
+	if base == "" {
+		base = "entry"
+	}
+	for n := 1; ; n++ {
+		slug := base
+		if n > 1 {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken, err := s.slugTaken(ctx, slug, entry.ID)
+		if err != nil {
+			return err
+		}
+		if !taken {
+			entry.Slug = slug
+			return nil
+		}
+	}
+}
+
+func (s *CatalogService[T, P]) slugTaken(ctx context.Context, slug string, id primitive.ObjectID) (bool, error) {
+	var entry models.Entry
+	err := s.items.FindOne(ctx, bson.M{"slug": slug, "_id": bson.M{"$ne": id}}, &entry)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrEntryInUse matches every *InUseError via errors.Is
+var ErrEntryInUse = errors.New("catalog entry is still referenced")
+
+// Reference is a field of another collection holding the IDs of entries, e.g.
+// Reference{Collection: "orders", Field: "order_level_id"}. Where narrows the
+// documents counted, for collections that mix references to several catalogs.
+type Reference struct {
+	Collection string
+	Field      string
+	Where      bson.M
+}
+
+// InUseError explains why an entry could not be deleted: how many documents
+// still refer to it, per collection
+type InUseError struct {
+	References   int64
+	ByCollection map[string]int64
+}
+
+func (e *InUseError) Error() string {
+	return fmt.Sprintf("%s by %d documents; archive it instead", ErrEntryInUse, e.References)
+}
+
+func (e *InUseError) Is(target error) bool {
+	return target == ErrEntryInUse
+}
+
+// CountReferences counts the documents referring to id through refs. It
+// returns an *InUseError when there are any.
+func CountReferences(ctx context.Context, counter database.Counter, id primitive.ObjectID, refs []Reference) error {
+	inUse := &InUseError{ByCollection: map[string]int64{}}
+	for _, ref := range refs {
+		filter := bson.M{ref.Field: id}
+		for k, v := range ref.Where {
+			filter[k] = v
+		}
+		n, err := counter.CountDocuments(ctx, ref.Collection, filter)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			inUse.References += n
+			inUse.ByCollection[ref.Collection] += n
+		}
+	}
+	if inUse.References > 0 {
+		return inUse
+	}
+	return nil
+}
+
+// DeleteUnreferenced deletes the entry with id from items unless refs refer
+// to it. An active entry is archived before references are counted, so
+// orders validated from then on reject it, and made active again if any are
+// found. An entry that was already archived stays archived.
+func DeleteUnreferenced(ctx context.Context, items repository.Repository, counter database.Counter, id primitive.ObjectID, refs []Reference) error {
+	archived, err := items.Update(ctx, bson.M{"_id": id, "active": bson.M{"$ne": false}}, bson.M{"active": false})
+	if err != nil {
+		return err
+	}
+	if archived == 0 {
+		n, err := items.Count(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrEntryNotFound
+		}
+	}
+	if err := CountReferences(ctx, counter, id, refs); err != nil {
+		if archived > 0 {
+			if _, restoreErr := items.Update(ctx, bson.M{"_id": id, "active": false}, bson.M{"active": true}); restoreErr != nil {
+				return fmt.Errorf("restore entry %s after a refused delete: %w", id.Hex(), restoreErr)
+			}
+		}
+		return err
+	}
+	deleted, err := items.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
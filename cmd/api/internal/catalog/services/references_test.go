@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type level struct {
+	models.Entry `bson:",inline"`
+}
+
+// orderingCounter tries to place an order for the entry with id whenever
+// references are counted, as a client might while the entry is deleted
+type orderingCounter struct {
+	*database.MemoryStore
+	id      primitive.ObjectID
+	require func(primitive.ObjectID) error
+	errs    []error
+}
+
+func (c *orderingCounter) CountDocuments(ctx context.Context, collection string, filter bson.M) (int64, error) {
+	err := c.require(c.id)
+	if err == nil {
+		c.MemoryStore.Insert("orders", bson.M{"_id": primitive.NewObjectID(), "order_level_id": c.id})
+	}
+	c.errs = append(c.errs, err)
+	return c.MemoryStore.CountDocuments(ctx, collection, filter)
+}
+
+func newLevels(t *testing.T) (*database.MemoryStore, *CatalogService[level, *level], primitive.ObjectID) {
+	t.Helper()
+	store := database.NewMemoryStore()
+	levels := NewCatalogServiceWith[level](repository.NewMemoryStore(store), "order_levels").
+		ReferencedBy(Reference{Collection: "orders", Field: "order_level_id"})
+	entry := &level{Entry: models.Entry{Name: "Masters", Active: true}}
+	if err := levels.Create(entry); err != nil {
+		t.Fatal(err)
+	}
+	return store, levels, entry.ID
+}
+
+func TestDeleteRefusesReferencedEntries(t *testing.T) {
+	store, levels, id := newLevels(t)
+	store.Insert("orders", bson.M{"_id": primitive.NewObjectID(), "order_level_id": id})
+
+	var inUse *InUseError
+	if err := levels.Delete(id); !errors.As(err, &inUse) || inUse.ByCollection["orders"] != 1 {
+		t.Fatalf("Delete = %v, want an *InUseError for one order", err)
+	}
+	if _, err := levels.GetByID(id); err != nil {
+		t.Errorf("entry is gone after a refused delete: %v", err)
+	}
+}
+
+func TestDeleteUnreferenced(t *testing.T) {
+	_, levels, id := newLevels(t)
+	if err := levels.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := levels.Delete(id); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("second Delete = %v, want ErrEntryNotFound", err)
+	}
+	if names, _ := levels.Names(); len(names) != 0 {
+		t.Errorf("Names = %v after delete", names)
+	}
+}
+
+func TestDeleteRefusedKeepsEntryActive(t *testing.T) {
+	store, levels, id := newLevels(t)
+	store.Insert("orders", bson.M{"_id": primitive.NewObjectID(), "order_level_id": id})
+
+	if err := levels.Delete(id); !errors.Is(err, ErrEntryInUse) {
+		t.Fatalf("Delete = %v, want ErrEntryInUse", err)
+	}
+	if err := levels.RequireActive(id); err != nil {
+		t.Errorf("entry is not active after a refused delete: %v", err)
+	}
+
+	if err := levels.Archive(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := levels.Delete(id); !errors.Is(err, ErrEntryInUse) {
+		t.Fatalf("Delete of archived entry = %v, want ErrEntryInUse", err)
+	}
+	if err := levels.RequireActive(id); !errors.Is(err, ErrEntryArchived) {
+		t.Errorf("RequireActive = %v after a refused delete of an archived entry, want ErrEntryArchived", err)
+	}
+}
+
+func TestDeleteArchivesBeforeCounting(t *testing.T) {
+	store, levels, id := newLevels(t)
+	counter := &orderingCounter{MemoryStore: store, id: id, require: levels.RequireActive}
+	items := repository.NewMemoryStore(store).Catalog("order_levels")
+
+	if err := DeleteUnreferenced(context.Background(), items, counter, id, levels.refs); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range counter.errs {
+		if !errors.Is(err, ErrEntryArchived) {
+			t.Errorf("order placed while the entry was being deleted: RequireActive = %v", err)
+		}
+	}
+	if n := store.Count("orders", bson.M{"order_level_id": id}); n != 0 {
+		t.Errorf("%d orders refer to the deleted entry", n)
+	}
+	if _, err := levels.GetByID(id); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("GetByID = %v after delete, want ErrEntryNotFound", err)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ExchangeRateHandler struct {
+	service *services.ExchangeRateService
+}
+
+func NewExchangeRateHandler(service *services.ExchangeRateService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{service: service}
+}
+
+// Create adds an exchange rate; effective_from defaults to now (admin)
+func (h *ExchangeRateHandler) Create(c *gin.Context) {
+	var rate models.ExchangeRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if adminID, ok := userIDFromContext(c); ok {
+		rate.CreatedBy = &adminID
+	}
+	if err := h.service.Create(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rate)
+}
+
+// List returns exchange rates, latest effective date first (paginated).
+// Filters: base and quote.
+func (h *ExchangeRateHandler) List(c *gin.Context) {
+	page := 1
+	pageSize := 10
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+	filters := map[string]string{"base": "", "quote": ""}
+	for param := range filters {
+		if v := c.Query(param); v != "" {
+			code, err := money.NormalizeCurrency(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + ": " + err.Error()})
+				return
+			}
+			filters[param] = code
+		}
+	}
+
+	rates, total, err := h.service.List(filters["base"], filters["quote"], page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"exchange_rates": rates,
+		"total":          total,
+		"page":           page,
+		"page_size":      pageSize,
+	})
+}
+
+func (h *ExchangeRateHandler) GetByID(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	rate, err := h.service.GetByID(id)
+	if err != nil {
+		if errors.Is(err, services.ErrExchangeRateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+func (h *ExchangeRateHandler) Delete(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.service.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+}
+
+// Currencies lists the currencies prices can be quoted in, and the default
+// currency prices are configured in
+func (h *ExchangeRateHandler) Currencies(c *gin.Context) {
+	currencies, err := h.service.Currencies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"default": money.DefaultCurrency(), "currencies": currencies})
+}
+
+// Convert converts an amount for display, e.g.
+// GET /api/currencies/convert?amount=12.5&from=USD&to=EUR. at (RFC 3339)
+// selects the rate of an earlier time.
+func (h *ExchangeRateHandler) Convert(c *gin.Context) {
+	amount, err := strconv.ParseFloat(c.Query("amount"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a number"})
+		return
+	}
+	from, err := money.NormalizeCurrency(c.DefaultQuery("from", money.DefaultCurrency()))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from: " + err.Error()})
+		return
+	}
+	to, err := money.NormalizeCurrency(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to: " + err.Error()})
+		return
+	}
+	at := time.Now()
+	if v := c.Query("at"); v != "" {
+		if at, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 time"})
+			return
+		}
+	}
+
+	converted, conversion, err := h.service.Convert(money.FromMajor(amount, from), to, at)
+	if err != nil {
+		if errors.Is(err, services.ErrNoExchangeRate) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"amount":     money.Round(amount, from),
+		"converted":  converted.Major(),
+		"conversion": conversion,
+	})
+}
+
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	return principal.UserID, true
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExchangeRate is what one unit of Base is worth in Quote from EffectiveFrom
+// until a later rate for the pair takes effect (exchange_rates collection).
+// Rates are never edited: a new rate with a later effective date replaces it.
+// e.g., {"base": "USD", "quote": "EUR", "rate": 0.92, "effective_from": "2024-06-01T00:00:00Z"}
+type ExchangeRate struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Base          string              `bson:"base" json:"base" binding:"required"`
+	Quote         string              `bson:"quote" json:"quote" binding:"required"`
+	Rate          float64             `bson:"rate" json:"rate" binding:"required"`
+	EffectiveFrom time.Time           `bson:"effective_from" json:"effective_from"`
+	CreatedBy     *primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt     time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// Conversion is the rate used to convert an amount from one currency to
+// another. Quotes and payouts keep it so the figures can be traced later.
+// e.g., {"from": "USD", "to": "EUR", "rate": 0.92, "effective_from": "2024-06-01T00:00:00Z"}
+type Conversion struct {
+	From          string    `bson:"from" json:"from"`
+	To            string    `bson:"to" json:"to"`
+	Rate          float64   `bson:"rate" json:"rate"`
+	EffectiveFrom time.Time `bson:"effective_from" json:"effective_from"`
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrExchangeRateNotFound = errors.New("exchange rate not found")
+	ErrNoExchangeRate       = errors.New("no exchange rate between these currencies")
+)
+
+// ExchangeRateService keeps the admin maintained exchange rate table and
+// converts amounts with the rate in effect at a given time. Pairs without a
+// rate of their own are converted through the default currency.
+type ExchangeRateService struct {
+	col *mongo.Collection
+}
+
+func NewExchangeRateService(db *mongo.Database) *ExchangeRateService {
+	return &ExchangeRateService{col: db.Collection("exchange_rates")}
+}
+
+// ValidateExchangeRate checks the admin supplied fields of a rate
+func ValidateExchangeRate(r *models.ExchangeRate) error {
+	var err error
+	if r.Base, err = money.NormalizeCurrency(r.Base); err != nil {
+		return fmt.Errorf("base: %w", err)
+	}
+	if r.Quote, err = money.NormalizeCurrency(r.Quote); err != nil {
+		return fmt.Errorf("quote: %w", err)
+	}
+	if r.Base == r.Quote {
+		return errors.New("base and quote must be different currencies")
+	}
+	if r.Rate <= 0 {
+		return errors.New("rate must be greater than 0")
+	}
+	return nil
+}
+
+// Create adds a rate; without an effective date it takes effect immediately
+func (s *ExchangeRateService) Create(r *models.ExchangeRate) error {
+	if err := ValidateExchangeRate(r); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.ID = primitive.NewObjectID()
+	r.CreatedAt = time.Now()
+	if r.EffectiveFrom.IsZero() {
+		r.EffectiveFrom = r.CreatedAt
+	}
+	if s.col.FindOne(ctx, bson.M{"base": r.Base, "quote": r.Quote, "effective_from": r.EffectiveFrom}).Err() == nil {
+		return fmt.Errorf("a %s/%s rate already takes effect at %s", r.Base, r.Quote, r.EffectiveFrom.Format(time.RFC3339))
+	}
+	_, err := s.col.InsertOne(ctx, r)
+	return err
+}
+
+// List returns rates, latest effective date first, optionally for one base and/or quote currency
+func (s *ExchangeRateService) List(base, quote string, page, pageSize int) ([]models.ExchangeRate, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{}
+	if base != "" {
+		filter["base"] = base
+	}
+	if quote != "" {
+		filter["quote"] = quote
+	}
+	total, err := s.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "effective_from", Value: -1}, {Key: "base", Value: 1}, {Key: "quote", Value: 1}})
+	cur, err := s.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	rates := []models.ExchangeRate{}
+	if err := cur.All(ctx, &rates); err != nil {
+		return nil, 0, err
+	}
+	return rates, total, nil
+}
+
+func (s *ExchangeRateService) GetByID(id primitive.ObjectID) (*models.ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var r models.ExchangeRate
+	if err := s.col.FindOne(ctx, bson.M{"_id": id}).Decode(&r); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrExchangeRateNotFound
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Delete removes a rate entered by mistake. Orders and payouts keep the
+// conversion they were made with.
+func (s *ExchangeRateService) Delete(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// Currencies lists the default currency and every currency with a rate
+func (s *ExchangeRateService) Currencies() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	seen := map[string]bool{money.DefaultCurrency(): true}
+	for _, field := range []string{"base", "quote"} {
+		values, err := s.col.Distinct(ctx, field, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			if code, ok := v.(string); ok {
+				seen[code] = true
+			}
+		}
+	}
+	currencies := make([]string, 0, len(seen))
+	for code := range seen {
+		currencies = append(currencies, code)
+	}
+	sort.Strings(currencies)
+	return currencies, nil
+}
+
+// Rate finds the rate from one currency to another in effect at at: the
+// latest rate entered for the pair in either direction, or else the cross
+// rate through the default currency.
+func (s *ExchangeRateService) Rate(from, to string, at time.Time) (*models.Conversion, error) {
+	if from == to {
+		return &models.Conversion{From: from, To: to, Rate: 1}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conversion, err := s.pairRate(ctx, from, to, at)
+	if err != ErrNoExchangeRate {
+		return conversion, err
+	}
+	base := money.DefaultCurrency()
+	if from == base || to == base {
+		return nil, fmt.Errorf("%w: %s to %s", ErrNoExchangeRate, from, to)
+	}
+	toBase, err := s.pairRate(ctx, from, base, at)
+	if err != nil {
+		return nil, noRate(err, from, to)
+	}
+	fromBase, err := s.pairRate(ctx, base, to, at)
+	if err != nil {
+		return nil, noRate(err, from, to)
+	}
+	effective := toBase.EffectiveFrom
+	if fromBase.EffectiveFrom.After(effective) {
+		effective = fromBase.EffectiveFrom
+	}
+	return &models.Conversion{From: from, To: to, Rate: toBase.Rate * fromBase.Rate, EffectiveFrom: effective}, nil
+}
+
+// Convert converts amount to currency at the rate in effect at at
+func (s *ExchangeRateService) Convert(amount money.Money, currency string, at time.Time) (money.Money, *models.Conversion, error) {
+	conversion, err := s.Rate(amount.Currency, currency, at)
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+	return amount.Convert(currency, conversion.Rate), conversion, nil
+}
+
+// pairRate looks up the latest rate of from/to or to/from, inverting the latter
+func (s *ExchangeRateService) pairRate(ctx context.Context, from, to string, at time.Time) (*models.Conversion, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "effective_from", Value: -1}})
+	var r models.ExchangeRate
+	err := s.col.FindOne(ctx, bson.M{
+		"base":           bson.M{"$in": bson.A{from, to}},
+		"quote":          bson.M{"$in": bson.A{from, to}},
+		"effective_from": bson.M{"$lte": at},
+	}, opts).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoExchangeRate
+	}
+	if err != nil {
+		return nil, err
+	}
+	conversion := &models.Conversion{From: from, To: to, Rate: r.Rate, EffectiveFrom: r.EffectiveFrom}
+	if r.Base != from {
+		conversion.Rate = 1 / r.Rate
+	}
+	return conversion, nil
+}
+
+func noRate(err error, from, to string) error {
+	if err == ErrNoExchangeRate {
+		return fmt.Errorf("%w: %s to %s", ErrNoExchangeRate, from, to)
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateDefaultCurrency stamps orders created before orders carried a
+// currency with the default currency, which is what they were priced and
+// paid in. It only touches orders without one, so running it on every start
+// is safe.
+func MigrateDefaultCurrency(db *mongo.Database) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	orders := db.Collection("orders")
+	currency := money.DefaultCurrency()
+	res, err := orders.UpdateMany(ctx,
+		bson.M{"currency": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"currency": currency}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := orders.UpdateMany(ctx,
+		bson.M{"price_breakdown": bson.M{"$type": "object"}, "price_breakdown.currency": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"price_breakdown.currency": currency}},
+	); err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
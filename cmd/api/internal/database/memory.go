@@ -0,0 +1,605 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrDuplicateID is returned when inserting a document whose _id is taken
+var ErrDuplicateID = errors.New("duplicate _id")
+
+// memoryRegistry decodes embedded documents as bson.M so stored documents can
+// be walked and updated without caring how they were written
+var memoryRegistry = func() *bsoncodec.Registry {
+	rb := bson.NewRegistryBuilder()
+	rb.RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(bson.M{}))
+	return rb.Build()
+}()
+
+// FindOptions sorts and pages the documents returned by MemoryStore.Find;
+// Sort keys are 1 for ascending and -1 for descending, like in MongoDB
+type FindOptions struct {
+	Sort  bson.D
+	Skip  int64
+	Limit int64
+}
+
+// MemoryStore is a thread-safe, in-memory stand-in for a MongoDB database,
+// backing the in-memory repositories used by tests. Documents are stored in
+// their BSON form, so they go through the same bson tags as with MongoDB.
+//
+// Filters support equality (which also matches array elements, dotted paths
+// and paths into arrays of documents), $ne, $in, $nin, $exists, $gt, $gte,
+// $lt, $lte and $or. Updates support $set, $unset, $inc, $push, $addToSet
+// (with $each) and $pull of equal values.
+type MemoryStore struct {
+	mu          sync.Mutex
+	tx          sync.Mutex
+	collections map[string][]bson.M
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{collections: map[string][]bson.M{}}
+}
+
+// Insert stores doc, which must have an _id
+func (s *MemoryStore) Insert(collection string, doc interface{}) error {
+	stored, err := toDocument(doc)
+	if err != nil {
+		return err
+	}
+	if _, ok := stored["_id"]; !ok {
+		return errors.New("document has no _id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.collections[collection] {
+		if equal(existing["_id"], stored["_id"]) {
+			return ErrDuplicateID
+		}
+	}
+	s.collections[collection] = append(s.collections[collection], stored)
+	return nil
+}
+
+// FindOne decodes the first document matching filter into out, or returns
+// mongo.ErrNoDocuments
+func (s *MemoryStore) FindOne(collection string, filter bson.M, out interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range s.collections[collection] {
+		if matches(doc, filter) {
+			return fromDocument(doc, out)
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+// Find decodes the documents matching filter into out, a pointer to a slice
+func (s *MemoryStore) Find(collection string, filter bson.M, opts FindOptions, out interface{}) error {
+	s.mu.Lock()
+	var found []bson.M
+	for _, doc := range s.collections[collection] {
+		if matches(doc, filter) {
+			found = append(found, doc)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(opts.Sort) > 0 {
+		sort.SliceStable(found, func(i, j int) bool {
+			for _, key := range opts.Sort {
+				a, _ := lookup(found[i], key.Key)
+				b, _ := lookup(found[j], key.Key)
+				c := compare(a, b)
+				if c == 0 {
+					continue
+				}
+				if dir, _ := toFloat(key.Value); dir < 0 {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if opts.Skip > 0 {
+		if opts.Skip >= int64(len(found)) {
+			found = nil
+		} else {
+			found = found[opts.Skip:]
+		}
+	}
+	if opts.Limit > 0 && int64(len(found)) > opts.Limit {
+		found = found[:opts.Limit]
+	}
+
+	slice := reflect.ValueOf(out).Elem()
+	result := reflect.MakeSlice(slice.Type(), 0, len(found))
+	for _, doc := range found {
+		item := reflect.New(slice.Type().Elem())
+		if err := fromDocument(doc, item.Interface()); err != nil {
+			return err
+		}
+		result = reflect.Append(result, item.Elem())
+	}
+	slice.Set(result)
+	return nil
+}
+
+// Count returns the number of documents matching filter
+func (s *MemoryStore) Count(collection string, filter bson.M) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, doc := range s.collections[collection] {
+		if matches(doc, filter) {
+			n++
+		}
+	}
+	return n
+}
+
+// CountDocuments implements Counter
+func (s *MemoryStore) CountDocuments(ctx context.Context, collection string, filter bson.M) (int64, error) {
+	return s.Count(collection, filter), nil
+}
+
+// UpdateOne applies update to the first document matching filter and
+// returns how many documents matched (0 or 1)
+func (s *MemoryStore) UpdateOne(collection string, filter, update bson.M) (int64, error) {
+	return s.update(collection, filter, update, false)
+}
+
+// UpdateMany applies update to every document matching filter
+func (s *MemoryStore) UpdateMany(collection string, filter, update bson.M) (int64, error) {
+	return s.update(collection, filter, update, true)
+}
+
+func (s *MemoryStore) update(collection string, filter, update bson.M, many bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched int64
+	for i, doc := range s.collections[collection] {
+		if !matches(doc, filter) {
+			continue
+		}
+		updated, err := applyUpdate(doc, update)
+		if err != nil {
+			return matched, err
+		}
+		s.collections[collection][i] = updated
+		matched++
+		if !many {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// ReplaceOne replaces the first document matching filter with doc, keeping
+// its _id, and returns how many documents matched
+func (s *MemoryStore) ReplaceOne(collection string, filter bson.M, doc interface{}) (int64, error) {
+	replacement, err := toDocument(doc)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.collections[collection] {
+		if matches(existing, filter) {
+			replacement["_id"] = existing["_id"]
+			s.collections[collection][i] = replacement
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// DeleteOne removes the first document matching filter and returns how many
+// documents were deleted
+func (s *MemoryStore) DeleteOne(collection string, filter bson.M) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs := s.collections[collection]
+	for i, doc := range docs {
+		if matches(doc, filter) {
+			s.collections[collection] = append(docs[:i:i], docs[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// WithTransaction implements Transactor. Transactions run one at a time and
+// every write made by fn is rolled back when it fails; writes made outside
+// a transaction meanwhile are rolled back with them.
+func (s *MemoryStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.tx.Lock()
+	defer s.tx.Unlock()
+	s.mu.Lock()
+	snapshot := make(map[string][]bson.M, len(s.collections))
+	for name, docs := range s.collections {
+		snapshot[name] = append([]bson.M(nil), docs...)
+	}
+	s.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		s.mu.Lock()
+		s.collections = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// toDocument converts any BSON-marshalable value into a fresh document
+func toDocument(v interface{}) (bson.M, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	if err := bson.UnmarshalWithRegistry(memoryRegistry, data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func fromDocument(doc bson.M, out interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, out)
+}
+
+// normalize gives v the type it would have once stored, e.g. time.Time
+// becomes primitive.DateTime and a struct becomes a bson.M
+func normalize(v interface{}) interface{} {
+	doc, err := toDocument(bson.M{"v": v})
+	if err != nil {
+		return v
+	}
+	return doc["v"]
+}
+
+// lookup resolves a dotted path such as "price_breakdown.currency". A path
+// through an array of documents, such as "lines.account", resolves to the
+// array of the values found in its elements.
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	return lookupParts(doc, strings.Split(path, "."))
+}
+
+func lookupParts(current interface{}, parts []string) (interface{}, bool) {
+	if len(parts) == 0 {
+		return current, true
+	}
+	switch v := current.(type) {
+	case bson.M:
+		next, ok := v[parts[0]]
+		if !ok {
+			return nil, false
+		}
+		return lookupParts(next, parts[1:])
+	case primitive.A:
+		var values primitive.A
+		for _, elem := range v {
+			if _, isDoc := elem.(bson.M); !isDoc {
+				continue
+			}
+			value, ok := lookupParts(elem, parts)
+			if !ok {
+				continue
+			}
+			if arr, isArr := value.(primitive.A); isArr {
+				values = append(values, arr...)
+			} else {
+				values = append(values, value)
+			}
+		}
+		return values, len(values) > 0
+	}
+	return nil, false
+}
+
+func matches(doc bson.M, filter bson.M) bool {
+	for key, cond := range filter {
+		if key == "$or" {
+			alternatives, _ := normalize(cond).(primitive.A)
+			matched := false
+			for _, alt := range alternatives {
+				if sub, ok := alt.(bson.M); ok && matches(doc, sub) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		value, exists := lookup(doc, key)
+		if !matchCondition(value, exists, cond) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchCondition(value interface{}, exists bool, cond interface{}) bool {
+	ops, isDoc := normalize(cond).(bson.M)
+	if !isDoc || !isOperatorDoc(ops) {
+		return valueEquals(value, exists, cond)
+	}
+	for op, arg := range ops {
+		switch op {
+		case "$ne":
+			if valueEquals(value, exists, arg) {
+				return false
+			}
+		case "$in", "$nin":
+			candidates, _ := arg.(primitive.A)
+			found := false
+			for _, candidate := range candidates {
+				if valueEquals(value, exists, candidate) {
+					found = true
+					break
+				}
+			}
+			if found != (op == "$in") {
+				return false
+			}
+		case "$exists":
+			if want, _ := arg.(bool); exists != want {
+				return false
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			if !exists {
+				return false
+			}
+			c := compare(value, arg)
+			if (op == "$gt" && c <= 0) || (op == "$gte" && c < 0) || (op == "$lt" && c >= 0) || (op == "$lte" && c > 0) {
+				return false
+			}
+		default:
+			panic(fmt.Sprintf("memory store: unsupported filter operator %s", op))
+		}
+	}
+	return true
+}
+
+func isOperatorDoc(m bson.M) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+// valueEquals is MongoDB equality: null matches missing fields and a scalar
+// matches an array containing it
+func valueEquals(value interface{}, exists bool, want interface{}) bool {
+	want = normalize(want)
+	if want == nil {
+		return !exists || value == nil
+	}
+	if !exists {
+		return false
+	}
+	if arr, ok := value.(primitive.A); ok {
+		if _, wantArr := want.(primitive.A); !wantArr {
+			for _, elem := range arr {
+				if equal(elem, want) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return equal(value, want)
+}
+
+func equal(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders two stored values of the same kind; missing values and
+// values of different kinds sort first
+func compare(a, b interface{}) int {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(x[:], y[:])
+		}
+	case primitive.DateTime:
+		if y, ok := b.(primitive.DateTime); ok {
+			return compare(int64(x), int64(y))
+		}
+	case bool:
+		if y, ok := b.(bool); ok && x != y {
+			if y {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// applyUpdate returns a copy of doc with the operators of update applied
+func applyUpdate(doc bson.M, update bson.M) (bson.M, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	updated := bson.M{}
+	if err := bson.UnmarshalWithRegistry(memoryRegistry, data, &updated); err != nil {
+		return nil, err
+	}
+	for op, arg := range update {
+		fields, ok := normalize(arg).(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("memory store: %s takes a document", op)
+		}
+		for path, value := range fields {
+			parent, key := parentOf(updated, path)
+			switch op {
+			case "$set":
+				parent[key] = value
+			case "$unset":
+				delete(parent, key)
+			case "$inc":
+				parent[key] = increment(parent[key], value)
+			case "$push":
+				current, exists := parent[key]
+				list, ok := current.(bson.A)
+				if exists && !ok {
+					return nil, fmt.Errorf("memory store: $push to %s, which is not an array", path)
+				}
+				parent[key] = append(append(bson.A{}, list...), value)
+			case "$addToSet":
+				list, err := arrayAt(parent, key, op, path)
+				if err != nil {
+					return nil, err
+				}
+				values := bson.A{value}
+				if each, ok := value.(bson.M); ok {
+					if values, ok = each["$each"].(bson.A); !ok {
+						return nil, fmt.Errorf("memory store: $addToSet to %s takes a value or $each", path)
+					}
+				}
+				list = append(bson.A{}, list...)
+				for _, v := range values {
+					if !containsEqual(list, v) {
+						list = append(list, v)
+					}
+				}
+				parent[key] = list
+			case "$pull":
+				list, err := arrayAt(parent, key, op, path)
+				if err != nil {
+					return nil, err
+				}
+				kept := bson.A{}
+				for _, v := range list {
+					if !equal(v, value) {
+						kept = append(kept, v)
+					}
+				}
+				parent[key] = kept
+			default:
+				return nil, fmt.Errorf("memory store: unsupported update operator %s", op)
+			}
+		}
+	}
+	return updated, nil
+}
+
+// arrayAt returns the array at key of parent, which may be missing
+func arrayAt(parent bson.M, key, op, path string) (bson.A, error) {
+	current, exists := parent[key]
+	list, ok := current.(bson.A)
+	if exists && current != nil && !ok {
+		return nil, fmt.Errorf("memory store: %s to %s, which is not an array", op, path)
+	}
+	return list, nil
+}
+
+func containsEqual(list bson.A, value interface{}) bool {
+	for _, v := range list {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentOf returns the document holding the last element of a dotted path,
+// creating the intermediate documents
+func parentOf(doc bson.M, path string) (bson.M, string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(bson.M)
+		if !ok {
+			next = bson.M{}
+			doc[part] = next
+		}
+		doc = next
+	}
+	return doc, parts[len(parts)-1]
+}
+
+func increment(current, by interface{}) interface{} {
+	switch c := current.(type) {
+	case int32:
+		if b, ok := by.(int32); ok {
+			return c + b
+		}
+	case int64:
+		if b, ok := toFloat(by); ok && b == float64(int64(b)) {
+			return c + int64(b)
+		}
+	case nil:
+		return by
+	}
+	a, _ := toFloat(current)
+	b, _ := toFloat(by)
+	return a + b
+}
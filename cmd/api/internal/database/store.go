@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs a function as a unit: either all of its writes are kept or none
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type mongoTransactor struct {
+	client *mongo.Client
+}
+
+// NewMongoTransactor runs functions in MongoDB transactions, which require a replica set
+func NewMongoTransactor(client *mongo.Client) Transactor {
+	return mongoTransactor{client: client}
+}
+
+func (t mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// Counter counts the documents of a collection that match a filter
+type Counter interface {
+	CountDocuments(ctx context.Context, collection string, filter bson.M) (int64, error)
+}
+
+type mongoCounter struct {
+	db *mongo.Database
+}
+
+func NewMongoCounter(db *mongo.Database) Counter {
+	return mongoCounter{db: db}
+}
+
+func (c mongoCounter) CountDocuments(ctx context.Context, collection string, filter bson.M) (int64, error) {
+	return c.db.Collection(collection).CountDocuments(ctx, filter)
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/render"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/services"
+	usermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreditNoteRequest represents the expected payload for crediting a refund
+// refund_id: a succeeded refund of the invoiced payment
+
+type CreditNoteRequest struct {
+	RefundID string `json:"refund_id" binding:"required"`
+}
+
+type InvoiceHandler struct {
+	service *services.InvoiceService
+}
+
+func NewInvoiceHandler(service *services.InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{service: service}
+}
+
+// GetOrderInvoice returns the invoice of a paid order as a PDF (default) or
+// HTML document. Only the client who paid and admins can see it.
+func (h *InvoiceHandler) GetOrderInvoice(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	format := c.DefaultQuery("format", "pdf")
+	if format != "pdf" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of pdf, html"})
+		return
+	}
+
+	invoice, err := h.service.ForOrder(orderID)
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotInvoiced) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No invoice for this order"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invoice"})
+		return
+	}
+	if invoice.UserID != userID && !middleware.HasPermission(c, usermodels.PermInvoicesRead) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No invoice for this order"})
+		return
+	}
+	writeDocument(c, invoice, format)
+}
+
+// List searches invoices and credit notes, newest first (paginated).
+// Filters: q (number, client name or email), kind, user_id, order_id and
+// from/to as YYYY-MM-DD, to inclusive.
+func (h *InvoiceHandler) List(c *gin.Context) {
+	page := 1
+	pageSize := 10
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	filter := services.Filter{Query: c.Query("q"), Kind: c.Query("kind")}
+	if filter.Kind != "" && filter.Kind != models.KindInvoice && filter.Kind != models.KindCreditNote {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be one of invoice, credit_note"})
+		return
+	}
+	for param, target := range map[string]**primitive.ObjectID{"user_id": &filter.UserID, "order_id": &filter.OrderID} {
+		if v := c.Query(param); v != "" {
+			id, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*target = &id
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date as YYYY-MM-DD"})
+			return
+		}
+		filter.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date as YYYY-MM-DD"})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	invoices, total, err := h.service.List(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"invoices":  invoices,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetByID returns an invoice or credit note as JSON (default), HTML or PDF
+func (h *InvoiceHandler) GetByID(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of json, pdf, html"})
+		return
+	}
+	invoice, err := h.service.GetByID(id)
+	if err != nil {
+		if errors.Is(err, services.ErrInvoiceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, invoice)
+		return
+	}
+	writeDocument(c, invoice, format)
+}
+
+// CreateCreditNote issues a credit note for a refund of the invoiced payment.
+// Repeating the request for the same refund returns the existing note.
+func (h *InvoiceHandler) CreateCreditNote(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var req CreditNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	refundID, err := primitive.ObjectIDFromHex(req.RefundID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund_id"})
+		return
+	}
+
+	note, created, err := h.service.IssueCreditNote(id, refundID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvoiceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		case errors.Is(err, services.ErrNotAnInvoice):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrRefundNotSettled):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue credit note"})
+		}
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, note)
+		return
+	}
+	c.JSON(http.StatusCreated, note)
+}
+
+// writeDocument renders the invoice in full before answering, so a rendering
+// failure can still be reported as an error
+func writeDocument(c *gin.Context, invoice *models.Invoice, format string) {
+	var buf bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	var err error
+	if format == "pdf" {
+		contentType = "application/pdf"
+		err = render.PDF(&buf, invoice)
+	} else {
+		err = render.HTML(&buf, invoice)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render invoice"})
+		return
+	}
+	if format == "pdf" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Number+".pdf"))
+	}
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	return principal.UserID, true
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Document kinds. Each kind is numbered in its own gapless yearly series.
+const (
+	KindInvoice    = "invoice"     // issued when an order is paid, e.g. INV-2025-000042
+	KindCreditNote = "credit_note" // issued for a refund of an invoiced order, e.g. CN-2025-000007
+)
+
+// Party is the seller or the client as printed on the document
+type Party struct {
+	Name       string `bson:"name" json:"name"`
+	Email      string `bson:"email,omitempty" json:"email,omitempty"`
+	Address    string `bson:"address,omitempty" json:"address,omitempty"`
+	UserNumber string `bson:"user_number,omitempty" json:"user_number,omitempty"`
+	Country    string `bson:"country,omitempty" json:"country,omitempty"`
+	VATID      string `bson:"vat_id,omitempty" json:"vat_id,omitempty"`
+}
+
+// Line is one billed item. Amounts are in major units, as on the order.
+type Line struct {
+	Code        string  `bson:"code" json:"code"`
+	Description string  `bson:"description" json:"description"`
+	Amount      float64 `bson:"amount" json:"amount"`
+}
+
+// Invoice is an immutable, numbered billing document (invoices collection).
+// Credit notes are stored alongside and point at the invoice they correct.
+// e.g., {"number": "INV-2025-000042", "kind": "invoice", "order_id": ObjectId, "subtotal": 50, "discount": 5, "tax": 0, "total": 45}
+type Invoice struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Number        string              `bson:"number" json:"number"`
+	Kind          string              `bson:"kind" json:"kind"`
+	Year          int                 `bson:"year" json:"year"`
+	Sequence      int64               `bson:"sequence" json:"sequence"`
+	OrderID       primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	OrderTitle    string              `bson:"order_title,omitempty" json:"order_title,omitempty"`
+	PaymentID     primitive.ObjectID  `bson:"payment_id" json:"payment_id"`
+	UserID        primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	InvoiceID     *primitive.ObjectID `bson:"invoice_id,omitempty" json:"invoice_id,omitempty"` // credit notes: the invoice credited
+	RefundID      *primitive.ObjectID `bson:"refund_id,omitempty" json:"refund_id,omitempty"`   // credit notes: the refund it documents
+	Reason        string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	Seller        Party               `bson:"seller" json:"seller"`
+	BillTo        Party               `bson:"bill_to" json:"bill_to"`
+	Currency      string              `bson:"currency" json:"currency"`
+	Lines         []Line              `bson:"lines" json:"lines"`
+	Subtotal      float64             `bson:"subtotal" json:"subtotal"`
+	Discount      float64             `bson:"discount,omitempty" json:"discount,omitempty"`
+	DiscountCode  string              `bson:"discount_code,omitempty" json:"discount_code,omitempty"`
+	Tax           float64             `bson:"tax" json:"tax"`
+	TaxName       string              `bson:"tax_name,omitempty" json:"tax_name,omitempty"`
+	TaxRate       float64             `bson:"tax_rate,omitempty" json:"tax_rate,omitempty"`
+	ReverseCharge bool                `bson:"reverse_charge,omitempty" json:"reverse_charge,omitempty"`
+	Total         float64             `bson:"total" json:"total"`
+	IssuedAt      time.Time           `bson:"issued_at" json:"issued_at"`
+}
@@ -0,0 +1,114 @@
+// Package render turns invoices and credit notes into documents clients can
+// keep: HTML through html/template and PDF written directly, so no external
+// tools or fonts are needed.
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money":         func(amount float64, currency string) string { return Money(amount, currency) },
+	"title":         Title,
+	"date":          func(inv *models.Invoice) string { return inv.IssuedAt.Format("2 January 2006") },
+	"tax":           TaxLabel,
+	"reverseCharge": func() string { return ReverseChargeNote },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{title .}} {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 760px; margin: 40px auto; }
+h1 { margin-bottom: 0; }
+.meta, .parties { margin: 24px 0; }
+.parties { display: flex; justify-content: space-between; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 6px 4px; border-bottom: 1px solid #ddd; text-align: left; }
+td.amount, th.amount { text-align: right; }
+tr.total td { font-weight: bold; border-bottom: none; }
+</style>
+</head>
+<body>
+<h1>{{title .}}</h1>
+<div class="meta">
+<div>Number: <strong>{{.Number}}</strong></div>
+<div>Date: {{date .}}</div>
+<div>Order: {{.OrderID.Hex}}{{if .OrderTitle}} ({{.OrderTitle}}){{end}}</div>
+{{- if .Reason}}
+<div>Reason: {{.Reason}}</div>
+{{- end}}
+</div>
+<div class="parties">
+<div>
+<strong>From</strong><br>
+{{.Seller.Name}}<br>
+{{- if .Seller.Address}}{{.Seller.Address}}<br>{{end}}
+{{- if .Seller.Country}}{{.Seller.Country}}<br>{{end}}
+{{- if .Seller.VATID}}VAT ID {{.Seller.VATID}}<br>{{end}}
+{{- if .Seller.Email}}{{.Seller.Email}}{{end}}
+</div>
+<div>
+<strong>Bill to</strong><br>
+{{.BillTo.Name}}<br>
+{{- if .BillTo.Address}}{{.BillTo.Address}}<br>{{end}}
+{{- if .BillTo.Country}}{{.BillTo.Country}}<br>{{end}}
+{{- if .BillTo.VATID}}VAT ID {{.BillTo.VATID}}<br>{{end}}
+{{- if .BillTo.Email}}{{.BillTo.Email}}<br>{{end}}
+{{- if .BillTo.UserNumber}}Client no. {{.BillTo.UserNumber}}{{end}}
+</div>
+</div>
+<table>
+<thead><tr><th>Description</th><th class="amount">Amount</th></tr></thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Description}}</td><td class="amount">{{money .Amount $.Currency}}</td></tr>
+{{- end}}
+<tr><td>Subtotal</td><td class="amount">{{money .Subtotal .Currency}}</td></tr>
+{{- if .Discount}}
+<tr><td>Discount{{if .DiscountCode}} ({{.DiscountCode}}){{end}}</td><td class="amount">-{{money .Discount .Currency}}</td></tr>
+{{- end}}
+<tr><td>{{tax .}}</td><td class="amount">{{money .Tax .Currency}}</td></tr>
+<tr class="total"><td>{{if eq .Kind "credit_note"}}Total credited{{else}}Total paid{{end}}</td><td class="amount">{{money .Total .Currency}}</td></tr>
+</tbody>
+</table>
+{{- if .ReverseCharge}}
+<p>{{reverseCharge}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML writes the document as a standalone HTML page
+func HTML(w io.Writer, invoice *models.Invoice) error {
+	return htmlTemplate.Execute(w, invoice)
+}
+
+// Title is the heading of the document
+func Title(invoice *models.Invoice) string {
+	if invoice.Kind == models.KindCreditNote {
+		return "Credit note"
+	}
+	return "Invoice"
+}
+
+// ReverseChargeNote is printed on documents of reverse charged orders
+const ReverseChargeNote = "Reverse charge: VAT to be accounted for by the recipient."
+
+// TaxLabel names the tax line, e.g. "VAT 20%"
+func TaxLabel(invoice *models.Invoice) string {
+	if invoice.TaxName == "" {
+		return "Tax"
+	}
+	return fmt.Sprintf("%s %.4g%%", invoice.TaxName, invoice.TaxRate)
+}
+
+// Money formats an amount in major units with its currency
+func Money(amount float64, currency string) string {
+	return money.FromMajor(amount, currency).String()
+}
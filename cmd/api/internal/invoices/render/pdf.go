@@ -0,0 +1,215 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+)
+
+// A4 in PDF points, and the margins the layout keeps
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	marginLeft   = 50
+	marginRight  = 545
+	marginTop    = 790
+	marginBottom = 60
+)
+
+// Fonts are the PDF standard fonts every viewer ships, so nothing is embedded.
+// Amounts use the monospaced Courier so they can be right aligned without
+// font metrics.
+const (
+	fontRegular = "F1" // Helvetica
+	fontBold    = "F2" // Helvetica-Bold
+	fontMono    = "F3" // Courier
+)
+
+// PDF writes the document as a single or multi page A4 PDF
+func PDF(w io.Writer, invoice *models.Invoice) error {
+	l := &layout{y: marginTop}
+	l.newPage()
+
+	l.text(marginLeft, fontBold, 20, Title(invoice))
+	l.y -= 14
+	l.text(marginLeft, fontRegular, 10, "Number: "+invoice.Number)
+	l.text(marginLeft, fontRegular, 10, "Date: "+invoice.IssuedAt.Format("2 January 2006"))
+	order := "Order: " + invoice.OrderID.Hex()
+	if invoice.OrderTitle != "" {
+		order += " (" + invoice.OrderTitle + ")"
+	}
+	l.text(marginLeft, fontRegular, 10, order)
+	if invoice.Reason != "" {
+		l.text(marginLeft, fontRegular, 10, "Reason: "+invoice.Reason)
+	}
+
+	l.y -= 14
+	l.text(marginLeft, fontBold, 10, "From")
+	for _, line := range partyLines(invoice.Seller, "") {
+		l.text(marginLeft, fontRegular, 10, line)
+	}
+	l.y -= 8
+	l.text(marginLeft, fontBold, 10, "Bill to")
+	for _, line := range partyLines(invoice.BillTo, "Client no. ") {
+		l.text(marginLeft, fontRegular, 10, line)
+	}
+
+	l.y -= 14
+	l.row(fontBold, "Description", "Amount")
+	l.rule()
+	for _, line := range invoice.Lines {
+		l.row(fontRegular, line.Description, Money(line.Amount, invoice.Currency))
+	}
+	l.rule()
+	l.row(fontRegular, "Subtotal", Money(invoice.Subtotal, invoice.Currency))
+	if invoice.Discount != 0 {
+		label := "Discount"
+		if invoice.DiscountCode != "" {
+			label += " (" + invoice.DiscountCode + ")"
+		}
+		l.row(fontRegular, label, "-"+Money(invoice.Discount, invoice.Currency))
+	}
+	l.row(fontRegular, TaxLabel(invoice), Money(invoice.Tax, invoice.Currency))
+	total := "Total paid"
+	if invoice.Kind == models.KindCreditNote {
+		total = "Total credited"
+	}
+	l.row(fontBold, total, Money(invoice.Total, invoice.Currency))
+	if invoice.ReverseCharge {
+		l.y -= 14
+		l.text(marginLeft, fontRegular, 10, ReverseChargeNote)
+	}
+
+	return writePDF(w, l.pages)
+}
+
+func partyLines(p models.Party, numberLabel string) []string {
+	lines := []string{p.Name}
+	for _, line := range strings.Split(p.Address, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	if p.Country != "" {
+		lines = append(lines, p.Country)
+	}
+	if p.VATID != "" {
+		lines = append(lines, "VAT ID "+p.VATID)
+	}
+	if p.Email != "" {
+		lines = append(lines, p.Email)
+	}
+	if p.UserNumber != "" && numberLabel != "" {
+		lines = append(lines, numberLabel+p.UserNumber)
+	}
+	return lines
+}
+
+// layout places text top to bottom, starting a new page when one is full.
+// Each page is its PDF content stream.
+type layout struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (l *layout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.y = marginTop
+}
+
+func (l *layout) advance(size float64) *bytes.Buffer {
+	if l.y-size < marginBottom {
+		l.newPage()
+	}
+	l.y -= size * 1.4
+	return l.pages[len(l.pages)-1]
+}
+
+func (l *layout) text(x float64, font string, size float64, s string) {
+	page := l.advance(size)
+	fmt.Fprintf(page, "BT /%s %.0f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, l.y, escape(s))
+}
+
+// row prints a description and an amount right aligned at the margin
+func (l *layout) row(font, description, amount string) {
+	const size = 10
+	page := l.advance(size)
+	fmt.Fprintf(page, "BT /%s %d Tf %d %.2f Td (%s) Tj ET\n", font, size, marginLeft, l.y, escape(truncate(description, 70)))
+	// Courier glyphs are 0.6 em wide
+	x := marginRight - float64(len([]rune(amount)))*0.6*size
+	fmt.Fprintf(page, "BT /%s %d Tf %.2f %.2f Td (%s) Tj ET\n", fontMono, size, x, l.y, escape(amount))
+}
+
+func (l *layout) rule() {
+	page := l.advance(4)
+	fmt.Fprintf(page, "0.5 w %d %.2f m %d %.2f l S\n", marginLeft, l.y, marginRight, l.y)
+}
+
+// writePDF assembles the objects, the cross-reference table and the trailer.
+// Objects 1-5 are the catalog, the page tree and the fonts; every page adds
+// a page object and its content stream.
+func writePDF(w io.Writer, pages []*bytes.Buffer) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, content := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, fontMono, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// escape encodes s as the body of a PDF string in WinAnsiEncoding. Latin-1
+// characters map to themselves; anything else becomes "?".
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testInvoice() *models.Invoice {
+	return &models.Invoice{
+		ID:         primitive.NewObjectID(),
+		Number:     "INV-2026-000042",
+		Kind:       models.KindInvoice,
+		OrderID:    primitive.NewObjectID(),
+		OrderTitle: "Essay (second draft)",
+		Seller:     models.Party{Name: "Treasure Shop", Address: "1 Market St\nLondon", Country: "GB", VATID: "GB123456789"},
+		BillTo:     models.Party{Name: "Zoë Müller", Email: "zoe@example.com", UserNumber: "C-1001"},
+		Currency:   "USD",
+		Lines:      []models.Line{{Code: "pages", Description: "3 pages", Amount: 41.67}},
+		Subtotal:   41.67,
+		Tax:        8.33,
+		TaxName:    "VAT",
+		TaxRate:    20,
+		Total:      50,
+		IssuedAt:   time.Date(2026, time.March, 14, 9, 30, 0, 0, time.UTC),
+	}
+}
+
+// checkPDF checks the structure of a PDF written by writePDF: the header, an
+// xref entry pointing at each object and the trailer. It returns the number
+// of pages.
+func checkPDF(t *testing.T, pdf []byte) int {
+	t.Helper()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF: %.40q ... %q", pdf, pdf[max(0, len(pdf)-20):])
+	}
+	start := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if start == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(start[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, m := range offsets {
+		offset, _ := strconv.Atoi(string(m[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %.12q, want %q", i+1, pdf[offset:], want)
+		}
+	}
+	if want := fmt.Sprintf("/Size %d ", len(offsets)+1); !bytes.Contains(pdf, []byte(want)) {
+		t.Errorf("trailer does not say %q", want)
+	}
+	count := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(pdf)
+	if count == nil {
+		t.Fatal("no page count")
+	}
+	pages, _ := strconv.Atoi(string(count[1]))
+	if n := bytes.Count(pdf, []byte("/Type /Page ")); n != pages {
+		t.Errorf("%d page objects, page tree counts %d", n, pages)
+	}
+	return pages
+}
+
+func TestPDF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := PDF(&buf, testInvoice()); err != nil {
+		t.Fatal(err)
+	}
+	if pages := checkPDF(t, buf.Bytes()); pages != 1 {
+		t.Errorf("invoice has %d pages, want 1", pages)
+	}
+	pdf := buf.String()
+	for _, want := range []string{
+		"(Invoice)",
+		"(Number: INV-2026-000042)",
+		"(Date: 14 March 2026)",
+		`(Essay \(second draft\)\))`, // parentheses escaped
+		`(Zo\353 M\374ller)`,         // Latin-1 as octal escapes
+		"(London)",
+		"(Client no. C-1001)",
+		"(VAT 20%)",
+		"(" + Money(8.33, "USD") + ")",
+		"(Total paid)",
+		"(" + Money(50, "USD") + ")",
+	} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF does not show %s", want)
+		}
+	}
+}
+
+func TestPDFCreditNote(t *testing.T) {
+	note := testInvoice()
+	note.Kind = models.KindCreditNote
+	note.Number = "CN-2026-000007"
+	note.Reason = "quality_issue"
+	note.ReverseCharge = true
+	var buf bytes.Buffer
+	if err := PDF(&buf, note); err != nil {
+		t.Fatal(err)
+	}
+	checkPDF(t, buf.Bytes())
+	for _, want := range []string{"(Credit note)", "(Number: CN-2026-000007)", "(Reason: quality_issue)", "(Total credited)", "(" + ReverseChargeNote + ")"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("credit note does not show %s", want)
+		}
+	}
+}
+
+func TestPDFBreaksPages(t *testing.T) {
+	invoice := testInvoice()
+	invoice.Lines = nil
+	for i := 0; i < 80; i++ {
+		invoice.Lines = append(invoice.Lines, models.Line{Code: "extra", Description: fmt.Sprintf("Extra %d", i), Amount: 1})
+	}
+	var buf bytes.Buffer
+	if err := PDF(&buf, invoice); err != nil {
+		t.Fatal(err)
+	}
+	if pages := checkPDF(t, buf.Bytes()); pages < 2 {
+		t.Errorf("invoice of 80 lines has %d page, want more", pages)
+	}
+	if !strings.Contains(buf.String(), "(Extra 79)") {
+		t.Error("last line is missing")
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryInvoiceRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryInvoiceRepository keeps invoices and credit notes in store, for tests
+func NewMemoryInvoiceRepository(store *database.MemoryStore) InvoiceRepository {
+	return &memoryInvoiceRepository{store: store}
+}
+
+func (r *memoryInvoiceRepository) Insert(ctx context.Context, invoice *models.Invoice) error {
+	return r.store.Insert("invoices", invoice)
+}
+
+func (r *memoryInvoiceRepository) FindOne(ctx context.Context, filter bson.M) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := r.store.FindOne("invoices", filter, &invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (r *memoryInvoiceRepository) Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.Invoice, error) {
+	invoices := []models.Invoice{}
+	findOpts := database.FindOptions{Sort: newestFirst, Skip: opts.Skip, Limit: opts.Limit}
+	err := r.store.Find("invoices", filter, findOpts, &invoices)
+	return invoices, err
+}
+
+func (r *memoryInvoiceRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.store.Count("invoices", filter), nil
+}
+
+func (r *memoryInvoiceRepository) InvoicedOrders(ctx context.Context) ([]primitive.ObjectID, error) {
+	invoices := []models.Invoice{}
+	if err := r.store.Find("invoices", invoicesOnly, database.FindOptions{}, &invoices); err != nil {
+		return nil, err
+	}
+	seen := map[primitive.ObjectID]bool{}
+	ids := []primitive.ObjectID{}
+	for _, invoice := range invoices {
+		if !seen[invoice.OrderID] {
+			seen[invoice.OrderID] = true
+			ids = append(ids, invoice.OrderID)
+		}
+	}
+	return ids, nil
+}
+
+type memoryCounterRepository struct {
+	store *database.MemoryStore
+	// mu makes each increment and the read of its result one step, like
+	// FindOneAndUpdate
+	mu sync.Mutex
+}
+
+// NewMemoryCounterRepository keeps counters in store, for tests
+func NewMemoryCounterRepository(store *database.MemoryStore) CounterRepository {
+	return &memoryCounterRepository{store: store}
+}
+
+func (r *memoryCounterRepository) Next(ctx context.Context, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matched, err := r.store.UpdateOne("counters", bson.M{"_id": key}, bson.M{"$inc": bson.M{"seq": 1}})
+	if err != nil {
+		return 0, err
+	}
+	if matched == 0 {
+		if err := r.store.Insert("counters", bson.M{"_id": key, "seq": int64(1)}); err != nil {
+			return 0, err
+		}
+	}
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	if err := r.store.FindOne("counters", bson.M{"_id": key}, &counter); err != nil {
+		return 0, err
+	}
+	return counter.Seq, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoInvoiceRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoInvoiceRepository(db *mongo.Database) InvoiceRepository {
+	return &mongoInvoiceRepository{col: db.Collection("invoices")}
+}
+
+func (r *mongoInvoiceRepository) Insert(ctx context.Context, invoice *models.Invoice) error {
+	_, err := r.col.InsertOne(ctx, invoice)
+	return err
+}
+
+func (r *mongoInvoiceRepository) FindOne(ctx context.Context, filter bson.M) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := r.col.FindOne(ctx, filter).Decode(&invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (r *mongoInvoiceRepository) Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.Invoice, error) {
+	findOpts := options.Find().SetSort(newestFirst)
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	cur, err := r.col.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	invoices := []models.Invoice{}
+	if err := cur.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
+
+func (r *mongoInvoiceRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.col.CountDocuments(ctx, filter)
+}
+
+func (r *mongoInvoiceRepository) InvoicedOrders(ctx context.Context) ([]primitive.ObjectID, error) {
+	values, err := r.col.Distinct(ctx, "order_id", invoicesOnly)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+type mongoCounterRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoCounterRepository(db *mongo.Database) CounterRepository {
+	return &mongoCounterRepository{col: db.Collection("counters")}
+}
+
+func (r *mongoCounterRepository) Next(ctx context.Context, key string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := r.col.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Seq, nil
+}
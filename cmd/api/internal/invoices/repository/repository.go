@@ -0,0 +1,44 @@
+// Package repository stores invoices, credit notes and the counters that
+// number them. The MongoDB implementations are used by the API and the
+// in-memory ones by tests; a missing document gives mongo.ErrNoDocuments
+// from both.
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindOptions pages a listing of documents, newest first; a zero Limit
+// returns every document
+type FindOptions struct {
+	Skip  int64
+	Limit int64
+}
+
+// InvoiceRepository stores the invoices collection, which holds both kinds
+// of document. Documents are only ever inserted.
+type InvoiceRepository interface {
+	Insert(ctx context.Context, invoice *models.Invoice) error
+	FindOne(ctx context.Context, filter bson.M) (*models.Invoice, error)
+	Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.Invoice, error)
+	Count(ctx context.Context, filter bson.M) (int64, error)
+	// InvoicedOrders returns the IDs of the orders that have an invoice
+	InvoicedOrders(ctx context.Context) ([]primitive.ObjectID, error)
+}
+
+// CounterRepository stores the counters collection
+type CounterRepository interface {
+	// Next increments the counter named key, starting it at 1, and returns
+	// its new value
+	Next(ctx context.Context, key string) (int64, error)
+}
+
+// newestFirst orders documents issued in the same instant by insertion
+var newestFirst = bson.D{{Key: "issued_at", Value: -1}, {Key: "_id", Value: -1}}
+
+// invoicesOnly matches invoices, leaving out credit notes
+var invoicesOnly = bson.M{"kind": models.KindInvoice}
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	invoicerepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	orderrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	paymentmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	paymentrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/repository"
+	taxmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+	userrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvoiceNotFound  = errors.New("invoice not found")
+	ErrOrderNotInvoiced = errors.New("order has not been paid")
+	ErrNotAnInvoice     = errors.New("credit notes can only be issued against invoices")
+	ErrRefundNotSettled = errors.New("refund not found on the invoiced payment or not succeeded yet")
+)
+
+// numberPrefixes start the document numbers of each kind
+var numberPrefixes = map[string]string{
+	models.KindInvoice:    "INV",
+	models.KindCreditNote: "CN",
+}
+
+// capturedStatuses are the payment statuses of a payment that took the client's money
+var capturedStatuses = []string{
+	paymentmodels.PaymentStatusCaptured, paymentmodels.PaymentStatusPartiallyRefunded,
+	paymentmodels.PaymentStatusRefunded, paymentmodels.PaymentStatusDisputed,
+}
+
+// Filter narrows an invoice search. Query matches the number, the client's
+// name or email; zero fields are ignored.
+type Filter struct {
+	Query   string
+	Kind    string
+	UserID  *primitive.ObjectID
+	OrderID *primitive.ObjectID
+	From    *time.Time
+	To      *time.Time
+}
+
+// InvoiceService issues invoices and credit notes. Numbers come from a
+// counter per kind and year that is incremented in the same transaction as
+// the insert, so an aborted transaction gives its number back and the series
+// has no gaps.
+type InvoiceService struct {
+	invoices invoicerepository.InvoiceRepository
+	counters invoicerepository.CounterRepository
+	orders   orderrepository.OrderRepository
+	users    userrepository.UserRepository
+	payments paymentrepository.PaymentRepository
+	tx       database.Transactor
+	seller   models.Party
+}
+
+// InvoiceServiceDeps are the stores an InvoiceService works with; see
+// NewInvoiceServiceWith
+type InvoiceServiceDeps struct {
+	Invoices   invoicerepository.InvoiceRepository
+	Counters   invoicerepository.CounterRepository
+	Orders     orderrepository.OrderRepository
+	Users      userrepository.UserRepository
+	Payments   paymentrepository.PaymentRepository
+	Transactor database.Transactor
+}
+
+func NewInvoiceService(db *mongo.Database) *InvoiceService {
+	return NewInvoiceServiceWith(InvoiceServiceDeps{
+		Invoices:   invoicerepository.NewMongoInvoiceRepository(db),
+		Counters:   invoicerepository.NewMongoCounterRepository(db),
+		Orders:     orderrepository.NewMongoOrderRepository(db),
+		Users:      userrepository.NewMongoUserRepository(db),
+		Payments:   paymentrepository.NewMongoPaymentRepository(db),
+		Transactor: database.NewMongoTransactor(db.Client()),
+	})
+}
+
+// NewInvoiceServiceWith builds the service on deps, e.g. in-memory stores in
+// tests. The seller is read from the environment.
+func NewInvoiceServiceWith(deps InvoiceServiceDeps) *InvoiceService {
+	seller := models.Party{
+		Name:    os.Getenv("INVOICE_SELLER_NAME"),
+		Email:   os.Getenv("INVOICE_SELLER_EMAIL"),
+		Address: os.Getenv("INVOICE_SELLER_ADDRESS"),
+		Country: strings.ToUpper(os.Getenv("TAX_HOME_COUNTRY")),
+		VATID:   os.Getenv("INVOICE_SELLER_VAT_ID"),
+	}
+	if seller.Name == "" {
+		seller.Name = "Treasure Shop"
+	}
+	return &InvoiceService{
+		invoices: deps.Invoices,
+		counters: deps.Counters,
+		orders:   deps.Orders,
+		users:    deps.Users,
+		payments: deps.Payments,
+		tx:       deps.Transactor,
+		seller:   seller,
+	}
+}
+
+// Issue creates the invoice for a captured payment, or returns the one issued
+// for it before. Run it inside the transaction that records the capture.
+func (s *InvoiceService) Issue(ctx context.Context, payment *paymentmodels.Payment) (*models.Invoice, error) {
+	return s.issue(ctx, payment, time.Now())
+}
+
+// issue is Issue dated issuedAt, which also picks the year the invoice is
+// numbered in
+func (s *InvoiceService) issue(ctx context.Context, payment *paymentmodels.Payment, issuedAt time.Time) (*models.Invoice, error) {
+	existing, err := s.invoices.FindOne(ctx, bson.M{"order_id": payment.OrderID, "kind": models.KindInvoice, "payment_id": payment.ID})
+	if err == nil {
+		return existing, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	order, err := s.orders.FindOne(ctx, bson.M{"_id": payment.OrderID})
+	if err != nil {
+		return nil, err
+	}
+	billTo, err := s.billTo(ctx, payment.UserID, order.Billing)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &models.Invoice{
+		ID:         primitive.NewObjectID(),
+		Kind:       models.KindInvoice,
+		OrderID:    payment.OrderID,
+		OrderTitle: order.Title,
+		PaymentID:  payment.ID,
+		UserID:     payment.UserID,
+		Seller:     s.seller,
+		BillTo:     billTo,
+		Currency:   payment.Currency,
+		Total:      payment.Amount,
+		IssuedAt:   issuedAt,
+	}
+	breakdown := order.PriceBreakdown
+	if breakdown != nil && sameAmount(breakdown.Total, payment.Amount, payment.Currency) {
+		for _, item := range breakdown.Items {
+			if item.Code == "discount" || item.Code == "tax" {
+				continue
+			}
+			invoice.Lines = append(invoice.Lines, models.Line{Code: item.Code, Description: item.Description, Amount: item.Amount})
+			invoice.Subtotal += item.Amount
+		}
+		if breakdown.Promotion != nil {
+			invoice.Discount = breakdown.Promotion.Amount
+			invoice.DiscountCode = breakdown.Promotion.Code
+		}
+		if breakdown.Tax != nil {
+			invoice.Tax = breakdown.Tax.Amount
+			invoice.TaxName = breakdown.Tax.Name
+			invoice.TaxRate = breakdown.Tax.Rate
+			invoice.ReverseCharge = breakdown.Tax.ReverseCharge
+		}
+	} else {
+		// Orders priced before itemized quotes, or paid a different amount
+		invoice.Tax = payment.Tax
+		invoice.Lines = []models.Line{{Code: "order", Description: "Order: " + order.Title, Amount: payment.Amount - payment.Tax}}
+		invoice.Subtotal = payment.Amount - payment.Tax
+	}
+	invoice.Subtotal = money.Round(invoice.Subtotal, invoice.Currency)
+
+	if err := s.number(ctx, invoice); err != nil {
+		return nil, err
+	}
+	if err := s.invoices.Insert(ctx, invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// ForOrder returns the order's newest invoice; an order paid again after its
+// capture was reversed has one per payment. Orders paid before invoicing
+// existed get theirs from BackfillInvoices at startup.
+func (s *InvoiceService) ForOrder(orderID primitive.ObjectID) (*models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	invoices, err := s.invoices.Find(ctx, bson.M{"order_id": orderID, "kind": models.KindInvoice}, invoicerepository.FindOptions{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(invoices) == 0 {
+		return nil, ErrOrderNotInvoiced
+	}
+	return &invoices[0], nil
+}
+
+// BackfillInvoices issues the invoices of orders paid before invoicing
+// existed, oldest payment first. Each is dated as of the payment that paid
+// the order, so it joins the series of the year the client paid. Returns how
+// many were issued.
+func (s *InvoiceService) BackfillInvoices() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	invoiced, err := s.invoices.InvoicedOrders(ctx)
+	if err != nil {
+		return 0, err
+	}
+	payments, err := s.payments.Find(ctx, bson.M{
+		"status":   bson.M{"$in": capturedStatuses},
+		"order_id": bson.M{"$nin": invoiced},
+	})
+	if err != nil {
+		return 0, err
+	}
+	// An order paid more than once is invoiced for its newest captured payment
+	latest := map[primitive.ObjectID]int{}
+	for i, payment := range payments {
+		latest[payment.OrderID] = i
+	}
+	var issued int64
+	for i := range payments {
+		payment := &payments[i]
+		if latest[payment.OrderID] != i {
+			continue
+		}
+		err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			_, err := s.issue(ctx, payment, payment.CreatedAt)
+			return err
+		})
+		if err != nil {
+			return issued, fmt.Errorf("invoicing order %s: %w", payment.OrderID.Hex(), err)
+		}
+		issued++
+	}
+	return issued, nil
+}
+
+// IssueCreditNote documents a succeeded refund of an invoiced payment. Each
+// refund gets at most one credit note; asking again returns it with created=false.
+func (s *InvoiceService) IssueCreditNote(invoiceID, refundID primitive.ObjectID) (note *models.Invoice, created bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		invoice, err := s.invoices.FindOne(ctx, bson.M{"_id": invoiceID})
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrInvoiceNotFound
+			}
+			return err
+		}
+		if invoice.Kind != models.KindInvoice {
+			return ErrNotAnInvoice
+		}
+		existing, err := s.invoices.FindOne(ctx, bson.M{"kind": models.KindCreditNote, "refund_id": refundID})
+		if err == nil {
+			note, created = existing, false
+			return nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		refund, err := s.settledRefund(ctx, invoice.PaymentID, refundID)
+		if err != nil {
+			return err
+		}
+		n := s.creditNote(invoice, refund.Reason, "refund", fmt.Sprintf("Refund against invoice %s (%s)", invoice.Number, refund.Reason), refund.Amount, refund.Tax)
+		n.RefundID = &refund.ID
+		if err := s.number(ctx, n); err != nil {
+			return err
+		}
+		if err := s.invoices.Insert(ctx, n); err != nil {
+			return err
+		}
+		note, created = n, true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return note, created, nil
+}
+
+// CreditInvoice cancels the invoice of a payment whose capture the provider
+// reversed with a credit note for all of it, or returns the one issued
+// before. A payment that was never invoiced gives nil. Run it inside the
+// transaction that records the reversal.
+func (s *InvoiceService) CreditInvoice(ctx context.Context, payment *paymentmodels.Payment, reason string) (*models.Invoice, error) {
+	invoice, err := s.invoices.FindOne(ctx, bson.M{"kind": models.KindInvoice, "payment_id": payment.ID})
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.invoices.FindOne(ctx, bson.M{"kind": models.KindCreditNote, "invoice_id": invoice.ID, "refund_id": bson.M{"$exists": false}})
+	if err == nil {
+		return existing, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	note := s.creditNote(invoice, reason, "cancellation", fmt.Sprintf("Cancels invoice %s (%s)", invoice.Number, reason), invoice.Total, invoice.Tax)
+	if err := s.number(ctx, note); err != nil {
+		return nil, err
+	}
+	if err := s.invoices.Insert(ctx, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// creditNote drafts a credit note of total, tax included, against invoice
+func (s *InvoiceService) creditNote(invoice *models.Invoice, reason, code, description string, total, tax float64) *models.Invoice {
+	return &models.Invoice{
+		ID:         primitive.NewObjectID(),
+		Kind:       models.KindCreditNote,
+		OrderID:    invoice.OrderID,
+		OrderTitle: invoice.OrderTitle,
+		PaymentID:  invoice.PaymentID,
+		UserID:     invoice.UserID,
+		InvoiceID:  &invoice.ID,
+		Reason:     reason,
+		Seller:     s.seller,
+		BillTo:     invoice.BillTo,
+		Currency:   invoice.Currency,
+		Lines: []models.Line{{
+			Code:        code,
+			Description: description,
+			Amount:      money.Round(total-tax, invoice.Currency),
+		}},
+		Subtotal:      money.Round(total-tax, invoice.Currency),
+		Tax:           tax,
+		TaxName:       invoice.TaxName,
+		TaxRate:       invoice.TaxRate,
+		ReverseCharge: invoice.ReverseCharge,
+		Total:         total,
+		IssuedAt:      time.Now(),
+	}
+}
+
+func (s *InvoiceService) GetByID(id primitive.ObjectID) (*models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	invoice, err := s.invoices.FindOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// List searches invoices and credit notes, newest first
+func (s *InvoiceService) List(f Filter, page, pageSize int) ([]models.Invoice, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{}
+	if q := strings.TrimSpace(f.Query); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"number": pattern},
+			bson.M{"bill_to.name": pattern},
+			bson.M{"bill_to.email": pattern},
+		}
+	}
+	if f.Kind != "" {
+		filter["kind"] = f.Kind
+	}
+	if f.UserID != nil {
+		filter["user_id"] = *f.UserID
+	}
+	if f.OrderID != nil {
+		filter["order_id"] = *f.OrderID
+	}
+	if f.From != nil || f.To != nil {
+		issued := bson.M{}
+		if f.From != nil {
+			issued["$gte"] = *f.From
+		}
+		if f.To != nil {
+			issued["$lt"] = *f.To
+		}
+		filter["issued_at"] = issued
+	}
+
+	total, err := s.invoices.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	invoices, err := s.invoices.Find(ctx, filter, invoicerepository.FindOptions{
+		Skip:  int64((page - 1) * pageSize),
+		Limit: int64(pageSize),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return invoices, total, nil
+}
+
+// number takes the next number of the document's kind for the year it is issued in
+func (s *InvoiceService) number(ctx context.Context, invoice *models.Invoice) error {
+	year := invoice.IssuedAt.Year()
+	seq, err := s.counters.Next(ctx, fmt.Sprintf("%s:%d", invoice.Kind, year))
+	if err != nil {
+		return err
+	}
+	invoice.Year = year
+	invoice.Sequence = seq
+	invoice.Number = fmt.Sprintf("%s-%d-%06d", numberPrefixes[invoice.Kind], year, seq)
+	return nil
+}
+
+// billTo is the client as billed on the order, falling back to their account
+func (s *InvoiceService) billTo(ctx context.Context, userID primitive.ObjectID, billing *taxmodels.Billing) (models.Party, error) {
+	var party models.Party
+	user, err := s.users.FindByID(ctx, userID)
+	switch {
+	case err == nil:
+		party = models.Party{
+			Name:       strings.TrimSpace(user.FirstName + " " + user.LastName),
+			Email:      user.Email,
+			UserNumber: user.UserNumber,
+		}
+	case err == mongo.ErrNoDocuments:
+		party = models.Party{Name: userID.Hex()}
+	default:
+		return models.Party{}, err
+	}
+	if billing != nil {
+		if billing.Company != "" {
+			party.Name = billing.Company
+		}
+		party.Address = billing.Address
+		party.Country = billing.Country
+		party.VATID = billing.VATID
+	}
+	return party, nil
+}
+
+func (s *InvoiceService) settledRefund(ctx context.Context, paymentID, refundID primitive.ObjectID) (*paymentmodels.Refund, error) {
+	payment, err := s.payments.FindByID(ctx, paymentID)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRefundNotSettled
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range payment.Refunds {
+		if payment.Refunds[i].ID == refundID && payment.Refunds[i].Status == paymentmodels.RefundStatusSucceeded {
+			return &payment.Refunds[i], nil
+		}
+	}
+	return nil, ErrRefundNotSettled
+}
+
+func sameAmount(a, b float64, currency string) bool {
+	return money.ToMinor(a, currency) == money.ToMinor(b, currency)
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	invoicerepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/repository"
+	ordermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	orderrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	paymentmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	paymentrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/repository"
+	pricingmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	taxmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+	usermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	userrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fixture struct {
+	store    *database.MemoryStore
+	s        *InvoiceService
+	orders   orderrepository.OrderRepository
+	payments paymentrepository.PaymentRepository
+	client   primitive.ObjectID
+}
+
+func newInvoices(t *testing.T) *fixture {
+	t.Helper()
+	store := database.NewMemoryStore()
+	f := &fixture{
+		store:    store,
+		orders:   orderrepository.NewMemoryOrderRepository(store),
+		payments: paymentrepository.NewMemoryPaymentRepository(store),
+		client:   primitive.NewObjectID(),
+	}
+	users := userrepository.NewMemoryUserRepository(store)
+	f.s = NewInvoiceServiceWith(InvoiceServiceDeps{
+		Invoices:   invoicerepository.NewMemoryInvoiceRepository(store),
+		Counters:   invoicerepository.NewMemoryCounterRepository(store),
+		Orders:     f.orders,
+		Users:      users,
+		Payments:   f.payments,
+		Transactor: store,
+	})
+	user := &usermodels.User{ID: f.client, FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", UserNumber: "C-1001"}
+	if err := users.Insert(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// paidOrder stores an order priced at $50, $8.33 of it tax, and its captured
+// payment made at paidAt, to the millisecond like MongoDB keeps it
+func (f *fixture) paidOrder(t *testing.T, paidAt time.Time) *paymentmodels.Payment {
+	t.Helper()
+	ctx := context.Background()
+	paidAt = paidAt.Truncate(time.Millisecond)
+	order := &ordermodels.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: f.client,
+		Title:  "Essay on the Analytical Engine",
+		PriceBreakdown: &pricingmodels.PriceBreakdown{
+			Items: []pricingmodels.LineItem{
+				{Code: "pages", Description: "3 pages", Amount: 41.67},
+				{Code: "tax", Description: "VAT 20%", Amount: 8.33},
+			},
+			Tax:      &taxmodels.AppliedTax{Country: "GB", Name: "VAT", Rate: 20, Taxable: 41.67, Amount: 8.33},
+			Total:    50,
+			Currency: "USD",
+		},
+	}
+	if err := f.orders.Insert(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	payment := &paymentmodels.Payment{
+		ID:        primitive.NewObjectID(),
+		OrderID:   order.ID,
+		UserID:    f.client,
+		Method:    "simulator",
+		Status:    paymentmodels.PaymentStatusCaptured,
+		Amount:    50,
+		Tax:       8.33,
+		Currency:  "USD",
+		CreatedAt: paidAt,
+		UpdatedAt: paidAt,
+	}
+	if err := f.payments.Insert(ctx, payment); err != nil {
+		t.Fatal(err)
+	}
+	return payment
+}
+
+// issue issues the invoice of payment in a transaction, like the capture does
+func (f *fixture) issue(t *testing.T, payment *paymentmodels.Payment) *models.Invoice {
+	t.Helper()
+	var invoice *models.Invoice
+	err := f.store.WithTransaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		invoice, err = f.s.Issue(ctx, payment)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invoice
+}
+
+func TestInvoiceNumbersAreSequentialWithinAYear(t *testing.T) {
+	f := newInvoices(t)
+	year := time.Now().Year()
+	for i := 1; i <= 3; i++ {
+		invoice := f.issue(t, f.paidOrder(t, time.Now()))
+		want := fmt.Sprintf("INV-%d-%06d", year, i)
+		if invoice.Number != want || invoice.Year != year || invoice.Sequence != int64(i) {
+			t.Errorf("invoice %d is %s (year %d, sequence %d), want %s", i, invoice.Number, invoice.Year, invoice.Sequence, want)
+		}
+	}
+
+	// Issuing again returns the order's invoice without taking a number
+	payment := f.paidOrder(t, time.Now())
+	first := f.issue(t, payment)
+	if again := f.issue(t, payment); again.ID != first.ID || again.Number != first.Number {
+		t.Errorf("second Issue = %s, want the existing %s", again.Number, first.Number)
+	}
+	if next := f.issue(t, f.paidOrder(t, time.Now())); next.Sequence != first.Sequence+1 {
+		t.Errorf("invoice after a repeated Issue = %s, want sequence %d", next.Number, first.Sequence+1)
+	}
+
+	// An aborted transaction gives its number back
+	err := f.store.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if _, err := f.s.Issue(ctx, f.paidOrder(t, time.Now())); err != nil {
+			return err
+		}
+		return errors.New("capture failed")
+	})
+	if err == nil {
+		t.Fatal("transaction did not fail")
+	}
+	if next := f.issue(t, f.paidOrder(t, time.Now())); next.Sequence != first.Sequence+2 {
+		t.Errorf("invoice after an aborted one = %s, want sequence %d", next.Number, first.Sequence+2)
+	}
+}
+
+func TestInvoiceFollowsPriceBreakdown(t *testing.T) {
+	f := newInvoices(t)
+	invoice := f.issue(t, f.paidOrder(t, time.Now()))
+	if len(invoice.Lines) != 1 || invoice.Lines[0].Code != "pages" {
+		t.Errorf("lines = %+v, want the pages without the tax", invoice.Lines)
+	}
+	if invoice.Subtotal != 41.67 || invoice.Tax != 8.33 || invoice.Total != 50 || invoice.TaxName != "VAT" {
+		t.Errorf("invoice totals: subtotal %v, tax %v %s, total %v", invoice.Subtotal, invoice.Tax, invoice.TaxName, invoice.Total)
+	}
+	if invoice.BillTo.Name != "Ada Lovelace" || invoice.BillTo.UserNumber != "C-1001" {
+		t.Errorf("bill to = %+v", invoice.BillTo)
+	}
+}
+
+func TestCreditNotesHaveTheirOwnSeries(t *testing.T) {
+	f := newInvoices(t)
+	ctx := context.Background()
+	payment := f.paidOrder(t, time.Now())
+	invoice := f.issue(t, payment)
+
+	refund := paymentmodels.Refund{
+		ID:     primitive.NewObjectID(),
+		Amount: 10,
+		Tax:    1.67,
+		Reason: paymentmodels.RefundReasonQualityIssue,
+		Status: paymentmodels.RefundStatusPending,
+	}
+	payment.Refunds = []paymentmodels.Refund{refund}
+	f.store.ReplaceOne("payments", bson.M{"_id": payment.ID}, payment)
+	if _, _, err := f.s.IssueCreditNote(invoice.ID, refund.ID); !errors.Is(err, ErrRefundNotSettled) {
+		t.Errorf("credit note for a pending refund = %v, want ErrRefundNotSettled", err)
+	}
+
+	payment.Refunds[0].Status = paymentmodels.RefundStatusSucceeded
+	f.store.ReplaceOne("payments", bson.M{"_id": payment.ID}, payment)
+	note, created, err := f.s.IssueCreditNote(invoice.ID, refund.ID)
+	if err != nil || !created {
+		t.Fatalf("IssueCreditNote = %v, created %v", err, created)
+	}
+	if want := fmt.Sprintf("CN-%d-000001", time.Now().Year()); note.Number != want {
+		t.Errorf("credit note is %s, want %s", note.Number, want)
+	}
+	if note.Total != 10 || note.Tax != 1.67 || note.Subtotal != 8.33 || *note.InvoiceID != invoice.ID {
+		t.Errorf("credit note = %+v", note)
+	}
+	again, created, err := f.s.IssueCreditNote(invoice.ID, refund.ID)
+	if err != nil || created || again.ID != note.ID {
+		t.Errorf("repeated IssueCreditNote = %v, %v, %v; want the existing note", again, created, err)
+	}
+	if _, _, err := f.s.IssueCreditNote(note.ID, refund.ID); !errors.Is(err, ErrNotAnInvoice) {
+		t.Errorf("credit note against a credit note = %v, want ErrNotAnInvoice", err)
+	}
+
+	// The invoice series goes on from where it was
+	if next := f.issue(t, f.paidOrder(t, time.Now())); next.Sequence != 2 {
+		t.Errorf("invoice after a credit note = %s, want sequence 2", next.Number)
+	}
+	if n, _ := f.s.invoices.Count(ctx, bson.M{"kind": models.KindCreditNote}); n != 1 {
+		t.Errorf("%d credit notes stored, want 1", n)
+	}
+}
+
+func TestForOrderDoesNotIssue(t *testing.T) {
+	f := newInvoices(t)
+	payment := f.paidOrder(t, time.Now())
+	if _, err := f.s.ForOrder(payment.OrderID); !errors.Is(err, ErrOrderNotInvoiced) {
+		t.Errorf("ForOrder of an uninvoiced order = %v, want ErrOrderNotInvoiced", err)
+	}
+	if n := f.store.Count("invoices", nil); n != 0 {
+		t.Errorf("ForOrder stored %d invoices", n)
+	}
+	issued := f.issue(t, payment)
+	if invoice, err := f.s.ForOrder(payment.OrderID); err != nil || invoice.ID != issued.ID {
+		t.Errorf("ForOrder = %v, %v; want %s", invoice, err, issued.Number)
+	}
+}
+
+func TestBackfillNumbersInThePaymentYear(t *testing.T) {
+	f := newInvoices(t)
+	thisYear := time.Now().Year()
+	lastYear := time.Date(thisYear-1, time.November, 3, 10, 0, 0, 0, time.UTC)
+
+	// Last year's series already has an invoice, and so does this year's
+	before := f.paidOrder(t, lastYear.Add(-24*time.Hour))
+	err := f.store.WithTransaction(context.Background(), func(ctx context.Context) error {
+		_, err := f.s.issue(ctx, before, before.CreatedAt)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.issue(t, f.paidOrder(t, time.Now()))
+
+	early := f.paidOrder(t, lastYear)
+	late := f.paidOrder(t, lastYear.Add(24*time.Hour))
+	recent := f.paidOrder(t, time.Now())
+	// A failed attempt gets no invoice, and a repaid order is invoiced once
+	failed := f.paidOrder(t, lastYear)
+	f.store.UpdateOne("payments", bson.M{"_id": failed.ID},
+		bson.M{"$set": bson.M{"status": paymentmodels.PaymentStatusFailed}})
+	repaid := *late
+	repaid.ID = primitive.NewObjectID()
+	repaid.CreatedAt = lastYear.Add(48 * time.Hour)
+	if err := f.payments.Insert(context.Background(), &repaid); err != nil {
+		t.Fatal(err)
+	}
+
+	issued, err := f.s.BackfillInvoices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued != 3 {
+		t.Errorf("backfill issued %d invoices, want 3", issued)
+	}
+	for _, tc := range []struct {
+		payment  *paymentmodels.Payment
+		number   string
+		issuedAt time.Time
+		paidBy   primitive.ObjectID
+	}{
+		{early, fmt.Sprintf("INV-%d-000002", thisYear-1), early.CreatedAt, early.ID},
+		{late, fmt.Sprintf("INV-%d-000003", thisYear-1), repaid.CreatedAt, repaid.ID},
+		{recent, fmt.Sprintf("INV-%d-000002", thisYear), recent.CreatedAt, recent.ID},
+	} {
+		invoice, err := f.s.ForOrder(tc.payment.OrderID)
+		if err != nil {
+			t.Errorf("order paid at %s: %v", tc.payment.CreatedAt, err)
+			continue
+		}
+		if invoice.Number != tc.number || !invoice.IssuedAt.Equal(tc.issuedAt) || invoice.PaymentID != tc.paidBy {
+			t.Errorf("invoice %s issued %s for payment %s, want %s issued %s for %s",
+				invoice.Number, invoice.IssuedAt, invoice.PaymentID.Hex(), tc.number, tc.issuedAt, tc.paidBy.Hex())
+		}
+	}
+	if _, err := f.s.ForOrder(failed.OrderID); !errors.Is(err, ErrOrderNotInvoiced) {
+		t.Errorf("ForOrder of an unpaid order = %v, want ErrOrderNotInvoiced", err)
+	}
+
+	// Running it again issues nothing
+	if issued, err := f.s.BackfillInvoices(); err != nil || issued != 0 {
+		t.Errorf("second backfill = %d, %v; want nothing issued", issued, err)
+	}
+}
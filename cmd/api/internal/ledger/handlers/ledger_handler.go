@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+)
+
+type LedgerHandler struct {
+	service *services.LedgerService
+}
+
+func NewLedgerHandler(service *services.LedgerService) *LedgerHandler {
+	return &LedgerHandler{service: service}
+}
+
+// ListAccounts returns account balances, optionally only those whose code starts with ?prefix=
+func (h *LedgerHandler) ListAccounts(c *gin.Context) {
+	balances, err := h.service.Balances(c.Query("prefix"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load balances"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accounts": balances})
+}
+
+// GetAccount returns one account's balances and its journal entries, newest first
+func (h *LedgerHandler) GetAccount(c *gin.Context) {
+	code := c.Param("code")
+	if models.AccountType(code) == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown account"})
+		return
+	}
+	page := 1
+	pageSize := 10
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	balances, err := h.service.AccountBalances(code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load balances"})
+		return
+	}
+	entries, total, err := h.service.AccountEntries(code, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load entries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"account":   code,
+		"type":      models.AccountType(code),
+		"balances":  balances,
+		"entries":   entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// TrialBalance lists every account with debit and credit totals per currency
+func (h *LedgerHandler) TrialBalance(c *gin.Context) {
+	report, err := h.service.TrialBalance()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build trial balance"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
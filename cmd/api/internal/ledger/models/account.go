@@ -0,0 +1,78 @@
+package models
+
+import "strings"
+
+// Account types. Asset and contra-revenue accounts grow with debits, the others with credits.
+const (
+	AccountTypeAsset         = "asset"
+	AccountTypeLiability     = "liability"
+	AccountTypeRevenue       = "revenue"
+	AccountTypeContraRevenue = "contra_revenue"
+)
+
+// Fixed accounts. Per-party accounts are built with ClientAccount, WalletAccount and WriterPayableAccount.
+const (
+	AccountCash            = "cash"             // money held at the payment providers
+	AccountPlatformRevenue = "platform_revenue" // our commission on approved orders
+	AccountRefunds         = "refunds"          // money returned after revenue was recognized
+	AccountTaxPayable      = "tax_payable"      // tax collected from clients, owed to the tax authorities
+	clientPrefix           = "client:"          // money a client paid for orders not approved yet
+	walletPrefix           = "wallet:"          // store credit a client can spend on orders
+	writerPayablePrefix    = "writer_payable:"  // earnings owed to a writer
+)
+
+// ClientAccount is the account holding a client's prepaid, not yet earned, money
+func ClientAccount(userID string) string { return clientPrefix + userID }
+
+// WalletAccount is the account holding a client's store credit
+func WalletAccount(userID string) string { return walletPrefix + userID }
+
+// WriterPayableAccount is the account holding what the platform owes a writer
+func WriterPayableAccount(writerID string) string { return writerPayablePrefix + writerID }
+
+// AccountType derives the type of an account from its code
+func AccountType(code string) string {
+	switch {
+	case code == AccountCash:
+		return AccountTypeAsset
+	case code == AccountPlatformRevenue:
+		return AccountTypeRevenue
+	case code == AccountRefunds:
+		return AccountTypeContraRevenue
+	case code == AccountTaxPayable:
+		return AccountTypeLiability
+	case strings.HasPrefix(code, clientPrefix), strings.HasPrefix(code, walletPrefix), strings.HasPrefix(code, writerPayablePrefix):
+		return AccountTypeLiability
+	}
+	return ""
+}
+
+// DebitNormal reports whether an account's balance is debits minus credits
+func DebitNormal(accountType string) bool {
+	return accountType == AccountTypeAsset || accountType == AccountTypeContraRevenue
+}
+
+// AccountBalance is the position of one account in one currency. Amounts are in minor units (cents).
+// e.g., {"account": "writer_payable:64b...", "type": "liability", "currency": "USD", "debit": 0, "credit": 2975, "balance": 2975}
+type AccountBalance struct {
+	Account  string `bson:"account" json:"account"`
+	Type     string `bson:"type" json:"type"`
+	Currency string `bson:"currency" json:"currency"`
+	Debit    int64  `bson:"debit" json:"debit"`
+	Credit   int64  `bson:"credit" json:"credit"`
+	Balance  int64  `bson:"balance" json:"balance"` // in the account's normal direction
+}
+
+// TrialBalance lists every account's totals; per currency, debits must equal credits
+type TrialBalance struct {
+	Accounts []AccountBalance    `json:"accounts"`
+	Totals   []TrialBalanceTotal `json:"totals"`
+	Balanced bool                `json:"balanced"`
+}
+
+// TrialBalanceTotal sums all accounts of one currency
+type TrialBalanceTotal struct {
+	Currency string `json:"currency"`
+	Debit    int64  `json:"debit"`
+	Credit   int64  `json:"credit"`
+}
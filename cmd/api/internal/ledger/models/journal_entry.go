@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Journal entry kinds
+const (
+	EntryKindCapture  = "capture"  // client paid: Dr cash (or wallet), Cr client
+	EntryKindApproval = "approval" // order approved: Dr client, Cr writer_payable + platform_revenue
+	EntryKindRefund   = "refund"   // money returned: Dr client (or refunds once approved), Cr cash (or wallet)
+	EntryKindPayout   = "payout"   // writer paid: Dr writer_payable, Cr cash
+
+	EntryKindCaptureReversal = "capture_reversal" // provider denied a capture afterwards: the capture's lines swapped
+	EntryKindPayoutReversal  = "payout_reversal"  // payout returned or cancelled: Dr cash, Cr writer_payable
+	EntryKindWalletTopUp     = "wallet_top_up"    // client added store credit: Dr cash, Cr wallet
+)
+
+// JournalEntry is an immutable, balanced double-entry posting (journal_entries collection).
+// The _id is "<kind>:<reference>", so posting the same business event twice is a no-op.
+// e.g., {"_id": "capture:64b...", "kind": "capture", "lines": [{"account": "cash", "debit": 4250}, {"account": "client:64a...", "credit": 4250}]}
+type JournalEntry struct {
+	ID        string              `bson:"_id" json:"id"`
+	Kind      string              `bson:"kind" json:"kind"`
+	Reference string              `bson:"reference" json:"reference"` // payment, order, refund or payout ID
+	OrderID   *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Currency  string              `bson:"currency" json:"currency"`
+	Lines     []Line              `bson:"lines" json:"lines"`
+	Memo      string              `bson:"memo,omitempty" json:"memo,omitempty"`
+	PostedAt  time.Time           `bson:"posted_at" json:"posted_at"`
+}
+
+// Line debits or credits one account, in minor units. Exactly one of Debit and Credit is set.
+type Line struct {
+	Account string `bson:"account" json:"account"`
+	Debit   int64  `bson:"debit,omitempty" json:"debit,omitempty"`
+	Credit  int64  `bson:"credit,omitempty" json:"credit,omitempty"`
+}
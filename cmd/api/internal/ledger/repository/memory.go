@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type memoryJournalEntryRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryJournalEntryRepository keeps journal entries in store, for tests
+func NewMemoryJournalEntryRepository(store *database.MemoryStore) JournalEntryRepository {
+	return &memoryJournalEntryRepository{store: store}
+}
+
+func (r *memoryJournalEntryRepository) Insert(ctx context.Context, entry *models.JournalEntry) error {
+	return r.store.Insert("journal_entries", entry)
+}
+
+func (r *memoryJournalEntryRepository) FindByID(ctx context.Context, id string) (*models.JournalEntry, error) {
+	var entry models.JournalEntry
+	if err := r.store.FindOne("journal_entries", bson.M{"_id": id}, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *memoryJournalEntryRepository) Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.JournalEntry, error) {
+	findOpts := database.FindOptions{
+		Sort:  bson.D{{Key: "posted_at", Value: -1}},
+		Skip:  opts.Skip,
+		Limit: opts.Limit,
+	}
+	entries := []models.JournalEntry{}
+	err := r.store.Find("journal_entries", filter, findOpts, &entries)
+	return entries, err
+}
+
+func (r *memoryJournalEntryRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.store.Count("journal_entries", filter), nil
+}
+
+func (r *memoryJournalEntryRepository) Totals(ctx context.Context, prefix string) ([]models.AccountBalance, error) {
+	var entries []models.JournalEntry
+	if err := r.store.Find("journal_entries", bson.M{}, database.FindOptions{}, &entries); err != nil {
+		return nil, err
+	}
+	type key struct{ account, currency string }
+	sums := map[key]*models.AccountBalance{}
+	var totals []*models.AccountBalance
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			if !strings.HasPrefix(line.Account, prefix) {
+				continue
+			}
+			k := key{line.Account, entry.Currency}
+			sum, ok := sums[k]
+			if !ok {
+				sum = &models.AccountBalance{Account: line.Account, Currency: entry.Currency}
+				sums[k] = sum
+				totals = append(totals, sum)
+			}
+			sum.Debit += line.Debit
+			sum.Credit += line.Credit
+		}
+	}
+	result := make([]models.AccountBalance, 0, len(totals))
+	for _, sum := range totals {
+		result = append(result, *sum)
+	}
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoJournalEntryRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoJournalEntryRepository(db *mongo.Database) JournalEntryRepository {
+	return &mongoJournalEntryRepository{col: db.Collection("journal_entries")}
+}
+
+func (r *mongoJournalEntryRepository) Insert(ctx context.Context, entry *models.JournalEntry) error {
+	_, err := r.col.InsertOne(ctx, entry)
+	return err
+}
+
+func (r *mongoJournalEntryRepository) FindByID(ctx context.Context, id string) (*models.JournalEntry, error) {
+	var entry models.JournalEntry
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *mongoJournalEntryRepository) Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.JournalEntry, error) {
+	findOpts := options.Find().SetSort(bson.D{{Key: "posted_at", Value: -1}})
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	cur, err := r.col.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	entries := []models.JournalEntry{}
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *mongoJournalEntryRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.col.CountDocuments(ctx, filter)
+}
+
+func (r *mongoJournalEntryRepository) Totals(ctx context.Context, prefix string) ([]models.AccountBalance, error) {
+	pipeline := mongo.Pipeline{{{Key: "$unwind", Value: "$lines"}}}
+	if prefix != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{
+			"lines.account": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)},
+		}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"account": "$lines.account", "currency": "$currency"},
+			"debit":  bson.M{"$sum": "$lines.debit"},
+			"credit": bson.M{"$sum": "$lines.credit"},
+		}}},
+	)
+	cur, err := r.col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var rows []struct {
+		ID struct {
+			Account  string `bson:"account"`
+			Currency string `bson:"currency"`
+		} `bson:"_id"`
+		Debit  int64 `bson:"debit"`
+		Credit int64 `bson:"credit"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	totals := make([]models.AccountBalance, 0, len(rows))
+	for _, row := range rows {
+		totals = append(totals, models.AccountBalance{
+			Account:  row.ID.Account,
+			Currency: row.ID.Currency,
+			Debit:    row.Debit,
+			Credit:   row.Credit,
+		})
+	}
+	return totals, nil
+}
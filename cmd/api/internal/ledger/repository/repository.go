@@ -0,0 +1,31 @@
+// Package repository stores journal entries. The MongoDB implementation is
+// used by the API and the in-memory one by tests; a missing entry gives
+// mongo.ErrNoDocuments from both.
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FindOptions pages a listing of entries, newest first; a zero Limit returns
+// every entry
+type FindOptions struct {
+	Skip  int64
+	Limit int64
+}
+
+// JournalEntryRepository stores the journal_entries collection. Entries are
+// only ever inserted.
+type JournalEntryRepository interface {
+	Insert(ctx context.Context, entry *models.JournalEntry) error
+	FindByID(ctx context.Context, id string) (*models.JournalEntry, error)
+	Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.JournalEntry, error)
+	Count(ctx context.Context, filter bson.M) (int64, error)
+	// Totals sums the debits and credits of every account whose code starts
+	// with prefix (all accounts when empty), per currency. Only Account,
+	// Currency, Debit and Credit are set.
+	Totals(ctx context.Context, prefix string) ([]models.AccountBalance, error)
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrUnbalancedEntry = errors.New("journal entry debits and credits do not balance")
+	ErrInvalidLine     = errors.New("journal lines must debit or credit a positive amount on a known account")
+)
+
+// LedgerService posts double-entry journal entries and reports balances.
+// Entries are only ever inserted; corrections are new entries.
+type LedgerService struct {
+	entries  repository.JournalEntryRepository
+	currency string
+}
+
+func NewLedgerService(db *mongo.Database) *LedgerService {
+	return NewLedgerServiceWith(repository.NewMongoJournalEntryRepository(db))
+}
+
+// NewLedgerServiceWith builds the service on any journal entry store
+func NewLedgerServiceWith(entries repository.JournalEntryRepository) *LedgerService {
+	return &LedgerService{entries: entries, currency: money.DefaultCurrency()}
+}
+
+// Post records entry unless one with the same kind and reference was posted
+// before, in which case the earlier entry is returned. ctx may be a session
+// context so postings commit together with the change they record.
+func (s *LedgerService) Post(ctx context.Context, entry *models.JournalEntry) (*models.JournalEntry, error) {
+	var debits, credits int64
+	for _, line := range entry.Lines {
+		if models.AccountType(line.Account) == "" || line.Debit < 0 || line.Credit < 0 || (line.Debit == 0) == (line.Credit == 0) {
+			return nil, ErrInvalidLine
+		}
+		debits += line.Debit
+		credits += line.Credit
+	}
+	if len(entry.Lines) < 2 || debits != credits {
+		return nil, ErrUnbalancedEntry
+	}
+	if entry.Currency == "" {
+		entry.Currency = s.currency
+	}
+	entry.ID = entry.Kind + ":" + entry.Reference
+
+	// Look first rather than relying on the duplicate key error: inside a
+	// transaction a failed insert aborts the whole transaction
+	existing, err := s.entries.FindByID(ctx, entry.ID)
+	if err == nil {
+		return existing, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	entry.PostedAt = time.Now()
+	if err := s.entries.Insert(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// PostCapture records money received from a client for an order, through a
+// payment provider or out of the client's wallet. The tax part of amount is
+// owed to the tax authorities and never becomes the client's balance.
+func (s *LedgerService) PostCapture(ctx context.Context, paymentID, orderID, clientID primitive.ObjectID, amount, tax int64, currency string, fromWallet bool) error {
+	client := models.ClientAccount(clientID.Hex())
+	source := models.AccountCash
+	if fromWallet {
+		source = models.WalletAccount(clientID.Hex())
+	}
+	lines := []models.Line{
+		{Account: source, Debit: amount},
+		{Account: client, Credit: amount - tax},
+	}
+	if tax > 0 {
+		lines = append(lines, models.Line{Account: models.AccountTaxPayable, Credit: tax})
+	}
+	_, err := s.Post(ctx, &models.JournalEntry{
+		Kind:      models.EntryKindCapture,
+		Reference: paymentID.Hex(),
+		OrderID:   &orderID,
+		Currency:  currency,
+		Lines:     lines,
+		Memo:      "payment captured",
+	})
+	return err
+}
+
+// PostCaptureReversal undoes the capture posted for paymentID, e.g. when the
+// provider denied it afterwards, by posting its lines the other way round.
+// Payments captured before the ledger existed have nothing to undo.
+func (s *LedgerService) PostCaptureReversal(ctx context.Context, paymentID primitive.ObjectID) error {
+	capture, err := s.entries.FindByID(ctx, models.EntryKindCapture+":"+paymentID.Hex())
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := make([]models.Line, len(capture.Lines))
+	for i, line := range capture.Lines {
+		lines[i] = models.Line{Account: line.Account, Debit: line.Credit, Credit: line.Debit}
+	}
+	_, err = s.Post(ctx, &models.JournalEntry{
+		Kind:      models.EntryKindCaptureReversal,
+		Reference: paymentID.Hex(),
+		OrderID:   capture.OrderID,
+		Currency:  capture.Currency,
+		Lines:     lines,
+		Memo:      "payment capture reversed",
+	})
+	return err
+}
+
+// PostWalletTopUp records money a client paid into their wallet
+func (s *LedgerService) PostWalletTopUp(ctx context.Context, reference string, clientID primitive.ObjectID, amount int64, currency string) error {
+	_, err := s.Post(ctx, &models.JournalEntry{
+		Kind:      models.EntryKindWalletTopUp,
+		Reference: reference,
+		Currency:  currency,
+		Lines: []models.Line{
+			{Account: models.AccountCash, Debit: amount},
+			{Account: models.WalletAccount(clientID.Hex()), Credit: amount},
+		},
+		Memo: "wallet top-up",
+	})
+	return err
+}
+
+// PostApproval recognizes what the client holds for an approved order: the
+// writer's share (in basis points) becomes payable, the rest is revenue.
+// Returns the writer's share in minor units and its currency.
+func (s *LedgerService) PostApproval(ctx context.Context, orderID, clientID, writerID primitive.ObjectID, writerShareBps int64) (int64, string, error) {
+	client := models.ClientAccount(clientID.Hex())
+	held, currency, err := s.orderBalance(ctx, orderID, client)
+	if err != nil {
+		return 0, "", err
+	}
+	if held <= 0 {
+		// Paid before the ledger existed, or fully refunded: nothing to recognize
+		return 0, currency, nil
+	}
+	writerShare := held * writerShareBps / 10000
+	lines := []models.Line{{Account: client, Debit: held}}
+	if writerShare > 0 {
+		lines = append(lines, models.Line{Account: models.WriterPayableAccount(writerID.Hex()), Credit: writerShare})
+	}
+	if held-writerShare > 0 {
+		lines = append(lines, models.Line{Account: models.AccountPlatformRevenue, Credit: held - writerShare})
+	}
+	entry, err := s.Post(ctx, &models.JournalEntry{
+		Kind:      models.EntryKindApproval,
+		Reference: orderID.Hex(),
+		OrderID:   &orderID,
+		Currency:  currency,
+		Lines:     lines,
+		Memo:      "order approved",
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	for _, line := range entry.Lines {
+		if line.Account == models.WriterPayableAccount(writerID.Hex()) {
+			return line.Credit, entry.Currency, nil
+		}
+	}
+	return 0, entry.Currency, nil
+}
+
+// PostRefund records money returned to a client, to their payment method or
+// as store credit in their wallet. Before approval it comes out of the
+// client's account; afterwards revenue was already recognized, so it is
+// booked against the refunds account. The tax part of amount is no longer
+// owed to the tax authorities.
+func (s *LedgerService) PostRefund(ctx context.Context, refundID, orderID, clientID primitive.ObjectID, amount, tax int64, currency string, toWallet bool) error {
+	debit := models.ClientAccount(clientID.Hex())
+	credit := models.AccountCash
+	if toWallet {
+		credit = models.WalletAccount(clientID.Hex())
+	}
+	count, err := s.entries.Count(ctx, bson.M{"_id": models.EntryKindApproval + ":" + orderID.Hex()})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		debit = models.AccountRefunds
+	}
+	var lines []models.Line
+	if amount-tax > 0 {
+		lines = append(lines, models.Line{Account: debit, Debit: amount - tax})
+	}
+	if tax > 0 {
+		lines = append(lines, models.Line{Account: models.AccountTaxPayable, Debit: tax})
+	}
+	lines = append(lines, models.Line{Account: credit, Credit: amount})
+	_, err = s.Post(ctx, &models.JournalEntry{
+		Kind:      models.EntryKindRefund,
+		Reference: refundID.Hex(),
+		OrderID:   &orderID,
+		Currency:  currency,
+		Lines:     lines,
+		Memo:      "refund to client",
+	})
+	return err
+}
+
+// PostPayout records money sent to a writer
+func (s *LedgerService) PostPayout(ctx context.Context, reference string, writerID primitive.ObjectID, amount int64, currency string) error {
+	_, err := s.Post(ctx, &models.JournalEntry{
+		Kind:      models.EntryKindPayout,
+		Reference: reference,
+		Currency:  currency,
+		Lines: []models.Line{
+			{Account: models.WriterPayableAccount(writerID.Hex()), Debit: amount},
+			{Account: models.AccountCash, Credit: amount},
+		},
+		Memo: "writer payout",
+	})
+	return err
+}
+
+// PostPayoutReversal undoes the payout posted under reference, e.g. when the
+// bank transfer bounced: the money is owed to the writer again
+func (s *LedgerService) PostPayoutReversal(ctx context.Context, reference string, writerID primitive.ObjectID, amount int64, currency string) error {
+	_, err := s.Post(ctx, &models.JournalEntry{
+		Kind:      models.EntryKindPayoutReversal,
+		Reference: reference,
+		Currency:  currency,
+		Lines: []models.Line{
+			{Account: models.AccountCash, Debit: amount},
+			{Account: models.WriterPayableAccount(writerID.Hex()), Credit: amount},
+		},
+		Memo: "writer payout reversed",
+	})
+	return err
+}
+
+// AccountBalances returns one account's balance per currency
+func (s *LedgerService) AccountBalances(account string) ([]models.AccountBalance, error) {
+	all, err := s.Balances(account)
+	if err != nil {
+		return nil, err
+	}
+	balances := []models.AccountBalance{}
+	for _, b := range all {
+		if b.Account == account {
+			balances = append(balances, b)
+		}
+	}
+	return balances, nil
+}
+
+// orderBalance is the credit balance of account from entries about one order
+func (s *LedgerService) orderBalance(ctx context.Context, orderID primitive.ObjectID, account string) (int64, string, error) {
+	entries, err := s.entries.Find(ctx, bson.M{"order_id": orderID, "lines.account": account}, repository.FindOptions{})
+	if err != nil {
+		return 0, "", err
+	}
+	var balance int64
+	currency := s.currency
+	for _, entry := range entries {
+		currency = entry.Currency
+		for _, line := range entry.Lines {
+			if line.Account == account {
+				balance += line.Credit - line.Debit
+			}
+		}
+	}
+	return balance, currency, nil
+}
+
+// Balances returns the balance of every account whose code starts with prefix
+// (all accounts when empty), per currency
+func (s *LedgerService) Balances(prefix string) ([]models.AccountBalance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	balances, err := s.entries.Totals(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i := range balances {
+		b := &balances[i]
+		b.Type = models.AccountType(b.Account)
+		if models.DebitNormal(b.Type) {
+			b.Balance = b.Debit - b.Credit
+		} else {
+			b.Balance = b.Credit - b.Debit
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Account != balances[j].Account {
+			return balances[i].Account < balances[j].Account
+		}
+		return balances[i].Currency < balances[j].Currency
+	})
+	return balances, nil
+}
+
+// AccountEntries lists the entries touching account, newest first
+func (s *LedgerService) AccountEntries(account string, page, pageSize int) ([]models.JournalEntry, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{"lines.account": account}
+	total, err := s.entries.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := s.entries.Find(ctx, filter, repository.FindOptions{
+		Skip:  int64((page - 1) * pageSize),
+		Limit: int64(pageSize),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// TrialBalance reports every account with per-currency totals
+func (s *LedgerService) TrialBalance() (*models.TrialBalance, error) {
+	balances, err := s.Balances("")
+	if err != nil {
+		return nil, err
+	}
+	report := &models.TrialBalance{Accounts: balances, Totals: []models.TrialBalanceTotal{}, Balanced: true}
+	totals := map[string]*models.TrialBalanceTotal{}
+	for _, b := range balances {
+		t, ok := totals[b.Currency]
+		if !ok {
+			t = &models.TrialBalanceTotal{Currency: b.Currency}
+			totals[b.Currency] = t
+		}
+		t.Debit += b.Debit
+		t.Credit += b.Credit
+	}
+	for _, t := range totals {
+		report.Totals = append(report.Totals, *t)
+		if t.Debit != t.Credit {
+			report.Balanced = false
+		}
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+	return report, nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newLedger() *LedgerService {
+	return NewLedgerServiceWith(repository.NewMemoryJournalEntryRepository(database.NewMemoryStore()))
+}
+
+// balanceOf is the balance of account in its normal direction, in USD
+func balanceOf(t *testing.T, s *LedgerService, account string) int64 {
+	t.Helper()
+	balances, err := s.AccountBalances(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range balances {
+		if b.Currency == "USD" {
+			return b.Balance
+		}
+	}
+	return 0
+}
+
+func TestPostingsBalance(t *testing.T) {
+	ctx := context.Background()
+	order, client, writer := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	approvedOrder := primitive.NewObjectID()
+
+	for _, tc := range []struct {
+		name  string
+		post  func(s *LedgerService) error
+		entry string
+		lines int
+	}{
+		{"capture", func(s *LedgerService) error {
+			return s.PostCapture(ctx, primitive.NewObjectID(), order, client, 4250, 0, "USD", false)
+		}, models.EntryKindCapture, 2},
+		{"capture with tax", func(s *LedgerService) error {
+			return s.PostCapture(ctx, primitive.NewObjectID(), order, client, 5000, 833, "USD", false)
+		}, models.EntryKindCapture, 3},
+		{"capture from wallet", func(s *LedgerService) error {
+			return s.PostCapture(ctx, primitive.NewObjectID(), order, client, 1999, 0, "USD", true)
+		}, models.EntryKindCapture, 2},
+		{"wallet top-up", func(s *LedgerService) error {
+			return s.PostWalletTopUp(ctx, "top-up-1", client, 10000, "USD")
+		}, models.EntryKindWalletTopUp, 2},
+		{"approval", func(s *LedgerService) error {
+			if err := s.PostCapture(ctx, primitive.NewObjectID(), order, client, 1001, 0, "USD", false); err != nil {
+				return err
+			}
+			_, _, err := s.PostApproval(ctx, order, client, writer, 7000)
+			return err
+		}, models.EntryKindApproval, 3},
+		{"refund before approval", func(s *LedgerService) error {
+			return s.PostRefund(ctx, primitive.NewObjectID(), order, client, 2000, 0, "USD", false)
+		}, models.EntryKindRefund, 2},
+		{"refund with tax to wallet", func(s *LedgerService) error {
+			return s.PostRefund(ctx, primitive.NewObjectID(), order, client, 1200, 200, "USD", true)
+		}, models.EntryKindRefund, 3},
+		{"refund of tax only", func(s *LedgerService) error {
+			return s.PostRefund(ctx, primitive.NewObjectID(), order, client, 200, 200, "USD", false)
+		}, models.EntryKindRefund, 2},
+		{"refund after approval", func(s *LedgerService) error {
+			if err := s.PostCapture(ctx, primitive.NewObjectID(), approvedOrder, client, 3000, 0, "USD", false); err != nil {
+				return err
+			}
+			if _, _, err := s.PostApproval(ctx, approvedOrder, client, writer, 7000); err != nil {
+				return err
+			}
+			return s.PostRefund(ctx, primitive.NewObjectID(), approvedOrder, client, 500, 0, "USD", false)
+		}, models.EntryKindRefund, 2},
+		{"payout", func(s *LedgerService) error {
+			return s.PostPayout(ctx, "batch-1:item-1", writer, 2975, "USD")
+		}, models.EntryKindPayout, 2},
+		{"payout reversal", func(s *LedgerService) error {
+			return s.PostPayoutReversal(ctx, "batch-1:item-1", writer, 2975, "USD")
+		}, models.EntryKindPayoutReversal, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newLedger()
+			if err := tc.post(s); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := s.entries.Find(ctx, bson.M{"kind": tc.entry}, repository.FindOptions{})
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("found %d %s entries, %v; want 1", len(entries), tc.entry, err)
+			}
+			entry := entries[0]
+			var debits, credits int64
+			for _, line := range entry.Lines {
+				debits += line.Debit
+				credits += line.Credit
+			}
+			if debits != credits || debits == 0 {
+				t.Errorf("entry debits %d and credits %d: %+v", debits, credits, entry.Lines)
+			}
+			if len(entry.Lines) != tc.lines {
+				t.Errorf("entry has %d lines, want %d: %+v", len(entry.Lines), tc.lines, entry.Lines)
+			}
+			report, err := s.TrialBalance()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Balanced {
+				t.Errorf("trial balance is not balanced: %+v", report.Totals)
+			}
+		})
+	}
+}
+
+func TestOrderLifecycleBalances(t *testing.T) {
+	ctx := context.Background()
+	s := newLedger()
+	order, client, writer := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	// $50 paid, $8.33 of it tax; $10 refunded before approval, $1.67 of it tax
+	if err := s.PostCapture(ctx, primitive.NewObjectID(), order, client, 5000, 833, "USD", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PostRefund(ctx, primitive.NewObjectID(), order, client, 1000, 167, "USD", false); err != nil {
+		t.Fatal(err)
+	}
+	share, currency, err := s.PostApproval(ctx, order, client, writer, 7000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client holds 5000-833 - (1000-167) = 3334; 70% of it goes to the writer
+	if share != 2333 || currency != "USD" {
+		t.Errorf("writer share = %d %s, want 2333 USD", share, currency)
+	}
+	if err := s.PostPayout(ctx, "batch-1:item-1", writer, share, "USD"); err != nil {
+		t.Fatal(err)
+	}
+
+	for account, want := range map[string]int64{
+		models.AccountCash:                        1667,
+		models.AccountTaxPayable:                  666,
+		models.ClientAccount(client.Hex()):        0,
+		models.WriterPayableAccount(writer.Hex()): 0,
+		models.AccountPlatformRevenue:             1001,
+	} {
+		if got := balanceOf(t, s, account); got != want {
+			t.Errorf("%s balance = %d, want %d", account, got, want)
+		}
+	}
+	report, err := s.TrialBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Balanced || len(report.Totals) != 1 || report.Totals[0].Debit != report.Totals[0].Credit {
+		t.Errorf("trial balance = %+v", report)
+	}
+}
+
+func TestPostIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	s := newLedger()
+	payment, order, client := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	for i := 0; i < 2; i++ {
+		if err := s.PostCapture(ctx, payment, order, client, 4250, 0, "USD", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := balanceOf(t, s, models.AccountCash); got != 4250 {
+		t.Errorf("cash = %d after posting one capture twice, want 4250", got)
+	}
+}
+
+func TestPostRejectsInvalidEntries(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		lines []models.Line
+		want  error
+	}{
+		{"unbalanced", []models.Line{{Account: models.AccountCash, Debit: 100}, {Account: models.AccountPlatformRevenue, Credit: 99}}, ErrUnbalancedEntry},
+		{"zero line", []models.Line{{Account: models.AccountCash}, {Account: models.AccountPlatformRevenue}}, ErrInvalidLine},
+		{"single sided", []models.Line{{Account: models.AccountCash, Debit: 100}}, ErrUnbalancedEntry},
+		{"unknown account", []models.Line{{Account: "bank", Debit: 100}, {Account: models.AccountCash, Credit: 100}}, ErrInvalidLine},
+		{"negative amount", []models.Line{{Account: models.AccountCash, Debit: -100}, {Account: models.AccountPlatformRevenue, Credit: -100}}, ErrInvalidLine},
+		{"debit and credit", []models.Line{{Account: models.AccountCash, Debit: 100, Credit: 100}, {Account: models.AccountPlatformRevenue, Credit: 100}}, ErrInvalidLine},
+	} {
+		_, err := newLedger().Post(context.Background(), &models.JournalEntry{Kind: "test", Reference: tc.name, Lines: tc.lines})
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: Post = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
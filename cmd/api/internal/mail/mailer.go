@@ -0,0 +1,105 @@
+// Package mail sends the emails of the API, such as password reset links.
+// Only local mailers exist so far: one writing messages to the log, one
+// writing each to a file and an in-memory outbox, for development and tests.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailerFromEnv writes messages to files in MAIL_DIR when it is set, and
+// to the log otherwise
+func NewMailerFromEnv() Mailer {
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return NewFileMailer(dir)
+	}
+	return NewLogMailer(log.Default())
+}
+
+// LogMailer writes messages to a logger
+type LogMailer struct {
+	logger *log.Logger
+}
+
+func NewLogMailer(logger *log.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// Outbox keeps the messages sent in memory
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
+
+// FileMailer writes every message to its own file in a directory, named so
+// they sort in the order they were sent
+type FileMailer struct {
+	dir  string
+	sent atomic.Int64
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%06d-%s.eml", time.Now().UnixNano(), m.sent.Add(1), sanitize(msg.To))
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o600)
+}
+
+// sanitize keeps an address usable in a file name
+func sanitize(address string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, address)
+}
@@ -0,0 +1,143 @@
+// Package money represents amounts as integer minor units of a currency, so
+// sums and conversions never pick up floating point drift. APIs keep showing
+// major units (e.g. 12.5 for $12.50); convert at the edges with FromMajor and
+// Major.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidCurrency  = errors.New("currency must be an ISO 4217 code")
+	ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// exponents lists the currencies whose minor unit is not a hundredth
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Money is an amount in the minor units of its currency
+// e.g., {"amount": 1250, "currency": "USD"} is $12.50
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+}
+
+// DefaultCurrency is the currency prices are configured in and orders
+// without one are in (PAYMENT_CURRENCY, USD when unset)
+func DefaultCurrency() string {
+	if currency := strings.ToUpper(os.Getenv("PAYMENT_CURRENCY")); currency != "" {
+		return currency
+	}
+	return "USD"
+}
+
+// NormalizeCurrency upper-cases code and checks it looks like an ISO 4217 code
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !currencyPattern.MatchString(code) {
+		return "", ErrInvalidCurrency
+	}
+	return code, nil
+}
+
+// Exponent is the number of decimals of currency, e.g. 2 for USD and 0 for JPY
+func Exponent(currency string) int {
+	if e, ok := exponents[currency]; ok {
+		return e
+	}
+	return 2
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// FromMajor converts an amount in major units, rounding to the nearest minor unit
+func FromMajor(amount float64, currency string) Money {
+	return Money{Amount: ToMinor(amount, currency), Currency: currency}
+}
+
+// ToMinor converts an amount in major units of currency to minor units
+func ToMinor(amount float64, currency string) int64 {
+	return roundMinor(amount * math.Pow10(Exponent(currency)))
+}
+
+// roundMinor rounds a scaled amount to whole minor units, halves away from
+// zero. Products like 1.005 * 100 come out a hair below the half they stand
+// for, so they are rounded to a millionth of a unit first.
+func roundMinor(scaled float64) int64 {
+	return int64(math.Round(math.Round(scaled*1e6) / 1e6))
+}
+
+// Round rounds an amount in major units to the minor unit of currency
+func Round(amount float64, currency string) float64 {
+	return FromMajor(amount, currency).Major()
+}
+
+// Major is the amount in major units
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(o.Neg())
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Bps is the share of m in basis points (7000 = 70%), rounded toward zero,
+// so the share of a negative amount is the negated share of its opposite
+func (m Money) Bps(bps int64) Money {
+	return Money{Amount: m.Amount * bps / 10000, Currency: m.Currency}
+}
+
+// Convert turns m into currency at rate (units of currency per unit of
+// m.Currency), rounding to the nearest minor unit of currency
+func (m Money) Convert(currency string, rate float64) Money {
+	scale := math.Pow10(Exponent(currency) - Exponent(m.Currency))
+	return Money{Amount: roundMinor(float64(m.Amount) * rate * scale), Currency: currency}
+}
+
+// String formats m in major units with its code, e.g. "12.50 USD"
+func (m Money) String() string {
+	return FormatMinor(m.Amount, m.Currency) + " " + m.Currency
+}
+
+// FormatMinor writes a minor unit amount as a plain decimal, e.g. "-12.50"
+func FormatMinor(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	exp := Exponent(currency)
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	unit := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exp, amount%unit)
+}
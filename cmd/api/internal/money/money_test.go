@@ -0,0 +1,158 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToMinor(t *testing.T) {
+	for _, tc := range []struct {
+		amount   float64
+		currency string
+		want     int64
+	}{
+		{12.5, "USD", 1250},
+		{0.1 + 0.2, "USD", 30},
+		{1.005, "USD", 101},
+		{2.675, "USD", 268},
+		{1.004, "USD", 100},
+		{-1.005, "USD", -101},
+		{-0.004, "USD", 0},
+		{1500, "JPY", 1500},
+		{1500.5, "JPY", 1501},
+		{1499.4, "JPY", 1499},
+		{1.2345, "KWD", 1235},
+		{1.2344, "KWD", 1234},
+		{-0.0005, "KWD", -1},
+	} {
+		if got := ToMinor(tc.amount, tc.currency); got != tc.want {
+			t.Errorf("ToMinor(%v, %s) = %d, want %d", tc.amount, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestFromMajor(t *testing.T) {
+	for _, tc := range []struct {
+		amount   float64
+		currency string
+		want     Money
+		major    float64
+	}{
+		{19.99, "USD", Money{1999, "USD"}, 19.99},
+		{19.999, "USD", Money{2000, "USD"}, 20},
+		{1999.5, "JPY", Money{2000, "JPY"}, 2000},
+		{3.1415, "BHD", Money{3142, "BHD"}, 3.142},
+	} {
+		got := FromMajor(tc.amount, tc.currency)
+		if got != tc.want {
+			t.Errorf("FromMajor(%v, %s) = %+v, want %+v", tc.amount, tc.currency, got, tc.want)
+		}
+		if got.Major() != tc.major {
+			t.Errorf("FromMajor(%v, %s).Major() = %v, want %v", tc.amount, tc.currency, got.Major(), tc.major)
+		}
+		if r := Round(tc.amount, tc.currency); r != tc.major {
+			t.Errorf("Round(%v, %s) = %v, want %v", tc.amount, tc.currency, r, tc.major)
+		}
+	}
+}
+
+func TestExponent(t *testing.T) {
+	for currency, want := range map[string]int{"USD": 2, "EUR": 2, "JPY": 0, "KRW": 0, "KWD": 3, "BHD": 3, "XYZ": 2} {
+		if got := Exponent(currency); got != want {
+			t.Errorf("Exponent(%s) = %d, want %d", currency, got, want)
+		}
+	}
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	if got, err := NormalizeCurrency(" eur "); err != nil || got != "EUR" {
+		t.Errorf("NormalizeCurrency(\" eur \") = %q, %v", got, err)
+	}
+	for _, code := range []string{"", "EU", "EURO", "E1R"} {
+		if _, err := NormalizeCurrency(code); !errors.Is(err, ErrInvalidCurrency) {
+			t.Errorf("NormalizeCurrency(%q) err = %v, want ErrInvalidCurrency", code, err)
+		}
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	sum, err := New(1250, "USD").Add(New(-300, "USD"))
+	if err != nil || sum != New(950, "USD") {
+		t.Errorf("Add = %+v, %v", sum, err)
+	}
+	diff, err := New(1250, "USD").Sub(New(1300, "USD"))
+	if err != nil || diff != New(-50, "USD") {
+		t.Errorf("Sub = %+v, %v", diff, err)
+	}
+	if _, err := New(1250, "USD").Add(New(1250, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies err = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestBps(t *testing.T) {
+	for _, tc := range []struct {
+		amount int64
+		bps    int64
+		want   int64
+	}{
+		{10000, 7000, 7000},
+		{1001, 7000, 700},
+		{-1001, 7000, -700},
+		{-10000, 2500, -2500},
+		{999, 10000, 999},
+		{1, 5000, 0},
+		{-1, 5000, 0},
+	} {
+		m := New(tc.amount, "USD")
+		if got := m.Bps(tc.bps); got != New(tc.want, "USD") {
+			t.Errorf("%d.Bps(%d) = %d, want %d", tc.amount, tc.bps, got.Amount, tc.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, tc := range []struct {
+		from Money
+		to   string
+		rate float64
+		want Money
+	}{
+		{New(1250, "USD"), "EUR", 0.9, New(1125, "EUR")},
+		{New(1250, "USD"), "JPY", 150.25, New(1878, "JPY")},
+		{New(1878, "JPY"), "USD", 0.0066, New(1239, "USD")},
+		{New(1250, "USD"), "KWD", 0.307, New(3838, "KWD")},
+		{New(3838, "KWD"), "USD", 3.2573, New(1250, "USD")},
+		{New(-1250, "USD"), "EUR", 0.9, New(-1125, "EUR")},
+		{New(-1, "USD"), "EUR", 0.5, New(-1, "EUR")},
+		{New(0, "USD"), "JPY", 150, New(0, "JPY")},
+	} {
+		if got := tc.from.Convert(tc.to, tc.rate); got != tc.want {
+			t.Errorf("%s.Convert(%s, %v) = %s, want %s", tc.from, tc.to, tc.rate, got, tc.want)
+		}
+	}
+}
+
+func TestFormatMinor(t *testing.T) {
+	for _, tc := range []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{1250, "USD", "12.50"},
+		{5, "USD", "0.05"},
+		{0, "USD", "0.00"},
+		{-1250, "USD", "-12.50"},
+		{-5, "USD", "-0.05"},
+		{1500, "JPY", "1500"},
+		{-1500, "JPY", "-1500"},
+		{1234, "KWD", "1.234"},
+		{-7, "KWD", "-0.007"},
+	} {
+		if got := FormatMinor(tc.amount, tc.currency); got != tc.want {
+			t.Errorf("FormatMinor(%d, %s) = %q, want %q", tc.amount, tc.currency, got, tc.want)
+		}
+	}
+	if got := New(-1250, "EUR").String(); got != "-12.50 EUR" {
+		t.Errorf("String() = %q, want \"-12.50 EUR\"", got)
+	}
+}
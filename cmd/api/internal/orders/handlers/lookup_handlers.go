@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	cataloghandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/handlers"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
+)
+
+type (
+	OrderLevelHandler    = cataloghandlers.CatalogHandler[models.OrderLevel, *models.OrderLevel]
+	OrderPagesHandler    = cataloghandlers.CatalogHandler[models.OrderPages, *models.OrderPages]
+	OrderUrgencyHandler  = cataloghandlers.CatalogHandler[models.OrderUrgency, *models.OrderUrgency]
+	OrderStyleHandler    = cataloghandlers.CatalogHandler[models.OrderStyle, *models.OrderStyle]
+	OrderLanguageHandler = cataloghandlers.CatalogHandler[models.OrderLanguage, *models.OrderLanguage]
+)
+
+func NewOrderLevelHandler(service *services.OrderLevelService) *OrderLevelHandler {
+	return cataloghandlers.NewCatalogHandler(service, "Order level", "order_levels")
+}
+
+func NewOrderPagesHandler(service *services.OrderPagesService) *OrderPagesHandler {
+	return cataloghandlers.NewCatalogHandler(service, "Order pages", "order_pages")
+}
+
+func NewOrderUrgencyHandler(service *services.OrderUrgencyService) *OrderUrgencyHandler {
+	return cataloghandlers.NewCatalogHandler(service, "Order urgency", "order_urgency")
+}
+
+func NewOrderStyleHandler(service *services.OrderStyleService) *OrderStyleHandler {
+	return cataloghandlers.NewCatalogHandler(service, "Order style", "order_styles")
+}
+
+func NewOrderLanguageHandler(service *services.OrderLanguageService) *OrderLanguageHandler {
+	return cataloghandlers.NewCatalogHandler(service, "Order language", "order_languages")
+}
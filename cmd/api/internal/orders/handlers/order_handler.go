@@ -1,26 +1,25 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
-	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type OrderHandler struct {
-	service *services.OrderService
-	db      *mongo.Database
+	service  *services.OrderService
+	enricher *services.OrderEnricher
 }
 
-func NewOrderHandler(client *mongo.Client, dbName string) *OrderHandler {
-	return &OrderHandler{
-		service: services.NewOrderService(client.Database(dbName)),
-		db:      client.Database(dbName),
-	}
+// NewOrderHandlerWith builds the handler on already built services
+func NewOrderHandlerWith(service *services.OrderService, enricher *services.OrderEnricher) *OrderHandler {
+	return &OrderHandler{service: service, enricher: enricher}
 }
 
 func (h *OrderHandler) ListOrders(c *gin.Context) {
@@ -63,24 +62,10 @@ func (h *OrderHandler) ListOrders(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list orders"})
 		return
 	}
-	// Populate LevelName
-	orderLevelService := services.NewOrderLevelService(h.db)
-	orders = services.PopulateOrderLevelNames(orders, orderLevelService)
-	// Populate OrderPagesName
-	orderPagesService := services.NewOrderPagesService(h.db)
-	orders = services.PopulateOrderPagesNames(orders, orderPagesService)
-	// Populate OrderUrgencyName
-	orderUrgencyService := services.NewOrderUrgencyService(h.db)
-	orders = services.PopulateOrderUrgencyNames(orders, orderUrgencyService)
-	// Populate OrderStyleName
-	orderStyleService := services.NewOrderStyleService(h.db)
-	orders = services.PopulateOrderStyleNames(orders, orderStyleService)
-	// Populate OrderLanguageName
-	orderLanguageService := services.NewOrderLanguageService(h.db)
-	orders = services.PopulateOrderLanguageNames(orders, orderLanguageService)
-	// Populate WriterName
-	userService := userservices.NewUserService(h.db)
-	orders = services.PopulateWriterNames(orders, userService)
+	if err := h.enricher.Enrich(orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order details"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"orders":    orders,
 		"total":     total,
@@ -90,22 +75,15 @@ func (h *OrderHandler) ListOrders(c *gin.Context) {
 }
 
 func (h *OrderHandler) ListSubmittedOrders(c *gin.Context) {
-	orders, err := h.service.GetOrdersByStatus("submitted_for_review")
+	orders, err := h.service.GetOrdersByStatus(statemachine.StatusSubmittedForReview)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list submitted orders"})
 		return
 	}
-	orderUrgencyService := services.NewOrderUrgencyService(h.db)
-	orders = services.PopulateOrderUrgencyNames(orders, orderUrgencyService)
-	// Populate OrderStyleName
-	orderStyleService := services.NewOrderStyleService(h.db)
-	orders = services.PopulateOrderStyleNames(orders, orderStyleService)
-	// Populate OrderLanguageName
-	orderLanguageService := services.NewOrderLanguageService(h.db)
-	orders = services.PopulateOrderLanguageNames(orders, orderLanguageService)
-	// Populate WriterName
-	userService := userservices.NewUserService(h.db)
-	orders = services.PopulateWriterNames(orders, userService)
+	if err := h.enricher.Enrich(orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order details"})
+		return
+	}
 	c.JSON(http.StatusOK, orders)
 }
 
@@ -129,9 +107,18 @@ func (h *OrderHandler) AssignOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid writer ID format"})
 		return
 	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found"})
+		return
+	}
 
-	if err := h.service.AssignOrder(orderOID, writerOID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign order"})
+	if err := h.service.AssignOrder(orderOID, writerOID, actor); err != nil {
+		if errors.Is(err, services.ErrWriterNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondOrderError(c, err, "Failed to assign order")
 		return
 	}
 
@@ -154,19 +141,14 @@ func (h *OrderHandler) SubmitOrder(c *gin.Context) {
 		return
 	}
 
-	writerIDInterface, exists := c.Get("userID")
-	if !exists {
+	actor, ok := actorFromContext(c)
+	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Writer ID not found"})
 		return
 	}
-	writerOID, err := primitive.ObjectIDFromHex(writerIDInterface.(string))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid writer ID format"})
-		return
-	}
 
-	if err := h.service.SubmitOrder(orderOID, writerOID, submitRequest.Content); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit order"})
+	if err := h.service.SubmitOrder(orderOID, actor, submitRequest.Content); err != nil {
+		respondOrderError(c, err, "Failed to submit order")
 		return
 	}
 
@@ -181,19 +163,14 @@ func (h *OrderHandler) ApproveOrder(c *gin.Context) {
 		return
 	}
 
-	userIDInterface, exists := c.Get("userID")
-	if !exists {
+	actor, ok := actorFromContext(c)
+	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found"})
 		return
 	}
-	userOID, err := primitive.ObjectIDFromHex(userIDInterface.(string))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
-		return
-	}
 
-	if err := h.service.ApproveOrder(orderOID, userOID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve order"})
+	if err := h.service.ApproveOrder(orderOID, actor); err != nil {
+		respondOrderError(c, err, "Failed to approve order")
 		return
 	}
 
@@ -208,16 +185,11 @@ func (h *OrderHandler) ProvideFeedback(c *gin.Context) {
 		return
 	}
 
-	userIDInterface, exists := c.Get("userID")
-	if !exists {
+	actor, ok := actorFromContext(c)
+	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found"})
 		return
 	}
-	userOID, err := primitive.ObjectIDFromHex(userIDInterface.(string))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
-		return
-	}
 
 	var feedbackRequest struct {
 		Feedback string `json:"feedback"`
@@ -227,8 +199,8 @@ func (h *OrderHandler) ProvideFeedback(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.ProvideFeedback(orderOID, userOID, feedbackRequest.Feedback); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provide feedback"})
+	if err := h.service.ProvideFeedback(orderOID, actor, feedbackRequest.Feedback); err != nil {
+		respondOrderError(c, err, "Failed to provide feedback")
 		return
 	}
 
@@ -249,19 +221,9 @@ func (h *OrderHandler) WriterAcceptAssignment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID format"})
 		return
 	}
-	userIDInterface, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
-		return
-	}
-	userID, ok := userIDInterface.(string)
+	actor, ok := actorFromContext(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID in context is not a string"})
-		return
-	}
-	writerOID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid writer ID format"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
 		return
 	}
 	var req WriterAssignmentResponseRequest
@@ -269,13 +231,28 @@ func (h *OrderHandler) WriterAcceptAssignment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.service.WriterAssignmentResponse(orderOID, writerOID, req.Accept); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment status", "details": err.Error()})
+	if err := h.service.WriterAssignmentResponse(orderOID, actor, req.Accept); err != nil {
+		respondOrderError(c, err, "Failed to update assignment status")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Assignment response recorded"})
 }
 
+// GetOrderHistory returns the status transitions recorded for an order
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	orderOID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID format"})
+		return
+	}
+	events, err := h.service.GetOrderHistory(orderOID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
 // GetOrdersByWriter returns all orders assigned to a specific writer
 func (h *OrderHandler) GetOrdersByWriter(c *gin.Context) {
 	writerID := c.Param("writer_id")
@@ -283,7 +260,6 @@ func (h *OrderHandler) GetOrdersByWriter(c *gin.Context) {
 		// Try to get from query param as fallback for misrouted requests
 		writerID = c.Query("writer_id")
 	}
-	fmt.Println("Writer ID:", writerID)
 	if len(writerID) != 24 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid writer ID format. Must be a 24-character hex string ObjectID."})
 		return
@@ -313,24 +289,10 @@ func (h *OrderHandler) GetOrdersByWriter(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list orders for writer"})
 		return
 	}
-	// Populate LevelName
-	orderLevelService := services.NewOrderLevelService(h.db)
-	orders = services.PopulateOrderLevelNames(orders, orderLevelService)
-	// Populate OrderPagesName
-	orderPagesService := services.NewOrderPagesService(h.db)
-	orders = services.PopulateOrderPagesNames(orders, orderPagesService)
-	// Populate OrderUrgencyName
-	orderUrgencyService := services.NewOrderUrgencyService(h.db)
-	orders = services.PopulateOrderUrgencyNames(orders, orderUrgencyService)
-	// Populate OrderStyleName
-	orderStyleService := services.NewOrderStyleService(h.db)
-	orders = services.PopulateOrderStyleNames(orders, orderStyleService)
-	// Populate OrderLanguageName
-	orderLanguageService := services.NewOrderLanguageService(h.db)
-	orders = services.PopulateOrderLanguageNames(orders, orderLanguageService)
-	// Populate WriterName
-	userService := userservices.NewUserService(h.db)
-	orders = services.PopulateWriterNames(orders, userService)
+	if err := h.enricher.Enrich(orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order details"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"orders":    orders,
 		"total":     total,
@@ -338,3 +300,26 @@ func (h *OrderHandler) GetOrdersByWriter(c *gin.Context) {
 		"page_size": pageSize,
 	})
 }
+
+// actorFromContext builds the state machine actor from the authenticated user
+func actorFromContext(c *gin.Context) (statemachine.Actor, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return statemachine.Actor{}, false
+	}
+	return statemachine.UserActor(principal.UserID, principal.Roles), true
+}
+
+// respondOrderError maps order workflow errors to HTTP status codes:
+// illegal transitions are a conflict with the order's current state.
+func respondOrderError(c *gin.Context, err error, message string) {
+	var transitionErr *statemachine.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		c.JSON(http.StatusConflict, gin.H{"error": transitionErr.Error()})
+	case errors.Is(err, statemachine.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -1,89 +0,0 @@
-package handlers
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-)
-
-type OrderLevelHandler struct {
-	service *services.OrderLevelService
-}
-
-func NewOrderLevelHandler(service *services.OrderLevelService) *OrderLevelHandler {
-	return &OrderLevelHandler{service: service}
-}
-
-func (h *OrderLevelHandler) Create(c *gin.Context) {
-	var level models.OrderLevel
-	if err := c.ShouldBindJSON(&level); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err := h.service.Create(&level); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusCreated, level)
-}
-
-func (h *OrderLevelHandler) List(c *gin.Context) {
-	levels, err := h.service.List()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, levels)
-}
-
-func (h *OrderLevelHandler) GetByID(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	level, err := h.service.GetByID(oid)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order level not found"})
-		return
-	}
-	c.JSON(http.StatusOK, level)
-}
-
-func (h *OrderLevelHandler) Update(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	var update bson.M
-	if err := c.ShouldBindJSON(&update); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err := h.service.Update(oid, update); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Order level updated"})
-}
-
-func (h *OrderLevelHandler) Delete(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	if err := h.service.Delete(oid); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Order level deleted"})
-}
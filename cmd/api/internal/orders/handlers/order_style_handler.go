@@ -1,89 +0,0 @@
-package handlers
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-)
-
-type OrderStyleHandler struct {
-	service *services.OrderStyleService
-}
-
-func NewOrderStyleHandler(service *services.OrderStyleService) *OrderStyleHandler {
-	return &OrderStyleHandler{service: service}
-}
-
-func (h *OrderStyleHandler) Create(c *gin.Context) {
-	var style models.OrderStyle
-	if err := c.ShouldBindJSON(&style); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err := h.service.Create(&style); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusCreated, style)
-}
-
-func (h *OrderStyleHandler) List(c *gin.Context) {
-	styles, err := h.service.List()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, styles)
-}
-
-func (h *OrderStyleHandler) GetByID(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	style, err := h.service.GetByID(oid)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order style not found"})
-		return
-	}
-	c.JSON(http.StatusOK, style)
-}
-
-func (h *OrderStyleHandler) Update(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	var update bson.M
-	if err := c.ShouldBindJSON(&update); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err := h.service.Update(oid, update); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Order style updated"})
-}
-
-func (h *OrderStyleHandler) Delete(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	if err := h.service.Delete(oid); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Order style deleted"})
-}
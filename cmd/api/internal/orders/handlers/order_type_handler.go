@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	cataloghandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/handlers"
+	catalogservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/services"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,39 +23,18 @@ func NewOrderTypeHandler(service *services.OrderTypeService) *OrderTypeHandler {
 	return &OrderTypeHandler{Service: service}
 }
 
-// Middleware to check admin or super admin
-func AdminOnly() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, _ := c.Get("role")
-		if role != "admin" && role != "super_admin" {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: Admins only"})
-			return
-		}
-		c.Next()
-	}
-}
-
 func (h *OrderTypeHandler) Create(c *gin.Context) {
-	var orderType models.OrderType
+	orderType := models.OrderType{Active: true}
 	if err := c.ShouldBindJSON(&orderType); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
-		return
-	}
-	userIDStr, ok := userID.(string)
+	principal, ok := middleware.CurrentPrincipal(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID is not a string"})
-		return
-	}
-	objID, err := primitive.ObjectIDFromHex(userIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
 		return
 	}
+	objID := principal.UserID
 	orderType.CreatedBy = objID
 	if err := h.Service.Create(context.Background(), &orderType); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -90,7 +73,8 @@ func (h *OrderTypeHandler) List(c *gin.Context) {
 	if pageSize < 1 || pageSize > 100 {
 		pageSize = 10
 	}
-	orderTypes, total, err := h.Service.ListPaginated(context.Background(), page, pageSize)
+	includeArchived := c.Query("include_inactive") == "true"
+	orderTypes, total, err := h.Service.ListPaginated(context.Background(), page, pageSize, includeArchived)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -104,7 +88,7 @@ func (h *OrderTypeHandler) List(c *gin.Context) {
 }
 
 func (h *OrderTypeHandler) ListAll(c *gin.Context) {
-	orderTypes, err := h.Service.List(c.Request.Context())
+	orderTypes, err := h.Service.List(c.Request.Context(), c.Query("include_inactive") == "true")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -137,8 +121,42 @@ func (h *OrderTypeHandler) Delete(c *gin.Context) {
 		return
 	}
 	if err := h.Service.Delete(context.Background(), id); err != nil {
+		if cataloghandlers.RespondInUse(c, err, "OrderType") {
+			return
+		}
+		if errors.Is(err, catalogservices.ErrEntryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "OrderType not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "OrderType deleted"})
 }
+
+// Archive hides an order type from lists and new orders; existing orders keep it
+func (h *OrderTypeHandler) Archive(c *gin.Context) {
+	h.setActive(c, false, "OrderType archived")
+}
+
+// Restore makes an archived order type available again
+func (h *OrderTypeHandler) Restore(c *gin.Context) {
+	h.setActive(c, true, "OrderType restored")
+}
+
+func (h *OrderTypeHandler) setActive(c *gin.Context, active bool, message string) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.Service.SetActive(context.Background(), id, active); err != nil {
+		if errors.Is(err, catalogservices.ErrEntryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "OrderType not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
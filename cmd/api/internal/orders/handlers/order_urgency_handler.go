@@ -1,89 +0,0 @@
-package handlers
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-)
-
-type OrderUrgencyHandler struct {
-	service *services.OrderUrgencyService
-}
-
-func NewOrderUrgencyHandler(service *services.OrderUrgencyService) *OrderUrgencyHandler {
-	return &OrderUrgencyHandler{service: service}
-}
-
-func (h *OrderUrgencyHandler) Create(c *gin.Context) {
-	var urgency models.OrderUrgency
-	if err := c.ShouldBindJSON(&urgency); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err := h.service.Create(&urgency); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusCreated, urgency)
-}
-
-func (h *OrderUrgencyHandler) List(c *gin.Context) {
-	urgencies, err := h.service.List()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, urgencies)
-}
-
-func (h *OrderUrgencyHandler) GetByID(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	urgency, err := h.service.GetByID(oid)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order urgency not found"})
-		return
-	}
-	c.JSON(http.StatusOK, urgency)
-}
-
-func (h *OrderUrgencyHandler) Update(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	var update bson.M
-	if err := c.ShouldBindJSON(&update); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err := h.service.Update(oid, update); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Order urgency updated"})
-}
-
-func (h *OrderUrgencyHandler) Delete(c *gin.Context) {
-	id := c.Param("id")
-	oid, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
-	}
-	if err := h.service.Delete(oid); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Order urgency deleted"})
-}
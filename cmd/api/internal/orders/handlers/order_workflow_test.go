@@ -0,0 +1,911 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	ahandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/handlers"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/keys"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	authrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/repository"
+	authservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/services"
+	catalogmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/models"
+	catalogrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/mail"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/handlers"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	payoutmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/models"
+	payoutservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/services"
+	pricingmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	userhandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/handlers"
+	usermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	userrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
+	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fixedQuoter prices every order the same; pricing has its own rules and is
+// not what these tests are about
+type fixedQuoter struct{}
+
+func (fixedQuoter) QuoteOrder(order *models.Order) (*pricingmodels.PriceBreakdown, error) {
+	return &pricingmodels.PriceBreakdown{Pages: 1, PricePerPage: 20, Total: 20, Currency: "USD"}, nil
+}
+
+// recordingAccruer remembers which orders earned their writer a payout
+type recordingAccruer struct {
+	mu       sync.Mutex
+	accruals []payoutservices.Accrual
+}
+
+func (a *recordingAccruer) Accrue(ctx context.Context, accrual payoutservices.Accrual) (*payoutmodels.Earning, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.accruals = append(a.accruals, accrual)
+	return &payoutmodels.Earning{}, nil
+}
+
+// testAPI wires the real handlers and middleware onto an in-memory store,
+// with the routes laid out as in main.go
+type testAPI struct {
+	t         *testing.T
+	router    *gin.Engine
+	store     *database.MemoryStore
+	machine   *statemachine.Machine
+	userRoles *userservices.UserRoleService
+	roles     *userservices.RoleService
+	accruer   *recordingAccruer
+	lookups   map[string]primitive.ObjectID
+	outbox    *mail.Outbox
+	keys      map[string]*keys.Key
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := database.NewMemoryStore()
+	users := userrepository.NewMemoryUserRepository(store)
+	userService := userservices.NewUserServiceWith(users)
+	userRoles := userservices.NewUserRoleServiceWith(userrepository.NewMemoryUserRoleRepository(store))
+	roles := userservices.NewRoleServiceWith(userrepository.NewMemoryRoleRepository(store))
+	catalogs := catalogrepository.NewMemoryStore(store)
+	machine := statemachine.NewMachineWith(
+		repository.NewMemoryOrderRepository(store),
+		repository.NewMemoryOrderEventRepository(store),
+	)
+	accruer := &recordingAccruer{}
+
+	orderService := services.NewOrderServiceWith(services.OrderServiceDeps{
+		Orders:      repository.NewMemoryOrderRepository(store),
+		Machine:     machine,
+		Transactor:  store,
+		Earnings:    accruer,
+		Lookups:     catalogs,
+		UserRoles:   userRoles,
+		RoleService: roles,
+	})
+	enricher := services.NewOrderEnricherWith(
+		services.NewOrderLevelServiceWith(catalogs),
+		services.NewOrderPagesServiceWith(catalogs),
+		services.NewOrderUrgencyServiceWith(catalogs),
+		services.NewOrderStyleServiceWith(catalogs),
+		services.NewOrderLanguageServiceWith(catalogs),
+		userService,
+	)
+
+	// Keys as in the middle of a rotation: "current" took over from
+	// "previous", which still verifies during the overlap, while "retired"
+	// no longer does and "next" is published ahead of signing
+	now := time.Now()
+	signingKeys := map[string]*keys.Key{}
+	for name, notBefore := range map[string]time.Time{
+		"retired":  now.Add(-3 * time.Hour),
+		"previous": now.Add(-2 * time.Hour),
+		"current":  now.Add(-30 * time.Minute),
+		"next":     now.Add(24 * time.Hour),
+	} {
+		key, err := keys.GenerateKey(name, notBefore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signingKeys[name] = key
+	}
+	signing, err := keys.NewSet([]*keys.Key{signingKeys["retired"], signingKeys["previous"], signingKeys["current"], signingKeys["next"]}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outbox := mail.NewOutbox()
+	authService := authservices.NewAuthServiceWith(authservices.AuthServiceDeps{
+		Users:       users,
+		UserRoles:   userRoles,
+		RoleService: roles,
+		Sessions:    authrepository.NewMemorySessionRepository(store),
+		Resets:      authrepository.NewMemoryPasswordResetRepository(store),
+		MFA:         authrepository.NewMemoryMFARepository(store),
+		Challenges:  authrepository.NewMemoryMFAChallengeRepository(store),
+		Attempts:    authrepository.NewMemoryLoginAttemptRepository(store),
+		// The fourth failure locks an account out for an hour rather than
+		// starting a backoff of seconds, which slow runs (e.g. -race) outlast
+		Lockout: authservices.LockoutPolicy{
+			Account: authservices.Throttle{Free: 3, Max: 4},
+			IP:      authservices.Throttle{Free: 20, Max: 100},
+			Lockout: time.Hour,
+		},
+		Keys:        signing,
+		EmailSecret: []byte("a test secret for email verification links"),
+		Mailer:      outbox,
+	})
+	authHandler := ahandlers.NewAuthHandlerWith(authService, userRoles, roles)
+	userHandler := userhandlers.NewUserHandlerWith(orderService, enricher, fixedQuoter{}, userService, userRoles, roles)
+	orderHandler := handlers.NewOrderHandlerWith(orderService, enricher)
+	roleHandler := userhandlers.NewRoleHandler(roles)
+
+	r := gin.New()
+	r.POST("/auth/register", authHandler.Register)
+	r.POST("/auth/login", authHandler.Login)
+	r.POST("/auth/login/mfa", authHandler.CompleteLogin)
+	r.POST("/auth/mfa/enroll", authHandler.EnrollDuringLogin)
+	r.POST("/auth/refresh", authHandler.Refresh)
+	r.POST("/auth/password/forgot", authHandler.ForgotPassword)
+	r.POST("/auth/password/reset", authHandler.ResetPassword)
+	r.POST("/auth/verify-email", authHandler.VerifyEmail)
+	r.POST("/auth/verify-email/resend", authHandler.ResendVerification)
+	r.GET("/.well-known/jwks.json", ahandlers.NewJWKSHandler(signing).Get)
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthMiddleware(userservices.NewRoleResolver(userRoles, roles), userService, signing))
+	{
+		protected.POST("/orders", middleware.RequirePermission(usermodels.PermOrdersPlace), middleware.RequireVerifiedEmail(userService), userHandler.CreateOrder)
+		protected.GET("/orders/me", middleware.RequirePermission(usermodels.PermOrdersPlace), userHandler.GetUserOrders)
+		protected.GET("/me", middleware.RequirePermission(usermodels.PermAccountManage), userHandler.Me)
+		protected.POST("/me/mfa", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.StartMFA)
+		protected.POST("/me/mfa/confirm", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.ConfirmMFA)
+		protected.POST("/me/mfa/disable", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.DisableMFA)
+
+		admin := protected.Group("/admin")
+		admin.PUT("/orders/:id/assign", middleware.RequirePermission(usermodels.PermOrdersAssign), orderHandler.AssignOrder)
+		admin.GET("/orders/:id/events", middleware.RequirePermission(usermodels.PermOrdersRead), orderHandler.GetOrderHistory)
+		admin.DELETE("/users/:id/lockout", middleware.RequirePermission(usermodels.PermUsersWrite), authHandler.UnlockUser)
+		admin.PUT("/roles/:id", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.Update)
+		admin.POST("/roles/:id/permissions", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.GrantPermissions)
+		admin.DELETE("/roles/:id/permissions/:permission", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.RevokePermission)
+
+		writer := protected.Group("/writer")
+		writer.POST("/orders/:id/submit", middleware.RequirePermission(usermodels.PermOrdersWork), orderHandler.SubmitOrder)
+		writer.PUT("/orders/:id/assignment-response", middleware.RequirePermission(usermodels.PermOrdersWork), orderHandler.WriterAcceptAssignment)
+
+		orderReview := protected.Group("/orders/:id/review")
+		orderReview.PUT("/approve", middleware.RequirePermission(usermodels.PermOrdersPlace), orderHandler.ApproveOrder)
+		orderReview.PUT("/feedback", middleware.RequirePermission(usermodels.PermOrdersPlace), orderHandler.ProvideFeedback)
+	}
+
+	api := &testAPI{
+		t:         t,
+		router:    r,
+		store:     store,
+		machine:   machine,
+		userRoles: userRoles,
+		roles:     roles,
+		accruer:   accruer,
+		lookups:   map[string]primitive.ObjectID{},
+		outbox:    outbox,
+		keys:      signingKeys,
+	}
+	api.seed()
+	return api
+}
+
+// seed creates the roles and one active entry of every lookup an order needs
+func (a *testAPI) seed() {
+	if err := a.roles.SeedDefaults(); err != nil {
+		a.t.Fatalf("seed roles: %v", err)
+	}
+	for field, collection := range map[string]string{
+		"order_level_id":    "order_levels",
+		"order_pages_id":    "order_pages",
+		"order_urgency_id":  "order_urgency",
+		"order_style_id":    "order_style",
+		"order_language_id": "order_language",
+	} {
+		entry := catalogmodels.Entry{ID: primitive.NewObjectID(), Name: field, Slug: collection, Active: true}
+		if err := a.store.Insert(collection, entry); err != nil {
+			a.t.Fatalf("seed %s: %v", collection, err)
+		}
+		a.lookups[field] = entry.ID
+	}
+	orderType := models.OrderType{ID: primitive.NewObjectID(), Name: "Essay", Active: true}
+	if err := a.store.Insert("order_types", orderType); err != nil {
+		a.t.Fatalf("seed order type: %v", err)
+	}
+	a.lookups["order_type_id"] = orderType.ID
+}
+
+// do sends body as JSON and decodes the JSON response into out, if given
+func (a *testAPI) do(method, path, token string, body interface{}, out interface{}) int {
+	a.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			a.t.Fatalf("encode %s %s: %v", method, path, err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			a.t.Fatalf("decode %s %s (%d): %v: %s", method, path, rec.Code, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+// expect fails the test unless the request answers with status
+func (a *testAPI) expect(status int, method, path, token string, body interface{}) {
+	a.t.Helper()
+	var res map[string]interface{}
+	if code := a.do(method, path, token, body, &res); code != status {
+		a.t.Fatalf("%s %s: got %d, want %d: %v", method, path, code, status, res)
+	}
+}
+
+type session struct {
+	token        string
+	refreshToken string
+	id           primitive.ObjectID
+}
+
+// register signs a user up, verifies their email, logs them in and grants
+// them extra roles, which apply to the token already issued
+func (a *testAPI) register(email string, extraRoles ...string) session {
+	a.t.Helper()
+	s := a.signUp(email)
+	a.expect(http.StatusOK, "POST", "/auth/verify-email", "", map[string]string{"token": a.mailedToken(email, "Verify your email address", 1)})
+	for _, name := range extraRoles {
+		role, err := a.roles.GetByName(name)
+		if err != nil {
+			a.t.Fatalf("role %s: %v", name, err)
+		}
+		if err := a.userRoles.Create(&usermodels.UserRole{UserID: s.id, RoleID: role.ID}); err != nil {
+			a.t.Fatalf("grant %s: %v", name, err)
+		}
+	}
+	return s
+}
+
+// signUp registers a user and logs them in, leaving their email unverified
+func (a *testAPI) signUp(email string) session {
+	a.t.Helper()
+	password := "correct horse battery staple"
+	a.expect(http.StatusCreated, "POST", "/auth/register", "", map[string]string{
+		"email": email, "username": email, "first_name": "Test", "last_name": "User", "password": password,
+	})
+	return a.login(email, password)
+}
+
+func (a *testAPI) login(email, password string) session {
+	a.t.Helper()
+	var res struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		User         struct {
+			ID primitive.ObjectID `json:"id"`
+		} `json:"user"`
+	}
+	if code := a.do("POST", "/auth/login", "", map[string]string{"email": email, "password": password}, &res); code != http.StatusOK {
+		a.t.Fatalf("login %s: got %d", email, code)
+	}
+	return session{token: res.Token, refreshToken: res.RefreshToken, id: res.User.ID}
+}
+
+// mailedToken waits for the count-th email with subject to reach to, as
+// emails go out in the background, and returns the token it carries
+func (a *testAPI) mailedToken(to, subject string, count int) string {
+	a.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var bodies []string
+		for _, msg := range a.outbox.Messages() {
+			if msg.To == to && msg.Subject == subject {
+				bodies = append(bodies, msg.Body)
+			}
+		}
+		if len(bodies) >= count {
+			firstLine, _, _ := strings.Cut(bodies[count-1], "\n")
+			return firstLine[strings.LastIndex(firstLine, ": ")+2:]
+		}
+		if time.Now().After(deadline) {
+			a.t.Fatalf("got %d %q emails to %s, want %d", len(bodies), subject, to, count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// placeOrder creates an order as client and marks it paid, as a confirmed
+// payment would
+func (a *testAPI) placeOrder(client session) primitive.ObjectID {
+	a.t.Helper()
+	body := map[string]interface{}{"title": "Essay on testing", "is_high_priority": false}
+	for field, id := range a.lookups {
+		body[field] = id
+	}
+	var order models.Order
+	if code := a.do("POST", "/api/orders", client.token, body, &order); code != http.StatusCreated {
+		a.t.Fatalf("create order: got %d", code)
+	}
+	if order.Status != statemachine.StatusPendingPayment || order.UserID != client.id || order.Price != 20 {
+		a.t.Fatalf("created order = %+v", order)
+	}
+	if _, err := a.machine.Apply(context.Background(), statemachine.Change{
+		OrderID: order.ID,
+		To:      statemachine.StatusPaid,
+		Actor:   statemachine.SystemActor(),
+	}); err != nil {
+		a.t.Fatalf("mark order paid: %v", err)
+	}
+	return order.ID
+}
+
+func (a *testAPI) order(id primitive.ObjectID) models.Order {
+	a.t.Helper()
+	var order models.Order
+	if err := a.store.FindOne("orders", map[string]interface{}{"_id": id}, &order); err != nil {
+		a.t.Fatalf("load order: %v", err)
+	}
+	return order
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	if client.token == "" || client.id.IsZero() {
+		t.Fatalf("login gave %+v", client)
+	}
+
+	api.expect(http.StatusBadRequest, "POST", "/auth/register", "", map[string]string{
+		"email": "client@example.com", "username": "again", "first_name": "A", "last_name": "B", "password": "another password",
+	})
+	api.expect(http.StatusUnauthorized, "POST", "/auth/login", "", map[string]string{
+		"email": "client@example.com", "password": "wrong password",
+	})
+	api.expect(http.StatusUnauthorized, "POST", "/auth/login", "", map[string]string{
+		"email": "nobody@example.com", "password": "correct horse battery staple",
+	})
+	api.expect(http.StatusUnauthorized, "GET", "/api/orders/me", "", nil)
+	api.expect(http.StatusOK, "GET", "/api/orders/me", client.token, nil)
+}
+
+func TestCreateOrderRejectsUnknownLookups(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	body := map[string]interface{}{"title": "Essay", "is_high_priority": false}
+	for field, id := range api.lookups {
+		body[field] = id
+	}
+	body["order_level_id"] = primitive.NewObjectID()
+	api.expect(http.StatusUnprocessableEntity, "POST", "/api/orders", client.token, body)
+}
+
+func TestCreateOrderIgnoresServerFields(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	writer := api.register("writer@example.com", "writer")
+	existing := api.placeOrder(client)
+	body := map[string]interface{}{
+		"title":                   "Essay",
+		"id":                      existing.Hex(),
+		"user_id":                 writer.id.Hex(),
+		"status":                  statemachine.StatusApproved,
+		"writer_id":               writer.id.Hex(),
+		"feedback":                "already reviewed",
+		"submission_date":         "2020-01-01T00:00:00Z",
+		"created_at":              "2020-01-01T00:00:00Z",
+		"apply_feedback_requests": 3,
+		"price":                   1,
+	}
+	for field, id := range api.lookups {
+		body[field] = id
+	}
+	var order models.Order
+	if code := api.do("POST", "/api/orders", client.token, body, &order); code != http.StatusCreated {
+		t.Fatalf("create order: got %d", code)
+	}
+	stored := api.order(order.ID)
+	if order.ID == existing || stored.UserID != client.id || stored.Status != statemachine.StatusPendingPayment || stored.Price != 20 {
+		t.Errorf("order = %+v", stored)
+	}
+	if stored.WriterID != nil || stored.Feedback != "" || stored.SubmissionDate != nil || stored.ApplyFeedbackRequests != 0 {
+		t.Errorf("order took work fields from the client: %+v", stored)
+	}
+	if time.Since(stored.CreatedAt) > time.Minute {
+		t.Errorf("created_at = %v, want now", stored.CreatedAt)
+	}
+	if api.order(existing).Status != statemachine.StatusPaid {
+		t.Errorf("existing order changed: %+v", api.order(existing))
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.signUp("client@example.com")
+	body := map[string]interface{}{"title": "Essay", "is_high_priority": false}
+	for field, id := range api.lookups {
+		body[field] = id
+	}
+	api.expect(http.StatusForbidden, "POST", "/api/orders", client.token, body)
+
+	// A resent link works as well as the first one
+	api.expect(http.StatusAccepted, "POST", "/auth/verify-email/resend", "", map[string]string{"email": "client@example.com"})
+	token := api.mailedToken("client@example.com", "Verify your email address", 2)
+	api.expect(http.StatusBadRequest, "POST", "/auth/verify-email", "", map[string]string{"token": token + "x"})
+	api.expect(http.StatusOK, "POST", "/auth/verify-email", "", map[string]string{"token": token})
+	api.expect(http.StatusCreated, "POST", "/api/orders", client.token, body)
+}
+
+func TestPasswordReset(t *testing.T) {
+	api := newTestAPI(t)
+	api.register("client@example.com")
+	session := api.login("client@example.com", "correct horse battery staple")
+
+	// Unknown emails get the same answer and no email
+	var known, unknown map[string]interface{}
+	if code := api.do("POST", "/auth/password/forgot", "", map[string]string{"email": "client@example.com"}, &known); code != http.StatusAccepted {
+		t.Fatalf("forgot: got %d", code)
+	}
+	if code := api.do("POST", "/auth/password/forgot", "", map[string]string{"email": "nobody@example.com"}, &unknown); code != http.StatusAccepted {
+		t.Fatalf("forgot unknown: got %d", code)
+	}
+	if known["message"] != unknown["message"] {
+		t.Fatalf("answers differ: %v, %v", known, unknown)
+	}
+	token := api.mailedToken("client@example.com", "Reset your password", 1)
+
+	api.expect(http.StatusBadRequest, "POST", "/auth/password/reset", "", map[string]string{"token": "not-a-token", "password": "a new password"})
+	api.expect(http.StatusOK, "POST", "/auth/password/reset", "", map[string]string{"token": token, "password": "a new password"})
+	// Tokens are single use
+	api.expect(http.StatusBadRequest, "POST", "/auth/password/reset", "", map[string]string{"token": token, "password": "another password"})
+
+	api.expect(http.StatusUnauthorized, "POST", "/auth/login", "", map[string]string{"email": "client@example.com", "password": "correct horse battery staple"})
+	fresh := api.login("client@example.com", "a new password")
+	// Sessions opened with the old password are revoked, and so are their
+	// access tokens, without waiting for them to expire
+	api.expect(http.StatusUnauthorized, "POST", "/auth/refresh", "", map[string]string{"refresh_token": session.refreshToken})
+	api.expect(http.StatusUnauthorized, "GET", "/api/orders/me", session.token, nil)
+	api.expect(http.StatusOK, "GET", "/api/orders/me", fresh.token, nil)
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+
+	// The token names the user; the profile is fetched from /api/me
+	var raw jwt.MapClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(client.token, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, claim := range []string{"sub", "sid", "jti", "roles", "user_number", "ver", "iat", "exp"} {
+		if _, ok := raw[claim]; !ok {
+			t.Errorf("token lacks claim %s: %v", claim, raw)
+		}
+	}
+	for _, claim := range []string{"user", "email", "password"} {
+		if _, ok := raw[claim]; ok {
+			t.Errorf("token carries claim %s: %v", claim, raw)
+		}
+	}
+	if raw["sub"] != client.id.Hex() {
+		t.Fatalf("sub = %v, want %s", raw["sub"], client.id.Hex())
+	}
+
+	var me map[string]interface{}
+	if code := api.do("GET", "/api/me", client.token, nil, &me); code != http.StatusOK {
+		t.Fatalf("me: got %d", code)
+	}
+	if me["id"] != client.id.Hex() || me["email"] != "client@example.com" || me["user_number"] != raw["user_number"] {
+		t.Fatalf("me = %v", me)
+	}
+	if me["password"] != "" {
+		t.Fatalf("me leaks the password hash: %v", me["password"])
+	}
+	if _, ok := me["token_version"]; ok {
+		t.Fatalf("me exposes the token version: %v", me)
+	}
+	api.expect(http.StatusUnauthorized, "GET", "/api/me", "", nil)
+}
+
+func TestRevokedRoleAppliesToIssuedToken(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	admin := api.register("admin@example.com", "admin")
+	orderID := api.placeOrder(client)
+	eventsPath := "/api/admin/orders/" + orderID.Hex() + "/events"
+
+	api.expect(http.StatusOK, "GET", eventsPath, admin.token, nil)
+	grants, err := api.userRoles.GetByUserID(admin.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminRole, err := api.roles.GetByName("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, grant := range grants {
+		if grant.RoleID == adminRole.ID {
+			if err := api.userRoles.Delete(grant.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	api.expect(http.StatusForbidden, "GET", eventsPath, admin.token, nil)
+}
+
+func TestPermissionsFollowRoles(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	writer := api.register("writer@example.com", "writer")
+	admin := api.register("admin@example.com", "admin")
+	superAdmin := api.register("root@example.com", "super_admin")
+	orderID := api.placeOrder(client)
+	eventsPath := "/api/admin/orders/" + orderID.Hex() + "/events"
+	adminRole, err := api.roles.GetByName("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerRole, err := api.roles.GetByName("writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api.expect(http.StatusForbidden, "GET", eventsPath, writer.token, nil)
+	api.expect(http.StatusOK, "GET", eventsPath, admin.token, nil)
+
+	// Revoking a permission from a role applies to its holders at once
+	revokePath := "/api/admin/roles/" + adminRole.ID.Hex() + "/permissions/" + usermodels.PermOrdersRead
+	api.expect(http.StatusOK, "DELETE", revokePath, admin.token, nil)
+	api.expect(http.StatusForbidden, "GET", eventsPath, admin.token, nil)
+	api.expect(http.StatusBadRequest, "DELETE", "/api/admin/roles/"+adminRole.ID.Hex()+"/permissions/orders:everything", admin.token, nil)
+
+	// The super admin holds every permission without being granted any
+	api.expect(http.StatusOK, "GET", eventsPath, superAdmin.token, nil)
+
+	grantPath := "/api/admin/roles/" + writerRole.ID.Hex() + "/permissions"
+	api.expect(http.StatusForbidden, "POST", grantPath, writer.token, map[string][]string{"permissions": {usermodels.PermOrdersRead}})
+	api.expect(http.StatusOK, "POST", grantPath, superAdmin.token, map[string][]string{"permissions": {usermodels.PermOrdersRead}})
+	api.expect(http.StatusOK, "GET", eventsPath, writer.token, nil)
+}
+
+func TestClientPermissions(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	admin := api.register("admin@example.com", "admin")
+	userRole, err := api.roles.GetByName("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api.expect(http.StatusOK, "GET", "/api/orders/me", client.token, nil)
+	revokePath := "/api/admin/roles/" + userRole.ID.Hex() + "/permissions/" + usermodels.PermOrdersPlace
+	api.expect(http.StatusOK, "DELETE", revokePath, admin.token, nil)
+	api.expect(http.StatusForbidden, "GET", "/api/orders/me", client.token, nil)
+	api.expect(http.StatusOK, "GET", "/api/me", client.token, nil)
+
+	// Seeding again on the next start leaves the revoked permission revoked
+	if err := api.roles.SeedDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	api.expect(http.StatusForbidden, "GET", "/api/orders/me", client.token, nil)
+}
+
+func TestSeedDefaultsUpgradesStoredRoles(t *testing.T) {
+	api := newTestAPI(t)
+	// The user role as stored before clients had permissions
+	if _, err := api.store.UpdateOne("roles", bson.M{"name": "user"}, bson.M{
+		"$set":   bson.M{"permissions": []string{}},
+		"$unset": bson.M{"seeded_permissions": ""},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.roles.SeedDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	role, err := api.roles.GetByName("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(role.Permissions) != len(usermodels.DefaultPermissions["user"]) {
+		t.Fatalf("user role permissions = %v, want %v", role.Permissions, usermodels.DefaultPermissions["user"])
+	}
+	client := api.register("client@example.com")
+	api.expect(http.StatusOK, "GET", "/api/orders/me", client.token, nil)
+}
+
+func TestLoginLockout(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	admin := api.register("admin@example.com", "admin")
+	wrong := map[string]string{"email": "client@example.com", "password": "wrong password"}
+	unknown := map[string]string{"email": "nobody@example.com", "password": "wrong password"}
+
+	// The first failures only fail; the last one locks the account out, for
+	// known and unknown emails alike
+	for i := 0; i < 4; i++ {
+		api.expect(http.StatusUnauthorized, "POST", "/auth/login", "", wrong)
+		api.expect(http.StatusUnauthorized, "POST", "/auth/login", "", unknown)
+	}
+	api.expect(http.StatusTooManyRequests, "POST", "/auth/login", "", unknown)
+	var res map[string]interface{}
+	if code := api.do("POST", "/auth/login", "", map[string]string{"email": "client@example.com", "password": "correct horse battery staple"}, &res); code != http.StatusTooManyRequests {
+		t.Fatalf("login while locked out: got %d: %v", code, res)
+	}
+	if res["retry_after"].(float64) < 1 {
+		t.Fatalf("locked out response = %v", res)
+	}
+
+	api.expect(http.StatusForbidden, "DELETE", "/api/admin/users/"+client.id.Hex()+"/lockout", client.token, nil)
+	api.expect(http.StatusOK, "DELETE", "/api/admin/users/"+client.id.Hex()+"/lockout", admin.token, nil)
+	// Unlocking one account leaves the others locked
+	api.expect(http.StatusTooManyRequests, "POST", "/auth/login", "", unknown)
+	api.login("client@example.com", "correct horse battery staple")
+}
+
+func TestSigningKeys(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+
+	token, _, err := jwt.NewParser().ParseUnverified(client.token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "current" || token.Method.Alg() != keys.EdDSA {
+		t.Fatalf("token header = %v, want the current key", token.Header)
+	}
+
+	var jwks keys.JWKS
+	if code := api.do("GET", "/.well-known/jwks.json", "", nil, &jwks); code != http.StatusOK {
+		t.Fatalf("jwks: got %d", code)
+	}
+	published := []string{}
+	for _, key := range jwks.Keys {
+		published = append(published, key.ID)
+	}
+	if strings.Join(published, ",") != "previous,current,next" {
+		t.Fatalf("published keys = %v", published)
+	}
+
+	// Tokens signed by a key are accepted while it is published and has
+	// started signing
+	claims := jwt.MapClaims{"sub": client.id.Hex(), "exp": time.Now().Add(time.Minute).Unix()}
+	for name, status := range map[string]int{"previous": http.StatusOK, "retired": http.StatusUnauthorized, "next": http.StatusUnauthorized} {
+		api.expect(status, "GET", "/api/orders/me", api.signWith(name, claims), nil)
+	}
+	stranger, err := keys.GenerateKey("current", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.expect(http.StatusUnauthorized, "GET", "/api/orders/me", signWith(t, stranger, claims), nil)
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmacToken.Header["kid"] = "current"
+	forged, err := hmacToken.SignedString([]byte("your-secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.expect(http.StatusUnauthorized, "GET", "/api/orders/me", forged, nil)
+}
+
+// signWith signs claims with one of the API's keys, whether or not it is
+// the one signing now
+func (a *testAPI) signWith(name string, claims jwt.Claims) string {
+	a.t.Helper()
+	return signWith(a.t, a.keys[name], claims)
+}
+
+func signWith(t *testing.T, key *keys.Key, claims jwt.Claims) string {
+	t.Helper()
+	token, err := key.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// totp computes the code of an authenticator app for a base32 secret, as in
+// RFC 6238, independently of the service
+func totp(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+type mfaLogin struct {
+	MFARequired        bool   `json:"mfa_required"`
+	MFAToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+type mfaLoginResult struct {
+	Token         string   `json:"token"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (a *testAPI) startLogin(email string) mfaLogin {
+	a.t.Helper()
+	var res mfaLogin
+	if code := a.do("POST", "/auth/login", "", map[string]string{"email": email, "password": "correct horse battery staple"}, &res); code != http.StatusOK {
+		a.t.Fatalf("login %s: got %d", email, code)
+	}
+	return res
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	admin := api.register("admin@example.com", "admin")
+	superAdmin := api.register("root@example.com", "super_admin")
+	orderID := api.placeOrder(client)
+	eventsPath := "/api/admin/orders/" + orderID.Hex() + "/events"
+	adminRole, err := api.roles.GetByName("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requiring a second factor for a role stops refreshing sessions opened
+	// without one
+	api.expect(http.StatusOK, "PUT", "/api/admin/roles/"+adminRole.ID.Hex(), superAdmin.token, map[string]bool{"require_mfa": true})
+	api.expect(http.StatusUnauthorized, "POST", "/auth/refresh", "", map[string]string{"refresh_token": admin.refreshToken})
+
+	challenge := api.startLogin("admin@example.com")
+	if !challenge.MFARequired || !challenge.EnrollmentRequired || challenge.MFAToken == "" {
+		t.Fatalf("admin login = %+v, want an enrollment challenge", challenge)
+	}
+	var enrollment struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	if code := api.do("POST", "/auth/mfa/enroll", "", map[string]string{"mfa_token": challenge.MFAToken}, &enrollment); code != http.StatusOK {
+		t.Fatalf("enroll: got %d", code)
+	}
+	if !strings.HasPrefix(enrollment.OTPAuthURI, "otpauth://totp/") {
+		t.Fatalf("otpauth URI = %q", enrollment.OTPAuthURI)
+	}
+	now := time.Now()
+	api.expect(http.StatusUnauthorized, "POST", "/auth/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": "000000x"})
+	var enrolled mfaLoginResult
+	if code := api.do("POST", "/auth/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": totp(t, enrollment.Secret, now)}, &enrolled); code != http.StatusOK {
+		t.Fatalf("complete enrollment login: got %d", code)
+	}
+	if len(enrolled.RecoveryCodes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(enrolled.RecoveryCodes))
+	}
+	api.expect(http.StatusOK, "GET", eventsPath, enrolled.Token, nil)
+	// A challenge is answered once
+	api.expect(http.StatusUnauthorized, "POST", "/auth/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": totp(t, enrollment.Secret, now)})
+
+	// A code is accepted once; a recovery code stands in for it, once
+	challenge = api.startLogin("admin@example.com")
+	if challenge.EnrollmentRequired {
+		t.Fatalf("enrolled admin login = %+v", challenge)
+	}
+	api.expect(http.StatusUnauthorized, "POST", "/auth/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": totp(t, enrollment.Secret, now)})
+	api.expect(http.StatusOK, "POST", "/auth/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": strings.ToUpper(enrolled.RecoveryCodes[0])})
+	challenge = api.startLogin("admin@example.com")
+	api.expect(http.StatusUnauthorized, "POST", "/auth/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": enrolled.RecoveryCodes[0]})
+
+	// The role requires the factor, so it cannot be turned off
+	api.expect(http.StatusForbidden, "POST", "/api/me/mfa/disable", enrolled.Token, map[string]string{"code": enrolled.RecoveryCodes[1]})
+
+	// Other users can turn it on for themselves
+	if code := api.do("POST", "/api/me/mfa", client.token, nil, &enrollment); code != http.StatusOK {
+		t.Fatalf("start enrollment: got %d", code)
+	}
+	api.expect(http.StatusUnauthorized, "POST", "/api/me/mfa/confirm", client.token, map[string]string{"code": "123456x"})
+	api.expect(http.StatusOK, "POST", "/api/me/mfa/confirm", client.token, map[string]string{"code": totp(t, enrollment.Secret, now)})
+	if challenge := api.startLogin("client@example.com"); !challenge.MFARequired || challenge.EnrollmentRequired {
+		t.Fatalf("client login = %+v, want a challenge", challenge)
+	}
+	api.expect(http.StatusOK, "POST", "/api/me/mfa/disable", client.token, map[string]string{"code": totp(t, enrollment.Secret, now.Add(30*time.Second))})
+	api.login("client@example.com", "correct horse battery staple")
+}
+
+func TestOrderWorkflow(t *testing.T) {
+	api := newTestAPI(t)
+	client := api.register("client@example.com")
+	writer := api.register("writer@example.com", "writer")
+	admin := api.register("admin@example.com", "admin")
+	orderID := api.placeOrder(client)
+	orderPath := "/api/orders/" + orderID.Hex()
+	writerPath := "/api/writer/orders/" + orderID.Hex()
+	assignPath := "/api/admin/orders/" + orderID.Hex() + "/assign"
+
+	// Only admins assign, and only to writers
+	api.expect(http.StatusForbidden, "PUT", assignPath, writer.token, map[string]string{"writer_id": writer.id.Hex()})
+	api.expect(http.StatusBadRequest, "PUT", assignPath, admin.token, map[string]string{"writer_id": client.id.Hex()})
+	api.expect(http.StatusOK, "PUT", assignPath, admin.token, map[string]string{"writer_id": writer.id.Hex()})
+
+	// The writer cannot submit before accepting
+	api.expect(http.StatusConflict, "POST", writerPath+"/submit", writer.token, map[string]string{"content": "draft"})
+	api.expect(http.StatusOK, "PUT", writerPath+"/assignment-response", writer.token, map[string]bool{"accept": true})
+	api.expect(http.StatusOK, "POST", writerPath+"/submit", writer.token, map[string]string{"content": "first draft"})
+	if order := api.order(orderID); order.Status != statemachine.StatusSubmittedForReview || order.WriterID == nil || *order.WriterID != writer.id {
+		t.Fatalf("after submission order = %+v", order)
+	}
+
+	// The client sends it back once, then it is reassigned and resubmitted
+	api.expect(http.StatusOK, "PUT", orderPath+"/review/feedback", client.token, map[string]string{"feedback": "needs more sources"})
+	order := api.order(orderID)
+	if order.Status != statemachine.StatusFeedback || order.ApplyFeedbackRequests != 1 || order.Feedback != "needs more sources" {
+		t.Fatalf("after feedback order = %+v", order)
+	}
+	api.expect(http.StatusOK, "PUT", assignPath, admin.token, map[string]string{"writer_id": writer.id.Hex()})
+	api.expect(http.StatusOK, "PUT", writerPath+"/assignment-response", writer.token, map[string]bool{"accept": true})
+	api.expect(http.StatusOK, "POST", writerPath+"/submit", writer.token, map[string]string{"content": "second draft"})
+
+	// Only the client who placed the order approves it
+	api.expect(http.StatusNotFound, "PUT", orderPath+"/review/approve", writer.token, nil)
+	if len(api.accruer.accruals) != 0 {
+		t.Fatalf("a failed approval accrued %+v", api.accruer.accruals)
+	}
+	api.expect(http.StatusOK, "PUT", orderPath+"/review/approve", client.token, nil)
+	api.expect(http.StatusConflict, "PUT", orderPath+"/review/approve", client.token, nil)
+
+	if order := api.order(orderID); order.Status != statemachine.StatusApproved {
+		t.Fatalf("after approval status = %q", order.Status)
+	}
+	if len(api.accruer.accruals) != 1 || api.accruer.accruals[0].WriterID != writer.id || api.accruer.accruals[0].ClientID != client.id {
+		t.Fatalf("accruals = %+v", api.accruer.accruals)
+	}
+
+	var history struct {
+		Events []models.OrderEvent `json:"events"`
+	}
+	if code := api.do("GET", "/api/admin/orders/"+orderID.Hex()+"/events", admin.token, nil, &history); code != http.StatusOK {
+		t.Fatalf("history: got %d", code)
+	}
+	want := []string{
+		statemachine.StatusPaid,
+		statemachine.StatusAwaitingAcceptance, statemachine.StatusAssigned, statemachine.StatusSubmittedForReview,
+		statemachine.StatusFeedback,
+		statemachine.StatusAwaitingAcceptance, statemachine.StatusAssigned, statemachine.StatusSubmittedForReview,
+		statemachine.StatusApproved,
+	}
+	if len(history.Events) != len(want) {
+		t.Fatalf("history has %d events, want %d: %+v", len(history.Events), len(want), history.Events)
+	}
+	for i, event := range history.Events {
+		if event.To != want[i] {
+			t.Errorf("event %d moved to %q, want %q", i, event.To, want[i])
+		}
+	}
+}
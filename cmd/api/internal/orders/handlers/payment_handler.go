@@ -1,37 +1,81 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	paymentmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	paymentservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/services"
+	walletservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // PaymentRequest represents the expected payload for payment
-// method: "paypal" or "mastercard"
-// paymentInfo: map with required fields for the gateway
+// method: "paypal", "mastercard", "simulator" (local development only) or "wallet" (store credit)
+// paymentInfo: map with required fields for the gateway; not needed for "wallet"
 // order_id: the order to pay for
 
 type PaymentRequest struct {
 	OrderID     string                 `json:"order_id" binding:"required"`
-	Method      string                 `json:"method" binding:"required,oneof=paypal mastercard"`
-	PaymentInfo map[string]interface{} `json:"payment_info" binding:"required"`
+	Method      string                 `json:"method" binding:"required,oneof=paypal mastercard simulator wallet"`
+	PaymentInfo map[string]interface{} `json:"payment_info"`
 }
 
-// PayForOrderHandler allows a user to pay for an order using PayPal or Mastercard
-func PayForOrderHandler(c *gin.Context) {
+type PaymentHandler struct {
+	paymentService *paymentservices.PaymentService
+}
+
+func NewPaymentHandler(client *mongo.Client, dbName string, registry *gateways.Registry) *PaymentHandler {
+	return &PaymentHandler{
+		paymentService: paymentservices.NewPaymentService(client.Database(dbName), registry),
+	}
+}
+
+// PayForOrder allows a user to pay for an order using one of the configured gateways or their wallet
+func (h *PaymentHandler) PayForOrder(c *gin.Context) {
 	var req PaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.PaymentInfo == nil && req.Method != paymentmodels.PaymentMethodWallet {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payment_info is required"})
+		return
+	}
+	orderOID, err := primitive.ObjectIDFromHex(req.OrderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID format"})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found"})
+		return
+	}
 
-	paymentService := services.NewPaymentService()
-	success, err := paymentService.ProcessPayment(req.OrderID, req.PaymentInfo)
-	if err != nil || !success {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Payment failed", "details": err})
+	payment, err := h.paymentService.PayForOrder(orderOID, *actor.ID, req.Method, req.PaymentInfo)
+	if err != nil {
+		switch {
+		case errors.Is(err, gateways.ErrUnknownMethod):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, gateways.ErrDeclined):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment declined"})
+		case errors.Is(err, gateways.ErrTimeout):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Payment provider did not respond, please check the order status before retrying"})
+		case errors.Is(err, walletservices.ErrInsufficientFunds):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient wallet balance"})
+		case errors.Is(err, walletservices.ErrCurrencyMismatch):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Wallet holds a different currency than the order"})
+		case errors.Is(err, paymentservices.ErrAmountMismatch):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			respondOrderError(c, err, "Payment failed")
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Payment successful"})
+	c.JSON(http.StatusOK, gin.H{"message": "Payment successful", "payment": payment})
 }
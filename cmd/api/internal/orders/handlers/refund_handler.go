@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	paymentmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	paymentservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RefundRequest represents the expected payload for a refund
+// amount: omit to refund everything not refunded yet
+// reason: writer_no_delivery, order_cancelled, quality_issue, duplicate_payment, goodwill or other
+// destination: "wallet" to return the money as store credit; wallet payments always go back to the wallet
+// The Idempotency-Key header is required; retrying with the same key never refunds twice.
+
+type RefundRequest struct {
+	Amount      float64 `json:"amount" binding:"omitempty,gt=0"`
+	Reason      string  `json:"reason" binding:"required"`
+	Note        string  `json:"note"`
+	Destination string  `json:"destination" binding:"omitempty,oneof=original_method wallet"`
+}
+
+type RefundHandler struct {
+	refundService *paymentservices.RefundService
+}
+
+func NewRefundHandler(client *mongo.Client, dbName string, registry *gateways.Registry) *RefundHandler {
+	return &RefundHandler{
+		refundService: paymentservices.NewRefundService(client.Database(dbName), registry),
+	}
+}
+
+// RefundOrder returns all or part of an order's captured payment to the client (admin)
+func (h *RefundHandler) RefundOrder(c *gin.Context) {
+	orderOID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID format"})
+		return
+	}
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actor, ok := actorFromContext(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	payment, refund, replayed, err := h.refundService.RefundOrder(orderOID, actor, paymentservices.RefundRequest{
+		Amount:         req.Amount,
+		Reason:         req.Reason,
+		Note:           req.Note,
+		IdempotencyKey: c.GetHeader("Idempotency-Key"),
+		ToWallet:       req.Destination == paymentmodels.RefundDestinationWallet,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, paymentservices.ErrInvalidRefundReason), errors.Is(err, paymentservices.ErrMissingIdempotencyKey),
+			errors.Is(err, gateways.ErrUnknownMethod):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, paymentservices.ErrNothingToRefund), errors.Is(err, paymentservices.ErrConcurrentRefund):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, paymentservices.ErrRefundExceedsCaptured), errors.Is(err, paymentservices.ErrIdempotencyConflict):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, gateways.ErrDeclined):
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Refund rejected by the payment provider"})
+		case errors.Is(err, gateways.ErrTimeout):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Payment provider did not respond; the refund stays pending until the provider confirms it"})
+		default:
+			respondOrderError(c, err, "Refund failed")
+		}
+		return
+	}
+
+	status := http.StatusCreated
+	if replayed {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"refund": refund, "payment": payment})
+}
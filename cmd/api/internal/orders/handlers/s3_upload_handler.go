@@ -12,38 +12,17 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
 )
 
 // S3UploadHandler handles file uploads to AWS S3
 func S3UploadHandler(c *gin.Context) {
-	userNumber := ""
-	if val, exists := c.Get("user_number"); exists {
-		switch v := val.(type) {
-		case string:
-			userNumber = v
-		case fmt.Stringer:
-			userNumber = v.String()
-		case interface{}:
-			userNumber = fmt.Sprintf("%v", v)
-		}
-	}
-	if userNumber == "" {
-		// Try to get from user struct in context (for backward compatibility)
-		if userVal, ok := c.Get("user"); ok {
-			switch user := userVal.(type) {
-			case map[string]interface{}:
-				if un, ok := user["user_number"]; ok {
-					userNumber = fmt.Sprintf("%v", un)
-				}
-			case struct{ UserNumber string }:
-				userNumber = user.UserNumber
-			}
-		}
-	}
-	if userNumber == "" {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok || principal.UserNumber == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "user_number is required in context (check authentication)"})
 		return
 	}
+	userNumber := principal.UserNumber
 
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
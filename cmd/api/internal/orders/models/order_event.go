@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrderEvent records a single status transition of an order (order_events collection)
+// e.g., {"order_id": ObjectId, "from": "paid", "to": "awaiting_asign_acceptance", "actor_role": "admin"}
+type OrderEvent struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID   primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	From      string              `bson:"from" json:"from"`
+	To        string              `bson:"to" json:"to"`
+	ActorID   *primitive.ObjectID `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	ActorRole string              `bson:"actor_role" json:"actor_role"`
+	Reason    string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
@@ -1,9 +1,7 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import catalogmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/models"
 
 type OrderStyle struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Name        string             `bson:"name" json:"name" binding:"required"`
-	Description string             `bson:"description" json:"description"`
+	catalogmodels.Entry `bson:",inline"`
 }
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryOrderRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryOrderRepository keeps orders in store, for tests
+func NewMemoryOrderRepository(store *database.MemoryStore) OrderRepository {
+	return &memoryOrderRepository{store: store}
+}
+
+func (r *memoryOrderRepository) Insert(ctx context.Context, order *models.Order) error {
+	return r.store.Insert("orders", order)
+}
+
+func (r *memoryOrderRepository) FindOne(ctx context.Context, filter bson.M) (*models.Order, error) {
+	var order models.Order
+	if err := r.store.FindOne("orders", filter, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *memoryOrderRepository) Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.Order, error) {
+	findOpts := database.FindOptions{Skip: opts.Skip, Limit: opts.Limit}
+	if opts.NewestFirst {
+		findOpts.Sort = bson.D{{Key: "created_at", Value: -1}}
+	}
+	var orders []models.Order
+	err := r.store.Find("orders", filter, findOpts, &orders)
+	return orders, err
+}
+
+func (r *memoryOrderRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.store.Count("orders", filter), nil
+}
+
+func (r *memoryOrderRepository) UpdateOne(ctx context.Context, filter, update bson.M) (int64, error) {
+	return r.store.UpdateOne("orders", filter, update)
+}
+
+type memoryOrderEventRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryOrderEventRepository keeps order events in store, for tests
+func NewMemoryOrderEventRepository(store *database.MemoryStore) OrderEventRepository {
+	return &memoryOrderEventRepository{store: store}
+}
+
+func (r *memoryOrderEventRepository) Insert(ctx context.Context, event *models.OrderEvent) error {
+	return r.store.Insert("order_events", event)
+}
+
+func (r *memoryOrderEventRepository) ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.OrderEvent, error) {
+	events := []models.OrderEvent{}
+	opts := database.FindOptions{Sort: bson.D{{Key: "created_at", Value: 1}}}
+	err := r.store.Find("order_events", bson.M{"order_id": orderID}, opts, &events)
+	return events, err
+}
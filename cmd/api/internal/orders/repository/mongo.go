@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoOrderRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoOrderRepository(db *mongo.Database) OrderRepository {
+	return &mongoOrderRepository{col: db.Collection("orders")}
+}
+
+func (r *mongoOrderRepository) Insert(ctx context.Context, order *models.Order) error {
+	_, err := r.col.InsertOne(ctx, order)
+	return err
+}
+
+func (r *mongoOrderRepository) FindOne(ctx context.Context, filter bson.M) (*models.Order, error) {
+	var order models.Order
+	if err := r.col.FindOne(ctx, filter).Decode(&order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *mongoOrderRepository) Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.Order, error) {
+	findOpts := options.Find()
+	if opts.NewestFirst {
+		findOpts.SetSort(bson.M{"created_at": -1})
+	}
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	cur, err := r.col.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var orders []models.Order
+	if err := cur.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *mongoOrderRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.col.CountDocuments(ctx, filter)
+}
+
+func (r *mongoOrderRepository) UpdateOne(ctx context.Context, filter, update bson.M) (int64, error) {
+	res, err := r.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+type mongoOrderEventRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoOrderEventRepository(db *mongo.Database) OrderEventRepository {
+	return &mongoOrderEventRepository{col: db.Collection("order_events")}
+}
+
+func (r *mongoOrderEventRepository) Insert(ctx context.Context, event *models.OrderEvent) error {
+	_, err := r.col.InsertOne(ctx, event)
+	return err
+}
+
+func (r *mongoOrderEventRepository) ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.OrderEvent, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cur, err := r.col.Find(ctx, bson.M{"order_id": orderID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	events := []models.OrderEvent{}
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
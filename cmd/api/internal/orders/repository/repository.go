@@ -0,0 +1,38 @@
+// Package repository stores orders and their status history. The MongoDB
+// implementations are used by the API and the in-memory ones by tests; a
+// missing order gives mongo.ErrNoDocuments from both.
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindOptions pages a listing of orders; a zero Limit returns every order
+type FindOptions struct {
+	Skip        int64
+	Limit       int64
+	NewestFirst bool
+}
+
+// OrderRepository stores the orders collection. Filters and updates use
+// MongoDB syntax, so status transitions can stay conditional.
+type OrderRepository interface {
+	Insert(ctx context.Context, order *models.Order) error
+	FindOne(ctx context.Context, filter bson.M) (*models.Order, error)
+	Find(ctx context.Context, filter bson.M, opts FindOptions) ([]models.Order, error)
+	Count(ctx context.Context, filter bson.M) (int64, error)
+	// UpdateOne applies update to the first order matching filter and
+	// returns how many matched
+	UpdateOne(ctx context.Context, filter, update bson.M) (int64, error)
+}
+
+// OrderEventRepository stores the order_events collection
+type OrderEventRepository interface {
+	Insert(ctx context.Context, event *models.OrderEvent) error
+	// ListByOrder returns the events of an order, oldest first
+	ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.OrderEvent, error)
+}
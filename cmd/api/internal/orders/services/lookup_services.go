@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	catalogrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/repository"
+	catalogservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	pricingmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The lookups an order refers to, each a catalog in its own collection
+type (
+	OrderLevelService    = catalogservices.CatalogService[models.OrderLevel, *models.OrderLevel]
+	OrderPagesService    = catalogservices.CatalogService[models.OrderPages, *models.OrderPages]
+	OrderUrgencyService  = catalogservices.CatalogService[models.OrderUrgency, *models.OrderUrgency]
+	OrderStyleService    = catalogservices.CatalogService[models.OrderStyle, *models.OrderStyle]
+	OrderLanguageService = catalogservices.CatalogService[models.OrderLanguage, *models.OrderLanguage]
+)
+
+func NewOrderLevelService(db *mongo.Database) *OrderLevelService {
+	return NewOrderLevelServiceWith(catalogrepository.NewMongoStore(db))
+}
+
+func NewOrderLevelServiceWith(store catalogrepository.Store) *OrderLevelService {
+	return catalogservices.NewCatalogServiceWith[models.OrderLevel](store, "order_levels").ReferencedBy(
+		append(lookupReferences("order_level_id", pricingmodels.DimensionOrderLevel),
+			catalogservices.Reference{Collection: "promotions", Field: "order_level_ids"},
+			catalogservices.Reference{Collection: "commission_rates", Field: "order_level_id"},
+		)...,
+	)
+}
+
+func NewOrderPagesService(db *mongo.Database) *OrderPagesService {
+	return NewOrderPagesServiceWith(catalogrepository.NewMongoStore(db))
+}
+
+func NewOrderPagesServiceWith(store catalogrepository.Store) *OrderPagesService {
+	return catalogservices.NewCatalogServiceWith[models.OrderPages](store, "order_pages").
+		ReferencedBy(lookupReferences("order_pages_id", pricingmodels.DimensionOrderPages)...)
+}
+
+func NewOrderUrgencyService(db *mongo.Database) *OrderUrgencyService {
+	return NewOrderUrgencyServiceWith(catalogrepository.NewMongoStore(db))
+}
+
+func NewOrderUrgencyServiceWith(store catalogrepository.Store) *OrderUrgencyService {
+	return catalogservices.NewCatalogServiceWith[models.OrderUrgency](store, "order_urgency").
+		ReferencedBy(lookupReferences("order_urgency_id", pricingmodels.DimensionOrderUrgency)...)
+}
+
+func NewOrderStyleService(db *mongo.Database) *OrderStyleService {
+	return NewOrderStyleServiceWith(catalogrepository.NewMongoStore(db))
+}
+
+func NewOrderStyleServiceWith(store catalogrepository.Store) *OrderStyleService {
+	return catalogservices.NewCatalogServiceWith[models.OrderStyle](store, "order_style").
+		ReferencedBy(lookupReferences("order_style_id", pricingmodels.DimensionOrderStyle)...)
+}
+
+func NewOrderLanguageService(db *mongo.Database) *OrderLanguageService {
+	return NewOrderLanguageServiceWith(catalogrepository.NewMongoStore(db))
+}
+
+func NewOrderLanguageServiceWith(store catalogrepository.Store) *OrderLanguageService {
+	return catalogservices.NewCatalogServiceWith[models.OrderLanguage](store, "order_language").
+		ReferencedBy(lookupReferences("order_language_id", pricingmodels.DimensionOrderLanguage)...)
+}
+
+// lookupReferences lists where every lookup is referenced: its field on
+// orders and the price rates of its dimension
+func lookupReferences(orderField, dimension string) []catalogservices.Reference {
+	return []catalogservices.Reference{
+		{Collection: "orders", Field: orderField},
+		{Collection: "price_rates", Field: "ref_id", Where: bson.M{"dimension": dimension}},
+	}
+}
+
+// BackfillLookups gives lookups created before catalogs had slugs and the
+// active flag their defaults; see CatalogService.Backfill
+func BackfillLookups(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := NewOrderTypeService(db.Collection("order_types")).Backfill(ctx); err != nil {
+		return err
+	}
+	for _, backfill := range []func() error{
+		NewOrderLevelService(db).Backfill,
+		NewOrderPagesService(db).Backfill,
+		NewOrderUrgencyService(db).Backfill,
+		NewOrderStyleService(db).Backfill,
+		NewOrderLanguageService(db).Backfill,
+	} {
+		if err := backfill(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
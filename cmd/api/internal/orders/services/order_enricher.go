@@ -0,0 +1,110 @@
+package services
+
+import (
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	usermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NameSource maps the IDs of a lookup catalog to entry names, e.g. a
+// CatalogService
+type NameSource interface {
+	Names() (map[primitive.ObjectID]string, error)
+}
+
+// UserSource loads several users at once, e.g. a UserService
+type UserSource interface {
+	GetUsersByIDs(ids []primitive.ObjectID) ([]usermodels.User, error)
+}
+
+// OrderEnricher fills in the lookup and writer names of a page of orders
+// with a fixed number of queries, whatever the page size: one per catalog
+// that is not cached yet and one for all the writers.
+type OrderEnricher struct {
+	levels    NameSource
+	pages     NameSource
+	urgencies NameSource
+	styles    NameSource
+	languages NameSource
+	users     UserSource
+}
+
+// NewOrderEnricherWith builds an enricher on the given sources. Pass the
+// catalog services the admin routes write through, so their name caches
+// see every change at once.
+func NewOrderEnricherWith(levels, pages, urgencies, styles, languages NameSource, users UserSource) *OrderEnricher {
+	return &OrderEnricher{
+		levels:    levels,
+		pages:     pages,
+		urgencies: urgencies,
+		styles:    styles,
+		languages: languages,
+		users:     users,
+	}
+}
+
+// Enrich sets the level, pages, urgency, style, language and writer names of
+// orders in place. Names of entries that no longer exist are left empty.
+func (e *OrderEnricher) Enrich(orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	lookups := []struct {
+		source NameSource
+		id     func(*models.Order) primitive.ObjectID
+		name   func(*models.Order) *string
+	}{
+		{e.levels, func(o *models.Order) primitive.ObjectID { return o.OrderLevelID }, func(o *models.Order) *string { return &o.LevelName }},
+		{e.pages, func(o *models.Order) primitive.ObjectID { return o.OrderPagesID }, func(o *models.Order) *string { return &o.OrderPagesName }},
+		{e.urgencies, func(o *models.Order) primitive.ObjectID { return o.OrderUrgencyID }, func(o *models.Order) *string { return &o.OrderUrgencyName }},
+		{e.styles, func(o *models.Order) primitive.ObjectID { return o.OrderStyleID }, func(o *models.Order) *string { return &o.OrderStyleName }},
+		{e.languages, func(o *models.Order) primitive.ObjectID { return o.OrderLanguageID }, func(o *models.Order) *string { return &o.OrderLanguageName }},
+	}
+	for _, lookup := range lookups {
+		names, err := lookup.source.Names()
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			*lookup.name(&orders[i]) = names[lookup.id(&orders[i])]
+		}
+	}
+	return e.enrichWriters(orders)
+}
+
+func (e *OrderEnricher) enrichWriters(orders []models.Order) error {
+	var ids []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{}
+	for _, order := range orders {
+		if order.WriterID != nil && !order.WriterID.IsZero() && !seen[*order.WriterID] {
+			seen[*order.WriterID] = true
+			ids = append(ids, *order.WriterID)
+		}
+	}
+	users, err := e.users.GetUsersByIDs(ids)
+	if err != nil {
+		return err
+	}
+	writers := make(map[primitive.ObjectID]usermodels.User, len(users))
+	for _, user := range users {
+		writers[user.ID] = user
+	}
+	for i := range orders {
+		orders[i].WriterName, orders[i].WriterUsername, orders[i].WriterNumber = "", "", ""
+		if orders[i].WriterID == nil {
+			continue
+		}
+		user, ok := writers[*orders[i].WriterID]
+		if !ok {
+			continue
+		}
+		if user.FirstName != "" || user.LastName != "" {
+			orders[i].WriterName = user.FirstName + " " + user.LastName
+		} else {
+			orders[i].WriterName = user.Username
+		}
+		orders[i].WriterUsername = user.Username
+		orders[i].WriterNumber = user.UserNumber
+	}
+	return nil
+}
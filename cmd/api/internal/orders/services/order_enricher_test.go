@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	usermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// countingCatalog stands in for a catalog collection and counts the queries
+// made against it
+type countingCatalog struct {
+	names   map[primitive.ObjectID]string
+	queries *int
+}
+
+func (c countingCatalog) Names() (map[primitive.ObjectID]string, error) {
+	*c.queries++
+	return c.names, nil
+}
+
+type countingUsers struct {
+	users   map[primitive.ObjectID]usermodels.User
+	queries *int
+}
+
+func (u countingUsers) GetUsersByIDs(ids []primitive.ObjectID) ([]usermodels.User, error) {
+	*u.queries++
+	var users []usermodels.User
+	for _, id := range ids {
+		if user, ok := u.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func newCatalog(queries *int, n int) (countingCatalog, []primitive.ObjectID) {
+	catalog := countingCatalog{names: map[primitive.ObjectID]string{}, queries: queries}
+	var ids []primitive.ObjectID
+	for i := 0; i < n; i++ {
+		id := primitive.NewObjectID()
+		catalog.names[id] = fmt.Sprintf("entry %d", i)
+		ids = append(ids, id)
+	}
+	return catalog, ids
+}
+
+// BenchmarkOrderEnricher checks the number of queries needed to enrich a page
+// of orders does not grow with the page size: one per catalog plus one for
+// all the writers, where the per-order lookups it replaced made about 6 per
+// order.
+func BenchmarkOrderEnricher(b *testing.B) {
+	for _, pageSize := range []int{10, 50, 100} {
+		b.Run(fmt.Sprintf("page_size=%d", pageSize), func(b *testing.B) {
+			queries := 0
+			levels, levelIDs := newCatalog(&queries, 5)
+			pages, pagesIDs := newCatalog(&queries, 20)
+			urgencies, urgencyIDs := newCatalog(&queries, 6)
+			styles, styleIDs := newCatalog(&queries, 8)
+			languages, languageIDs := newCatalog(&queries, 3)
+			users := countingUsers{users: map[primitive.ObjectID]usermodels.User{}, queries: &queries}
+			orders := make([]models.Order, pageSize)
+			for i := range orders {
+				writerID := primitive.NewObjectID()
+				users.users[writerID] = usermodels.User{ID: writerID, Username: fmt.Sprintf("writer%d", i), FirstName: "Ann", UserNumber: fmt.Sprintf("W%04d", i)}
+				orders[i] = models.Order{
+					OrderLevelID:    levelIDs[i%len(levelIDs)],
+					OrderPagesID:    pagesIDs[i%len(pagesIDs)],
+					OrderUrgencyID:  urgencyIDs[i%len(urgencyIDs)],
+					OrderStyleID:    styleIDs[i%len(styleIDs)],
+					OrderLanguageID: languageIDs[i%len(languageIDs)],
+					WriterID:        &writerID,
+				}
+			}
+			enricher := NewOrderEnricherWith(levels, pages, urgencies, styles, languages, users)
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if err := enricher.Enrich(orders); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			perPage := float64(queries) / float64(b.N)
+			b.ReportMetric(perPage, "queries/page")
+			if perPage != 6 {
+				b.Fatalf("enriching a page of %d orders took %.1f queries, want 6", pageSize, perPage)
+			}
+			last := orders[len(orders)-1]
+			if last.LevelName == "" || last.OrderLanguageName == "" || last.WriterName != "Ann " || last.WriterNumber == "" {
+				b.Fatalf("order not enriched: %+v", last)
+			}
+		})
+	}
+}
@@ -6,49 +6,162 @@ import (
 	"fmt"
 	"time"
 
+	catalogrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/repository"
+	catalogservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	payoutmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/models"
+	payoutservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/services"
+	promomodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	promoservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/services"
 	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrUnknownReference  = errors.New("refers to an entry that does not exist")
+	ErrArchivedReference = errors.New("refers to an archived entry")
+)
+
+// Accruer credits the writer of an approved order, e.g. an EarningService
+type Accruer interface {
+	Accrue(ctx context.Context, a payoutservices.Accrual) (*payoutmodels.Earning, error)
+}
+
+// Redeemer counts a use of a promotion by an order, e.g. a PromotionService
+type Redeemer interface {
+	Redeem(ctx context.Context, applied *promomodels.AppliedPromotion, userID, orderID primitive.ObjectID) error
+}
+
+// OrderServiceDeps are the stores and services an OrderService works with;
+// see NewOrderServiceWith
+type OrderServiceDeps struct {
+	Orders      repository.OrderRepository
+	Machine     *statemachine.Machine
+	Transactor  database.Transactor
+	Earnings    Accruer
+	Promotions  Redeemer
+	Lookups     catalogrepository.Store
+	UserRoles   *userservices.UserRoleService
+	RoleService *userservices.RoleService
+}
+
 type OrderService struct {
-	orderCollection *mongo.Collection
-	userCollection  *mongo.Collection // For checking user/writer existence
+	orders      repository.OrderRepository
+	machine     *statemachine.Machine
+	tx          database.Transactor
+	earnings    Accruer
+	promotions  Redeemer
+	userRoles   *userservices.UserRoleService // For checking writer roles
+	roleService *userservices.RoleService
+	orderTypes  *OrderTypeService
+	levels      *OrderLevelService
+	pages       *OrderPagesService
+	urgencies   *OrderUrgencyService
+	styles      *OrderStyleService
+	languages   *OrderLanguageService
+}
+
+// NewOrderService checks writer roles through the process's role services
+func NewOrderService(db *mongo.Database, userRoles *userservices.UserRoleService, roles *userservices.RoleService) *OrderService {
+	return NewOrderServiceWith(OrderServiceDeps{
+		Orders:      repository.NewMongoOrderRepository(db),
+		Machine:     statemachine.NewMachine(db),
+		Transactor:  database.NewMongoTransactor(db.Client()),
+		Earnings:    payoutservices.NewEarningService(db),
+		Promotions:  promoservices.NewPromotionService(db),
+		Lookups:     catalogrepository.NewMongoStore(db),
+		UserRoles:   userRoles,
+		RoleService: roles,
+	})
 }
 
-func NewOrderService(db *mongo.Database) *OrderService {
+// NewOrderServiceWith builds the service on deps, e.g. in-memory stores and
+// fakes in tests. Order types and lookups are read from deps.Lookups.
+func NewOrderServiceWith(deps OrderServiceDeps) *OrderService {
 	return &OrderService{
-		orderCollection: db.Collection("orders"),
-		userCollection:  db.Collection("users"),
+		orders:      deps.Orders,
+		machine:     deps.Machine,
+		tx:          deps.Transactor,
+		earnings:    deps.Earnings,
+		promotions:  deps.Promotions,
+		userRoles:   deps.UserRoles,
+		roleService: deps.RoleService,
+		orderTypes:  NewOrderTypeServiceWith(deps.Lookups),
+		levels:      NewOrderLevelServiceWith(deps.Lookups),
+		pages:       NewOrderPagesServiceWith(deps.Lookups),
+		urgencies:   NewOrderUrgencyServiceWith(deps.Lookups),
+		styles:      NewOrderStyleServiceWith(deps.Lookups),
+		languages:   NewOrderLanguageServiceWith(deps.Lookups),
+	}
+}
+
+// ValidateReferences checks every lookup the order refers to exists and is
+// not archived. The error names the offending field and matches
+// ErrUnknownReference or ErrArchivedReference.
+func (s *OrderService) ValidateReferences(order *models.Order) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	checks := []struct {
+		field   string
+		require func() error
+	}{
+		{"order_type_id", func() error { return s.orderTypes.RequireActive(ctx, order.OrderTypeID) }},
+		{"order_level_id", func() error { return s.levels.RequireActive(order.OrderLevelID) }},
+		{"order_pages_id", func() error { return s.pages.RequireActive(order.OrderPagesID) }},
+		{"order_urgency_id", func() error { return s.urgencies.RequireActive(order.OrderUrgencyID) }},
+		{"order_style_id", func() error { return s.styles.RequireActive(order.OrderStyleID) }},
+		{"order_language_id", func() error { return s.languages.RequireActive(order.OrderLanguageID) }},
+	}
+	for _, check := range checks {
+		err := check.require()
+		switch {
+		case errors.Is(err, catalogservices.ErrEntryNotFound):
+			return fmt.Errorf("%s %w", check.field, ErrUnknownReference)
+		case errors.Is(err, catalogservices.ErrEntryArchived):
+			return fmt.Errorf("%s %w", check.field, ErrArchivedReference)
+		case err != nil:
+			return err
+		}
 	}
+	return nil
 }
 
+// CreateOrder stores a new order awaiting payment under a new ID, once
+// ValidateReferences passes. If its price includes a promotion, the
+// redemption is counted in the same transaction, so an order is never
+// created with a discount that was no longer available.
 func (s *OrderService) CreateOrder(order *models.Order) error {
+	if err := s.ValidateReferences(order); err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	order.ID = primitive.NewObjectID()
+	order.Status = statemachine.StatusPendingPayment
 	order.ApplyFeedbackRequests = 0 // Default to zero on creation
-	fmt.Println("Creating order:", order)
-	_, err := s.orderCollection.InsertOne(ctx, order)
-	return err
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = order.CreatedAt
+	if order.PriceBreakdown == nil || order.PriceBreakdown.Promotion == nil {
+		return s.orders.Insert(ctx, order)
+	}
+
+	return s.tx.WithTransaction(ctx, func(tc context.Context) error {
+		if err := s.promotions.Redeem(tc, order.PriceBreakdown.Promotion, order.UserID, order.ID); err != nil {
+			return err
+		}
+		return s.orders.Insert(tc, order)
+	})
 }
 
 func (s *OrderService) GetAllOrders() ([]models.Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cursor, err := s.orderCollection.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var orders []models.Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		return nil, err
-	}
-	return orders, nil
+	return s.orders.Find(ctx, bson.M{}, repository.FindOptions{})
 }
 
 func (s *OrderService) GetAllOrdersPaginated(page, pageSize int) ([]models.Order, int64, error) {
@@ -58,55 +171,28 @@ func (s *OrderService) GetAllOrdersPaginated(page, pageSize int) ([]models.Order
 	skip := int64((page - 1) * pageSize)
 	limit := int64(pageSize)
 
-	total, err := s.orderCollection.CountDocuments(ctx, bson.M{})
+	total, err := s.orders.Count(ctx, bson.M{})
 	if err != nil {
 		return nil, 0, err
 	}
 
-	opts := options.Find().SetSkip(skip).SetLimit(limit).SetSort(bson.M{"created_at": -1})
-	cursor, err := s.orderCollection.Find(ctx, bson.M{}, opts)
+	orders, err := s.orders.Find(ctx, bson.M{}, repository.FindOptions{Skip: skip, Limit: limit, NewestFirst: true})
 	if err != nil {
 		return nil, 0, err
 	}
-	defer cursor.Close(ctx)
-
-	var orders []models.Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		return nil, 0, err
-	}
 	return orders, total, nil
 }
 
 func (s *OrderService) GetOrdersByUserID(userID primitive.ObjectID) ([]models.Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cursor, err := s.orderCollection.Find(ctx, bson.M{"user_id": userID})
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var orders []models.Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		return nil, err
-	}
-	return orders, nil
+	return s.orders.Find(ctx, bson.M{"user_id": userID}, repository.FindOptions{})
 }
 
 func (s *OrderService) GetOrdersByStatus(status string) ([]models.Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cursor, err := s.orderCollection.Find(ctx, bson.M{"status": status})
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var orders []models.Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		return nil, err
-	}
-	return orders, nil
+	return s.orders.Find(ctx, bson.M{"status": status}, repository.FindOptions{})
 }
 
 // GetOrdersFiltered returns orders filtered by user_id, writer_id, and/or status (all are optional)
@@ -127,283 +213,173 @@ func (s *OrderService) GetOrdersFiltered(userID, writerID *primitive.ObjectID, s
 
 	skip := int64((page - 1) * pageSize)
 	limit := int64(pageSize)
-	total, err := s.orderCollection.CountDocuments(ctx, filter)
+	total, err := s.orders.Count(ctx, filter)
 	if err != nil {
 		return nil, 0, err
 	}
-	findOpts := options.Find().SetSkip(skip).SetLimit(limit).SetSort(bson.M{"created_at": -1})
-	cursor, err := s.orderCollection.Find(ctx, filter, findOpts)
+	orders, err := s.orders.Find(ctx, filter, repository.FindOptions{Skip: skip, Limit: limit, NewestFirst: true})
 	if err != nil {
 		return nil, 0, err
 	}
-	defer cursor.Close(ctx)
-	var orders []models.Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		return nil, 0, err
-	}
 	return orders, total, nil
 }
 
-func (s *OrderService) AssignOrder(orderID, writerID primitive.ObjectID) error {
+// ErrWriterNotFound is returned when assigning an order to someone without the writer role
+var ErrWriterNotFound = errors.New("writer not found")
+
+// maxFeedbackRequests is how many times a client may send an order back to the writer
+const maxFeedbackRequests = 4
+
+func (s *OrderService) AssignOrder(orderID, writerID primitive.ObjectID, actor statemachine.Actor) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Verify writer exists (multi-role system: check user_roles for writer role)
-	writerRole := s.userCollection.Database().Collection("user_roles")
-	roleCol := s.userCollection.Database().Collection("roles")
-	var writerRoleIDs []primitive.ObjectID
-	cursor, err := writerRole.Find(ctx, bson.M{"user_id": writerID})
+	userRoles, err := s.userRoles.GetByUserID(writerID)
 	if err != nil {
 		return errors.New("failed to check writer roles")
 	}
-	defer cursor.Close(ctx)
-	for cursor.Next(ctx) {
-		var ur struct {
-			RoleID primitive.ObjectID `bson:"role_id"`
-		}
-		if err := cursor.Decode(&ur); err == nil {
-			writerRoleIDs = append(writerRoleIDs, ur.RoleID)
-		}
-	}
 	isWriter := false
-	for _, roleID := range writerRoleIDs {
-		var roleDoc struct {
-			Name string `bson:"name"`
-		}
-		if err := roleCol.FindOne(ctx, bson.M{"_id": roleID}).Decode(&roleDoc); err == nil && roleDoc.Name == "writer" {
+	for _, ur := range userRoles {
+		if role, err := s.roleService.GetByID(ur.RoleID); err == nil && role.Name == "writer" {
 			isWriter = true
 			break
 		}
 	}
 	if !isWriter {
-		return errors.New("writer not found")
+		return ErrWriterNotFound
 	}
 
-	// Allow reassignment if order is in 'paid' or 'feedback' status
-	filter := bson.M{"_id": orderID, "$or": []bson.M{{"status": "paid"}, {"status": "feedback"}}}
-	update := bson.M{"$set": bson.M{"writer_id": writerID, "status": "awaiting_asign_acceptance", "assignment_date": time.Now()}}
-	_, err = s.orderCollection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		if mongo.IsDuplicateKeyError(err) {
-			return errors.New("order already assigned to a writer")
-		}
-		if err == mongo.ErrNoDocuments {
-			return errors.New("order not found or not awaiting assignment")
-		}
-	}
-	return err
+	// Reassignment from 'feedback' is allowed by the state machine as well as first assignment from 'paid'
+	return s.apply(ctx, statemachine.Change{
+		OrderID: orderID,
+		To:      statemachine.StatusAwaitingAcceptance,
+		Actor:   actor,
+		Set:     bson.M{"writer_id": writerID, "assignment_date": time.Now()},
+	})
 }
 
-func (s *OrderService) SubmitOrder(orderID primitive.ObjectID, writerID primitive.ObjectID, content string) error {
+func (s *OrderService) SubmitOrder(orderID primitive.ObjectID, actor statemachine.Actor, content string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Verify order belongs to the writer and is in the correct status
-	result := s.orderCollection.FindOne(ctx, bson.M{"_id": orderID, "writer_id": writerID, "status": "assigned"})
-	if result.Err() != nil {
-		return errors.New("order not found or not assigned to this writer")
-	}
-
-	_, err := s.orderCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": orderID},
-		bson.M{"$set": bson.M{"status": "submitted_for_review", "content": content, "submission_date": time.Now()}},
-	)
-	if err != nil {
-		return err
-	}
-
-	// In a real application, you would likely create a 'Review' record here as well.
-	// This could include the content submitted by the writer, the order ID, and any other relevant details.
-
-	// For this basic example, we'll just update the order status.
-
-	return nil
+	// Only the writer the order is assigned to can submit it
+	return s.apply(ctx, statemachine.Change{
+		OrderID: orderID,
+		To:      statemachine.StatusSubmittedForReview,
+		Actor:   actor,
+		Match:   bson.M{"writer_id": *actor.ID},
+		Set:     bson.M{"content": content, "submission_date": time.Now()},
+	})
 }
 
-func (s *OrderService) ApproveOrder(orderID, userID primitive.ObjectID) error {
+func (s *OrderService) ApproveOrder(orderID primitive.ObjectID, actor statemachine.Actor) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Verify order belongs to the user and is in the correct status
-	result := s.orderCollection.FindOne(ctx, bson.M{"_id": orderID, "user_id": userID, "status": "submitted_for_review"})
-	if result.Err() != nil {
-		return errors.New("order not found or not awaiting approval by this user")
-	}
-
-	_, err := s.orderCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": orderID},
-		bson.M{"$set": bson.M{"status": "approved", "approval_date": time.Now()}},
-	)
-	return err
+	// The approval and the writer's earnings are recorded together
+	return s.tx.WithTransaction(ctx, func(tc context.Context) error {
+		// Only the client who placed the order can approve it
+		if _, err := s.machine.Apply(tc, statemachine.Change{
+			OrderID: orderID,
+			To:      statemachine.StatusApproved,
+			Actor:   actor,
+			Match:   bson.M{"user_id": *actor.ID},
+			Set:     bson.M{"approval_date": time.Now()},
+		}); err != nil {
+			return err
+		}
+		order, err := s.orders.FindOne(tc, bson.M{"_id": orderID})
+		if err != nil {
+			return err
+		}
+		if order.WriterID == nil {
+			return ErrWriterNotFound
+		}
+		_, err = s.earnings.Accrue(tc, payoutservices.Accrual{
+			OrderID:      orderID,
+			ClientID:     order.UserID,
+			WriterID:     *order.WriterID,
+			OrderLevelID: order.OrderLevelID,
+		})
+		return err
+	})
 }
 
-func (s *OrderService) ProvideFeedback(orderID, userID primitive.ObjectID, feedback string) error {
+func (s *OrderService) ProvideFeedback(orderID primitive.ObjectID, actor statemachine.Actor, feedback string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Verify order belongs to the user and is in the correct status
-	result := s.orderCollection.FindOne(ctx, bson.M{"_id": orderID, "user_id": userID, "status": "submitted_for_review"})
-	if result.Err() != nil {
-		return errors.New("order not found or not awaiting feedback from this user")
-	}
-
-	// Increment apply_feedback_requests when feedback is requested
-	// Take the current number of requests of the order and increment it by 1
-	feedbackCount := 0
-	err := s.orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&bson.M{"apply_feedback_requests": &feedbackCount})
+	current, err := s.orders.FindOne(ctx, bson.M{"_id": orderID, "user_id": *actor.ID})
 	if err != nil {
-		return errors.New("failed to retrieve current feedback request count")
+		if err == mongo.ErrNoDocuments {
+			return statemachine.ErrOrderNotFound
+		}
+		return err
 	}
-
-	if feedbackCount >= 4 {
-		return errors.New("feedback request limit reached for this order")
+	if current.ApplyFeedbackRequests >= maxFeedbackRequests {
+		return &statemachine.TransitionError{From: current.Status, To: statemachine.StatusFeedback, Reason: "feedback request limit reached for this order"}
 	}
-	// Update the order status to 'feedback' and set the feedback
-	_, err = s.orderCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": orderID, "user_id": userID, "status": "submitted_for_review"},
-		bson.M{"$set": bson.M{"status": "feedback", "feedback": feedback, "feedback_date": time.Now()}, "$inc": bson.M{"apply_feedback_requests": feedbackCount + 1}},
-	)
-	return err
+
+	return s.apply(ctx, statemachine.Change{
+		OrderID: orderID,
+		To:      statemachine.StatusFeedback,
+		Actor:   actor,
+		Reason:  feedback,
+		Match:   bson.M{"user_id": *actor.ID, "apply_feedback_requests": current.ApplyFeedbackRequests},
+		Set:     bson.M{"feedback": feedback, "feedback_date": time.Now()},
+		Inc:     bson.M{"apply_feedback_requests": 1},
+	})
 }
 
-func (s *OrderService) WriterAssignmentResponse(orderID, writerID primitive.ObjectID, accept bool) error {
+func (s *OrderService) WriterAssignmentResponse(orderID primitive.ObjectID, actor statemachine.Actor, accept bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	change := statemachine.Change{
+		OrderID: orderID,
+		Actor:   actor,
+		Match:   bson.M{"writer_id": *actor.ID},
+	}
 	if accept {
 		// Writer accepts: set status to assigned and update assignment_date
-		_, err := s.orderCollection.UpdateOne(
-			ctx,
-			bson.M{"_id": orderID, "writer_id": writerID, "status": "awaiting_asign_acceptance"},
-			bson.M{"$set": bson.M{"status": "assigned", "assignment_acceptance_date": time.Now()}},
-		)
-		return err
+		change.To = statemachine.StatusAssigned
+		change.Set = bson.M{"assignment_acceptance_date": time.Now()}
 	} else {
 		// Writer declines: set status back to paid, clear writer_id and assignment_date
-		_, err := s.orderCollection.UpdateOne(
-			ctx,
-			bson.M{"_id": orderID, "writer_id": writerID, "status": "awaiting_asign_acceptance"},
-			bson.M{"$set": bson.M{"status": "paid"}, "$unset": bson.M{"writer_id": "", "assignment_date": "", "assignment_decline_date": time.Now()}},
-		)
-		return err
-	}
-}
-
-func (s *OrderService) GetDB() *mongo.Database {
-	return s.orderCollection.Database()
-}
-
-// Helper: populate LevelName for orders
-func PopulateOrderLevelNames(orders []models.Order, orderLevelService *OrderLevelService) []models.Order {
-	for i, order := range orders {
-		if order.OrderLevelID.IsZero() {
-			orders[i].LevelName = ""
-			continue
-		}
-		level, err := orderLevelService.GetByID(order.OrderLevelID)
-		if err == nil && level != nil {
-			orders[i].LevelName = level.Name
-		} else {
-			orders[i].LevelName = ""
-		}
-	}
-	return orders
-}
-
-// Helper: populate OrderPagesName for orders
-func PopulateOrderPagesNames(orders []models.Order, orderPagesService *OrderPagesService) []models.Order {
-	for i, order := range orders {
-		if order.OrderPagesID.IsZero() {
-			orders[i].OrderPagesName = ""
-			continue
-		}
-		pages, err := orderPagesService.GetByID(order.OrderPagesID)
-		if err == nil && pages != nil {
-			orders[i].OrderPagesName = pages.Name
-		} else {
-			orders[i].OrderPagesName = ""
-		}
-	}
-	return orders
-}
-
-// Helper: populate OrderUrgencyName for orders
-func PopulateOrderUrgencyNames(orders []models.Order, orderUrgencyService *OrderUrgencyService) []models.Order {
-	for i, order := range orders {
-		if order.OrderUrgencyID.IsZero() {
-			orders[i].OrderUrgencyName = ""
-			continue
-		}
-		urgency, err := orderUrgencyService.GetByID(order.OrderUrgencyID)
-		if err == nil && urgency != nil {
-			orders[i].OrderUrgencyName = urgency.Name
-		} else {
-			orders[i].OrderUrgencyName = ""
-		}
+		change.To = statemachine.StatusPaid
+		change.Reason = "writer declined assignment"
+		change.Set = bson.M{"assignment_decline_date": time.Now()}
+		change.Unset = bson.M{"writer_id": "", "assignment_date": ""}
 	}
-	return orders
+	return s.apply(ctx, change)
 }
 
-// Helper: populate OrderStyleName for orders
-func PopulateOrderStyleNames(orders []models.Order, orderStyleService *OrderStyleService) []models.Order {
-	for i, order := range orders {
-		if order.OrderStyleID.IsZero() {
-			orders[i].OrderStyleName = ""
-			continue
-		}
-		style, err := orderStyleService.GetByID(order.OrderStyleID)
-		if err == nil && style != nil {
-			orders[i].OrderStyleName = style.Name
-		} else {
-			orders[i].OrderStyleName = ""
-		}
-	}
-	return orders
+// apply makes one transition in a transaction of its own, so the status
+// change and its order_events entry are written together or not at all
+func (s *OrderService) apply(ctx context.Context, change statemachine.Change) error {
+	return s.tx.WithTransaction(ctx, func(tc context.Context) error {
+		_, err := s.machine.Apply(tc, change)
+		return err
+	})
 }
 
-// Helper: populate OrderLanguageName for orders
-func PopulateOrderLanguageNames(orders []models.Order, orderLanguageService *OrderLanguageService) []models.Order {
-	for i, order := range orders {
-		if order.OrderLanguageID.IsZero() {
-			orders[i].OrderLanguageName = ""
-			continue
-		}
-		lang, err := orderLanguageService.GetByID(order.OrderLanguageID)
-		if err == nil && lang != nil {
-			orders[i].OrderLanguageName = lang.Name
-		} else {
-			orders[i].OrderLanguageName = ""
+func (s *OrderService) GetOrderByID(id primitive.ObjectID) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	order, err := s.orders.FindOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, statemachine.ErrOrderNotFound
 		}
+		return nil, err
 	}
-	return orders
+	return order, nil
 }
 
-// PopulateWriterNames populates WriterName for each order if WriterID is set
-func PopulateWriterNames(orders []models.Order, userService *userservices.UserService) []models.Order {
-	for i, order := range orders {
-		if order.WriterID != nil && !order.WriterID.IsZero() {
-			user, err := userService.GetUserByID(*order.WriterID)
-			if err == nil && user != nil {
-				if user.FirstName != "" || user.LastName != "" {
-					orders[i].WriterName = user.FirstName + " " + user.LastName
-				} else {
-					orders[i].WriterName = user.Username
-				}
-				orders[i].WriterUsername = user.Username
-				orders[i].WriterNumber = user.UserNumber
-			} else {
-				orders[i].WriterName = ""
-				orders[i].WriterUsername = ""
-				orders[i].WriterNumber = ""
-			}
-		} else {
-			orders[i].WriterName = ""
-			orders[i].WriterUsername = ""
-			orders[i].WriterNumber = ""
-		}
-	}
-	return orders
+// GetOrderHistory returns the recorded status transitions of an order
+func (s *OrderService) GetOrderHistory(id primitive.ObjectID) ([]models.OrderEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.machine.History(ctx, id)
 }
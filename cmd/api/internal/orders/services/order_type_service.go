@@ -4,6 +4,9 @@ import (
 	"context"
 	"time"
 
+	catalogrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/repository"
+	catalogservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/catalog/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,86 +14,115 @@ import (
 )
 
 type OrderTypeService struct {
-	Collection *mongo.Collection
+	types   catalogrepository.Repository
+	counter database.Counter
 }
 
 func NewOrderTypeService(col *mongo.Collection) *OrderTypeService {
-	return &OrderTypeService{Collection: col}
+	return NewOrderTypeServiceWith(catalogrepository.NewMongoStore(col.Database()))
+}
+
+// NewOrderTypeServiceWith keeps order types in the order_types collection of store
+func NewOrderTypeServiceWith(store catalogrepository.Store) *OrderTypeService {
+	return &OrderTypeService{types: store.Catalog("order_types"), counter: store}
+}
+
+// orderTypeReferences lists where order types are referenced
+var orderTypeReferences = []catalogservices.Reference{
+	{Collection: "orders", Field: "order_type_id"},
+	{Collection: "promotions", Field: "order_type_ids"},
+}
+
+// activeFilter leaves archived order types out unless includeArchived is set
+func activeFilter(includeArchived bool) bson.M {
+	if includeArchived {
+		return bson.M{}
+	}
+	return bson.M{"active": bson.M{"$ne": false}}
 }
 
 func (s *OrderTypeService) Create(ctx context.Context, orderType *models.OrderType) error {
 	orderType.ID = primitive.NewObjectID()
 	orderType.CreatedAt = time.Now()
 	orderType.UpdatedAt = time.Now()
-	_, err := s.Collection.InsertOne(ctx, orderType)
-	return err
+	return s.types.Insert(ctx, orderType)
 }
 
 func (s *OrderTypeService) GetByID(ctx context.Context, id primitive.ObjectID) (*models.OrderType, error) {
 	var orderType models.OrderType
-	err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&orderType)
-	if err != nil {
+	if err := s.types.FindOne(ctx, bson.M{"_id": id}, &orderType); err != nil {
 		return nil, err
 	}
 	return &orderType, nil
 }
 
-func (s *OrderTypeService) List(ctx context.Context) ([]models.OrderType, error) {
-	cur, err := s.Collection.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	defer cur.Close(ctx)
+func (s *OrderTypeService) List(ctx context.Context, includeArchived bool) ([]models.OrderType, error) {
 	var orderTypes []models.OrderType
-	for cur.Next(ctx) {
-		var ot models.OrderType
-		if err := cur.Decode(&ot); err != nil {
-			return nil, err
-		}
-		orderTypes = append(orderTypes, ot)
+	if err := s.types.Find(ctx, activeFilter(includeArchived), catalogrepository.Page{}, &orderTypes); err != nil {
+		return nil, err
 	}
 	return orderTypes, nil
 }
 
 // ListPaginated returns paginated order types and total count
-func (s *OrderTypeService) ListPaginated(ctx context.Context, page, pageSize int) ([]models.OrderType, int64, error) {
+func (s *OrderTypeService) ListPaginated(ctx context.Context, page, pageSize int, includeArchived bool) ([]models.OrderType, int64, error) {
 	skip := int64((page - 1) * pageSize)
 	limit := int64(pageSize)
-	total, err := s.Collection.CountDocuments(ctx, bson.M{})
+	filter := activeFilter(includeArchived)
+	total, err := s.types.Count(ctx, filter)
 	if err != nil {
 		return nil, 0, err
 	}
-	cur, err := s.Collection.Find(ctx, bson.M{}, nil)
-	if err != nil {
+	orderTypes := []models.OrderType{}
+	if err := s.types.Find(ctx, filter, catalogrepository.Page{Skip: skip, Limit: limit}, &orderTypes); err != nil {
 		return nil, 0, err
 	}
-	defer cur.Close(ctx)
-	var allOrderTypes []models.OrderType
-	for cur.Next(ctx) {
-		var ot models.OrderType
-		if err := cur.Decode(&ot); err != nil {
-			return nil, 0, err
-		}
-		allOrderTypes = append(allOrderTypes, ot)
-	}
-	start := int(skip)
-	end := start + int(limit)
-	if start > len(allOrderTypes) {
-		return []models.OrderType{}, total, nil
-	}
-	if end > len(allOrderTypes) {
-		end = len(allOrderTypes)
-	}
-	return allOrderTypes[start:end], total, nil
+	return orderTypes, total, nil
 }
 
 func (s *OrderTypeService) Update(ctx context.Context, id primitive.ObjectID, update bson.M) error {
 	update["updated_at"] = time.Now()
-	_, err := s.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
+	_, err := s.types.Update(ctx, bson.M{"_id": id}, update)
 	return err
 }
 
+// Delete removes an order type no order or promotion refers to; otherwise
+// it returns a *catalogservices.InUseError
 func (s *OrderTypeService) Delete(ctx context.Context, id primitive.ObjectID) error {
-	_, err := s.Collection.DeleteOne(ctx, bson.M{"_id": id})
+	return catalogservices.DeleteUnreferenced(ctx, s.types, s.counter, id, orderTypeReferences)
+}
+
+// SetActive archives (false) or restores (true) an order type. Archived types
+// are left out of lists and cannot be ordered, but still resolve by ID.
+func (s *OrderTypeService) SetActive(ctx context.Context, id primitive.ObjectID, active bool) error {
+	matched, err := s.types.Update(ctx, bson.M{"_id": id}, bson.M{"active": active, "updated_at": time.Now()})
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return catalogservices.ErrEntryNotFound
+	}
+	return nil
+}
+
+// RequireActive checks an order type exists and is not archived, giving
+// catalogservices.ErrEntryNotFound or ErrEntryArchived otherwise
+func (s *OrderTypeService) RequireActive(ctx context.Context, id primitive.ObjectID) error {
+	orderType, err := s.GetByID(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return catalogservices.ErrEntryNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !orderType.Active {
+		return catalogservices.ErrEntryArchived
+	}
+	return nil
+}
+
+// Backfill marks order types created before archiving existed as active
+func (s *OrderTypeService) Backfill(ctx context.Context) error {
+	_, err := s.types.Update(ctx, bson.M{"active": bson.M{"$exists": false}}, bson.M{"active": true})
 	return err
 }
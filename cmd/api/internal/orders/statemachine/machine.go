@@ -0,0 +1,107 @@
+package statemachine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrOrderNotFound is returned when no order matches the change
+var ErrOrderNotFound = errors.New("order not found")
+
+// Change describes one transition of one order
+type Change struct {
+	OrderID primitive.ObjectID
+	To      string
+	Actor   Actor
+	Reason  string
+	Match   bson.M // extra conditions the order must meet, e.g. {"writer_id": id}
+	Set     bson.M // fields written together with the new status
+	Unset   bson.M
+	Inc     bson.M
+}
+
+// Machine applies transitions to the orders collection and records each one in order_events
+type Machine struct {
+	orders repository.OrderRepository
+	events repository.OrderEventRepository
+}
+
+func NewMachine(db *mongo.Database) *Machine {
+	return NewMachineWith(repository.NewMongoOrderRepository(db), repository.NewMongoOrderEventRepository(db))
+}
+
+// NewMachineWith applies transitions through the given stores, e.g. in-memory ones in tests
+func NewMachineWith(orders repository.OrderRepository, events repository.OrderEventRepository) *Machine {
+	return &Machine{orders: orders, events: events}
+}
+
+// Apply moves the order to ch.To if the transition table allows it for the
+// actor. The status update is conditional on the status it was read with, so
+// two concurrent transitions cannot both succeed. The update and its
+// order_events entry are separate writes: run it inside a transaction
+// (database.Transactor) so a failed insert rolls the status back.
+func (m *Machine) Apply(ctx context.Context, ch Change) (*models.OrderEvent, error) {
+	filter := bson.M{"_id": ch.OrderID}
+	for k, v := range ch.Match {
+		filter[k] = v
+	}
+	current, err := m.orders.FindOne(ctx, filter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	role, err := Authorize(current.Status, ch.To, ch.Actor.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	set := bson.M{"status": ch.To, "updated_at": now}
+	for k, v := range ch.Set {
+		set[k] = v
+	}
+	update := bson.M{"$set": set}
+	if len(ch.Unset) > 0 {
+		update["$unset"] = ch.Unset
+	}
+	if len(ch.Inc) > 0 {
+		update["$inc"] = ch.Inc
+	}
+	filter["status"] = current.Status
+	matched, err := m.orders.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, &TransitionError{From: current.Status, To: ch.To, Reason: "order status changed concurrently"}
+	}
+
+	event := &models.OrderEvent{
+		ID:        primitive.NewObjectID(),
+		OrderID:   ch.OrderID,
+		From:      current.Status,
+		To:        ch.To,
+		ActorID:   ch.Actor.ID,
+		ActorRole: role,
+		Reason:    ch.Reason,
+		CreatedAt: now,
+	}
+	if err := m.events.Insert(ctx, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// History returns every recorded transition of an order, oldest first
+func (m *Machine) History(ctx context.Context, orderID primitive.ObjectID) ([]models.OrderEvent, error) {
+	return m.events.ListByOrder(ctx, orderID)
+}
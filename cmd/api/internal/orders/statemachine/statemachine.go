@@ -0,0 +1,153 @@
+// Package statemachine is the single source of truth for order statuses, the
+// transitions allowed between them and who may trigger each one.
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Order statuses
+const (
+	StatusPendingPayment     = "pending_payment"
+	StatusPaid               = "paid"
+	StatusAwaitingAcceptance = "awaiting_asign_acceptance"
+	StatusAssigned           = "assigned"
+	StatusSubmittedForReview = "submitted_for_review"
+	StatusFeedback           = "feedback"
+	StatusApproved           = "approved"
+	StatusDisputed           = "disputed" // the client opened a chargeback with the payment provider
+	StatusRefunded           = "refunded"
+	StatusPartiallyRefunded  = "partially_refunded"
+	StatusOnHold             = "on_hold" // the provider took the payment back after work started; the client has to pay again
+)
+
+// Actor roles. RoleSystem is used for transitions the platform performs on its
+// own (e.g. a confirmed payment) rather than on behalf of a logged in user.
+const (
+	RoleClient     = "user"
+	RoleWriter     = "writer"
+	RoleAdmin      = "admin"
+	RoleSuperAdmin = "super_admin"
+	RoleSystem     = "system"
+)
+
+// Rule allows moving an order From one status To another by any of Roles
+type Rule struct {
+	From  string
+	To    string
+	Roles []string
+}
+
+var rules = []Rule{
+	{From: StatusPendingPayment, To: StatusPaid, Roles: []string{RoleSystem}},
+	{From: StatusPaid, To: StatusPendingPayment, Roles: []string{RoleSystem}}, // provider denied the capture afterwards
+	{From: StatusPaid, To: StatusAwaitingAcceptance, Roles: []string{RoleAdmin, RoleSuperAdmin}},
+	{From: StatusFeedback, To: StatusAwaitingAcceptance, Roles: []string{RoleAdmin, RoleSuperAdmin}},
+	{From: StatusAwaitingAcceptance, To: StatusAssigned, Roles: []string{RoleWriter}},
+	{From: StatusAwaitingAcceptance, To: StatusPaid, Roles: []string{RoleWriter}}, // writer declined
+	{From: StatusAssigned, To: StatusSubmittedForReview, Roles: []string{RoleWriter}},
+	{From: StatusSubmittedForReview, To: StatusApproved, Roles: []string{RoleClient}},
+	{From: StatusSubmittedForReview, To: StatusFeedback, Roles: []string{RoleClient}},
+	{From: StatusDisputed, To: StatusRefunded, Roles: []string{RoleSystem}},
+	{From: StatusPartiallyRefunded, To: StatusRefunded, Roles: []string{RoleAdmin, RoleSuperAdmin, RoleSystem}},
+	{From: StatusPartiallyRefunded, To: StatusDisputed, Roles: []string{RoleSystem}},
+	{From: StatusOnHold, To: StatusPaid, Roles: []string{RoleSystem}}, // paid again
+}
+
+// paidStatuses are the statuses in which the platform holds the client's money
+var paidStatuses = []string{
+	StatusPaid, StatusAwaitingAcceptance, StatusAssigned, StatusSubmittedForReview, StatusFeedback, StatusApproved,
+}
+
+func init() {
+	// Admins (through the refunds API) and provider notifications can refund a
+	// paid order at any point of the workflow; only the provider opens disputes
+	refunders := []string{RoleAdmin, RoleSuperAdmin, RoleSystem}
+	for _, from := range paidStatuses {
+		rules = append(rules,
+			Rule{From: from, To: StatusRefunded, Roles: refunders},
+			Rule{From: from, To: StatusPartiallyRefunded, Roles: refunders},
+			Rule{From: from, To: StatusDisputed, Roles: []string{RoleSystem}},
+		)
+		if from != StatusPaid {
+			// The provider denied the capture once a writer was involved
+			rules = append(rules, Rule{From: from, To: StatusOnHold, Roles: []string{RoleSystem}})
+		}
+	}
+}
+
+// Statuses lists every known order status
+func Statuses() []string {
+	return []string{
+		StatusPendingPayment, StatusPaid, StatusAwaitingAcceptance, StatusAssigned,
+		StatusSubmittedForReview, StatusFeedback, StatusApproved, StatusDisputed, StatusRefunded,
+		StatusPartiallyRefunded, StatusOnHold,
+	}
+}
+
+// Rules returns a copy of the transition table
+func Rules() []Rule {
+	out := make([]Rule, len(rules))
+	copy(out, rules)
+	return out
+}
+
+// Actor is whoever triggers a transition
+type Actor struct {
+	ID    *primitive.ObjectID
+	Roles []string
+}
+
+// UserActor builds an actor for a logged in user
+func UserActor(id primitive.ObjectID, roles []string) Actor {
+	return Actor{ID: &id, Roles: roles}
+}
+
+// SystemActor is the actor for transitions performed by the platform itself
+func SystemActor() Actor {
+	return Actor{Roles: []string{RoleSystem}}
+}
+
+// ErrIllegalTransition matches every *TransitionError via errors.Is
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// TransitionError explains why an order could not move between two statuses
+type TransitionError struct {
+	From   string
+	To     string
+	Reason string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move order from %q to %q: %s", e.From, e.To, e.Reason)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// Authorize checks the transition table and returns the role that allows the
+// transition, or a *TransitionError.
+func Authorize(from, to string, roles []string) (string, error) {
+	known := false
+	for _, rule := range rules {
+		if rule.From != from || rule.To != to {
+			continue
+		}
+		known = true
+		for _, allowed := range rule.Roles {
+			for _, role := range roles {
+				if role == allowed {
+					return role, nil
+				}
+			}
+		}
+	}
+	if !known {
+		return "", &TransitionError{From: from, To: to, Reason: "transition not allowed"}
+	}
+	return "", &TransitionError{From: from, To: to, Reason: "role not permitted to perform this transition"}
+}
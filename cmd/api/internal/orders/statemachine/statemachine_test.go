@@ -0,0 +1,215 @@
+package statemachine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuthorize(t *testing.T) {
+	client := []string{RoleClient}
+	writer := []string{RoleWriter}
+	admin := []string{RoleAdmin}
+	system := []string{RoleSystem}
+	for _, tc := range []struct {
+		from, to string
+		roles    []string
+		want     string // the role that allows it, or empty when refused
+	}{
+		{StatusPendingPayment, StatusPaid, system, RoleSystem},
+		{StatusPaid, StatusAwaitingAcceptance, admin, RoleAdmin},
+		{StatusPaid, StatusAwaitingAcceptance, []string{RoleSuperAdmin}, RoleSuperAdmin},
+		{StatusFeedback, StatusAwaitingAcceptance, admin, RoleAdmin},
+		{StatusAwaitingAcceptance, StatusAssigned, writer, RoleWriter},
+		{StatusAwaitingAcceptance, StatusPaid, writer, RoleWriter},
+		{StatusAssigned, StatusSubmittedForReview, writer, RoleWriter},
+		{StatusSubmittedForReview, StatusApproved, client, RoleClient},
+		{StatusSubmittedForReview, StatusFeedback, client, RoleClient},
+		{StatusAssigned, StatusRefunded, admin, RoleAdmin},
+		{StatusApproved, StatusPartiallyRefunded, system, RoleSystem},
+		{StatusPartiallyRefunded, StatusRefunded, admin, RoleAdmin},
+		{StatusAssigned, StatusDisputed, system, RoleSystem},
+		{StatusAssigned, StatusOnHold, system, RoleSystem},
+		{StatusOnHold, StatusPaid, system, RoleSystem},
+		// The first role that is allowed wins
+		{StatusSubmittedForReview, StatusApproved, []string{RoleWriter, RoleClient}, RoleClient},
+
+		// Allowed transitions, wrong role
+		{StatusPendingPayment, StatusPaid, client, ""},
+		{StatusPaid, StatusAwaitingAcceptance, writer, ""},
+		{StatusAwaitingAcceptance, StatusAssigned, admin, ""},
+		{StatusSubmittedForReview, StatusApproved, writer, ""},
+		{StatusAssigned, StatusDisputed, admin, ""},
+		{StatusAssigned, StatusRefunded, client, ""},
+		{StatusPaid, StatusAwaitingAcceptance, nil, ""},
+
+		// Transitions that do not exist
+		{StatusPendingPayment, StatusApproved, system, ""},
+		{StatusPaid, StatusOnHold, system, ""},
+		{StatusApproved, StatusFeedback, client, ""},
+		{StatusRefunded, StatusPaid, system, ""},
+		{StatusPaid, StatusPaid, system, ""},
+		{"shipped", StatusPaid, system, ""},
+	} {
+		role, err := Authorize(tc.from, tc.to, tc.roles)
+		if tc.want == "" {
+			var transitionErr *TransitionError
+			if !errors.As(err, &transitionErr) || !errors.Is(err, ErrIllegalTransition) || transitionErr.From != tc.from || transitionErr.To != tc.to {
+				t.Errorf("%s -> %s by %v = %q, %v; want a TransitionError", tc.from, tc.to, tc.roles, role, err)
+			}
+			continue
+		}
+		if err != nil || role != tc.want {
+			t.Errorf("%s -> %s by %v = %q, %v; want %q", tc.from, tc.to, tc.roles, role, err, tc.want)
+		}
+	}
+}
+
+func TestRulesOnlyUseKnownStatuses(t *testing.T) {
+	known := map[string]bool{}
+	for _, status := range Statuses() {
+		known[status] = true
+	}
+	for _, rule := range Rules() {
+		if !known[rule.From] || !known[rule.To] || len(rule.Roles) == 0 {
+			t.Errorf("rule %+v", rule)
+		}
+	}
+}
+
+// failingEvents stores orders' history but refuses every new event
+type failingEvents struct {
+	repository.OrderEventRepository
+}
+
+func (failingEvents) Insert(ctx context.Context, event *models.OrderEvent) error {
+	return errors.New("order_events unavailable")
+}
+
+type fixture struct {
+	t      *testing.T
+	store  *database.MemoryStore
+	orders repository.OrderRepository
+	events repository.OrderEventRepository
+	client primitive.ObjectID
+}
+
+func newFixture(t *testing.T) *fixture {
+	store := database.NewMemoryStore()
+	return &fixture{
+		t:      t,
+		store:  store,
+		orders: repository.NewMemoryOrderRepository(store),
+		events: repository.NewMemoryOrderEventRepository(store),
+		client: primitive.NewObjectID(),
+	}
+}
+
+// order stores an order of the client in status
+func (f *fixture) order(status string) primitive.ObjectID {
+	f.t.Helper()
+	order := &models.Order{ID: primitive.NewObjectID(), UserID: f.client, Title: "Lab report", Price: 42.5, Status: status}
+	if err := f.orders.Insert(context.Background(), order); err != nil {
+		f.t.Fatal(err)
+	}
+	return order.ID
+}
+
+func (f *fixture) status(orderID primitive.ObjectID) string {
+	f.t.Helper()
+	order, err := f.orders.FindOne(context.Background(), bson.M{"_id": orderID})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return order.Status
+}
+
+func (f *fixture) history(orderID primitive.ObjectID) []models.OrderEvent {
+	f.t.Helper()
+	events, err := f.events.ListByOrder(context.Background(), orderID)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return events
+}
+
+func TestApply(t *testing.T) {
+	f := newFixture(t)
+	m := NewMachineWith(f.orders, f.events)
+	ctx := context.Background()
+	orderID := f.order(StatusSubmittedForReview)
+	client := UserActor(f.client, []string{RoleClient})
+
+	event, err := m.Apply(ctx, Change{
+		OrderID: orderID,
+		To:      StatusFeedback,
+		Actor:   client,
+		Reason:  "add references",
+		Match:   bson.M{"user_id": f.client},
+		Set:     bson.M{"feedback": "add references"},
+		Inc:     bson.M{"apply_feedback_requests": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.From != StatusSubmittedForReview || event.To != StatusFeedback || event.ActorRole != RoleClient || *event.ActorID != f.client {
+		t.Errorf("event = %+v", event)
+	}
+	order, err := f.orders.FindOne(ctx, bson.M{"_id": orderID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != StatusFeedback || order.Feedback != "add references" || order.ApplyFeedbackRequests != 1 {
+		t.Errorf("order = %+v", order)
+	}
+	if history := f.history(orderID); len(history) != 1 || history[0].ID != event.ID || history[0].Reason != "add references" {
+		t.Errorf("history = %+v", history)
+	}
+
+	for _, tc := range []struct {
+		name string
+		ch   Change
+		want error
+	}{
+		{"illegal transition", Change{OrderID: orderID, To: StatusApproved, Actor: client}, ErrIllegalTransition},
+		{"role not permitted", Change{OrderID: orderID, To: StatusAwaitingAcceptance, Actor: client}, ErrIllegalTransition},
+		{"match fails", Change{OrderID: orderID, To: StatusAwaitingAcceptance, Actor: SystemActor(), Match: bson.M{"user_id": primitive.NewObjectID()}}, ErrOrderNotFound},
+		{"unknown order", Change{OrderID: primitive.NewObjectID(), To: StatusPaid, Actor: SystemActor()}, ErrOrderNotFound},
+	} {
+		if _, err := m.Apply(ctx, tc.ch); !errors.Is(err, tc.want) {
+			t.Errorf("%s: Apply = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if status := f.status(orderID); status != StatusFeedback {
+		t.Errorf("order is %s after refused transitions, want feedback", status)
+	}
+	if history := f.history(orderID); len(history) != 1 {
+		t.Errorf("refused transitions were recorded: %+v", history)
+	}
+}
+
+func TestApplyRollsBackWhenHistoryFails(t *testing.T) {
+	f := newFixture(t)
+	m := NewMachineWith(f.orders, failingEvents{f.events})
+	orderID := f.order(StatusPendingPayment)
+
+	err := f.store.WithTransaction(context.Background(), func(ctx context.Context) error {
+		_, err := m.Apply(ctx, Change{OrderID: orderID, To: StatusPaid, Actor: SystemActor(), Set: bson.M{"payment_id": primitive.NewObjectID()}})
+		return err
+	})
+	if err == nil {
+		t.Fatal("Apply succeeded without recording the transition")
+	}
+	if status := f.status(orderID); status != StatusPendingPayment {
+		t.Errorf("order is %s although its transition was not recorded, want pending_payment", status)
+	}
+	if history := f.history(orderID); len(history) != 0 {
+		t.Errorf("history = %+v", history)
+	}
+}
@@ -0,0 +1,127 @@
+// Package gateways abstracts the payment providers the shop can charge through.
+// Each provider is a PaymentGateway selected by the method name clients send in
+// their payment request (e.g. "paypal", "mastercard").
+package gateways
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Transaction statuses reported by gateways
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusRefunded   = "refunded"
+	StatusVoided     = "voided"
+	StatusDeclined   = "declined"
+	StatusPending    = "pending"
+)
+
+var (
+	// ErrDeclined means the provider refused the payment
+	ErrDeclined = errors.New("payment declined")
+	// ErrTimeout means the provider did not answer in time; the outcome is unknown
+	ErrTimeout = errors.New("payment gateway timeout")
+	// ErrUnknownMethod means no gateway is configured for the requested method
+	ErrUnknownMethod = errors.New("payment method not available")
+)
+
+// AuthorizeRequest is what the shop asks a gateway to reserve
+type AuthorizeRequest struct {
+	Reference string                 // our order ID, sent to the provider for reconciliation
+	Amount    float64                // amount in major units
+	Currency  string                 // ISO 4217 code
+	Info      map[string]interface{} // provider specific payment details from the client
+}
+
+// Result is a gateway's view of a transaction after an operation
+type Result struct {
+	TransactionID string  `json:"transaction_id"`
+	Status        string  `json:"status"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	Message       string  `json:"message,omitempty"`
+}
+
+// PaymentGateway is implemented by every payment provider adapter.
+// Capture and Refund take the TransactionID returned by the previous step;
+// the Result of Refund carries the provider's ID for that refund.
+type PaymentGateway interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	Capture(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error)
+	Refund(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error)
+	Void(ctx context.Context, transactionID string) (*Result, error)
+	Status(ctx context.Context, transactionID string) (*Result, error)
+}
+
+// Registry maps payment method names to gateways
+type Registry struct {
+	mu       sync.RWMutex
+	gateways map[string]PaymentGateway
+}
+
+func NewRegistry(gateways ...PaymentGateway) *Registry {
+	r := &Registry{gateways: map[string]PaymentGateway{}}
+	for _, g := range gateways {
+		r.Register(g)
+	}
+	return r
+}
+
+// NewRegistryFromEnv registers every provider that has credentials configured.
+// The simulator is only available when PAYMENT_SIMULATOR=true.
+func NewRegistryFromEnv() *Registry {
+	r := NewRegistry()
+	if cfg, ok := PayPalConfigFromEnv(); ok {
+		r.Register(NewPayPalGateway(cfg))
+	}
+	if cfg, ok := MastercardConfigFromEnv(); ok {
+		r.Register(NewMastercardGateway(cfg))
+	}
+	if os.Getenv("PAYMENT_SIMULATOR") == "true" {
+		r.Register(NewSimulator(DefaultSimulatorConfig()))
+	}
+	return r
+}
+
+func (r *Registry) Register(g PaymentGateway) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gateways[g.Name()] = g
+}
+
+// Get returns the gateway for a payment method
+func (r *Registry) Get(method string) (PaymentGateway, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g, ok := r.gateways[method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+	return g, nil
+}
+
+// Methods lists the configured payment methods
+func (r *Registry) Methods() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	methods := make([]string, 0, len(r.gateways))
+	for name := range r.gateways {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func stringInfo(info map[string]interface{}, key string) string {
+	if v, ok := info[key]; ok && v != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package gateways
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// MastercardConfig holds Mastercard Payment Gateway Services (MPGS) REST credentials
+type MastercardConfig struct {
+	BaseURL     string // e.g. https://ap-gateway.mastercard.com
+	MerchantID  string
+	APIPassword string
+	APIVersion  string
+}
+
+// MastercardConfigFromEnv reads MASTERCARD_GATEWAY_URL, MASTERCARD_MERCHANT_ID,
+// MASTERCARD_API_PASSWORD and MASTERCARD_API_VERSION
+func MastercardConfigFromEnv() (MastercardConfig, bool) {
+	cfg := MastercardConfig{
+		BaseURL:     os.Getenv("MASTERCARD_GATEWAY_URL"),
+		MerchantID:  os.Getenv("MASTERCARD_MERCHANT_ID"),
+		APIPassword: os.Getenv("MASTERCARD_API_PASSWORD"),
+		APIVersion:  os.Getenv("MASTERCARD_API_VERSION"),
+	}
+	if cfg.APIVersion == "" {
+		cfg.APIVersion = "78"
+	}
+	return cfg, cfg.BaseURL != "" && cfg.MerchantID != "" && cfg.APIPassword != ""
+}
+
+// MastercardGateway charges cards through MPGS. Every payment is an MPGS order
+// and our TransactionID is that order's ID; captures, refunds and voids are
+// further transactions on the same MPGS order.
+type MastercardGateway struct {
+	config MastercardConfig
+	client *http.Client
+}
+
+func NewMastercardGateway(config MastercardConfig) *MastercardGateway {
+	return &MastercardGateway{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (g *MastercardGateway) Name() string { return "mastercard" }
+
+type mpgsResponse struct {
+	Result   string `json:"result"`
+	Response struct {
+		GatewayCode string `json:"gatewayCode"`
+	} `json:"response"`
+	Order struct {
+		ID                  string  `json:"id"`
+		Amount              float64 `json:"amount"`
+		Currency            string  `json:"currency"`
+		Status              string  `json:"status"`
+		TotalCapturedAmount float64 `json:"totalCapturedAmount"`
+		TotalRefundedAmount float64 `json:"totalRefundedAmount"`
+	} `json:"order"`
+	Transaction struct {
+		ID     string  `json:"id"`
+		Amount float64 `json:"amount"`
+	} `json:"transaction"`
+}
+
+func (g *MastercardGateway) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	card := map[string]interface{}{
+		"number": stringInfo(req.Info, "card_number"),
+		"expiry": map[string]string{
+			"month": stringInfo(req.Info, "expiry_month"),
+			"year":  stringInfo(req.Info, "expiry_year"),
+		},
+		"securityCode": stringInfo(req.Info, "cvv"),
+	}
+	body := map[string]interface{}{
+		"apiOperation": "AUTHORIZE",
+		"order":        map[string]string{"amount": formatAmount(req.Amount, req.Currency), "currency": req.Currency, "reference": req.Reference},
+		"sourceOfFunds": map[string]interface{}{
+			"type":     "CARD",
+			"provided": map[string]interface{}{"card": card},
+		},
+	}
+	// A fresh MPGS order per attempt so a declined attempt can be retried
+	mpgsOrderID := req.Reference + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	out, err := g.transaction(ctx, mpgsOrderID, "authorize", body)
+	if err != nil {
+		return nil, err
+	}
+	return g.result(mpgsOrderID, out, req.Amount, req.Currency)
+}
+
+func (g *MastercardGateway) Capture(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error) {
+	body := map[string]interface{}{
+		"apiOperation": "CAPTURE",
+		"transaction":  map[string]string{"amount": formatAmount(amount, currency), "currency": currency},
+	}
+	out, err := g.transaction(ctx, transactionID, "capture", body)
+	if err != nil {
+		return nil, err
+	}
+	return g.result(transactionID, out, amount, currency)
+}
+
+func (g *MastercardGateway) Refund(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error) {
+	body := map[string]interface{}{
+		"apiOperation": "REFUND",
+		"transaction":  map[string]string{"amount": formatAmount(amount, currency), "currency": currency},
+	}
+	refundID := "refund-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	out, err := g.transaction(ctx, transactionID, refundID, body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := g.result(transactionID, out, amount, currency)
+	if res != nil {
+		res.TransactionID = refundID
+	}
+	return res, err
+}
+
+func (g *MastercardGateway) Void(ctx context.Context, transactionID string) (*Result, error) {
+	body := map[string]interface{}{
+		"apiOperation": "VOID",
+		"transaction":  map[string]string{"targetTransactionId": "authorize"},
+	}
+	out, err := g.transaction(ctx, transactionID, "void", body)
+	if err != nil {
+		return nil, err
+	}
+	return g.result(transactionID, out, 0, "")
+}
+
+func (g *MastercardGateway) Status(ctx context.Context, transactionID string) (*Result, error) {
+	var out mpgsResponse
+	if err := g.do(ctx, http.MethodGet, g.orderPath(transactionID), nil, &out.Order); err != nil {
+		return nil, err
+	}
+	out.Result = "SUCCESS"
+	return g.result(transactionID, &out, out.Order.Amount, out.Order.Currency)
+}
+
+func (g *MastercardGateway) result(mpgsOrderID string, out *mpgsResponse, amount float64, currency string) (*Result, error) {
+	res := &Result{TransactionID: mpgsOrderID, Amount: amount, Currency: currency, Message: out.Response.GatewayCode}
+	if out.Transaction.Amount > 0 {
+		res.Amount = out.Transaction.Amount
+	}
+	if out.Result == "FAILURE" || (out.Response.GatewayCode != "" && out.Response.GatewayCode != "APPROVED") {
+		res.Status = StatusDeclined
+		return res, ErrDeclined
+	}
+	switch out.Order.Status {
+	case "AUTHORIZED":
+		res.Status = StatusAuthorized
+	case "CAPTURED", "PARTIALLY_CAPTURED":
+		res.Status = StatusCaptured
+	case "REFUNDED", "PARTIALLY_REFUNDED":
+		res.Status = StatusRefunded
+	case "CANCELLED":
+		res.Status = StatusVoided
+	case "FAILED", "DECLINED":
+		res.Status = StatusDeclined
+		return res, ErrDeclined
+	default:
+		res.Status = StatusPending
+	}
+	return res, nil
+}
+
+func (g *MastercardGateway) orderPath(mpgsOrderID string) string {
+	return fmt.Sprintf("/api/rest/version/%s/merchant/%s/order/%s", g.config.APIVersion, g.config.MerchantID, mpgsOrderID)
+}
+
+func (g *MastercardGateway) transaction(ctx context.Context, mpgsOrderID, transactionID string, body interface{}) (*mpgsResponse, error) {
+	var out mpgsResponse
+	if err := g.do(ctx, http.MethodPut, g.orderPath(mpgsOrderID)+"/transaction/"+transactionID, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (g *MastercardGateway) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.config.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("merchant."+g.config.MerchantID, g.config.APIPassword)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusBadRequest {
+			return errors.New("mastercard: request rejected: " + string(msg))
+		}
+		return fmt.Errorf("mastercard: %s %s failed with status %d: %s", method, path, resp.StatusCode, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
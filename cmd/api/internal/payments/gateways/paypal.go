@@ -0,0 +1,244 @@
+package gateways
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+)
+
+// PayPalConfig holds REST API credentials (https://developer.paypal.com/api/rest/)
+type PayPalConfig struct {
+	ClientID string
+	Secret   string
+	BaseURL  string // https://api-m.paypal.com or https://api-m.sandbox.paypal.com
+}
+
+// PayPalConfigFromEnv reads PAYPAL_CLIENT_ID, PAYPAL_CLIENT_SECRET and PAYPAL_BASE_URL
+func PayPalConfigFromEnv() (PayPalConfig, bool) {
+	cfg := PayPalConfig{
+		ClientID: os.Getenv("PAYPAL_CLIENT_ID"),
+		Secret:   os.Getenv("PAYPAL_CLIENT_SECRET"),
+		BaseURL:  os.Getenv("PAYPAL_BASE_URL"),
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://api-m.sandbox.paypal.com"
+	}
+	return cfg, cfg.ClientID != "" && cfg.Secret != ""
+}
+
+// PayPalGateway charges PayPal orders the client approved in the browser. The
+// client sends the approved PayPal order ID as payment_info.paypal_order_id.
+type PayPalGateway struct {
+	config PayPalConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewPayPalGateway(config PayPalConfig) *PayPalGateway {
+	return &PayPalGateway{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (g *PayPalGateway) Name() string { return "paypal" }
+
+type paypalAmount struct {
+	Value        string `json:"value"`
+	CurrencyCode string `json:"currency_code"`
+}
+
+type paypalPayment struct {
+	ID     string        `json:"id"`
+	Status string        `json:"status"`
+	Amount *paypalAmount `json:"amount,omitempty"`
+}
+
+func (g *PayPalGateway) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	paypalOrderID := stringInfo(req.Info, "paypal_order_id")
+	if paypalOrderID == "" {
+		return nil, errors.New("paypal: payment_info.paypal_order_id is required")
+	}
+	var out struct {
+		PurchaseUnits []struct {
+			Payments struct {
+				Authorizations []paypalPayment `json:"authorizations"`
+			} `json:"payments"`
+		} `json:"purchase_units"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/v2/checkout/orders/"+paypalOrderID+"/authorize", struct{}{}, &out); err != nil {
+		return nil, err
+	}
+	if len(out.PurchaseUnits) == 0 || len(out.PurchaseUnits[0].Payments.Authorizations) == 0 {
+		return nil, errors.New("paypal: authorization missing from response")
+	}
+	return g.result(out.PurchaseUnits[0].Payments.Authorizations[0], req.Amount, req.Currency)
+}
+
+func (g *PayPalGateway) Capture(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error) {
+	body := map[string]interface{}{
+		"amount":        paypalAmount{Value: formatAmount(amount, currency), CurrencyCode: currency},
+		"final_capture": true,
+	}
+	var out paypalPayment
+	if err := g.do(ctx, http.MethodPost, "/v2/payments/authorizations/"+transactionID+"/capture", body, &out); err != nil {
+		return nil, err
+	}
+	return g.result(out, amount, currency)
+}
+
+func (g *PayPalGateway) Refund(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error) {
+	body := map[string]interface{}{
+		"amount": paypalAmount{Value: formatAmount(amount, currency), CurrencyCode: currency},
+	}
+	var out paypalPayment
+	if err := g.do(ctx, http.MethodPost, "/v2/payments/captures/"+transactionID+"/refund", body, &out); err != nil {
+		return nil, err
+	}
+	return g.result(out, amount, currency)
+}
+
+func (g *PayPalGateway) Void(ctx context.Context, transactionID string) (*Result, error) {
+	if err := g.do(ctx, http.MethodPost, "/v2/payments/authorizations/"+transactionID+"/void", nil, nil); err != nil {
+		return nil, err
+	}
+	return &Result{TransactionID: transactionID, Status: StatusVoided}, nil
+}
+
+func (g *PayPalGateway) Status(ctx context.Context, transactionID string) (*Result, error) {
+	var out paypalPayment
+	err := g.do(ctx, http.MethodGet, "/v2/payments/captures/"+transactionID, nil, &out)
+	if err != nil {
+		// Not a capture, the ID may still refer to an authorization
+		if err := g.do(ctx, http.MethodGet, "/v2/payments/authorizations/"+transactionID, nil, &out); err != nil {
+			return nil, err
+		}
+	}
+	return g.result(out, 0, "")
+}
+
+func (g *PayPalGateway) result(p paypalPayment, amount float64, currency string) (*Result, error) {
+	res := &Result{TransactionID: p.ID, Amount: amount, Currency: currency}
+	if p.Amount != nil {
+		if v, err := strconv.ParseFloat(p.Amount.Value, 64); err == nil {
+			res.Amount = v
+		}
+		res.Currency = p.Amount.CurrencyCode
+	}
+	switch p.Status {
+	case "CREATED":
+		res.Status = StatusAuthorized
+	case "COMPLETED", "CAPTURED":
+		res.Status = StatusCaptured
+	case "REFUNDED", "PARTIALLY_REFUNDED":
+		res.Status = StatusRefunded
+	case "VOIDED":
+		res.Status = StatusVoided
+	case "DENIED", "DECLINED", "FAILED":
+		res.Status = StatusDeclined
+		return res, ErrDeclined
+	default:
+		res.Status = StatusPending
+	}
+	return res, nil
+}
+
+func (g *PayPalGateway) accessToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Now().Before(g.tokenExpiry) {
+		return g.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.config.BaseURL+"/v1/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(g.config.ClientID, g.config.Secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", transportError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("paypal: token request failed with status %d", resp.StatusCode)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	g.token = out.AccessToken
+	// Refresh a minute early so a token never expires mid-request
+	g.tokenExpiry = time.Now().Add(time.Duration(out.ExpiresIn)*time.Second - time.Minute)
+	return g.token, nil
+}
+
+func (g *PayPalGateway) do(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.config.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		// PayPal reports instrument/authorization problems as 422 UNPROCESSABLE_ENTITY
+		return ErrDeclined
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("paypal: %s %s failed with status %d: %s", method, path, resp.StatusCode, msg)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// transportError turns client timeouts into ErrTimeout so callers can treat the outcome as unknown
+func transportError(err error) error {
+	var netErr interface{ Timeout() bool }
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+	return err
+}
+
+// formatAmount writes amount with as many decimals as currency has, e.g.
+// "12.50" for USD, "1250" for JPY and "1.250" for KWD
+func formatAmount(amount float64, currency string) string {
+	return money.FormatMinor(money.ToMinor(amount, currency), currency)
+}
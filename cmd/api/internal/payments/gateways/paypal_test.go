@@ -0,0 +1,22 @@
+package gateways
+
+import "testing"
+
+func TestFormatAmount(t *testing.T) {
+	for _, tc := range []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{12.5, "USD", "12.50"},
+		{0.1 + 0.2, "EUR", "0.30"},
+		{1250, "JPY", "1250"},
+		{1249.6, "JPY", "1250"},
+		{1.25, "KWD", "1.250"},
+		{0.005, "BHD", "0.005"},
+	} {
+		if got := formatAmount(tc.amount, tc.currency); got != tc.want {
+			t.Errorf("formatAmount(%v, %s) = %q, want %q", tc.amount, tc.currency, got, tc.want)
+		}
+	}
+}
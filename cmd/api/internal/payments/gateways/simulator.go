@@ -0,0 +1,151 @@
+package gateways
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+)
+
+// Simulator outcomes
+const (
+	OutcomeApprove = "approve"
+	OutcomeDecline = "decline"
+	OutcomeTimeout = "timeout"
+)
+
+// SimulatorConfig decides the outcome of an authorization. A card rule wins
+// over an amount rule; anything not listed is approved.
+type SimulatorConfig struct {
+	CardOutcomes   map[string]string // card number -> outcome
+	AmountOutcomes map[int64]string  // amount in minor units of its currency -> outcome
+}
+
+// DefaultSimulatorConfig mirrors the test cards most providers document
+func DefaultSimulatorConfig() SimulatorConfig {
+	return SimulatorConfig{
+		CardOutcomes: map[string]string{
+			"4111111111111111": OutcomeApprove,
+			"5555555555554444": OutcomeApprove,
+			"4000000000000002": OutcomeDecline,
+			"4000000000009995": OutcomeDecline,
+			"4000000000000119": OutcomeTimeout,
+		},
+		AmountOutcomes: map[int64]string{},
+	}
+}
+
+type simTransaction struct {
+	status   string
+	amount   float64
+	captured float64
+	refunded float64
+	refunds  int
+	currency string
+}
+
+// Simulator is a deterministic in-process gateway for local development and
+// tests. It keeps transactions in memory and never talks to the network.
+type Simulator struct {
+	config SimulatorConfig
+	mu     sync.Mutex
+	seq    int
+	txns   map[string]*simTransaction
+}
+
+func NewSimulator(config SimulatorConfig) *Simulator {
+	return &Simulator{config: config, txns: map[string]*simTransaction{}}
+}
+
+func (s *Simulator) Name() string { return "simulator" }
+
+func (s *Simulator) outcome(card string, amount float64, currency string) string {
+	if o, ok := s.config.CardOutcomes[card]; ok {
+		return o
+	}
+	if o, ok := s.config.AmountOutcomes[money.ToMinor(amount, currency)]; ok {
+		return o
+	}
+	return OutcomeApprove
+}
+
+func (s *Simulator) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	switch s.outcome(stringInfo(req.Info, "card_number"), req.Amount, req.Currency) {
+	case OutcomeDecline:
+		return &Result{Status: StatusDeclined, Amount: req.Amount, Currency: req.Currency, Message: "card declined"}, ErrDeclined
+	case OutcomeTimeout:
+		return nil, ErrTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	id := fmt.Sprintf("sim_%06d", s.seq)
+	s.txns[id] = &simTransaction{status: StatusAuthorized, amount: req.Amount, currency: req.Currency}
+	return &Result{TransactionID: id, Status: StatusAuthorized, Amount: req.Amount, Currency: req.Currency}, nil
+}
+
+func (s *Simulator) Capture(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.txns[transactionID]
+	if !ok {
+		return nil, errors.New("simulator: unknown transaction " + transactionID)
+	}
+	if t.status != StatusAuthorized {
+		return nil, fmt.Errorf("simulator: cannot capture a %s transaction", t.status)
+	}
+	if money.ToMinor(amount, t.currency) > money.ToMinor(t.amount, t.currency) {
+		return nil, errors.New("simulator: capture exceeds authorized amount")
+	}
+	t.status = StatusCaptured
+	t.captured = amount
+	return &Result{TransactionID: transactionID, Status: StatusCaptured, Amount: amount, Currency: t.currency}, nil
+}
+
+func (s *Simulator) Refund(ctx context.Context, transactionID string, amount float64, currency string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.txns[transactionID]
+	if !ok {
+		return nil, errors.New("simulator: unknown transaction " + transactionID)
+	}
+	if t.status != StatusCaptured {
+		return nil, fmt.Errorf("simulator: cannot refund a %s transaction", t.status)
+	}
+	if money.ToMinor(t.refunded+amount, t.currency) > money.ToMinor(t.captured, t.currency) {
+		return nil, errors.New("simulator: refund exceeds captured amount")
+	}
+	t.refunded += amount
+	t.refunds++
+	if money.ToMinor(t.refunded, t.currency) == money.ToMinor(t.captured, t.currency) {
+		t.status = StatusRefunded
+	}
+	refundID := fmt.Sprintf("%s_r%d", transactionID, t.refunds)
+	return &Result{TransactionID: refundID, Status: StatusRefunded, Amount: amount, Currency: t.currency}, nil
+}
+
+func (s *Simulator) Void(ctx context.Context, transactionID string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.txns[transactionID]
+	if !ok {
+		return nil, errors.New("simulator: unknown transaction " + transactionID)
+	}
+	if t.status != StatusAuthorized {
+		return nil, fmt.Errorf("simulator: cannot void a %s transaction", t.status)
+	}
+	t.status = StatusVoided
+	return &Result{TransactionID: transactionID, Status: StatusVoided, Amount: t.amount, Currency: t.currency}, nil
+}
+
+func (s *Simulator) Status(ctx context.Context, transactionID string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.txns[transactionID]
+	if !ok {
+		return nil, errors.New("simulator: unknown transaction " + transactionID)
+	}
+	return &Result{TransactionID: transactionID, Status: t.status, Amount: t.amount, Currency: t.currency}, nil
+}
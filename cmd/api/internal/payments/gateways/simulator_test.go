@@ -0,0 +1,49 @@
+package gateways
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSimulatorUsesMinorUnitsOfTheCurrency(t *testing.T) {
+	sim := NewSimulator(SimulatorConfig{AmountOutcomes: map[int64]string{1250: OutcomeDecline}})
+	ctx := context.Background()
+	for _, tc := range []struct {
+		amount   float64
+		currency string
+		declined bool
+	}{
+		{12.5, "USD", true},
+		{1250, "JPY", true},
+		{1.25, "KWD", true},
+		{12.5, "JPY", false},
+		{1250, "USD", false},
+	} {
+		_, err := sim.Authorize(ctx, AuthorizeRequest{Amount: tc.amount, Currency: tc.currency})
+		if declined := errors.Is(err, ErrDeclined); declined != tc.declined {
+			t.Errorf("Authorize %v %s: %v, want declined %v", tc.amount, tc.currency, err, tc.declined)
+		}
+	}
+
+	auth, err := sim.Authorize(ctx, AuthorizeRequest{Amount: 1.001, Currency: "KWD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.Capture(ctx, auth.TransactionID, 1.001, "KWD"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.Refund(ctx, auth.TransactionID, 0.9, "KWD"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.Refund(ctx, auth.TransactionID, 0.102, "KWD"); err == nil {
+		t.Error("refund past the captured amount was accepted")
+	}
+	refund, err := sim.Refund(ctx, auth.TransactionID, 0.101, "KWD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.txns[auth.TransactionID].status != StatusRefunded || refund.Amount != 0.101 {
+		t.Errorf("after refunding the whole capture: %s, %+v", sim.txns[auth.TransactionID].status, refund)
+	}
+}
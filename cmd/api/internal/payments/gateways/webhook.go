@@ -0,0 +1,246 @@
+package gateways
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Normalized webhook event types every provider notification is mapped to
+const (
+	EventCaptured = "captured"
+	EventFailed   = "failed"
+	EventRefunded = "refunded"
+	EventDisputed = "disputed"
+)
+
+// SignatureHeader carries "t=<unix seconds>,v1=<hex HMAC-SHA256>" where the
+// HMAC is computed over "<unix seconds>.<raw body>" with the provider's secret.
+const SignatureHeader = "X-Webhook-Signature"
+
+// SignatureTolerance is how old a signed timestamp may be before it is rejected as a replay
+const SignatureTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnsupportedEvent = errors.New("unsupported webhook event")
+)
+
+// WebhookEvent is a provider notification translated into our vocabulary
+type WebhookEvent struct {
+	ID            string    `json:"id"`             // provider event ID, used for deduplication
+	Type          string    `json:"type"`           // one of the Event* constants
+	TransactionID string    `json:"transaction_id"` // matches Payment.TransactionID or AuthorizationID
+	RefundID      string    `json:"refund_id,omitempty"`
+	Amount        float64   `json:"amount"`
+	Currency      string    `json:"currency"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+// WebhookParser is implemented by gateways that receive asynchronous notifications
+type WebhookParser interface {
+	ParseWebhook(body []byte, header http.Header) (*WebhookEvent, error)
+}
+
+// SignWebhook returns the SignatureHeader value for body
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + computeSignature(secret, ts, body)
+}
+
+// VerifyWebhook checks the signature header against body and rejects
+// timestamps outside SignatureTolerance of now.
+func VerifyWebhook(secret, header string, body []byte, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sig = kv[1]
+		}
+	}
+	if ts == "" || sig == "" {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := now.Sub(time.Unix(unix, 0))
+	if age > SignatureTolerance || age < -SignatureTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	expected := computeSignature(secret, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func computeSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSignedWebhookRequest builds a POST to url carrying payload signed with
+// secret, exactly as a provider would deliver it. Used to drive the webhook
+// endpoint from the simulator and from tests.
+func NewSignedWebhookRequest(url, secret string, payload []byte, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, SignWebhook(secret, now, payload))
+	return req, nil
+}
+
+// ParseWebhook reads PayPal webhook notifications
+// (https://developer.paypal.com/api/rest/webhooks/event-names/)
+func (g *PayPalGateway) ParseWebhook(body []byte, header http.Header) (*WebhookEvent, error) {
+	var in struct {
+		ID         string    `json:"id"`
+		EventType  string    `json:"event_type"`
+		CreateTime time.Time `json:"create_time"`
+		Resource   struct {
+			ID     string        `json:"id"`
+			Amount *paypalAmount `json:"amount"`
+			Links  []struct {
+				Rel  string `json:"rel"`
+				Href string `json:"href"`
+			} `json:"links"`
+			DisputedTransactions []struct {
+				SellerTransactionID string `json:"seller_transaction_id"`
+			} `json:"disputed_transactions"`
+			DisputeAmount *paypalAmount `json:"dispute_amount"`
+		} `json:"resource"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	event := &WebhookEvent{ID: in.ID, TransactionID: in.Resource.ID, OccurredAt: in.CreateTime}
+	amount := in.Resource.Amount
+	switch in.EventType {
+	case "PAYMENT.CAPTURE.COMPLETED":
+		event.Type = EventCaptured
+	case "PAYMENT.CAPTURE.DENIED", "PAYMENT.CAPTURE.DECLINED":
+		event.Type = EventFailed
+	case "PAYMENT.CAPTURE.REFUNDED":
+		event.Type = EventRefunded
+		event.RefundID = in.Resource.ID
+		// The resource is the refund; the capture it belongs to is the "up" link
+		for _, link := range in.Resource.Links {
+			if link.Rel == "up" {
+				event.TransactionID = link.Href[strings.LastIndex(link.Href, "/")+1:]
+			}
+		}
+	case "CUSTOMER.DISPUTE.CREATED":
+		event.Type = EventDisputed
+		if len(in.Resource.DisputedTransactions) > 0 {
+			event.TransactionID = in.Resource.DisputedTransactions[0].SellerTransactionID
+		}
+		amount = in.Resource.DisputeAmount
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEvent, in.EventType)
+	}
+	if amount != nil {
+		event.Amount, _ = strconv.ParseFloat(amount.Value, 64)
+		event.Currency = amount.CurrencyCode
+	}
+	return event, nil
+}
+
+// ParseWebhook reads MPGS notifications. MPGS sends the unique notification
+// ID in the X-Notification-Id header.
+func (g *MastercardGateway) ParseWebhook(body []byte, header http.Header) (*WebhookEvent, error) {
+	var in struct {
+		Result string `json:"result"`
+		Order  struct {
+			ID       string `json:"id"`
+			Currency string `json:"currency"`
+		} `json:"order"`
+		Transaction struct {
+			ID     string  `json:"id"`
+			Type   string  `json:"type"`
+			Amount float64 `json:"amount"`
+		} `json:"transaction"`
+		TimeOfRecord time.Time `json:"timeOfRecord"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	id := header.Get("X-Notification-Id")
+	if id == "" {
+		id = in.Order.ID + ":" + in.Transaction.ID
+	}
+	event := &WebhookEvent{
+		ID:            id,
+		TransactionID: in.Order.ID,
+		Amount:        in.Transaction.Amount,
+		Currency:      in.Order.Currency,
+		OccurredAt:    in.TimeOfRecord,
+	}
+	switch {
+	case in.Transaction.Type == "CHARGEBACK":
+		event.Type = EventDisputed
+	case in.Result != "SUCCESS":
+		event.Type = EventFailed
+	case in.Transaction.Type == "CAPTURE" || in.Transaction.Type == "PAYMENT":
+		event.Type = EventCaptured
+	case in.Transaction.Type == "REFUND":
+		event.Type = EventRefunded
+		event.RefundID = in.Transaction.ID
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEvent, in.Transaction.Type)
+	}
+	return event, nil
+}
+
+// ParseWebhook reads simulator notifications, which are WebhookEvent JSON as is
+func (s *Simulator) ParseWebhook(body []byte, header http.Header) (*WebhookEvent, error) {
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	switch event.Type {
+	case EventCaptured, EventFailed, EventRefunded, EventDisputed:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEvent, event.Type)
+	}
+	return &event, nil
+}
+
+// WebhookFor builds the notification the simulator would send for a
+// transaction it knows about, e.g. to confirm a capture asynchronously.
+func (s *Simulator) WebhookFor(eventID, eventType, transactionID string, amount float64) ([]byte, error) {
+	s.mu.Lock()
+	t, ok := s.txns[transactionID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.New("simulator: unknown transaction " + transactionID)
+	}
+	return json.Marshal(WebhookEvent{
+		ID:            eventID,
+		Type:          eventType,
+		TransactionID: transactionID,
+		Amount:        amount,
+		Currency:      t.currency,
+		OccurredAt:    time.Now().UTC(),
+	})
+}
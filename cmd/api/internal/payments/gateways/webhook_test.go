@@ -0,0 +1,68 @@
+package gateways
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "whsec_test"
+	now := time.Unix(1760000000, 0)
+	body := []byte(`{"id":"evt_1","type":"captured","transaction_id":"sim_000001","amount":42.5}`)
+
+	if err := VerifyWebhook(secret, SignWebhook(secret, now, body), body, now); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := VerifyWebhook(secret, SignWebhook(secret, now.Add(-SignatureTolerance), body), body, now); err != nil {
+		t.Errorf("signature at the edge of the tolerance: %v", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		header string
+		body   []byte
+	}{
+		{"no header", "", body},
+		{"no signature", "t=1760000000", body},
+		{"bad timestamp", "t=yesterday,v1=00", body},
+		{"wrong secret", SignWebhook("whsec_other", now, body), body},
+		{"tampered body", SignWebhook(secret, now, body), []byte(`{"id":"evt_1","type":"captured","transaction_id":"sim_000001","amount":4250}`)},
+		{"stale timestamp", SignWebhook(secret, now.Add(-SignatureTolerance-time.Second), body), body},
+		{"future timestamp", SignWebhook(secret, now.Add(SignatureTolerance+time.Second), body), body},
+	} {
+		if err := VerifyWebhook(secret, tc.header, tc.body, now); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: VerifyWebhook = %v, want ErrInvalidSignature", tc.name, err)
+		}
+	}
+}
+
+func TestNewSignedWebhookRequest(t *testing.T) {
+	sim := NewSimulator(DefaultSimulatorConfig())
+	if _, err := sim.WebhookFor("evt_1", EventCaptured, "sim_unknown", 10); err == nil {
+		t.Error("WebhookFor built a notification for an unknown transaction")
+	}
+	auth, err := sim.Authorize(context.Background(), AuthorizeRequest{Amount: 42.5, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := sim.WebhookFor("evt_1", EventCaptured, auth.TransactionID, 42.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	req, err := NewSignedWebhookRequest("/webhooks/payments/simulator", "whsec_test", body, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyWebhook("whsec_test", req.Header.Get(SignatureHeader), body, now); err != nil {
+		t.Errorf("signed request does not verify: %v", err)
+	}
+	event, err := sim.ParseWebhook(body, req.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != "evt_1" || event.Type != EventCaptured || event.TransactionID != auth.TransactionID || event.Amount != 42.5 || event.Currency != "USD" {
+		t.Errorf("event = %+v", event)
+	}
+}
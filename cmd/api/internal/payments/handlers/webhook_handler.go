@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/services"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxWebhookBody caps what we read from a provider; real notifications are a few KB
+const maxWebhookBody = 1 << 20
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(client *mongo.Client, dbName string, registry *gateways.Registry) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: services.NewWebhookService(client.Database(dbName), registry),
+	}
+}
+
+// Receive accepts a signed notification from a payment provider. Providers
+// retry anything but a 2xx, so duplicates and events we do not act on are
+// acknowledged with 200.
+func (h *WebhookHandler) Receive(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Webhook body too large"})
+		return
+	}
+
+	result, err := h.webhookService.Handle(c.Param("provider"), body, c.Request.Header)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrWebhookNotConfigured):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, gateways.ErrInvalidSignature):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		case errors.Is(err, services.ErrInvalidPayload):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": result})
+}
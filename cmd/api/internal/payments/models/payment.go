@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment statuses
+const (
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+	PaymentStatusDisputed          = "disputed"
+	PaymentStatusDuplicate         = "duplicate" // captured late for an order another payment had paid; returned to the client, see Refunds
+)
+
+// PaymentMethodWallet pays out of the client's store credit instead of through a gateway
+const PaymentMethodWallet = "wallet"
+
+// Payment is one attempt to pay for an order (payments collection)
+// e.g., {"order_id": ObjectId, "method": "paypal", "status": "captured", "amount": 42.5}
+type Payment struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID         primitive.ObjectID `bson:"order_id" json:"order_id"`
+	UserID          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Method          string             `bson:"method" json:"method"`
+	Status          string             `bson:"status" json:"status"`
+	Amount          float64            `bson:"amount" json:"amount"`
+	Tax             float64            `bson:"tax,omitempty" json:"tax,omitempty"` // part of Amount that is tax
+	Currency        string             `bson:"currency" json:"currency"`
+	AuthorizationID string             `bson:"authorization_id,omitempty" json:"authorization_id,omitempty"`
+	TransactionID   string             `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`   // provider reference used for refunds, or the wallet transaction
+	RefundedAmount  float64            `bson:"refunded_amount,omitempty" json:"refunded_amount,omitempty"` // includes pending refunds
+	Refunds         []Refund           `bson:"refunds,omitempty" json:"refunds,omitempty"`
+	FailureReason   string             `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+}
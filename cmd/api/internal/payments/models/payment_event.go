@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook event processing statuses
+const (
+	PaymentEventReceived  = "received"
+	PaymentEventProcessed = "processed"
+	PaymentEventIgnored   = "ignored" // verified but no matching payment or nothing to change
+)
+
+// PaymentEvent is a provider webhook we have accepted (payment_events collection).
+// The _id is "<provider>:<provider event id>" so a redelivered event is rejected by the unique index.
+// e.g., {"_id": "paypal:WH-58D329510W468432D", "type": "captured", "transaction_id": "2GG279541U471931P", "status": "processed"}
+type PaymentEvent struct {
+	ID            string              `bson:"_id" json:"id"`
+	Provider      string              `bson:"provider" json:"provider"`
+	EventID       string              `bson:"event_id" json:"event_id"`
+	Type          string              `bson:"type" json:"type"`
+	TransactionID string              `bson:"transaction_id" json:"transaction_id"`
+	Amount        float64             `bson:"amount" json:"amount"`
+	Currency      string              `bson:"currency,omitempty" json:"currency,omitempty"`
+	PaymentID     *primitive.ObjectID `bson:"payment_id,omitempty" json:"payment_id,omitempty"`
+	Status        string              `bson:"status" json:"status"`
+	Error         string              `bson:"error,omitempty" json:"error,omitempty"`
+	Payload       string              `bson:"payload" json:"-"` // raw body as received, for audits
+	OccurredAt    time.Time           `bson:"occurred_at" json:"occurred_at"`
+	ReceivedAt    time.Time           `bson:"received_at" json:"received_at"`
+	ProcessedAt   *time.Time          `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Refund reason codes
+const (
+	RefundReasonWriterNoDelivery = "writer_no_delivery"
+	RefundReasonOrderCancelled   = "order_cancelled"
+	RefundReasonQualityIssue     = "quality_issue"
+	RefundReasonDuplicatePayment = "duplicate_payment"
+	RefundReasonGoodwill         = "goodwill"
+	RefundReasonOther            = "other"
+	RefundReasonProvider         = "provider_initiated" // issued outside the API and learned from a webhook
+)
+
+// RefundReasons lists the reason codes an admin may choose
+func RefundReasons() []string {
+	return []string{
+		RefundReasonWriterNoDelivery, RefundReasonOrderCancelled, RefundReasonQualityIssue,
+		RefundReasonDuplicatePayment, RefundReasonGoodwill, RefundReasonOther,
+	}
+}
+
+// Refund statuses. A pending refund has been reserved against the payment but
+// the provider has not confirmed it yet.
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+// Refund destinations. Refunds of wallet payments always go back to the wallet.
+const (
+	RefundDestinationOriginal = "original_method" // back through the payment provider
+	RefundDestinationWallet   = "wallet"          // as store credit
+)
+
+// Refund is one entry of a payment's refund ledger (embedded in payments.refunds)
+// e.g., {"idempotency_key": "c0ffee", "amount": 10, "reason": "quality_issue", "status": "succeeded"}
+type Refund struct {
+	ID               primitive.ObjectID  `bson:"_id" json:"id"`
+	IdempotencyKey   string              `bson:"idempotency_key" json:"idempotency_key"`
+	Amount           float64             `bson:"amount" json:"amount"`
+	Tax              float64             `bson:"tax,omitempty" json:"tax,omitempty"` // part of Amount that is tax, set when it succeeds
+	Reason           string              `bson:"reason" json:"reason"`
+	Note             string              `bson:"note,omitempty" json:"note,omitempty"`
+	Status           string              `bson:"status" json:"status"`
+	Destination      string              `bson:"destination,omitempty" json:"destination,omitempty"` // empty means original_method
+	ProviderRefundID string              `bson:"provider_refund_id,omitempty" json:"provider_refund_id,omitempty"`
+	FailureReason    string              `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	ActorID          *primitive.ObjectID `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	CreatedAt        time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time           `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryPaymentRepository struct {
+	store *database.MemoryStore
+	// mu makes each update and the read of its result one step, like
+	// FindOneAndUpdate, and keeps updates from overwriting each other's
+	// refunds
+	mu sync.Mutex
+}
+
+// NewMemoryPaymentRepository keeps payments in store, for tests
+func NewMemoryPaymentRepository(store *database.MemoryStore) PaymentRepository {
+	return &memoryPaymentRepository{store: store}
+}
+
+func (r *memoryPaymentRepository) Insert(ctx context.Context, payment *models.Payment) error {
+	return r.store.Insert("payments", payment)
+}
+
+func (r *memoryPaymentRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.store.FindOne("payments", bson.M{"_id": id}, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r *memoryPaymentRepository) FindLatest(ctx context.Context, filter bson.M) (*models.Payment, error) {
+	payments := []models.Payment{}
+	if err := r.store.Find("payments", filter, database.FindOptions{Sort: newestFirst, Limit: 1}, &payments); err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &payments[0], nil
+}
+
+func (r *memoryPaymentRepository) Find(ctx context.Context, filter bson.M) ([]models.Payment, error) {
+	payments := []models.Payment{}
+	err := r.store.Find("payments", filter, database.FindOptions{Sort: oldestFirst}, &payments)
+	return payments, err
+}
+
+func (r *memoryPaymentRepository) ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Payment, error) {
+	payments := []models.Payment{}
+	err := r.store.Find("payments", bson.M{"order_id": orderID}, database.FindOptions{Sort: newestFirst}, &payments)
+	return payments, err
+}
+
+func (r *memoryPaymentRepository) Update(ctx context.Context, filter, update bson.M) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.store.UpdateOne("payments", filter, update)
+}
+
+// UpdateRefund edits the refund on the decoded payment and writes the payment
+// back, as the memory store has no positional updates
+func (r *memoryPaymentRepository) UpdateRefund(ctx context.Context, change RefundChange) (*models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	payment, err := r.FindByID(ctx, change.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	for i < len(payment.Refunds) && !(payment.Refunds[i].ID == change.RefundID && payment.Refunds[i].Status == change.From) {
+		i++
+	}
+	if i == len(payment.Refunds) {
+		return nil, mongo.ErrNoDocuments
+	}
+	if err := setFields(&payment.Refunds[i], change.Set); err != nil {
+		return nil, err
+	}
+	if _, err := r.store.ReplaceOne("payments", bson.M{"_id": payment.ID}, payment); err != nil {
+		return nil, err
+	}
+	update := bson.M{}
+	if len(change.PaymentSet) > 0 {
+		update["$set"] = change.PaymentSet
+	}
+	if len(change.PaymentInc) > 0 {
+		update["$inc"] = change.PaymentInc
+	}
+	if len(update) > 0 {
+		if _, err := r.store.UpdateOne("payments", bson.M{"_id": payment.ID}, update); err != nil {
+			return nil, err
+		}
+	}
+	return r.FindByID(ctx, payment.ID)
+}
+
+// setFields sets the fields of refund named by their BSON keys in set
+func setFields(refund *models.Refund, set bson.M) error {
+	data, err := bson.Marshal(refund)
+	if err != nil {
+		return err
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	for k, v := range set {
+		doc[k] = v
+	}
+	if data, err = bson.Marshal(doc); err != nil {
+		return err
+	}
+	*refund = models.Refund{}
+	return bson.Unmarshal(data, refund)
+}
+
+type memoryPaymentEventRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryPaymentEventRepository keeps payment events in store, for tests
+func NewMemoryPaymentEventRepository(store *database.MemoryStore) PaymentEventRepository {
+	return &memoryPaymentEventRepository{store: store}
+}
+
+func (r *memoryPaymentEventRepository) Insert(ctx context.Context, event *models.PaymentEvent) (bool, error) {
+	err := r.store.Insert("payment_events", event)
+	if err == database.ErrDuplicateID {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *memoryPaymentEventRepository) FindByID(ctx context.Context, id string) (*models.PaymentEvent, error) {
+	var event models.PaymentEvent
+	if err := r.store.FindOne("payment_events", bson.M{"_id": id}, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *memoryPaymentEventRepository) Update(ctx context.Context, filter, update bson.M) (int64, error) {
+	return r.store.UpdateOne("payment_events", filter, update)
+}
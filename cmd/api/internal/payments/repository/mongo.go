@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoPaymentRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoPaymentRepository(db *mongo.Database) PaymentRepository {
+	return &mongoPaymentRepository{col: db.Collection("payments")}
+}
+
+func (r *mongoPaymentRepository) Insert(ctx context.Context, payment *models.Payment) error {
+	_, err := r.col.InsertOne(ctx, payment)
+	return err
+}
+
+func (r *mongoPaymentRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r *mongoPaymentRepository) FindLatest(ctx context.Context, filter bson.M) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.col.FindOne(ctx, filter, options.FindOne().SetSort(newestFirst)).Decode(&payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r *mongoPaymentRepository) Find(ctx context.Context, filter bson.M) ([]models.Payment, error) {
+	return r.find(ctx, filter, oldestFirst)
+}
+
+func (r *mongoPaymentRepository) ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Payment, error) {
+	return r.find(ctx, bson.M{"order_id": orderID}, newestFirst)
+}
+
+func (r *mongoPaymentRepository) find(ctx context.Context, filter bson.M, sort bson.D) ([]models.Payment, error) {
+	cur, err := r.col.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	payments := []models.Payment{}
+	if err := cur.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (r *mongoPaymentRepository) Update(ctx context.Context, filter, update bson.M) (int64, error) {
+	res, err := r.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func (r *mongoPaymentRepository) UpdateRefund(ctx context.Context, change RefundChange) (*models.Payment, error) {
+	set := bson.M{}
+	for k, v := range change.Set {
+		set["refunds.$."+k] = v
+	}
+	for k, v := range change.PaymentSet {
+		set[k] = v
+	}
+	update := bson.M{"$set": set}
+	if len(change.PaymentInc) > 0 {
+		update["$inc"] = change.PaymentInc
+	}
+	var payment models.Payment
+	err := r.col.FindOneAndUpdate(ctx,
+		bson.M{"_id": change.PaymentID, "refunds": bson.M{"$elemMatch": bson.M{"_id": change.RefundID, "status": change.From}}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&payment)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+type mongoPaymentEventRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoPaymentEventRepository(db *mongo.Database) PaymentEventRepository {
+	return &mongoPaymentEventRepository{col: db.Collection("payment_events")}
+}
+
+func (r *mongoPaymentEventRepository) Insert(ctx context.Context, event *models.PaymentEvent) (bool, error) {
+	_, err := r.col.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *mongoPaymentEventRepository) FindByID(ctx context.Context, id string) (*models.PaymentEvent, error) {
+	var event models.PaymentEvent
+	if err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *mongoPaymentEventRepository) Update(ctx context.Context, filter, update bson.M) (int64, error) {
+	res, err := r.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+// newestFirst and oldestFirst order payments made in the same instant by insertion
+var (
+	newestFirst = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+	oldestFirst = bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+)
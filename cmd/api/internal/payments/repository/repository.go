@@ -0,0 +1,55 @@
+// Package repository stores payments and the provider events applied to
+// them. The MongoDB implementation is used by the API and the in-memory one by
+// tests; a missing document gives mongo.ErrNoDocuments from both.
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentRepository stores the payments collection
+type PaymentRepository interface {
+	Insert(ctx context.Context, payment *models.Payment) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
+	// FindLatest returns the newest payment matching filter
+	FindLatest(ctx context.Context, filter bson.M) (*models.Payment, error)
+	// Find returns the payments matching filter, oldest first
+	Find(ctx context.Context, filter bson.M) ([]models.Payment, error)
+	// ListByOrder returns every payment attempt for an order, newest first
+	ListByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Payment, error)
+	// Update applies update to the payment matching filter and returns how
+	// many matched
+	Update(ctx context.Context, filter, update bson.M) (int64, error)
+	// UpdateRefund applies change to one refund of a payment and returns the
+	// payment as updated, or mongo.ErrNoDocuments when the refund is not in
+	// the status the change is made from
+	UpdateRefund(ctx context.Context, change RefundChange) (*models.Payment, error)
+}
+
+// PaymentEventRepository stores the payment_events collection, keyed by
+// "<provider>:<provider event id>"
+type PaymentEventRepository interface {
+	// Insert stores event and reports false, without an error, when an event
+	// with its ID was stored before
+	Insert(ctx context.Context, event *models.PaymentEvent) (bool, error)
+	FindByID(ctx context.Context, id string) (*models.PaymentEvent, error)
+	// Update applies update to the event matching filter and returns how many
+	// matched
+	Update(ctx context.Context, filter, update bson.M) (int64, error)
+}
+
+// RefundChange updates the refund RefundID of payment PaymentID if it is
+// still in status From. Set holds refund fields, e.g. {"status": "failed"};
+// PaymentSet and PaymentInc are applied to the payment in the same write.
+type RefundChange struct {
+	PaymentID  primitive.ObjectID
+	RefundID   primitive.ObjectID
+	From       string
+	Set        bson.M
+	PaymentSet bson.M
+	PaymentInc bson.M
+}
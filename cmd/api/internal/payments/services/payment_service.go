@@ -1,27 +1,302 @@
 package services
 
-// PaymentService will handle payment processing logic
-// You would integrate with a third-party payment gateway here
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
 
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	invoiceservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/services"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	ordermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	orderrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/repository"
+	walletmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	walletservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrAmountMismatch is returned when the provider authorized or captured something other than the order price
+var ErrAmountMismatch = errors.New("payment amount does not match the order price")
+
+// PaymentService charges orders through the configured payment gateways
 type PaymentService struct {
-	// Add any dependencies for your payment gateway (e.g., API keys)
+	payments repository.PaymentRepository
+	orders   orderrepository.OrderRepository
+	machine  *statemachine.Machine
+	tx       database.Transactor
+	ledger   *ledgerservices.LedgerService
+	wallets  *walletservices.WalletService
+	invoices *invoiceservices.InvoiceService
+	gateways *gateways.Registry
+}
+
+// PaymentServiceDeps are the stores and services a PaymentService works
+// with; see NewPaymentServiceWith
+type PaymentServiceDeps struct {
+	Payments   repository.PaymentRepository
+	Orders     orderrepository.OrderRepository
+	Machine    *statemachine.Machine
+	Transactor database.Transactor
+	Ledger     *ledgerservices.LedgerService
+	Wallets    *walletservices.WalletService
+	Invoices   *invoiceservices.InvoiceService
+	Gateways   *gateways.Registry
+}
+
+func NewPaymentService(db *mongo.Database, registry *gateways.Registry) *PaymentService {
+	return NewPaymentServiceWith(PaymentServiceDeps{
+		Payments:   repository.NewMongoPaymentRepository(db),
+		Orders:     orderrepository.NewMongoOrderRepository(db),
+		Machine:    statemachine.NewMachine(db),
+		Transactor: database.NewMongoTransactor(db.Client()),
+		Ledger:     ledgerservices.NewLedgerService(db),
+		Wallets:    walletservices.NewWalletService(db, registry),
+		Invoices:   invoiceservices.NewInvoiceService(db),
+		Gateways:   registry,
+	})
+}
+
+// NewPaymentServiceWith builds the service on deps, e.g. in-memory stores and
+// the simulator in tests
+func NewPaymentServiceWith(deps PaymentServiceDeps) *PaymentService {
+	return &PaymentService{
+		payments: deps.Payments,
+		orders:   deps.Orders,
+		machine:  deps.Machine,
+		tx:       deps.Transactor,
+		ledger:   deps.Ledger,
+		wallets:  deps.Wallets,
+		invoices: deps.Invoices,
+		gateways: deps.Gateways,
+	}
+}
+
+// PayForOrder authorizes and captures the order price with the gateway for
+// method, or takes it from the client's wallet when method is "wallet". An
+// authorization for another amount or currency is voided before anything is
+// captured. The payment record and the order's move to "paid" are committed
+// in one MongoDB transaction; if that fails the capture is refunded.
+func (s *PaymentService) PayForOrder(orderID, userID primitive.ObjectID, method string, info map[string]interface{}) (*models.Payment, error) {
+	if method == models.PaymentMethodWallet {
+		return s.payFromWallet(orderID, userID)
+	}
+	gateway, err := s.gateways.Get(method)
+	if err != nil {
+		return nil, err
+	}
+	// Gateways talk to the network, give them longer than a database call
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	order, err := s.payableOrder(ctx, orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	payment := &models.Payment{
+		ID:        primitive.NewObjectID(),
+		OrderID:   orderID,
+		UserID:    userID,
+		Method:    method,
+		Amount:    order.Price,
+		Tax:       orderTax(order),
+		Currency:  orderCurrency(order),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	auth, err := gateway.Authorize(ctx, gateways.AuthorizeRequest{
+		Reference: orderID.Hex(),
+		Amount:    order.Price,
+		Currency:  payment.Currency,
+		Info:      info,
+	})
+	if err != nil {
+		s.recordFailure(payment, err)
+		return nil, err
+	}
+	payment.AuthorizationID = auth.TransactionID
+	if auth.Currency != payment.Currency || !sameAmount(auth.Amount, order.Price, payment.Currency) {
+		if _, voidErr := gateway.Void(ctx, auth.TransactionID); voidErr != nil {
+			log.Printf("payments: failed to void authorization %s: %v", auth.TransactionID, voidErr)
+		}
+		s.recordFailure(payment, ErrAmountMismatch)
+		return nil, ErrAmountMismatch
+	}
+
+	captured, err := gateway.Capture(ctx, auth.TransactionID, order.Price, payment.Currency)
+	if err != nil {
+		if _, voidErr := gateway.Void(ctx, auth.TransactionID); voidErr != nil {
+			log.Printf("payments: failed to void authorization %s: %v", auth.TransactionID, voidErr)
+		}
+		s.recordFailure(payment, err)
+		return nil, err
+	}
+	payment.TransactionID = captured.TransactionID
+	if !sameAmount(captured.Amount, order.Price, payment.Currency) {
+		s.refundQuietly(ctx, gateway, captured)
+		s.recordFailure(payment, ErrAmountMismatch)
+		return nil, ErrAmountMismatch
+	}
+
+	payment.Status = models.PaymentStatusCaptured
+	if err := s.commitCapture(ctx, payment); err != nil {
+		s.refundQuietly(ctx, gateway, captured)
+		return nil, err
+	}
+	return payment, nil
 }
 
-func NewPaymentService() *PaymentService {
-	return &PaymentService{}
+// payFromWallet spends the client's store credit on the order. The debit is
+// committed together with the payment and the order's move to "paid", so
+// parallel payments can never take the same credit twice.
+func (s *PaymentService) payFromWallet(orderID, userID primitive.ObjectID) (*models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	order, err := s.payableOrder(ctx, orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	payment := &models.Payment{
+		ID:        primitive.NewObjectID(),
+		OrderID:   orderID,
+		UserID:    userID,
+		Method:    models.PaymentMethodWallet,
+		Status:    models.PaymentStatusCaptured,
+		Amount:    order.Price,
+		Tax:       orderTax(order),
+		Currency:  orderCurrency(order),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		tx, err := s.wallets.Debit(ctx, userID, money.ToMinor(order.Price, payment.Currency), payment.Currency, walletmodels.TransactionKindPayment, payment.ID.Hex(), &orderID)
+		if err != nil {
+			return err
+		}
+		payment.TransactionID = tx.ID.Hex()
+		return s.recordCapture(ctx, payment)
+	})
+	if err != nil {
+		if errors.Is(err, walletservices.ErrInsufficientFunds) || errors.Is(err, walletservices.ErrCurrencyMismatch) {
+			payment.TransactionID = ""
+			s.recordFailure(payment, err)
+		}
+		return nil, err
+	}
+	return payment, nil
 }
 
-func (s *PaymentService) ProcessPayment(orderID string, paymentInfo map[string]interface{}) (bool, error) {
-	// In a real application, you would interact with a payment gateway API
-	// For example, using Stripe:
-	// stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-	// _, err := charge.New(params)
-	// if err != nil {
-	// 	return false, err
-	// }
-	// return true, nil
+// payableOrder loads the user's order and checks it is waiting for payment
+func (s *PaymentService) payableOrder(ctx context.Context, orderID, userID primitive.ObjectID) (*ordermodels.Order, error) {
+	order, err := s.orders.FindOne(ctx, bson.M{"_id": orderID, "user_id": userID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, statemachine.ErrOrderNotFound
+		}
+		return nil, err
+	}
+	if _, err := statemachine.Authorize(order.Status, statemachine.StatusPaid, statemachine.SystemActor().Roles); err != nil {
+		return nil, err
+	}
+	if order.Price <= 0 {
+		return nil, errors.New("order has no price to pay")
+	}
+	return order, nil
+}
 
-	// For now, simulate success
-	println("Processing payment for order:", orderID, "with info:", paymentInfo)
-	return true, nil
-}
\ No newline at end of file
+// orderCurrency is the currency the order was priced in; orders from before
+// currencies were recorded are in the default one
+func orderCurrency(order *ordermodels.Order) string {
+	if order.Currency == "" {
+		return money.DefaultCurrency()
+	}
+	return order.Currency
+}
+
+// orderTax is the tax included in the order's price
+func orderTax(order *ordermodels.Order) float64 {
+	if order.PriceBreakdown == nil || order.PriceBreakdown.Tax == nil {
+		return 0
+	}
+	return order.PriceBreakdown.Tax.Amount
+}
+
+// commitCapture stores the captured payment, posts it to the ledger and marks the order paid atomically
+func (s *PaymentService) commitCapture(ctx context.Context, payment *models.Payment) error {
+	return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		return s.recordCapture(ctx, payment)
+	})
+}
+
+// recordCapture is the body of a capture transaction
+func (s *PaymentService) recordCapture(ctx context.Context, payment *models.Payment) error {
+	if err := s.payments.Insert(ctx, payment); err != nil {
+		return err
+	}
+	fromWallet := payment.Method == models.PaymentMethodWallet
+	if err := s.ledger.PostCapture(ctx, payment.ID, payment.OrderID, payment.UserID, money.ToMinor(payment.Amount, payment.Currency), money.ToMinor(payment.Tax, payment.Currency), payment.Currency, fromWallet); err != nil {
+		return err
+	}
+	_, err := s.machine.Apply(ctx, statemachine.Change{
+		OrderID: payment.OrderID,
+		To:      statemachine.StatusPaid,
+		Actor:   statemachine.SystemActor(),
+		Reason:  "payment captured via " + payment.Method,
+		Match:   bson.M{"user_id": payment.UserID},
+		Set:     bson.M{"paid_at": payment.UpdatedAt, "payment_id": payment.ID},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.invoices.Issue(ctx, payment)
+	return err
+}
+
+// GetByID returns a payment record
+func (s *PaymentService) GetByID(id primitive.ObjectID) (*models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.payments.FindByID(ctx, id)
+}
+
+// ListByOrder returns every payment attempt for an order, newest first
+func (s *PaymentService) ListByOrder(orderID primitive.ObjectID) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.payments.ListByOrder(ctx, orderID)
+}
+
+// recordFailure keeps declined and failed attempts for support and reconciliation
+func (s *PaymentService) recordFailure(payment *models.Payment, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payment.Status = models.PaymentStatusFailed
+	payment.FailureReason = cause.Error()
+	payment.UpdatedAt = time.Now()
+	if err := s.payments.Insert(ctx, payment); err != nil {
+		log.Printf("payments: failed to record failed payment for order %s: %v", payment.OrderID.Hex(), err)
+	}
+}
+
+func (s *PaymentService) refundQuietly(ctx context.Context, gateway gateways.PaymentGateway, captured *gateways.Result) {
+	if _, err := gateway.Refund(ctx, captured.TransactionID, captured.Amount, captured.Currency); err != nil {
+		log.Printf("payments: failed to refund capture %s: %v", captured.TransactionID, err)
+	}
+}
+
+func sameAmount(a, b float64, currency string) bool {
+	return money.ToMinor(a, currency) == money.ToMinor(b, currency)
+}
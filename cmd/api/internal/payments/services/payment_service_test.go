@@ -0,0 +1,421 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	invoicerepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/repository"
+	invoiceservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/services"
+	ledgermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	ledgerrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/repository"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	ordermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	orderrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/repository"
+	userrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
+	walletmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	walletrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/repository"
+	walletservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	approvedCard = "4111111111111111"
+	declinedCard = "4000000000000002"
+	timeoutCard  = "4000000000000119"
+)
+
+// shop wires the payment services onto an in-memory store and the simulator
+type shop struct {
+	t        *testing.T
+	store    *database.MemoryStore
+	sim      *gateways.Simulator
+	registry *gateways.Registry
+	orders   orderrepository.OrderRepository
+	payments repository.PaymentRepository
+	machine  *statemachine.Machine
+	ledger   *ledgerservices.LedgerService
+	wallets  *walletservices.WalletService
+	invoices *invoiceservices.InvoiceService
+	pay      *PaymentService
+	refunds  *RefundService
+	webhooks *WebhookService
+	events   repository.PaymentEventRepository
+	client   primitive.ObjectID
+}
+
+func newShop(t *testing.T) *shop {
+	t.Helper()
+	t.Setenv("PAYMENT_CURRENCY", "USD")
+	t.Setenv("PAYMENT_WEBHOOK_SECRET_SIMULATOR", webhookSecret)
+	store := database.NewMemoryStore()
+	sim := gateways.NewSimulator(gateways.DefaultSimulatorConfig())
+	s := &shop{
+		t:        t,
+		store:    store,
+		sim:      sim,
+		registry: gateways.NewRegistry(sim),
+		orders:   orderrepository.NewMemoryOrderRepository(store),
+		payments: repository.NewMemoryPaymentRepository(store),
+		events:   repository.NewMemoryPaymentEventRepository(store),
+		ledger:   ledgerservices.NewLedgerServiceWith(ledgerrepository.NewMemoryJournalEntryRepository(store)),
+		client:   primitive.NewObjectID(),
+	}
+	s.machine = statemachine.NewMachineWith(s.orders, orderrepository.NewMemoryOrderEventRepository(store))
+	s.wallets = walletservices.NewWalletServiceWith(walletservices.WalletServiceDeps{
+		Wallets:      walletrepository.NewMemoryWalletRepository(store),
+		Transactions: walletrepository.NewMemoryTransactionRepository(store),
+		Transactor:   store,
+		Ledger:       s.ledger,
+		Gateways:     s.registry,
+	})
+	s.invoices = invoiceservices.NewInvoiceServiceWith(invoiceservices.InvoiceServiceDeps{
+		Invoices:   invoicerepository.NewMemoryInvoiceRepository(store),
+		Counters:   invoicerepository.NewMemoryCounterRepository(store),
+		Orders:     s.orders,
+		Users:      userrepository.NewMemoryUserRepository(store),
+		Payments:   s.payments,
+		Transactor: store,
+	})
+	s.pay = NewPaymentServiceWith(PaymentServiceDeps{
+		Payments:   s.payments,
+		Orders:     s.orders,
+		Machine:    s.machine,
+		Transactor: store,
+		Ledger:     s.ledger,
+		Wallets:    s.wallets,
+		Invoices:   s.invoices,
+		Gateways:   s.registry,
+	})
+	s.refunds = NewRefundServiceWith(RefundServiceDeps{
+		Payments:   s.payments,
+		Orders:     s.orders,
+		Machine:    s.machine,
+		Transactor: store,
+		Ledger:     s.ledger,
+		Wallets:    s.wallets,
+		Gateways:   s.registry,
+	})
+	s.webhooks = NewWebhookServiceWith(WebhookServiceDeps{
+		Payments:   s.payments,
+		Events:     s.events,
+		Orders:     s.orders,
+		Machine:    s.machine,
+		Transactor: store,
+		Ledger:     s.ledger,
+		Refunds:    s.refunds,
+		Invoices:   s.invoices,
+		Gateways:   s.registry,
+	})
+	return s
+}
+
+// order stores an order of the client waiting for payment of price USD
+func (s *shop) order(price float64) primitive.ObjectID {
+	s.t.Helper()
+	order := &ordermodels.Order{
+		ID:       primitive.NewObjectID(),
+		UserID:   s.client,
+		Title:    "Lab report",
+		Price:    price,
+		Currency: "USD",
+		Status:   statemachine.StatusPendingPayment,
+	}
+	if err := s.orders.Insert(context.Background(), order); err != nil {
+		s.t.Fatal(err)
+	}
+	return order.ID
+}
+
+// paid pays for a new order of price USD by card
+func (s *shop) paid(price float64) *models.Payment {
+	s.t.Helper()
+	payment, err := s.pay.PayForOrder(s.order(price), s.client, "simulator", card(approvedCard))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return payment
+}
+
+func (s *shop) orderStatus(orderID primitive.ObjectID) string {
+	s.t.Helper()
+	order, err := s.orders.FindOne(context.Background(), bson.M{"_id": orderID})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return order.Status
+}
+
+// balance is the balance of a ledger account in USD minor units
+func (s *shop) balance(account string) int64 {
+	s.t.Helper()
+	balances, err := s.ledger.AccountBalances(account)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	for _, b := range balances {
+		if b.Currency == "USD" {
+			return b.Balance
+		}
+	}
+	return 0
+}
+
+func (s *shop) gatewayStatus(transactionID string) string {
+	s.t.Helper()
+	result, err := s.sim.Status(context.Background(), transactionID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return result.Status
+}
+
+// onlyAttempt returns the single payment attempt of an order
+func (s *shop) onlyAttempt(orderID primitive.ObjectID) models.Payment {
+	s.t.Helper()
+	attempts, err := s.pay.ListByOrder(orderID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if len(attempts) != 1 {
+		s.t.Fatalf("order has %d payment attempts, want 1", len(attempts))
+	}
+	return attempts[0]
+}
+
+func card(number string) map[string]interface{} {
+	return map[string]interface{}{"card_number": number}
+}
+
+// shortCapture captures a cent less than asked, like a provider that
+// applied a fee or a rounding rule of its own
+type shortCapture struct {
+	*gateways.Simulator
+}
+
+func (g shortCapture) Capture(ctx context.Context, transactionID string, amount float64, currency string) (*gateways.Result, error) {
+	return g.Simulator.Capture(ctx, transactionID, amount-0.01, currency)
+}
+
+// otherAuthorization authorizes a different amount or currency than asked
+type otherAuthorization struct {
+	*gateways.Simulator
+	amount   float64
+	currency string
+}
+
+func (g otherAuthorization) Authorize(ctx context.Context, req gateways.AuthorizeRequest) (*gateways.Result, error) {
+	req.Amount += g.amount
+	if g.currency != "" {
+		req.Currency = g.currency
+	}
+	return g.Simulator.Authorize(ctx, req)
+}
+
+// failingCapture authorizes but never captures
+type failingCapture struct {
+	*gateways.Simulator
+}
+
+func (failingCapture) Capture(ctx context.Context, transactionID string, amount float64, currency string) (*gateways.Result, error) {
+	return nil, errors.New("capture rejected")
+}
+
+func TestPayForOrder(t *testing.T) {
+	s := newShop(t)
+	orderID := s.order(42.5)
+
+	payment, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(approvedCard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != models.PaymentStatusCaptured || payment.Amount != 42.5 || payment.Currency != "USD" {
+		t.Errorf("payment = %+v", payment)
+	}
+	if got := s.gatewayStatus(payment.TransactionID); got != gateways.StatusCaptured {
+		t.Errorf("gateway transaction is %s, want captured", got)
+	}
+	if got := s.orderStatus(orderID); got != statemachine.StatusPaid {
+		t.Errorf("order is %s, want paid", got)
+	}
+	if got := s.balance(ledgermodels.AccountCash); got != 4250 {
+		t.Errorf("cash = %d, want 4250", got)
+	}
+	if invoice, err := s.invoices.ForOrder(orderID); err != nil || invoice.PaymentID != payment.ID || invoice.Total != 42.5 {
+		t.Errorf("invoice = %+v, %v; want one for the payment", invoice, err)
+	}
+	if stored := s.onlyAttempt(orderID); stored.ID != payment.ID || stored.Status != models.PaymentStatusCaptured {
+		t.Errorf("stored payment = %+v", stored)
+	}
+
+	// A paid order cannot be charged again
+	if _, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(approvedCard)); !errors.Is(err, statemachine.ErrIllegalTransition) {
+		t.Errorf("paying a paid order = %v, want ErrIllegalTransition", err)
+	}
+	if _, err := s.pay.PayForOrder(orderID, primitive.NewObjectID(), "simulator", card(approvedCard)); !errors.Is(err, statemachine.ErrOrderNotFound) {
+		t.Errorf("paying another client's order = %v, want ErrOrderNotFound", err)
+	}
+	if _, err := s.pay.PayForOrder(s.order(10), s.client, "bitcoin", nil); !errors.Is(err, gateways.ErrUnknownMethod) {
+		t.Errorf("paying with an unknown method = %v, want ErrUnknownMethod", err)
+	}
+	if got := s.balance(ledgermodels.AccountCash); got != 4250 {
+		t.Errorf("cash = %d after refused payments, want 4250", got)
+	}
+}
+
+func TestPayForOrderRecordsFailedAttempts(t *testing.T) {
+	for _, tc := range []struct {
+		card string
+		want error
+	}{
+		{declinedCard, gateways.ErrDeclined},
+		{timeoutCard, gateways.ErrTimeout},
+	} {
+		s := newShop(t)
+		orderID := s.order(42.5)
+		if _, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(tc.card)); !errors.Is(err, tc.want) {
+			t.Errorf("card %s: PayForOrder = %v, want %v", tc.card, err, tc.want)
+			continue
+		}
+		attempt := s.onlyAttempt(orderID)
+		if attempt.Status != models.PaymentStatusFailed || attempt.FailureReason != tc.want.Error() {
+			t.Errorf("card %s: attempt = %+v", tc.card, attempt)
+		}
+		if got := s.orderStatus(orderID); got != statemachine.StatusPendingPayment {
+			t.Errorf("card %s: order is %s, want pending_payment", tc.card, got)
+		}
+		if got := s.balance(ledgermodels.AccountCash); got != 0 {
+			t.Errorf("card %s: cash = %d, want 0", tc.card, got)
+		}
+	}
+}
+
+func TestPayForOrderRefundsAmountMismatch(t *testing.T) {
+	s := newShop(t)
+	s.registry.Register(shortCapture{s.sim})
+	orderID := s.order(42.5)
+
+	if _, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(approvedCard)); !errors.Is(err, ErrAmountMismatch) {
+		t.Fatalf("PayForOrder = %v, want ErrAmountMismatch", err)
+	}
+	attempt := s.onlyAttempt(orderID)
+	if attempt.Status != models.PaymentStatusFailed || attempt.FailureReason != ErrAmountMismatch.Error() {
+		t.Errorf("attempt = %+v", attempt)
+	}
+	// What the provider took went back to the client
+	if got := s.gatewayStatus(attempt.TransactionID); got != gateways.StatusRefunded {
+		t.Errorf("gateway transaction is %s, want refunded", got)
+	}
+	if got := s.orderStatus(orderID); got != statemachine.StatusPendingPayment {
+		t.Errorf("order is %s, want pending_payment", got)
+	}
+	if _, err := s.invoices.ForOrder(orderID); !errors.Is(err, invoiceservices.ErrOrderNotInvoiced) {
+		t.Errorf("invoice of an unpaid order: %v", err)
+	}
+}
+
+func TestPayForOrderRejectsOtherAuthorizedAmount(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		gateway otherAuthorization
+	}{
+		{"less", otherAuthorization{amount: -0.01}},
+		{"more", otherAuthorization{amount: 10}},
+		{"other currency", otherAuthorization{currency: "EUR"}},
+	} {
+		s := newShop(t)
+		tc.gateway.Simulator = s.sim
+		s.registry.Register(tc.gateway)
+		orderID := s.order(42.5)
+
+		if _, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(approvedCard)); !errors.Is(err, ErrAmountMismatch) {
+			t.Errorf("%s: PayForOrder = %v, want ErrAmountMismatch", tc.name, err)
+			continue
+		}
+		attempt := s.onlyAttempt(orderID)
+		if attempt.Status != models.PaymentStatusFailed || attempt.FailureReason != ErrAmountMismatch.Error() || attempt.TransactionID != "" {
+			t.Errorf("%s: attempt = %+v", tc.name, attempt)
+		}
+		// Nothing was captured, the hold on the client's card is released
+		if got := s.gatewayStatus(attempt.AuthorizationID); got != gateways.StatusVoided {
+			t.Errorf("%s: authorization is %s, want voided", tc.name, got)
+		}
+		if got := s.orderStatus(orderID); got != statemachine.StatusPendingPayment {
+			t.Errorf("%s: order is %s, want pending_payment", tc.name, got)
+		}
+		if got := s.balance(ledgermodels.AccountCash); got != 0 {
+			t.Errorf("%s: cash = %d, want 0", tc.name, got)
+		}
+	}
+}
+
+func TestPayForOrderVoidsUncapturedAuthorization(t *testing.T) {
+	s := newShop(t)
+	s.registry.Register(failingCapture{s.sim})
+	orderID := s.order(42.5)
+
+	if _, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(approvedCard)); err == nil {
+		t.Fatal("PayForOrder succeeded without a capture")
+	}
+	attempt := s.onlyAttempt(orderID)
+	if attempt.Status != models.PaymentStatusFailed || attempt.AuthorizationID == "" {
+		t.Fatalf("attempt = %+v", attempt)
+	}
+	if got := s.gatewayStatus(attempt.AuthorizationID); got != gateways.StatusVoided {
+		t.Errorf("authorization is %s, want voided", got)
+	}
+	if got := s.orderStatus(orderID); got != statemachine.StatusPendingPayment {
+		t.Errorf("order is %s, want pending_payment", got)
+	}
+}
+
+func TestPayFromWallet(t *testing.T) {
+	s := newShop(t)
+	ctx := context.Background()
+	if _, err := s.wallets.Credit(ctx, s.client, 5000, "USD", walletmodels.TransactionKindRefund, "refund-1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	orderID := s.order(42.5)
+	payment, err := s.pay.PayForOrder(orderID, s.client, models.PaymentMethodWallet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Method != models.PaymentMethodWallet || payment.Status != models.PaymentStatusCaptured || payment.TransactionID == "" {
+		t.Errorf("payment = %+v", payment)
+	}
+	if wallet, _ := s.wallets.Get(s.client); wallet.Balance != 750 {
+		t.Errorf("wallet balance = %d, want 750", wallet.Balance)
+	}
+	if got := s.orderStatus(orderID); got != statemachine.StatusPaid {
+		t.Errorf("order is %s, want paid", got)
+	}
+	if _, err := s.invoices.ForOrder(orderID); err != nil {
+		t.Errorf("wallet payment was not invoiced: %v", err)
+	}
+
+	// Too little credit left: nothing is taken and the attempt is kept
+	second := s.order(10)
+	if _, err := s.pay.PayForOrder(second, s.client, models.PaymentMethodWallet, nil); !errors.Is(err, walletservices.ErrInsufficientFunds) {
+		t.Fatalf("PayForOrder = %v, want ErrInsufficientFunds", err)
+	}
+	if attempt := s.onlyAttempt(second); attempt.Status != models.PaymentStatusFailed || attempt.TransactionID != "" {
+		t.Errorf("attempt = %+v", attempt)
+	}
+	if wallet, _ := s.wallets.Get(s.client); wallet.Balance != 750 {
+		t.Errorf("wallet balance = %d after a refused payment, want 750", wallet.Balance)
+	}
+	if got := s.orderStatus(second); got != statemachine.StatusPendingPayment {
+		t.Errorf("order is %s, want pending_payment", got)
+	}
+	report, err := s.ledger.TrialBalance()
+	if err != nil || !report.Balanced {
+		t.Errorf("trial balance = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	orderrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/repository"
+	walletmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	walletservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidRefundReason   = errors.New("unknown refund reason")
+	ErrMissingIdempotencyKey = errors.New("an idempotency key is required")
+	ErrNothingToRefund       = errors.New("order has no captured payment to refund")
+	ErrRefundExceedsCaptured = errors.New("refund exceeds the amount still refundable")
+	ErrIdempotencyConflict   = errors.New("idempotency key was already used for a different refund")
+	ErrConcurrentRefund      = errors.New("payment changed while the refund was being reserved, retry")
+)
+
+// refundableStatuses are the payment statuses money can still be returned from
+var refundableStatuses = []string{models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded}
+
+// RefundRequest is what an admin asks to return to the client
+type RefundRequest struct {
+	Amount         float64 // 0 refunds everything not refunded yet
+	Reason         string  // one of models.RefundReasons()
+	Note           string
+	IdempotencyKey string
+	ToWallet       bool // return the money as store credit instead of through the provider
+}
+
+// RefundService returns captured money to clients and keeps the refund ledger on the payment
+type RefundService struct {
+	payments repository.PaymentRepository
+	orders   orderrepository.OrderRepository
+	machine  *statemachine.Machine
+	tx       database.Transactor
+	ledger   *ledgerservices.LedgerService
+	wallets  *walletservices.WalletService
+	gateways *gateways.Registry
+}
+
+// RefundServiceDeps are the stores and services a RefundService works with;
+// see NewRefundServiceWith
+type RefundServiceDeps struct {
+	Payments   repository.PaymentRepository
+	Orders     orderrepository.OrderRepository
+	Machine    *statemachine.Machine
+	Transactor database.Transactor
+	Ledger     *ledgerservices.LedgerService
+	Wallets    *walletservices.WalletService
+	Gateways   *gateways.Registry
+}
+
+func NewRefundService(db *mongo.Database, registry *gateways.Registry) *RefundService {
+	return NewRefundServiceWith(RefundServiceDeps{
+		Payments:   repository.NewMongoPaymentRepository(db),
+		Orders:     orderrepository.NewMongoOrderRepository(db),
+		Machine:    statemachine.NewMachine(db),
+		Transactor: database.NewMongoTransactor(db.Client()),
+		Ledger:     ledgerservices.NewLedgerService(db),
+		Wallets:    walletservices.NewWalletService(db, registry),
+		Gateways:   registry,
+	})
+}
+
+// NewRefundServiceWith builds the service on deps, e.g. in-memory stores and
+// the simulator in tests
+func NewRefundServiceWith(deps RefundServiceDeps) *RefundService {
+	return &RefundService{
+		payments: deps.Payments,
+		orders:   deps.Orders,
+		machine:  deps.Machine,
+		tx:       deps.Transactor,
+		ledger:   deps.Ledger,
+		wallets:  deps.Wallets,
+		gateways: deps.Gateways,
+	}
+}
+
+// RefundOrder refunds the order's captured payment, through the provider or
+// into the client's wallet. The amount is reserved on the payment before the
+// provider is called, so concurrent refunds can never add up to more than was
+// captured. Repeating a request with the same idempotency key returns the
+// original refund and replayed=true.
+func (s *RefundService) RefundOrder(orderID primitive.ObjectID, actor statemachine.Actor, req RefundRequest) (payment *models.Payment, refund *models.Refund, replayed bool, err error) {
+	if !validRefundReason(req.Reason) {
+		return nil, nil, false, ErrInvalidRefundReason
+	}
+	if req.IdempotencyKey == "" {
+		return nil, nil, false, ErrMissingIdempotencyKey
+	}
+	// Gateways talk to the network, give them longer than a database call
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	payment, err = s.refundablePayment(ctx, orderID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	toWallet := req.ToWallet || payment.Method == models.PaymentMethodWallet
+	for i := range payment.Refunds {
+		existing := payment.Refunds[i]
+		if existing.IdempotencyKey != req.IdempotencyKey {
+			continue
+		}
+		if existing.Reason != req.Reason || (req.Amount != 0 && !sameAmount(existing.Amount, req.Amount, payment.Currency)) ||
+			(existing.Destination == models.RefundDestinationWallet) != toWallet {
+			return nil, nil, false, ErrIdempotencyConflict
+		}
+		return payment, &existing, true, nil
+	}
+
+	remaining := payment.Amount - payment.RefundedAmount
+	amount := req.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	amount = money.Round(amount, payment.Currency)
+	if amount <= 0 || money.ToMinor(amount, payment.Currency) > money.ToMinor(remaining, payment.Currency) {
+		return nil, nil, false, ErrRefundExceedsCaptured
+	}
+	var gateway gateways.PaymentGateway
+	if !toWallet {
+		gateway, err = s.gateways.Get(payment.Method)
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	now := time.Now()
+	refund = &models.Refund{
+		ID:             primitive.NewObjectID(),
+		IdempotencyKey: req.IdempotencyKey,
+		Amount:         amount,
+		Reason:         req.Reason,
+		Note:           req.Note,
+		Status:         models.RefundStatusPending,
+		ActorID:        actor.ID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if toWallet {
+		refund.Destination = models.RefundDestinationWallet
+	}
+	matched, err := s.payments.Update(ctx,
+		bson.M{
+			"_id":                     payment.ID,
+			"status":                  bson.M{"$in": refundableStatuses},
+			"updated_at":              payment.UpdatedAt,
+			"refunds.idempotency_key": bson.M{"$ne": req.IdempotencyKey},
+		},
+		bson.M{
+			"$push": bson.M{"refunds": refund},
+			"$inc":  bson.M{"refunded_amount": amount},
+			"$set":  bson.M{"updated_at": now},
+		},
+	)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if matched == 0 {
+		return nil, nil, false, ErrConcurrentRefund
+	}
+
+	// Store credit needs no provider; the wallet is credited when the refund settles
+	providerRefundID := ""
+	if !toWallet {
+		result, err := gateway.Refund(ctx, payment.TransactionID, amount, payment.Currency)
+		if err != nil {
+			if errors.Is(err, gateways.ErrTimeout) {
+				// The provider may still issue it; keep the reservation until a webhook settles it
+				return nil, nil, false, err
+			}
+			s.releaseRefund(payment.ID, refund.ID, err)
+			return nil, nil, false, err
+		}
+		providerRefundID = result.TransactionID
+	}
+
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.settleRefund(ctx, payment.ID, refund.ID, providerRefundID, actor, "refund: "+req.Reason)
+		return err
+	})
+	if err != nil {
+		if toWallet {
+			s.releaseRefund(payment.ID, refund.ID, err)
+		} else {
+			log.Printf("payments: refund %s of payment %s was issued by %s but not recorded: %v", providerRefundID, payment.ID.Hex(), payment.Method, err)
+		}
+		return nil, nil, false, err
+	}
+
+	payment, err = s.payments.FindByID(ctx, payment.ID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for i := range payment.Refunds {
+		if payment.Refunds[i].ID == refund.ID {
+			refund = &payment.Refunds[i]
+		}
+	}
+	return payment, refund, false, nil
+}
+
+// refundablePayment finds the payment that captured the order's price
+func (s *RefundService) refundablePayment(ctx context.Context, orderID primitive.ObjectID) (*models.Payment, error) {
+	filter := bson.M{
+		"order_id": orderID,
+		"status":   bson.M{"$in": []string{models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded}},
+	}
+	payment, err := s.payments.FindLatest(ctx, filter)
+	if err == nil {
+		return payment, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	count, err := s.orders.Count(ctx, bson.M{"_id": orderID})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, statemachine.ErrOrderNotFound
+	}
+	return nil, ErrNothingToRefund
+}
+
+// releaseRefund gives back the amount reserved for a refund the provider rejected
+func (s *RefundService) releaseRefund(paymentID, refundID primitive.ObjectID, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payment, err := s.payments.FindByID(ctx, paymentID)
+	if err != nil {
+		log.Printf("payments: failed to release refund %s: %v", refundID.Hex(), err)
+		return
+	}
+	for _, r := range payment.Refunds {
+		if r.ID != refundID {
+			continue
+		}
+		now := time.Now()
+		// Conditional on the refund still pending, so only one release gives the amount back
+		_, err := s.payments.UpdateRefund(ctx, repository.RefundChange{
+			PaymentID:  paymentID,
+			RefundID:   refundID,
+			From:       models.RefundStatusPending,
+			Set:        bson.M{"status": models.RefundStatusFailed, "failure_reason": cause.Error(), "updated_at": now},
+			PaymentSet: bson.M{"updated_at": now},
+			PaymentInc: bson.M{"refunded_amount": -r.Amount},
+		})
+		if err != nil {
+			log.Printf("payments: failed to release refund %s: %v", refundID.Hex(), err)
+		}
+		return
+	}
+	log.Printf("payments: failed to release refund %s: not on payment %s", refundID.Hex(), paymentID.Hex())
+}
+
+// settleRefund marks a pending refund as confirmed by the provider (or credits
+// the wallet for store credit), posts it to the ledger, then moves the payment
+// and the order to refunded or partially_refunded depending on how much has
+// been returned. Run it inside a transaction.
+func (s *RefundService) settleRefund(ctx context.Context, paymentID, refundID primitive.ObjectID, providerRefundID string, actor statemachine.Actor, reason string) (*models.Payment, error) {
+	now := time.Now()
+	set := bson.M{"status": models.RefundStatusSucceeded, "updated_at": now}
+	if providerRefundID != "" {
+		set["provider_refund_id"] = providerRefundID
+	}
+	payment, err := s.payments.UpdateRefund(ctx, repository.RefundChange{
+		PaymentID:  paymentID,
+		RefundID:   refundID,
+		From:       models.RefundStatusPending,
+		Set:        set,
+		PaymentSet: bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var settled, taxRefunded float64
+	for _, r := range payment.Refunds {
+		if r.Status == models.RefundStatusSucceeded {
+			settled += r.Amount
+			taxRefunded += r.Tax
+		}
+	}
+	for _, r := range payment.Refunds {
+		if r.ID != refundID {
+			continue
+		}
+		// The tax returned so far follows the share of the payment returned,
+		// so the last refund returns whatever tax rounding left over
+		taxDue := money.Round(payment.Tax*math.Min(settled/payment.Amount, 1), payment.Currency)
+		tax := money.Round(taxDue-taxRefunded, payment.Currency)
+		if tax > 0 {
+			if _, err := s.payments.UpdateRefund(ctx, repository.RefundChange{
+				PaymentID: paymentID,
+				RefundID:  refundID,
+				From:      models.RefundStatusSucceeded,
+				Set:       bson.M{"tax": tax},
+			}); err != nil {
+				return nil, err
+			}
+		}
+		toWallet := r.Destination == models.RefundDestinationWallet
+		if toWallet {
+			if _, err := s.wallets.Credit(ctx, payment.UserID, money.ToMinor(r.Amount, payment.Currency), payment.Currency, walletmodels.TransactionKindRefund, refundID.Hex(), &payment.OrderID); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.ledger.PostRefund(ctx, refundID, payment.OrderID, payment.UserID, money.ToMinor(r.Amount, payment.Currency), money.ToMinor(tax, payment.Currency), payment.Currency, toWallet); err != nil {
+			return nil, err
+		}
+	}
+	full := settled >= payment.Amount || sameAmount(settled, payment.Amount, payment.Currency)
+	status := payment.Status
+	orderStatus := statemachine.StatusPartiallyRefunded
+	switch {
+	case full:
+		status = models.PaymentStatusRefunded
+		orderStatus = statemachine.StatusRefunded
+	case payment.Status == models.PaymentStatusDisputed:
+		// A partial refund does not end a chargeback; the order stays disputed
+		orderStatus = ""
+	default:
+		status = models.PaymentStatusPartiallyRefunded
+	}
+	if status != payment.Status {
+		if _, err := s.payments.Update(ctx, bson.M{"_id": paymentID}, bson.M{"$set": bson.M{"status": status}}); err != nil {
+			return nil, err
+		}
+		payment.Status = status
+	}
+	if orderStatus != "" {
+		if err := moveOrder(ctx, s.machine, payment.OrderID, orderStatus, actor, reason); err != nil {
+			return nil, err
+		}
+	}
+	return payment, nil
+}
+
+// moveOrder transitions the order of a payment after money moved. The money
+// has already moved by then, so an order that is not in a status the move is
+// allowed from is left alone (and logged) rather than failing the caller.
+func moveOrder(ctx context.Context, machine *statemachine.Machine, orderID primitive.ObjectID, to string, actor statemachine.Actor, reason string) error {
+	_, err := machine.Apply(ctx, statemachine.Change{
+		OrderID: orderID,
+		To:      to,
+		Actor:   actor,
+		Reason:  reason,
+	})
+	var transitionErr *statemachine.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		if transitionErr.From != to {
+			log.Printf("payments: left order %s unchanged: %v", orderID.Hex(), err)
+		}
+		return nil
+	case errors.Is(err, statemachine.ErrOrderNotFound):
+		log.Printf("payments: order %s of payment not found", orderID.Hex())
+		return nil
+	}
+	return err
+}
+
+func validRefundReason(reason string) bool {
+	for _, r := range models.RefundReasons() {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
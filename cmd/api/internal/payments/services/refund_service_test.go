@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	ledgermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var admin = statemachine.UserActor(primitive.NewObjectID(), []string{statemachine.RoleAdmin})
+
+// failingRefund captures but the provider refuses every refund
+type failingRefund struct {
+	*gateways.Simulator
+}
+
+func (failingRefund) Refund(ctx context.Context, transactionID string, amount float64, currency string) (*gateways.Result, error) {
+	return nil, errors.New("refund rejected")
+}
+
+func refundOf(amount float64, key string) RefundRequest {
+	return RefundRequest{Amount: amount, Reason: models.RefundReasonQualityIssue, IdempotencyKey: key}
+}
+
+func TestPartialThenFullRefund(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+
+	got, refund, replayed, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(10, "first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed || refund.Status != models.RefundStatusSucceeded || refund.Amount != 10 || refund.ProviderRefundID == "" {
+		t.Errorf("refund = %+v, replayed %v", refund, replayed)
+	}
+	if got.Status != models.PaymentStatusPartiallyRefunded || got.RefundedAmount != 10 {
+		t.Errorf("payment is %s with %v refunded, want partially_refunded with 10", got.Status, got.RefundedAmount)
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusPartiallyRefunded {
+		t.Errorf("order is %s, want partially_refunded", status)
+	}
+	if status := s.gatewayStatus(payment.TransactionID); status != gateways.StatusCaptured {
+		t.Errorf("gateway transaction is %s after a partial refund, want captured", status)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 3250 {
+		t.Errorf("cash = %d, want 3250", cash)
+	}
+
+	// The same request again returns the refund without moving money
+	_, again, replayed, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(10, "first"))
+	if err != nil || !replayed || again.ID != refund.ID {
+		t.Errorf("replayed refund = %+v, %v, %v; want the first one", again, replayed, err)
+	}
+	if _, _, _, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(5, "first")); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("reusing the key for another amount = %v, want ErrIdempotencyConflict", err)
+	}
+
+	// No amount refunds whatever is left
+	got, refund, _, err = s.refunds.RefundOrder(payment.OrderID, admin, refundOf(0, "rest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Amount != 32.5 || got.Status != models.PaymentStatusRefunded || got.RefundedAmount != 42.5 || len(got.Refunds) != 2 {
+		t.Errorf("payment is %s with %v refunded in %d refunds, want refunded with 42.5 in 2", got.Status, got.RefundedAmount, len(got.Refunds))
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusRefunded {
+		t.Errorf("order is %s, want refunded", status)
+	}
+	if status := s.gatewayStatus(payment.TransactionID); status != gateways.StatusRefunded {
+		t.Errorf("gateway transaction is %s, want refunded", status)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 0 {
+		t.Errorf("cash = %d, want 0", cash)
+	}
+	if _, _, _, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(0, "more")); !errors.Is(err, ErrRefundExceedsCaptured) {
+		t.Errorf("refunding a refunded payment = %v, want ErrRefundExceedsCaptured", err)
+	}
+	report, err := s.ledger.TrialBalance()
+	if err != nil || !report.Balanced {
+		t.Errorf("trial balance = %+v, %v", report, err)
+	}
+}
+
+func TestRefundCannotExceedCaptured(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+
+	if _, _, _, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(42.51, "too-much")); !errors.Is(err, ErrRefundExceedsCaptured) {
+		t.Errorf("refunding more than captured = %v, want ErrRefundExceedsCaptured", err)
+	}
+	if _, _, _, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(40, "most")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(2.51, "over")); !errors.Is(err, ErrRefundExceedsCaptured) {
+		t.Errorf("refunding more than is left = %v, want ErrRefundExceedsCaptured", err)
+	}
+	stored, err := s.payments.FindByID(context.Background(), payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RefundedAmount != 40 || len(stored.Refunds) != 1 {
+		t.Errorf("payment has %v refunded in %d refunds, want 40 in 1", stored.RefundedAmount, len(stored.Refunds))
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 250 {
+		t.Errorf("cash = %d, want 250", cash)
+	}
+}
+
+func TestConcurrentRefundsNeverExceedCaptured(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+
+	const refunds = 10
+	var wg sync.WaitGroup
+	errs := make([]error, refunds)
+	for i := 0; i < refunds; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, _, errs[i] = s.refunds.RefundOrder(payment.OrderID, admin, refundOf(10, fmt.Sprintf("key-%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrRefundExceedsCaptured) && !errors.Is(err, ErrConcurrentRefund):
+			t.Errorf("RefundOrder = %v, want nil, ErrRefundExceedsCaptured or ErrConcurrentRefund", err)
+		}
+	}
+	if succeeded == 0 || succeeded > 4 {
+		t.Errorf("%d refunds of 10 succeeded on a payment of 42.5, want 1 to 4", succeeded)
+	}
+	stored, err := s.payments.FindByID(context.Background(), payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(10 * succeeded); stored.RefundedAmount != want || len(stored.Refunds) != succeeded {
+		t.Errorf("payment has %v refunded in %d refunds, want %v in %d", stored.RefundedAmount, len(stored.Refunds), want, succeeded)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 4250-1000*int64(succeeded) {
+		t.Errorf("cash = %d after %d refunds of 10", cash, succeeded)
+	}
+}
+
+func TestRefundToWallet(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+
+	req := refundOf(12.5, "credit")
+	req.ToWallet = true
+	_, refund, _, err := s.refunds.RefundOrder(payment.OrderID, admin, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Destination != models.RefundDestinationWallet || refund.Status != models.RefundStatusSucceeded || refund.ProviderRefundID != "" {
+		t.Errorf("refund = %+v", refund)
+	}
+	if wallet, _ := s.wallets.Get(s.client); wallet.Balance != 1250 {
+		t.Errorf("wallet balance = %d, want 1250", wallet.Balance)
+	}
+	// The provider keeps the whole capture
+	if status := s.gatewayStatus(payment.TransactionID); status != gateways.StatusCaptured {
+		t.Errorf("gateway transaction is %s, want captured", status)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 4250 {
+		t.Errorf("cash = %d, want 4250", cash)
+	}
+}
+
+func TestRefundRejectedByProviderIsReleased(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+	s.registry.Register(failingRefund{s.sim})
+
+	if _, _, _, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(10, "rejected")); err == nil {
+		t.Fatal("RefundOrder succeeded although the provider rejected it")
+	}
+	stored, err := s.payments.FindByID(context.Background(), payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RefundedAmount != 0 || len(stored.Refunds) != 1 || stored.Refunds[0].Status != models.RefundStatusFailed || stored.Refunds[0].FailureReason == "" {
+		t.Errorf("payment after a rejected refund = %+v", stored)
+	}
+	if stored.Status != models.PaymentStatusCaptured {
+		t.Errorf("payment is %s, want captured", stored.Status)
+	}
+
+	// The released amount can be refunded again
+	s.registry.Register(s.sim)
+	if _, _, _, err := s.refunds.RefundOrder(payment.OrderID, admin, refundOf(42.5, "retry")); err != nil {
+		t.Errorf("refund after a rejected one = %v", err)
+	}
+}
+
+func TestRefundRequestErrors(t *testing.T) {
+	s := newShop(t)
+	unpaid := s.order(42.5)
+	for _, tc := range []struct {
+		name    string
+		orderID primitive.ObjectID
+		req     RefundRequest
+		want    error
+	}{
+		{"unpaid order", unpaid, refundOf(10, "k"), ErrNothingToRefund},
+		{"unknown order", primitive.NewObjectID(), refundOf(10, "k"), statemachine.ErrOrderNotFound},
+		{"unknown reason", unpaid, RefundRequest{Amount: 10, Reason: "bored", IdempotencyKey: "k"}, ErrInvalidRefundReason},
+		{"no idempotency key", unpaid, refundOf(10, ""), ErrMissingIdempotencyKey},
+	} {
+		if _, _, _, err := s.refunds.RefundOrder(tc.orderID, admin, tc.req); !errors.Is(err, tc.want) {
+			t.Errorf("%s: RefundOrder = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	invoiceservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/services"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	orderrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/repository"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Outcomes of handling a webhook delivery
+const (
+	WebhookProcessed = "processed"
+	WebhookDuplicate = "duplicate"
+	WebhookIgnored   = "ignored"
+)
+
+var (
+	// ErrWebhookNotConfigured is returned for providers that are not registered,
+	// cannot parse webhooks or have no PAYMENT_WEBHOOK_SECRET_<PROVIDER> set
+	ErrWebhookNotConfigured = errors.New("webhooks are not configured for this provider")
+	ErrInvalidPayload       = errors.New("invalid webhook payload")
+
+	errAlreadyHandled = errors.New("webhook event already handled")
+)
+
+// creditReasonCaptureDenied is the reason on the credit note cancelling the
+// invoice of a capture the provider denied afterwards
+const creditReasonCaptureDenied = "capture_denied"
+
+// WebhookService verifies provider notifications and applies them to payments and orders
+type WebhookService struct {
+	payments repository.PaymentRepository
+	events   repository.PaymentEventRepository
+	orders   orderrepository.OrderRepository
+	machine  *statemachine.Machine
+	tx       database.Transactor
+	ledger   *ledgerservices.LedgerService
+	refunds  *RefundService
+	invoices *invoiceservices.InvoiceService
+	gateways *gateways.Registry
+}
+
+// WebhookServiceDeps are the stores and services a WebhookService works with;
+// see NewWebhookServiceWith
+type WebhookServiceDeps struct {
+	Payments   repository.PaymentRepository
+	Events     repository.PaymentEventRepository
+	Orders     orderrepository.OrderRepository
+	Machine    *statemachine.Machine
+	Transactor database.Transactor
+	Ledger     *ledgerservices.LedgerService
+	Refunds    *RefundService
+	Invoices   *invoiceservices.InvoiceService
+	Gateways   *gateways.Registry
+}
+
+func NewWebhookService(db *mongo.Database, registry *gateways.Registry) *WebhookService {
+	return NewWebhookServiceWith(WebhookServiceDeps{
+		Payments:   repository.NewMongoPaymentRepository(db),
+		Events:     repository.NewMongoPaymentEventRepository(db),
+		Orders:     orderrepository.NewMongoOrderRepository(db),
+		Machine:    statemachine.NewMachine(db),
+		Transactor: database.NewMongoTransactor(db.Client()),
+		Ledger:     ledgerservices.NewLedgerService(db),
+		Refunds:    NewRefundService(db, registry),
+		Invoices:   invoiceservices.NewInvoiceService(db),
+		Gateways:   registry,
+	})
+}
+
+// NewWebhookServiceWith builds the service on deps, e.g. in-memory stores and
+// the simulator in tests
+func NewWebhookServiceWith(deps WebhookServiceDeps) *WebhookService {
+	return &WebhookService{
+		payments: deps.Payments,
+		events:   deps.Events,
+		orders:   deps.Orders,
+		machine:  deps.Machine,
+		tx:       deps.Transactor,
+		ledger:   deps.Ledger,
+		refunds:  deps.Refunds,
+		invoices: deps.Invoices,
+		gateways: deps.Gateways,
+	}
+}
+
+// WebhookSecret returns the shared signing secret for provider, e.g. PAYMENT_WEBHOOK_SECRET_PAYPAL
+func WebhookSecret(provider string) string {
+	return os.Getenv("PAYMENT_WEBHOOK_SECRET_" + strings.ToUpper(provider))
+}
+
+// Handle verifies the signature of a delivery, records it in payment_events
+// and applies it. Deliveries of an event that was already handled are
+// acknowledged without being applied again. A capture that turns out to be a
+// duplicate is refunded once it has been recorded.
+func (s *WebhookService) Handle(provider string, body []byte, header http.Header) (string, error) {
+	gateway, err := s.gateways.Get(provider)
+	if err != nil {
+		return "", ErrWebhookNotConfigured
+	}
+	parser, ok := gateway.(gateways.WebhookParser)
+	secret := WebhookSecret(provider)
+	if !ok || secret == "" {
+		return "", ErrWebhookNotConfigured
+	}
+	if err := gateways.VerifyWebhook(secret, header.Get(gateways.SignatureHeader), body, time.Now()); err != nil {
+		return "", err
+	}
+	event, err := parser.ParseWebhook(body, header)
+	if err != nil {
+		if errors.Is(err, gateways.ErrUnsupportedEvent) {
+			return WebhookIgnored, nil
+		}
+		return "", fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if event.ID == "" || event.TransactionID == "" {
+		return "", fmt.Errorf("%w: missing event or transaction id", ErrInvalidPayload)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	record := models.PaymentEvent{
+		ID:            provider + ":" + event.ID,
+		Provider:      provider,
+		EventID:       event.ID,
+		Type:          event.Type,
+		TransactionID: event.TransactionID,
+		Amount:        event.Amount,
+		Currency:      event.Currency,
+		Status:        models.PaymentEventReceived,
+		Payload:       string(body),
+		OccurredAt:    event.OccurredAt,
+		ReceivedAt:    time.Now(),
+	}
+	inserted, err := s.events.Insert(ctx, &record)
+	if err != nil {
+		return "", err
+	}
+	if !inserted {
+		existing, err := s.events.FindByID(ctx, record.ID)
+		if err != nil {
+			return "", err
+		}
+		if existing.Status != models.PaymentEventReceived {
+			return WebhookDuplicate, nil
+		}
+		// A previous delivery was recorded but failed to apply; try again
+	}
+
+	result, err := s.apply(ctx, provider, record.ID, event)
+	if errors.Is(err, errAlreadyHandled) {
+		return WebhookDuplicate, nil
+	}
+	if err != nil {
+		if _, updErr := s.events.Update(ctx, bson.M{"_id": record.ID}, bson.M{"$set": bson.M{"error": err.Error()}}); updErr != nil {
+			log.Printf("payments: failed to record webhook error for %s: %v", record.ID, updErr)
+		}
+		return "", err
+	}
+	if result == WebhookProcessed && event.Type == gateways.EventCaptured {
+		s.refundDuplicate(ctx, gateway, provider, event.TransactionID)
+	}
+	return result, nil
+}
+
+// apply changes the payment and order and marks the event handled in one
+// transaction. Marking is conditional on the event still being "received", so
+// concurrent deliveries of the same event cannot both apply it.
+func (s *WebhookService) apply(ctx context.Context, provider, recordID string, event *gateways.WebhookEvent) (string, error) {
+	var outcome string
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		payment, err := s.findPayment(ctx, provider, event.TransactionID)
+		if err != nil {
+			return err
+		}
+		outcome = WebhookIgnored
+		var note string
+		if payment != nil {
+			outcome, note, err = s.applyToPayment(ctx, payment, event)
+			if err != nil {
+				return err
+			}
+		} else {
+			note = "no payment matches transaction " + event.TransactionID
+		}
+
+		now := time.Now()
+		set := bson.M{"status": outcome, "processed_at": now, "error": note}
+		if payment != nil {
+			set["payment_id"] = payment.ID
+		}
+		matched, err := s.events.Update(ctx,
+			bson.M{"_id": recordID, "status": models.PaymentEventReceived},
+			bson.M{"$set": set},
+		)
+		if err != nil {
+			return err
+		}
+		if matched == 0 {
+			return errAlreadyHandled
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return outcome, nil
+}
+
+func (s *WebhookService) findPayment(ctx context.Context, provider, transactionID string) (*models.Payment, error) {
+	filter := bson.M{
+		"method": provider,
+		"$or": []bson.M{
+			{"transaction_id": transactionID},
+			{"authorization_id": transactionID},
+		},
+	}
+	payment, err := s.payments.FindLatest(ctx, filter)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return payment, err
+}
+
+// applyToPayment returns WebhookProcessed when something changed, or
+// WebhookIgnored with a note explaining why nothing did
+func (s *WebhookService) applyToPayment(ctx context.Context, payment *models.Payment, event *gateways.WebhookEvent) (string, string, error) {
+	now := time.Now()
+	switch event.Type {
+	case gateways.EventCaptured:
+		if payment.Status != models.PaymentStatusFailed {
+			return WebhookIgnored, "payment already " + payment.Status, nil
+		}
+		if event.Amount != 0 && !sameAmount(event.Amount, payment.Amount, payment.Currency) {
+			log.Printf("payments: webhook captured %.2f for payment %s of %.2f", event.Amount, payment.ID.Hex(), payment.Amount)
+			return WebhookIgnored, ErrAmountMismatch.Error(), nil
+		}
+		order, err := s.orders.FindOne(ctx, bson.M{"_id": payment.OrderID})
+		if err != nil && err != mongo.ErrNoDocuments {
+			return "", "", err
+		}
+		if err == mongo.ErrNoDocuments || order.Status != statemachine.StatusPendingPayment {
+			// Paid by another payment since this one failed, or no longer
+			// payable: keep the capture off the ledger and give it back
+			note := "order not found"
+			if order != nil {
+				note = "order already " + order.Status
+			}
+			if err := s.markDuplicate(ctx, payment, event.TransactionID, note, now); err != nil {
+				return "", "", err
+			}
+			return WebhookProcessed, "", nil
+		}
+		if err := s.setPayment(ctx, payment.ID, payment.Status, bson.M{
+			"status":         models.PaymentStatusCaptured,
+			"transaction_id": event.TransactionID,
+			"failure_reason": "",
+			"updated_at":     now,
+		}, nil, nil); err != nil {
+			return "", "", err
+		}
+		if err := s.ledger.PostCapture(ctx, payment.ID, payment.OrderID, payment.UserID, money.ToMinor(payment.Amount, payment.Currency), money.ToMinor(payment.Tax, payment.Currency), payment.Currency, false); err != nil {
+			return "", "", err
+		}
+		// The synchronous flow gave up on this payment; the order may still be waiting for it
+		if err := s.markOrderPaid(ctx, payment, now); err != nil {
+			return "", "", err
+		}
+		if _, err := s.invoices.Issue(ctx, payment); err != nil {
+			return "", "", err
+		}
+
+	case gateways.EventFailed:
+		if payment.Status != models.PaymentStatusCaptured {
+			return WebhookIgnored, "payment already " + payment.Status, nil
+		}
+		// A capture the provider reported as completed was later denied
+		if err := s.setPayment(ctx, payment.ID, payment.Status, bson.M{
+			"status":         models.PaymentStatusFailed,
+			"failure_reason": "capture denied by provider",
+			"updated_at":     now,
+		}, nil, nil); err != nil {
+			return "", "", err
+		}
+		// The money never arrived: take it off the ledger, cancel the
+		// invoice and stop the order until the client pays again
+		if err := s.ledger.PostCaptureReversal(ctx, payment.ID); err != nil {
+			return "", "", err
+		}
+		if _, err := s.invoices.CreditInvoice(ctx, payment, creditReasonCaptureDenied); err != nil {
+			return "", "", err
+		}
+		if err := s.unpayOrder(ctx, payment.OrderID); err != nil {
+			return "", "", err
+		}
+
+	case gateways.EventRefunded:
+		if payment.Status == models.PaymentStatusDuplicate {
+			// The provider confirms the return of a duplicate capture whose
+			// refund we could not record, e.g. after a timeout
+			refundID, note := s.matchRefund(payment, event)
+			if note == "" && refundID.IsZero() {
+				note = "duplicate payment has no pending refund"
+			}
+			if note != "" {
+				return WebhookIgnored, note, nil
+			}
+			if err := s.settleDuplicate(ctx, payment.ID, refundID, event.RefundID); err != nil {
+				return "", "", err
+			}
+			break
+		}
+		switch payment.Status {
+		case models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded, models.PaymentStatusDisputed:
+		default:
+			return WebhookIgnored, "cannot refund a " + payment.Status + " payment", nil
+		}
+		refundID, note := s.matchRefund(payment, event)
+		if note != "" {
+			return WebhookIgnored, note, nil
+		}
+		if refundID.IsZero() {
+			// Issued outside the refunds API, e.g. from the provider's dashboard.
+			// The ledger never records more than is left to refund.
+			remaining := payment.Amount - payment.RefundedAmount
+			amount := event.Amount
+			if amount == 0 || money.ToMinor(amount, payment.Currency) > money.ToMinor(remaining, payment.Currency) {
+				if amount != 0 {
+					log.Printf("payments: webhook refunded %.2f of payment %s with %.2f left to refund", amount, payment.ID.Hex(), remaining)
+				}
+				amount = remaining
+			}
+			amount = money.Round(amount, payment.Currency)
+			if amount <= 0 {
+				return WebhookIgnored, "payment has nothing left to refund", nil
+			}
+			refund := models.Refund{
+				ID:             primitive.NewObjectID(),
+				IdempotencyKey: "webhook:" + event.ID,
+				Amount:         amount,
+				Reason:         models.RefundReasonProvider,
+				Status:         models.RefundStatusPending,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			if err := s.setPayment(ctx, payment.ID, payment.Status, bson.M{"updated_at": now}, bson.M{"refunded_amount": amount}, bson.M{"refunds": refund}); err != nil {
+				return "", "", err
+			}
+			refundID = refund.ID
+		}
+		if _, err := s.refunds.settleRefund(ctx, payment.ID, refundID, event.RefundID, statemachine.SystemActor(), "payment refunded by provider"); err != nil {
+			return "", "", err
+		}
+
+	case gateways.EventDisputed:
+		if payment.Status != models.PaymentStatusCaptured && payment.Status != models.PaymentStatusPartiallyRefunded {
+			return WebhookIgnored, "cannot dispute a " + payment.Status + " payment", nil
+		}
+		if err := s.setPayment(ctx, payment.ID, payment.Status, bson.M{"status": models.PaymentStatusDisputed, "updated_at": now}, nil, nil); err != nil {
+			return "", "", err
+		}
+		if err := moveOrder(ctx, s.machine, payment.OrderID, statemachine.StatusDisputed, statemachine.SystemActor(), "chargeback opened with provider"); err != nil {
+			return "", "", err
+		}
+	}
+	return WebhookProcessed, "", nil
+}
+
+// setPayment updates a payment only if it is still in the status it was read with
+func (s *WebhookService) setPayment(ctx context.Context, id primitive.ObjectID, from string, set, inc, push bson.M) error {
+	update := bson.M{"$set": set}
+	if len(inc) > 0 {
+		update["$inc"] = inc
+	}
+	if len(push) > 0 {
+		update["$push"] = push
+	}
+	matched, err := s.payments.Update(ctx, bson.M{"_id": id, "status": from}, update)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return errors.New("payment changed while applying webhook")
+	}
+	return nil
+}
+
+// matchRefund finds the ledger entry a refund notification is about. A zero
+// ID with no note means the refund is new to us.
+func (s *WebhookService) matchRefund(payment *models.Payment, event *gateways.WebhookEvent) (primitive.ObjectID, string) {
+	for _, r := range payment.Refunds {
+		if event.RefundID != "" && r.ProviderRefundID == event.RefundID {
+			return primitive.NilObjectID, "refund already recorded"
+		}
+	}
+	// A refund made through the API whose confirmation was lost, e.g. to a timeout
+	for _, r := range payment.Refunds {
+		if r.Status == models.RefundStatusPending && (event.Amount == 0 || sameAmount(r.Amount, event.Amount, payment.Currency)) {
+			return r.ID, ""
+		}
+	}
+	return primitive.NilObjectID, ""
+}
+
+// markOrderPaid moves the order of a late captured payment to paid. The order
+// was read waiting for payment, so an order paid meanwhile fails the
+// transaction; the redelivery then finds it paid and refunds this capture.
+func (s *WebhookService) markOrderPaid(ctx context.Context, payment *models.Payment, paidAt time.Time) error {
+	_, err := s.machine.Apply(ctx, statemachine.Change{
+		OrderID: payment.OrderID,
+		To:      statemachine.StatusPaid,
+		Actor:   statemachine.SystemActor(),
+		Reason:  "payment captured (provider notification)",
+		Set:     bson.M{"paid_at": paidAt, "payment_id": payment.ID},
+	})
+	return err
+}
+
+// unpayOrder takes the order of a denied capture back to pending_payment, or
+// puts it on hold once a writer is involved so work stops until the client
+// pays again. An order that can do neither fails the transaction rather than
+// carrying on as if it were paid.
+func (s *WebhookService) unpayOrder(ctx context.Context, orderID primitive.ObjectID) error {
+	order, err := s.orders.FindOne(ctx, bson.M{"_id": orderID})
+	if err == mongo.ErrNoDocuments {
+		log.Printf("payments: order %s of denied capture not found", orderID.Hex())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	to := statemachine.StatusPendingPayment
+	if order.Status != statemachine.StatusPaid {
+		to = statemachine.StatusOnHold
+		log.Printf("payments: capture of order %s denied while %s, putting it on hold", orderID.Hex(), order.Status)
+	}
+	_, err = s.machine.Apply(ctx, statemachine.Change{
+		OrderID: orderID,
+		To:      to,
+		Actor:   statemachine.SystemActor(),
+		Reason:  "payment capture denied by provider",
+	})
+	return err
+}
+
+// markDuplicate records a late capture of an order that no longer waits for
+// payment, with a pending refund of all of it for refundDuplicate to send
+func (s *WebhookService) markDuplicate(ctx context.Context, payment *models.Payment, transactionID, note string, now time.Time) error {
+	refund := models.Refund{
+		ID:             primitive.NewObjectID(),
+		IdempotencyKey: "duplicate:" + payment.ID.Hex(),
+		Amount:         payment.Amount,
+		Reason:         models.RefundReasonDuplicatePayment,
+		Note:           note,
+		Status:         models.RefundStatusPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	return s.setPayment(ctx, payment.ID, payment.Status, bson.M{
+		"status":         models.PaymentStatusDuplicate,
+		"transaction_id": transactionID,
+		"failure_reason": "",
+		"updated_at":     now,
+	}, bson.M{"refunded_amount": payment.Amount}, bson.M{"refunds": refund})
+}
+
+// refundDuplicate sends the refunds markDuplicate recorded for the payment of
+// transactionID. A refund the provider refuses stays pending on the payment
+// for an admin to review.
+func (s *WebhookService) refundDuplicate(ctx context.Context, gateway gateways.PaymentGateway, provider, transactionID string) {
+	payment, err := s.findPayment(ctx, provider, transactionID)
+	if err != nil {
+		log.Printf("payments: failed to load payment of transaction %s: %v", transactionID, err)
+		return
+	}
+	if payment == nil || payment.Status != models.PaymentStatusDuplicate {
+		return
+	}
+	for _, r := range payment.Refunds {
+		if r.Status != models.RefundStatusPending || r.Reason != models.RefundReasonDuplicatePayment {
+			continue
+		}
+		result, err := gateway.Refund(ctx, payment.TransactionID, r.Amount, payment.Currency)
+		if err != nil {
+			log.Printf("payments: duplicate payment %s of order %s needs review, refund failed: %v", payment.ID.Hex(), payment.OrderID.Hex(), err)
+			continue
+		}
+		// A refund notification may have settled it first
+		if err := s.settleDuplicate(ctx, payment.ID, r.ID, result.TransactionID); err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("payments: failed to record refund %s of duplicate payment %s: %v", result.TransactionID, payment.ID.Hex(), err)
+		}
+	}
+}
+
+// settleDuplicate marks the refund of a duplicate capture as confirmed.
+// Nothing was posted to the ledger or invoiced for the capture, so nothing is
+// reversed either.
+func (s *WebhookService) settleDuplicate(ctx context.Context, paymentID, refundID primitive.ObjectID, providerRefundID string) error {
+	now := time.Now()
+	set := bson.M{"status": models.RefundStatusSucceeded, "updated_at": now}
+	if providerRefundID != "" {
+		set["provider_refund_id"] = providerRefundID
+	}
+	_, err := s.payments.UpdateRefund(ctx, repository.RefundChange{
+		PaymentID:  paymentID,
+		RefundID:   refundID,
+		From:       models.RefundStatusPending,
+		Set:        set,
+		PaymentSet: bson.M{"updated_at": now},
+	})
+	return err
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	invoicemodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/models"
+	ledgermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/statemachine"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const webhookSecret = "whsec_test"
+
+// webhook builds the simulator's notification about a transaction
+func (s *shop) webhook(eventID, eventType, transactionID string, amount float64) []byte {
+	s.t.Helper()
+	body, err := s.sim.WebhookFor(eventID, eventType, transactionID, amount)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return body
+}
+
+// deliver signs body the way the simulator does and hands it to the webhook service
+func (s *shop) deliver(body []byte) (string, error) {
+	s.t.Helper()
+	req, err := gateways.NewSignedWebhookRequest("/webhooks/payments/simulator", webhookSecret, body, time.Now())
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return s.webhooks.Handle("simulator", body, req.Header)
+}
+
+// lateCapture stores a payment we recorded as failed although the provider
+// captured it, like a capture that timed out on our side
+func (s *shop) lateCapture(orderID primitive.ObjectID, amount float64) *models.Payment {
+	s.t.Helper()
+	ctx := context.Background()
+	auth, err := s.sim.Authorize(ctx, gateways.AuthorizeRequest{Reference: orderID.Hex(), Amount: amount, Currency: "USD", Info: card(approvedCard)})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if _, err := s.sim.Capture(ctx, auth.TransactionID, amount, "USD"); err != nil {
+		s.t.Fatal(err)
+	}
+	now := time.Now()
+	payment := &models.Payment{
+		ID:              primitive.NewObjectID(),
+		OrderID:         orderID,
+		UserID:          s.client,
+		Method:          "simulator",
+		Status:          models.PaymentStatusFailed,
+		Amount:          amount,
+		Currency:        "USD",
+		AuthorizationID: auth.TransactionID,
+		FailureReason:   gateways.ErrTimeout.Error(),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.payments.Insert(ctx, payment); err != nil {
+		s.t.Fatal(err)
+	}
+	return payment
+}
+
+func (s *shop) payment(id primitive.ObjectID) *models.Payment {
+	s.t.Helper()
+	payment, err := s.payments.FindByID(context.Background(), id)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return payment
+}
+
+func TestWebhookRejectsUnsignedDeliveries(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+	body := s.webhook("evt_1", gateways.EventRefunded, payment.TransactionID, 10)
+
+	for _, tc := range []struct {
+		name   string
+		header string
+	}{
+		{"no signature", ""},
+		{"wrong secret", gateways.SignWebhook("whsec_other", time.Now(), body)},
+		{"other body", gateways.SignWebhook(webhookSecret, time.Now(), []byte(`{"id":"evt_1"}`))},
+		{"stale timestamp", gateways.SignWebhook(webhookSecret, time.Now().Add(-gateways.SignatureTolerance-time.Minute), body)},
+	} {
+		header := http.Header{}
+		header.Set(gateways.SignatureHeader, tc.header)
+		if _, err := s.webhooks.Handle("simulator", body, header); !errors.Is(err, gateways.ErrInvalidSignature) {
+			t.Errorf("%s: Handle = %v, want ErrInvalidSignature", tc.name, err)
+		}
+	}
+	if _, err := s.events.FindByID(context.Background(), "simulator:evt_1"); err != mongo.ErrNoDocuments {
+		t.Errorf("rejected delivery was recorded: %v", err)
+	}
+	if got := s.payment(payment.ID); got.RefundedAmount != 0 {
+		t.Errorf("rejected delivery refunded %v", got.RefundedAmount)
+	}
+
+	t.Setenv("PAYMENT_WEBHOOK_SECRET_SIMULATOR", "")
+	if _, err := s.deliver(body); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Errorf("delivery without a secret = %v, want ErrWebhookNotConfigured", err)
+	}
+}
+
+func TestWebhookIsAppliedOnce(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+	body := s.webhook("evt_1", gateways.EventRefunded, payment.TransactionID, 10)
+
+	if result, err := s.deliver(body); err != nil || result != WebhookProcessed {
+		t.Fatalf("first delivery = %q, %v; want processed", result, err)
+	}
+	if result, err := s.deliver(body); err != nil || result != WebhookDuplicate {
+		t.Errorf("redelivery = %q, %v; want duplicate", result, err)
+	}
+	if got := s.payment(payment.ID); got.RefundedAmount != 10 || len(got.Refunds) != 1 {
+		t.Errorf("payment has %v refunded in %d refunds, want 10 in 1", got.RefundedAmount, len(got.Refunds))
+	}
+	event, err := s.events.FindByID(context.Background(), "simulator:evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Status != models.PaymentEventProcessed || event.PaymentID == nil || *event.PaymentID != payment.ID || event.ProcessedAt == nil {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Deduplication is by event ID: another event about the same refund is applied
+	if result, err := s.deliver(s.webhook("evt_2", gateways.EventRefunded, payment.TransactionID, 10)); err != nil || result != WebhookProcessed {
+		t.Errorf("second event = %q, %v; want processed", result, err)
+	}
+	if got := s.payment(payment.ID); got.RefundedAmount != 20 {
+		t.Errorf("payment has %v refunded, want 20", got.RefundedAmount)
+	}
+}
+
+func TestWebhookIgnoresUnknownTransactions(t *testing.T) {
+	s := newShop(t)
+	auth, err := s.sim.Authorize(context.Background(), gateways.AuthorizeRequest{Amount: 10, Currency: "USD", Info: card(approvedCard)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventCaptured, auth.TransactionID, 10)); err != nil || result != WebhookIgnored {
+		t.Errorf("Handle = %q, %v; want ignored", result, err)
+	}
+	if event, err := s.events.FindByID(context.Background(), "simulator:evt_1"); err != nil || event.Status != models.PaymentEventIgnored || event.Error == "" {
+		t.Errorf("event = %+v, %v; want ignored with a note", event, err)
+	}
+}
+
+func TestWebhookCapturedCompletesFailedPayment(t *testing.T) {
+	s := newShop(t)
+	orderID := s.order(42.5)
+	payment := s.lateCapture(orderID, 42.5)
+
+	// A capture of another amount is not taken as payment of the order
+	if result, err := s.deliver(s.webhook("evt_0", gateways.EventCaptured, payment.AuthorizationID, 40)); err != nil || result != WebhookIgnored {
+		t.Errorf("capture of 40 = %q, %v; want ignored", result, err)
+	}
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventCaptured, payment.AuthorizationID, 42.5)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	if got := s.payment(payment.ID); got.Status != models.PaymentStatusCaptured || got.TransactionID != payment.AuthorizationID || got.FailureReason != "" {
+		t.Errorf("payment = %+v", got)
+	}
+	if got := s.orderStatus(orderID); got != statemachine.StatusPaid {
+		t.Errorf("order is %s, want paid", got)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 4250 {
+		t.Errorf("cash = %d, want 4250", cash)
+	}
+	if invoice, err := s.invoices.ForOrder(orderID); err != nil || invoice.PaymentID != payment.ID {
+		t.Errorf("invoice = %+v, %v; want one for the payment", invoice, err)
+	}
+}
+
+func TestWebhookCapturedRefundsDuplicatePayment(t *testing.T) {
+	s := newShop(t)
+	orderID := s.order(42.5)
+	late := s.lateCapture(orderID, 42.5)
+	// The client paid again before the provider confirmed the first capture
+	paid, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(approvedCard))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventCaptured, late.AuthorizationID, 42.5)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	got := s.payment(late.ID)
+	if got.Status != models.PaymentStatusDuplicate || got.RefundedAmount != 42.5 || len(got.Refunds) != 1 {
+		t.Fatalf("late payment = %+v", got)
+	}
+	if r := got.Refunds[0]; r.Status != models.RefundStatusSucceeded || r.Reason != models.RefundReasonDuplicatePayment || r.ProviderRefundID == "" {
+		t.Errorf("refund = %+v", r)
+	}
+	if status := s.gatewayStatus(late.AuthorizationID); status != gateways.StatusRefunded {
+		t.Errorf("late capture is %s at the provider, want refunded", status)
+	}
+	// Only the payment that paid the order is on the ledger and invoiced
+	if cash := s.balance(ledgermodels.AccountCash); cash != 4250 {
+		t.Errorf("cash = %d, want 4250", cash)
+	}
+	if n := s.store.Count("invoices", bson.M{"order_id": orderID}); n != 1 {
+		t.Errorf("order has %d invoices, want 1", n)
+	}
+	if invoice, err := s.invoices.ForOrder(orderID); err != nil || invoice.PaymentID != paid.ID {
+		t.Errorf("invoice = %+v, %v; want the one of the first payment", invoice, err)
+	}
+	if status := s.orderStatus(orderID); status != statemachine.StatusPaid {
+		t.Errorf("order is %s, want paid", status)
+	}
+
+	// The provider's confirmation of our refund changes nothing
+	body := s.webhook("evt_2", gateways.EventRefunded, late.AuthorizationID, 42.5)
+	if result, err := s.deliver(body); err != nil || result != WebhookIgnored {
+		t.Errorf("refund notification = %q, %v; want ignored", result, err)
+	}
+	report, err := s.ledger.TrialBalance()
+	if err != nil || !report.Balanced {
+		t.Errorf("trial balance = %+v, %v", report, err)
+	}
+}
+
+func TestWebhookDuplicateRefundRejectedIsKeptForReview(t *testing.T) {
+	s := newShop(t)
+	orderID := s.order(42.5)
+	late := s.lateCapture(orderID, 42.5)
+	if _, err := s.pay.PayForOrder(orderID, s.client, "simulator", card(approvedCard)); err != nil {
+		t.Fatal(err)
+	}
+	s.registry.Register(failingRefund{s.sim})
+
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventCaptured, late.AuthorizationID, 42.5)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	got := s.payment(late.ID)
+	if got.Status != models.PaymentStatusDuplicate || len(got.Refunds) != 1 || got.Refunds[0].Status != models.RefundStatusPending {
+		t.Fatalf("late payment = %+v, want duplicate with a pending refund", got)
+	}
+
+	// Refunded from the provider's dashboard instead
+	s.registry.Register(s.sim)
+	if _, err := s.sim.Refund(context.Background(), late.AuthorizationID, 42.5, "USD"); err != nil {
+		t.Fatal(err)
+	}
+	body := s.webhook("evt_2", gateways.EventRefunded, late.AuthorizationID, 42.5)
+	if outcome, err := s.deliver(body); err != nil || outcome != WebhookProcessed {
+		t.Fatalf("refund notification = %q, %v; want processed", outcome, err)
+	}
+	got = s.payment(late.ID)
+	if got.Status != models.PaymentStatusDuplicate || got.Refunds[0].Status != models.RefundStatusSucceeded {
+		t.Errorf("late payment = %+v, want duplicate with a settled refund", got)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 4250 {
+		t.Errorf("cash = %d, want 4250", cash)
+	}
+	if status := s.orderStatus(orderID); status != statemachine.StatusPaid {
+		t.Errorf("order is %s, want paid", status)
+	}
+}
+
+func TestWebhookFailedReversesCapture(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+	invoice, err := s.invoices.ForOrder(payment.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventFailed, payment.TransactionID, 42.5)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	if got := s.payment(payment.ID); got.Status != models.PaymentStatusFailed || got.FailureReason == "" {
+		t.Errorf("payment = %+v", got)
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusPendingPayment {
+		t.Errorf("order is %s, want pending_payment", status)
+	}
+	// The capture is off the ledger and its invoice is credited in full
+	if cash := s.balance(ledgermodels.AccountCash); cash != 0 {
+		t.Errorf("cash = %d, want 0", cash)
+	}
+	if client := s.balance(ledgermodels.ClientAccount(s.client.Hex())); client != 0 {
+		t.Errorf("client account = %d, want 0", client)
+	}
+	report, err := s.ledger.TrialBalance()
+	if err != nil || !report.Balanced {
+		t.Errorf("trial balance = %+v, %v", report, err)
+	}
+	var notes []invoicemodels.Invoice
+	if err := s.store.Find("invoices", bson.M{"kind": invoicemodels.KindCreditNote}, database.FindOptions{}, &notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || *notes[0].InvoiceID != invoice.ID || notes[0].Total != invoice.Total || notes[0].Reason != creditReasonCaptureDenied {
+		t.Errorf("credit notes = %+v, want one of %v against %s", notes, invoice.Total, invoice.Number)
+	}
+
+	// A failed payment cannot fail again
+	if result, err := s.deliver(s.webhook("evt_2", gateways.EventFailed, payment.TransactionID, 42.5)); err != nil || result != WebhookIgnored {
+		t.Errorf("second failure = %q, %v; want ignored", result, err)
+	}
+	// Paying again gives the order a new invoice
+	again, err := s.pay.PayForOrder(payment.OrderID, s.client, "simulator", card(approvedCard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newest, err := s.invoices.ForOrder(payment.OrderID); err != nil || newest.PaymentID != again.ID || newest.Number == invoice.Number {
+		t.Errorf("invoice after paying again = %+v, %v", newest, err)
+	}
+}
+
+func TestWebhookFailedPutsOrderInProgressOnHold(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+	ctx := context.Background()
+	writer := statemachine.UserActor(primitive.NewObjectID(), []string{statemachine.RoleWriter})
+	for _, ch := range []statemachine.Change{
+		{OrderID: payment.OrderID, To: statemachine.StatusAwaitingAcceptance, Actor: admin},
+		{OrderID: payment.OrderID, To: statemachine.StatusAssigned, Actor: writer},
+	} {
+		if _, err := s.machine.Apply(ctx, ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventFailed, payment.TransactionID, 42.5)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusOnHold {
+		t.Errorf("order is %s, want on_hold", status)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 0 {
+		t.Errorf("cash = %d, want 0", cash)
+	}
+	// The client can pay for the order on hold
+	if _, err := s.pay.PayForOrder(payment.OrderID, s.client, "simulator", card(approvedCard)); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusPaid {
+		t.Errorf("order is %s after paying again, want paid", status)
+	}
+}
+
+func TestWebhookRefunded(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventRefunded, payment.TransactionID, 12.5)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	got := s.payment(payment.ID)
+	if got.Status != models.PaymentStatusPartiallyRefunded || got.RefundedAmount != 12.5 || len(got.Refunds) != 1 {
+		t.Fatalf("payment is %s with %v refunded, want partially_refunded with 12.5", got.Status, got.RefundedAmount)
+	}
+	if r := got.Refunds[0]; r.Status != models.RefundStatusSucceeded || r.Reason != models.RefundReasonProvider {
+		t.Errorf("refund = %+v", r)
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusPartiallyRefunded {
+		t.Errorf("order is %s, want partially_refunded", status)
+	}
+
+	// The provider's amount is capped at what is left to refund
+	if result, err := s.deliver(s.webhook("evt_2", gateways.EventRefunded, payment.TransactionID, 100)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	got = s.payment(payment.ID)
+	if got.Status != models.PaymentStatusRefunded || got.RefundedAmount != 42.5 || got.Refunds[1].Amount != 30 {
+		t.Errorf("payment is %s with %v refunded, want refunded with 42.5", got.Status, got.RefundedAmount)
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusRefunded {
+		t.Errorf("order is %s, want refunded", status)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 0 {
+		t.Errorf("cash = %d, want 0", cash)
+	}
+	report, err := s.ledger.TrialBalance()
+	if err != nil || !report.Balanced {
+		t.Errorf("trial balance = %+v, %v", report, err)
+	}
+}
+
+func TestWebhookRefundedSettlesPendingRefund(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+	ctx := context.Background()
+	// A refund reserved through the API whose confirmation from the provider was lost
+	now := time.Now()
+	refund := models.Refund{
+		ID:             primitive.NewObjectID(),
+		IdempotencyKey: "lost",
+		Amount:         10,
+		Reason:         models.RefundReasonQualityIssue,
+		Status:         models.RefundStatusPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if _, err := s.payments.Update(ctx, bson.M{"_id": payment.ID}, bson.M{"$push": bson.M{"refunds": refund}, "$inc": bson.M{"refunded_amount": 10.0}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.sim.Refund(ctx, payment.TransactionID, 10, "USD"); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventRefunded, payment.TransactionID, 10)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	got := s.payment(payment.ID)
+	if len(got.Refunds) != 1 || got.Refunds[0].ID != refund.ID || got.Refunds[0].Status != models.RefundStatusSucceeded || got.RefundedAmount != 10 {
+		t.Errorf("payment = %+v, want the pending refund settled", got)
+	}
+	if cash := s.balance(ledgermodels.AccountCash); cash != 3250 {
+		t.Errorf("cash = %d, want 3250", cash)
+	}
+}
+
+func TestWebhookDisputed(t *testing.T) {
+	s := newShop(t)
+	payment := s.paid(42.5)
+
+	if result, err := s.deliver(s.webhook("evt_1", gateways.EventDisputed, payment.TransactionID, 42.5)); err != nil || result != WebhookProcessed {
+		t.Fatalf("Handle = %q, %v; want processed", result, err)
+	}
+	if got := s.payment(payment.ID); got.Status != models.PaymentStatusDisputed {
+		t.Errorf("payment is %s, want disputed", got.Status)
+	}
+	if status := s.orderStatus(payment.OrderID); status != statemachine.StatusDisputed {
+		t.Errorf("order is %s, want disputed", status)
+	}
+	if result, err := s.deliver(s.webhook("evt_2", gateways.EventDisputed, payment.TransactionID, 42.5)); err != nil || result != WebhookIgnored {
+		t.Errorf("second dispute = %q, %v; want ignored", result, err)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CommissionRateHandler struct {
+	service *services.CommissionService
+}
+
+func NewCommissionRateHandler(service *services.CommissionService) *CommissionRateHandler {
+	return &CommissionRateHandler{service: service}
+}
+
+func (h *CommissionRateHandler) Create(c *gin.Context) {
+	var rate models.CommissionRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.Create(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rate)
+}
+
+func (h *CommissionRateHandler) List(c *gin.Context) {
+	rates, err := h.service.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+func (h *CommissionRateHandler) GetByID(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	rate, err := h.service.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commission rate not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+func (h *CommissionRateHandler) Update(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var req struct {
+		WriterShareBps *int64 `json:"writer_share_bps" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.Update(id, *req.WriterShareBps); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Commission rate updated"})
+}
+
+func (h *CommissionRateHandler) Delete(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.service.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete commission rate"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Commission rate deleted"})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EarningsHandler struct {
+	service *services.EarningService
+}
+
+func NewEarningsHandler(service *services.EarningService) *EarningsHandler {
+	return &EarningsHandler{service: service}
+}
+
+// MyEarnings is the logged in writer's earnings statement: totals per
+// currency and the earnings themselves, newest first (?status=accrued|paid)
+func (h *EarningsHandler) MyEarnings(c *gin.Context) {
+	writerID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	page := 1
+	pageSize := 10
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	summary, err := h.service.Summary(writerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load earnings"})
+		return
+	}
+	earnings, total, err := h.service.ListForWriter(writerID, c.Query("status"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load earnings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"summary":   summary,
+		"earnings":  earnings,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	return principal.UserID, true
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	currencyservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreatePayoutBatchRequest represents the expected payload for a payout batch
+// reference: unique per batch, e.g. "2024-06-week-1"; repeating it returns the existing batch
+// writer_ids: optional, pay only these writers
+
+type CreatePayoutBatchRequest struct {
+	Reference string   `json:"reference" binding:"required"`
+	WriterIDs []string `json:"writer_ids"`
+}
+
+type PayoutBatchHandler struct {
+	service *services.PayoutService
+}
+
+func NewPayoutBatchHandler(service *services.PayoutService) *PayoutBatchHandler {
+	return &PayoutBatchHandler{service: service}
+}
+
+// Create pays out accrued earnings in a new batch (admin)
+func (h *PayoutBatchHandler) Create(c *gin.Context) {
+	var req CreatePayoutBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	writerIDs := make([]primitive.ObjectID, 0, len(req.WriterIDs))
+	for _, id := range req.WriterIDs {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid writer ID format"})
+			return
+		}
+		writerIDs = append(writerIDs, oid)
+	}
+	var createdBy *primitive.ObjectID
+	if adminID, ok := userIDFromContext(c); ok {
+		createdBy = &adminID
+	}
+
+	batch, created, err := h.service.CreateBatch(req.Reference, writerIDs, createdBy)
+	if err != nil {
+		if errors.Is(err, services.ErrNothingToPay) || errors.Is(err, currencyservices.ErrNoExchangeRate) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payout batch"})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, batch)
+		return
+	}
+	c.JSON(http.StatusCreated, batch)
+}
+
+func (h *PayoutBatchHandler) List(c *gin.Context) {
+	page := 1
+	pageSize := 10
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+	batches, total, err := h.service.List(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payout batches"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"batches":   batches,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *PayoutBatchHandler) GetByID(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	batch, err := h.service.GetByID(id)
+	if err != nil {
+		respondPayoutError(c, err, "Failed to load payout batch")
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// Reverse undoes a batch whose transfers failed; its earnings can be paid again in a new batch
+func (h *PayoutBatchHandler) Reverse(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var reversedBy *primitive.ObjectID
+	if adminID, ok := userIDFromContext(c); ok {
+		reversedBy = &adminID
+	}
+	batch, err := h.service.Reverse(id, req.Reason, reversedBy)
+	if err != nil {
+		respondPayoutError(c, err, "Failed to reverse payout batch")
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// ExportCSV downloads the batch as a bank transfer file
+func (h *PayoutBatchHandler) ExportCSV(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	batch, err := h.service.GetByID(id)
+	if err != nil {
+		respondPayoutError(c, err, "Failed to load payout batch")
+		return
+	}
+	var buf bytes.Buffer
+	if err := h.service.WriteCSV(&buf, batch); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export payout batch"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="payout-%s.csv"`, batch.ID.Hex()))
+	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+}
+
+func respondPayoutError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrPayoutBatchNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout batch not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Commission rate scopes, from most to least specific. The most specific rate
+// that matches an approved order decides the writer's share.
+const (
+	ScopeWriter     = "writer"
+	ScopeTier       = "tier"
+	ScopeOrderLevel = "order_level"
+	ScopeDefault    = "default"
+)
+
+// DefaultWriterShareBps applies when no commission rate matches
+const DefaultWriterShareBps = 7000
+
+// CommissionRate is the share of an order's price a writer earns (commission_rates collection)
+// e.g., {"scope": "tier", "tier": "gold", "writer_share_bps": 7500}
+type CommissionRate struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Scope          string              `bson:"scope" json:"scope" binding:"required"`
+	WriterID       *primitive.ObjectID `bson:"writer_id,omitempty" json:"writer_id,omitempty"`           // scope writer
+	Tier           string              `bson:"tier,omitempty" json:"tier,omitempty"`                     // scope tier, matches User.Tier
+	OrderLevelID   *primitive.ObjectID `bson:"order_level_id,omitempty" json:"order_level_id,omitempty"` // scope order_level
+	WriterShareBps int64               `bson:"writer_share_bps" json:"writer_share_bps"`                 // basis points, 7000 = 70%
+	UpdatedAt      time.Time           `bson:"updated_at" json:"updated_at"`
+}
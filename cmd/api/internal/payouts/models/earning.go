@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Earning statuses
+const (
+	EarningStatusAccrued = "accrued" // owed to the writer, not in a payout batch yet
+	EarningStatusPaid    = "paid"
+)
+
+// Earning is what a writer earned for one approved order (earnings collection).
+// Amounts are in minor units.
+// e.g., {"writer_id": ObjectId, "order_id": ObjectId, "amount": 2975, "currency": "USD", "status": "accrued"}
+type Earning struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	WriterID       primitive.ObjectID  `bson:"writer_id" json:"writer_id"`
+	OrderID        primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	Amount         int64               `bson:"amount" json:"amount"`
+	Currency       string              `bson:"currency" json:"currency"`
+	WriterShareBps int64               `bson:"writer_share_bps" json:"writer_share_bps"`
+	Status         string              `bson:"status" json:"status"`
+	PayoutBatchID  *primitive.ObjectID `bson:"payout_batch_id,omitempty" json:"payout_batch_id,omitempty"`
+	AccruedAt      time.Time           `bson:"accrued_at" json:"accrued_at"`
+	PaidAt         *time.Time          `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+}
+
+// EarningsSummary totals a writer's earnings per currency
+type EarningsSummary struct {
+	Currency string `json:"currency"`
+	Accrued  int64  `json:"accrued"`
+	Paid     int64  `json:"paid"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	currencymodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payout batch statuses
+const (
+	PayoutBatchStatusPaid     = "paid"
+	PayoutBatchStatusReversed = "reversed"
+)
+
+// PayoutBatch pays out every accrued earning at once (payout_batches collection).
+// Reference is the admin supplied idempotency key; creating a batch with a
+// reference that exists returns the existing batch.
+// e.g., {"reference": "2024-06-week-1", "status": "paid", "items": [{"writer_id": ObjectId, "amount": 12000, "currency": "USD"}]}
+type PayoutBatch struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Reference      string              `bson:"reference" json:"reference"`
+	Status         string              `bson:"status" json:"status"`
+	Items          []PayoutItem        `bson:"items" json:"items"`
+	CreatedBy      *primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+	ReversedBy     *primitive.ObjectID `bson:"reversed_by,omitempty" json:"reversed_by,omitempty"`
+	ReversedAt     *time.Time          `bson:"reversed_at,omitempty" json:"reversed_at,omitempty"`
+	ReversalReason string              `bson:"reversal_reason,omitempty" json:"reversal_reason,omitempty"`
+}
+
+// PayoutItem is the transfer to one writer of their earnings in one currency.
+// Amount is what they earned; PayoutAmount is what is sent, converted to the
+// writer's payout currency at the rate of the day the batch was created.
+// e.g., {"amount": 12000, "currency": "USD", "payout_amount": 11040, "payout_currency": "EUR", "conversion": {"rate": 0.92}}
+type PayoutItem struct {
+	WriterID       primitive.ObjectID         `bson:"writer_id" json:"writer_id"`
+	Amount         int64                      `bson:"amount" json:"amount"`
+	Currency       string                     `bson:"currency" json:"currency"`
+	PayoutAmount   int64                      `bson:"payout_amount" json:"payout_amount"`
+	PayoutCurrency string                     `bson:"payout_currency" json:"payout_currency"`
+	Conversion     *currencymodels.Conversion `bson:"conversion,omitempty" json:"conversion,omitempty"`
+	EarningIDs     []primitive.ObjectID       `bson:"earning_ids" json:"earning_ids"`
+}
+
+// Payout is what the item sends; batches created before payout currencies
+// send what was earned
+func (item PayoutItem) Payout() (int64, string) {
+	if item.PayoutCurrency == "" {
+		return item.Amount, item.Currency
+	}
+	return item.PayoutAmount, item.PayoutCurrency
+}
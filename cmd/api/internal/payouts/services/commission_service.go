@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CommissionService struct {
+	col *mongo.Collection
+}
+
+func NewCommissionService(db *mongo.Database) *CommissionService {
+	return &CommissionService{col: db.Collection("commission_rates")}
+}
+
+// ValidateCommissionRate checks the rate names exactly the target its scope needs
+func ValidateCommissionRate(rate *models.CommissionRate) error {
+	switch rate.Scope {
+	case models.ScopeWriter:
+		if rate.WriterID == nil || rate.WriterID.IsZero() {
+			return errors.New("writer_id is required for writer rates")
+		}
+		rate.Tier, rate.OrderLevelID = "", nil
+	case models.ScopeTier:
+		if rate.Tier == "" {
+			return errors.New("tier is required for tier rates")
+		}
+		rate.WriterID, rate.OrderLevelID = nil, nil
+	case models.ScopeOrderLevel:
+		if rate.OrderLevelID == nil || rate.OrderLevelID.IsZero() {
+			return errors.New("order_level_id is required for order_level rates")
+		}
+		rate.WriterID, rate.Tier = nil, ""
+	case models.ScopeDefault:
+		rate.WriterID, rate.Tier, rate.OrderLevelID = nil, "", nil
+	default:
+		return errors.New("scope must be one of writer, tier, order_level, default")
+	}
+	return validateShare(rate.WriterShareBps)
+}
+
+func validateShare(bps int64) error {
+	if bps < 0 || bps > 10000 {
+		return errors.New("writer_share_bps must be between 0 and 10000")
+	}
+	return nil
+}
+
+func (s *CommissionService) Create(rate *models.CommissionRate) error {
+	if err := ValidateCommissionRate(rate); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.col.FindOne(ctx, commissionKey(rate)).Err() == nil {
+		return errors.New("a commission rate already exists for this " + rate.Scope)
+	}
+	rate.ID = primitive.NewObjectID()
+	rate.UpdatedAt = time.Now()
+	_, err := s.col.InsertOne(ctx, rate)
+	return err
+}
+
+func (s *CommissionService) List() ([]models.CommissionRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cur, err := s.col.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	rates := []models.CommissionRate{}
+	if err := cur.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (s *CommissionService) GetByID(id primitive.ObjectID) (*models.CommissionRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var rate models.CommissionRate
+	err := s.col.FindOne(ctx, bson.M{"_id": id}).Decode(&rate)
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// Update only allows the share to change; the rate's scope and target are fixed
+func (s *CommissionService) Update(id primitive.ObjectID, writerShareBps int64) error {
+	if err := validateShare(writerShareBps); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"writer_share_bps": writerShareBps, "updated_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *CommissionService) Delete(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// Resolve returns the writer's share for an order: a rate for the writer wins
+// over one for their tier, then the order's level, then the default rate.
+func (s *CommissionService) Resolve(ctx context.Context, writerID primitive.ObjectID, tier string, orderLevelID primitive.ObjectID) (int64, error) {
+	or := []bson.M{
+		{"scope": models.ScopeWriter, "writer_id": writerID},
+		{"scope": models.ScopeOrderLevel, "order_level_id": orderLevelID},
+		{"scope": models.ScopeDefault},
+	}
+	if tier != "" {
+		or = append(or, bson.M{"scope": models.ScopeTier, "tier": tier})
+	}
+	cur, err := s.col.Find(ctx, bson.M{"$or": or})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	var rates []models.CommissionRate
+	if err := cur.All(ctx, &rates); err != nil {
+		return 0, err
+	}
+	for _, scope := range []string{models.ScopeWriter, models.ScopeTier, models.ScopeOrderLevel, models.ScopeDefault} {
+		for _, rate := range rates {
+			if rate.Scope == scope {
+				return rate.WriterShareBps, nil
+			}
+		}
+	}
+	return models.DefaultWriterShareBps, nil
+}
+
+func commissionKey(rate *models.CommissionRate) bson.M {
+	switch rate.Scope {
+	case models.ScopeWriter:
+		return bson.M{"scope": rate.Scope, "writer_id": rate.WriterID}
+	case models.ScopeTier:
+		return bson.M{"scope": rate.Scope, "tier": rate.Tier}
+	case models.ScopeOrderLevel:
+		return bson.M{"scope": rate.Scope, "order_level_id": rate.OrderLevelID}
+	}
+	return bson.M{"scope": rate.Scope}
+}
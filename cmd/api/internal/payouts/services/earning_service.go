@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Accrual identifies an approved order whose writer is to be credited
+type Accrual struct {
+	OrderID      primitive.ObjectID
+	ClientID     primitive.ObjectID
+	WriterID     primitive.ObjectID
+	OrderLevelID primitive.ObjectID
+}
+
+// EarningService credits writers for approved orders
+type EarningService struct {
+	earnings    *mongo.Collection
+	users       *mongo.Collection
+	commissions *CommissionService
+	ledger      *ledgerservices.LedgerService
+}
+
+func NewEarningService(db *mongo.Database) *EarningService {
+	return &EarningService{
+		earnings:    db.Collection("earnings"),
+		users:       db.Collection("users"),
+		commissions: NewCommissionService(db),
+		ledger:      ledgerservices.NewLedgerService(db),
+	}
+}
+
+// Accrue resolves the writer's commission rate, posts the approval to the
+// ledger and records the earning. Accruing the same order again returns the
+// existing earning. Run it in the approval's transaction.
+func (s *EarningService) Accrue(ctx context.Context, a Accrual) (*models.Earning, error) {
+	var existing models.Earning
+	err := s.earnings.FindOne(ctx, bson.M{"order_id": a.OrderID}).Decode(&existing)
+	if err == nil {
+		return &existing, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	var writer struct {
+		Tier string `bson:"tier"`
+	}
+	if err := s.users.FindOne(ctx, bson.M{"_id": a.WriterID}).Decode(&writer); err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	share, err := s.commissions.Resolve(ctx, a.WriterID, writer.Tier, a.OrderLevelID)
+	if err != nil {
+		return nil, err
+	}
+	amount, currency, err := s.ledger.PostApproval(ctx, a.OrderID, a.ClientID, a.WriterID, share)
+	if err != nil {
+		return nil, err
+	}
+	if amount == 0 {
+		return nil, nil
+	}
+	earning := &models.Earning{
+		ID:             primitive.NewObjectID(),
+		WriterID:       a.WriterID,
+		OrderID:        a.OrderID,
+		Amount:         amount,
+		Currency:       currency,
+		WriterShareBps: share,
+		Status:         models.EarningStatusAccrued,
+		AccruedAt:      time.Now(),
+	}
+	if _, err := s.earnings.InsertOne(ctx, earning); err != nil {
+		return nil, err
+	}
+	return earning, nil
+}
+
+// ListForWriter returns a writer's earnings, newest first, optionally only those with status
+func (s *EarningService) ListForWriter(writerID primitive.ObjectID, status string, page, pageSize int) ([]models.Earning, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{"writer_id": writerID}
+	if status != "" {
+		filter["status"] = status
+	}
+	total, err := s.earnings.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "accrued_at", Value: -1}})
+	cur, err := s.earnings.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	earnings := []models.Earning{}
+	if err := cur.All(ctx, &earnings); err != nil {
+		return nil, 0, err
+	}
+	return earnings, total, nil
+}
+
+// Summary totals a writer's accrued and paid earnings per currency
+func (s *EarningService) Summary(writerID primitive.ObjectID) ([]models.EarningsSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cur, err := s.earnings.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"writer_id": writerID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"currency": "$currency", "status": "$status"},
+			"total": bson.M{"$sum": "$amount"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.currency", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var rows []struct {
+		ID struct {
+			Currency string `bson:"currency"`
+			Status   string `bson:"status"`
+		} `bson:"_id"`
+		Total int64 `bson:"total"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	summary := []models.EarningsSummary{}
+	for _, row := range rows {
+		if len(summary) == 0 || summary[len(summary)-1].Currency != row.ID.Currency {
+			summary = append(summary, models.EarningsSummary{Currency: row.ID.Currency})
+		}
+		current := &summary[len(summary)-1]
+		switch row.ID.Status {
+		case models.EarningStatusAccrued:
+			current.Accrued = row.Total
+		case models.EarningStatusPaid:
+			current.Paid = row.Total
+		}
+	}
+	return summary, nil
+}
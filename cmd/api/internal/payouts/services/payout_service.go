@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	currencyservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/services"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/models"
+	usermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrMissingReference    = errors.New("a payout batch reference is required")
+	ErrNothingToPay        = errors.New("no accrued earnings to pay out")
+	ErrPayoutBatchNotFound = errors.New("payout batch not found")
+	errEarningsChanged     = errors.New("earnings changed while creating the payout batch")
+)
+
+// PayoutService pays accrued writer earnings in batches
+type PayoutService struct {
+	db            *mongo.Database
+	batches       *mongo.Collection
+	earnings      *mongo.Collection
+	users         *mongo.Collection
+	ledger        *ledgerservices.LedgerService
+	exchangeRates *currencyservices.ExchangeRateService
+}
+
+func NewPayoutService(db *mongo.Database) *PayoutService {
+	return &PayoutService{
+		db:            db,
+		batches:       db.Collection("payout_batches"),
+		earnings:      db.Collection("earnings"),
+		users:         db.Collection("users"),
+		ledger:        ledgerservices.NewLedgerService(db),
+		exchangeRates: currencyservices.NewExchangeRateService(db),
+	}
+}
+
+// CreateBatch pays every accrued earning (only those of writerIDs when given)
+// in one batch: the earnings are marked paid and a payout is posted to the
+// ledger per writer and currency. Each transfer is converted to the writer's
+// payout currency; the ledger keeps the currency the earnings are in. If a
+// batch with reference already exists it is returned with created=false and
+// nothing else happens.
+func (s *PayoutService) CreateBatch(reference string, writerIDs []primitive.ObjectID, createdBy *primitive.ObjectID) (batch *models.PayoutBatch, created bool, err error) {
+	if reference == "" {
+		return nil, false, ErrMissingReference
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	session, err := s.db.Client().StartSession()
+	if err != nil {
+		return nil, false, err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// Checked inside the transaction so a concurrent request with the same
+		// reference sees the committed batch when its transaction is retried
+		var existing models.PayoutBatch
+		err := s.batches.FindOne(sc, bson.M{"reference": reference}).Decode(&existing)
+		if err == nil {
+			batch, created = &existing, false
+			return nil, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		filter := bson.M{"status": models.EarningStatusAccrued}
+		if len(writerIDs) > 0 {
+			filter["writer_id"] = bson.M{"$in": writerIDs}
+		}
+		cur, err := s.earnings.Find(sc, filter)
+		if err != nil {
+			return nil, err
+		}
+		var earnings []models.Earning
+		if err := cur.All(sc, &earnings); err != nil {
+			return nil, err
+		}
+		if len(earnings) == 0 {
+			return nil, ErrNothingToPay
+		}
+
+		now := time.Now()
+		items, err := s.convertItems(sc, groupEarnings(earnings), now)
+		if err != nil {
+			return nil, err
+		}
+		b := &models.PayoutBatch{
+			ID:        primitive.NewObjectID(),
+			Reference: reference,
+			Status:    models.PayoutBatchStatusPaid,
+			Items:     items,
+			CreatedBy: createdBy,
+			CreatedAt: now,
+		}
+		if _, err := s.batches.InsertOne(sc, b); err != nil {
+			return nil, err
+		}
+		ids := make([]primitive.ObjectID, len(earnings))
+		for i, e := range earnings {
+			ids[i] = e.ID
+		}
+		res, err := s.earnings.UpdateMany(sc,
+			bson.M{"_id": bson.M{"$in": ids}, "status": models.EarningStatusAccrued},
+			bson.M{"$set": bson.M{"status": models.EarningStatusPaid, "payout_batch_id": b.ID, "paid_at": now}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if res.ModifiedCount != int64(len(ids)) {
+			return nil, errEarningsChanged
+		}
+		for _, item := range b.Items {
+			if err := s.ledger.PostPayout(sc, itemReference(b, item), item.WriterID, item.Amount, item.Currency); err != nil {
+				return nil, err
+			}
+		}
+		batch, created = b, true
+		return nil, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return batch, created, nil
+}
+
+// Reverse undoes a batch, e.g. when the bank rejected the transfers: its
+// earnings become accrued again and the payouts are reversed in the ledger.
+// Reversing a reversed batch returns it unchanged.
+func (s *PayoutService) Reverse(id primitive.ObjectID, reason string, reversedBy *primitive.ObjectID) (*models.PayoutBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	session, err := s.db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var batch models.PayoutBatch
+		if err := s.batches.FindOne(sc, bson.M{"_id": id}).Decode(&batch); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, ErrPayoutBatchNotFound
+			}
+			return nil, err
+		}
+		if batch.Status == models.PayoutBatchStatusReversed {
+			return &batch, nil
+		}
+
+		now := time.Now()
+		set := bson.M{"status": models.PayoutBatchStatusReversed, "reversed_at": now, "reversal_reason": reason}
+		if reversedBy != nil {
+			set["reversed_by"] = *reversedBy
+		}
+		if _, err := s.batches.UpdateOne(sc, bson.M{"_id": id, "status": models.PayoutBatchStatusPaid}, bson.M{"$set": set}); err != nil {
+			return nil, err
+		}
+		if _, err := s.earnings.UpdateMany(sc,
+			bson.M{"payout_batch_id": id},
+			bson.M{
+				"$set":   bson.M{"status": models.EarningStatusAccrued},
+				"$unset": bson.M{"payout_batch_id": "", "paid_at": ""},
+			},
+		); err != nil {
+			return nil, err
+		}
+		for _, item := range batch.Items {
+			if err := s.ledger.PostPayoutReversal(sc, itemReference(&batch, item), item.WriterID, item.Amount, item.Currency); err != nil {
+				return nil, err
+			}
+		}
+		batch.Status = models.PayoutBatchStatusReversed
+		batch.ReversedAt = &now
+		batch.ReversedBy = reversedBy
+		batch.ReversalReason = reason
+		return &batch, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*models.PayoutBatch), nil
+}
+
+// List returns payout batches, newest first
+func (s *PayoutService) List(page, pageSize int) ([]models.PayoutBatch, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	total, err := s.batches.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cur, err := s.batches.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	batches := []models.PayoutBatch{}
+	if err := cur.All(ctx, &batches); err != nil {
+		return nil, 0, err
+	}
+	return batches, total, nil
+}
+
+func (s *PayoutService) GetByID(id primitive.ObjectID) (*models.PayoutBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var batch models.PayoutBatch
+	if err := s.batches.FindOne(ctx, bson.M{"_id": id}).Decode(&batch); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPayoutBatchNotFound
+		}
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// WriteCSV writes one bank transfer line per item of the batch
+func (s *PayoutService) WriteCSV(w io.Writer, batch *models.PayoutBatch) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ids := make([]primitive.ObjectID, len(batch.Items))
+	for i, item := range batch.Items {
+		ids[i] = item.WriterID
+	}
+	cur, err := s.users.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	var users []usermodels.User
+	if err := cur.All(ctx, &users); err != nil {
+		return err
+	}
+	byID := make(map[primitive.ObjectID]usermodels.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"reference", "writer_id", "writer_number", "first_name", "last_name", "email", "amount", "currency", "orders", "payout_amount", "payout_currency", "exchange_rate"})
+	for _, item := range batch.Items {
+		u := byID[item.WriterID]
+		payoutAmount, payoutCurrency := item.Payout()
+		rate := "1"
+		if item.Conversion != nil {
+			rate = strconv.FormatFloat(item.Conversion.Rate, 'f', -1, 64)
+		}
+		out.Write([]string{
+			itemReference(batch, item),
+			item.WriterID.Hex(),
+			u.UserNumber,
+			u.FirstName,
+			u.LastName,
+			u.Email,
+			money.FormatMinor(item.Amount, item.Currency),
+			item.Currency,
+			fmt.Sprint(len(item.EarningIDs)),
+			money.FormatMinor(payoutAmount, payoutCurrency),
+			payoutCurrency,
+			rate,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// groupEarnings sums earnings into one item per writer and currency
+func groupEarnings(earnings []models.Earning) []models.PayoutItem {
+	type key struct {
+		writer   primitive.ObjectID
+		currency string
+	}
+	byKey := map[key]*models.PayoutItem{}
+	var keys []key
+	for _, e := range earnings {
+		k := key{e.WriterID, e.Currency}
+		item, ok := byKey[k]
+		if !ok {
+			item = &models.PayoutItem{WriterID: e.WriterID, Currency: e.Currency}
+			byKey[k] = item
+			keys = append(keys, k)
+		}
+		item.Amount += e.Amount
+		item.EarningIDs = append(item.EarningIDs, e.ID)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].writer != keys[j].writer {
+			return keys[i].writer.Hex() < keys[j].writer.Hex()
+		}
+		return keys[i].currency < keys[j].currency
+	})
+	items := make([]models.PayoutItem, len(keys))
+	for i, k := range keys {
+		items[i] = *byKey[k]
+	}
+	return items
+}
+
+// convertItems sets what each item pays out in the writer's payout currency,
+// at the exchange rate in effect at at
+func (s *PayoutService) convertItems(ctx context.Context, items []models.PayoutItem, at time.Time) ([]models.PayoutItem, error) {
+	ids := make([]primitive.ObjectID, len(items))
+	for i, item := range items {
+		ids[i] = item.WriterID
+	}
+	cur, err := s.users.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"payout_currency": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []usermodels.User
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	payoutCurrency := make(map[primitive.ObjectID]string, len(users))
+	for _, u := range users {
+		payoutCurrency[u.ID] = u.PayoutCurrency
+	}
+
+	for i := range items {
+		item := &items[i]
+		currency := payoutCurrency[item.WriterID]
+		if currency == "" || currency == item.Currency {
+			item.PayoutAmount, item.PayoutCurrency = item.Amount, item.Currency
+			continue
+		}
+		converted, conversion, err := s.exchangeRates.Convert(money.New(item.Amount, item.Currency), currency, at)
+		if err != nil {
+			return nil, err
+		}
+		item.PayoutAmount, item.PayoutCurrency, item.Conversion = converted.Amount, converted.Currency, conversion
+	}
+	return items, nil
+}
+
+// itemReference identifies one transfer; it is also the ledger reference of its payout
+func itemReference(batch *models.PayoutBatch, item models.PayoutItem) string {
+	return batch.ID.Hex() + ":" + item.WriterID.Hex() + ":" + item.Currency
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PriceRateHandler struct {
+	service *services.PriceRateService
+}
+
+func NewPriceRateHandler(service *services.PriceRateService) *PriceRateHandler {
+	return &PriceRateHandler{service: service}
+}
+
+func (h *PriceRateHandler) Create(c *gin.Context) {
+	var rate models.PriceRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.Create(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rate)
+}
+
+func (h *PriceRateHandler) List(c *gin.Context) {
+	rates, err := h.service.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+func (h *PriceRateHandler) GetByID(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	rate, err := h.service.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price rate not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+func (h *PriceRateHandler) Update(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var req struct {
+		Value *float64 `json:"value" binding:"required"`
+		Kind  string   `json:"kind"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.Update(id, *req.Value, req.Kind); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Price rate updated"})
+}
+
+func (h *PriceRateHandler) Delete(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.service.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Price rate deleted"})
+}
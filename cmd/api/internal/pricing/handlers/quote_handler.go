@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	currencyservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/services"
+	promoservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/services"
+	taxservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/services"
+)
+
+type QuoteHandler struct {
+	service *services.QuoteService
+}
+
+func NewQuoteHandler(service *services.QuoteService) *QuoteHandler {
+	return &QuoteHandler{service: service}
+}
+
+// Quote returns an itemized price for an order that has not been placed yet
+func (h *QuoteHandler) Quote(c *gin.Context) {
+	var req models.QuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	breakdown, err := h.service.Quote(&req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRateNotConfigured), errors.Is(err, taxservices.ErrInvalidCountry),
+			errors.Is(err, money.ErrInvalidCurrency):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, promoservices.ErrPromotionNotFound), errors.Is(err, promoservices.ErrPromotionNotApplicable),
+			errors.Is(err, taxservices.ErrInvalidVATID), errors.Is(err, currencyservices.ErrNoExchangeRate):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, promoservices.ErrPromotionExhausted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute quote"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, breakdown)
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rate dimensions. Each one names the lookup collection (or the add-on flags)
+// a PriceRate applies to and decides how its Value is interpreted.
+const (
+	DimensionOrderLevel    = "order_level"    // Value is the price per page for the level
+	DimensionOrderPages    = "order_pages"    // Value is the number of pages the option stands for
+	DimensionOrderUrgency  = "order_urgency"  // Value is a multiplier on the page subtotal
+	DimensionOrderStyle    = "order_style"    // Value is a multiplier on the page subtotal
+	DimensionOrderLanguage = "order_language" // Value is a multiplier on the page subtotal
+	DimensionAddOn         = "add_on"         // Value is charged according to Kind
+)
+
+// Add-on charge kinds (only used by the add_on dimension)
+const (
+	AddOnKindFlat    = "flat"     // charged once per order
+	AddOnKindPerPage = "per_page" // charged once per page
+	AddOnKindPercent = "percent"  // percentage of the page subtotal
+)
+
+// Add-on codes match the boolean flags on orders.Order
+const (
+	AddOnHighPriority               = "is_high_priority"
+	AddOnTopWriter                  = "top_writer"
+	AddOnPlagarismReport            = "plagarism_report"
+	AddOnOnePageSummary             = "one_page_summary"
+	AddOnExtraQualityCheck          = "extra_quality_check"
+	AddOnInitialDraft               = "initial_draft"
+	AddOnSmsUpdate                  = "sms_update"
+	AddOnFullTextCopySources        = "full_text_copy_sources"
+	AddOnSamePaperFromAnotherWriter = "same_paper_from_another_writer"
+)
+
+// PriceRate is one row of the admin-editable rate table (price_rates collection)
+// e.g., {"dimension": "order_level", "ref_id": ObjectId, "value": 12.5}
+// e.g., {"dimension": "add_on", "add_on": "top_writer", "kind": "percent", "value": 25}
+type PriceRate struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Dimension string              `bson:"dimension" json:"dimension" binding:"required"`
+	RefID     *primitive.ObjectID `bson:"ref_id,omitempty" json:"ref_id,omitempty"`
+	AddOn     string              `bson:"add_on,omitempty" json:"add_on,omitempty"`
+	Kind      string              `bson:"kind,omitempty" json:"kind,omitempty"`
+	Value     float64             `bson:"value" json:"value"`
+	UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	currencymodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/models"
+	promomodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	taxmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QuoteRequest carries everything that influences the price of an order.
+// Currency defaults to the one prices are configured in.
+type QuoteRequest struct {
+	OrderTypeID                primitive.ObjectID `json:"order_type_id"`
+	OrderLevelID               primitive.ObjectID `json:"order_level_id" binding:"required"`
+	OrderPagesID               primitive.ObjectID `json:"order_pages_id" binding:"required"`
+	OrderUrgencyID             primitive.ObjectID `json:"order_urgency_id" binding:"required"`
+	OrderStyleID               primitive.ObjectID `json:"order_style_id"`
+	OrderLanguageID            primitive.ObjectID `json:"order_language_id"`
+	IsHighPriority             bool               `json:"is_high_priority"`
+	TopWriter                  bool               `json:"top_writer"`
+	PlagarismReport            bool               `json:"plagarism_report"`
+	OnePageSummary             bool               `json:"one_page_summary"`
+	ExtraQualityCheck          bool               `json:"extra_quality_check"`
+	InitialDraft               bool               `json:"initial_draft"`
+	SmsUpdate                  bool               `json:"sms_update"`
+	FullTextCopySources        bool               `json:"full_text_copy_sources"`
+	SamePaperFromAnotherWriter bool               `json:"same_paper_from_another_writer"`
+	PromoCode                  string             `json:"promo_code"`
+	Billing                    *taxmodels.Billing `json:"billing,omitempty"`
+	Currency                   string             `json:"currency,omitempty"`
+}
+
+// AddOns returns the codes of the add-ons requested
+func (r *QuoteRequest) AddOns() []string {
+	flags := []struct {
+		code string
+		on   bool
+	}{
+		{AddOnHighPriority, r.IsHighPriority},
+		{AddOnTopWriter, r.TopWriter},
+		{AddOnPlagarismReport, r.PlagarismReport},
+		{AddOnOnePageSummary, r.OnePageSummary},
+		{AddOnExtraQualityCheck, r.ExtraQualityCheck},
+		{AddOnInitialDraft, r.InitialDraft},
+		{AddOnSmsUpdate, r.SmsUpdate},
+		{AddOnFullTextCopySources, r.FullTextCopySources},
+		{AddOnSamePaperFromAnotherWriter, r.SamePaperFromAnotherWriter},
+	}
+	var codes []string
+	for _, f := range flags {
+		if f.on {
+			codes = append(codes, f.code)
+		}
+	}
+	return codes
+}
+
+// LineItem is a single priced row of a breakdown
+type LineItem struct {
+	Code        string  `bson:"code" json:"code"`
+	Description string  `bson:"description" json:"description"`
+	Amount      float64 `bson:"amount" json:"amount"`
+}
+
+// PriceBreakdown is the itemized result of a quote. The line items always add
+// up to Total and the same structure is persisted on the order. A promotion
+// adds a negative "discount" item and tax a "tax" item; Subtotal is the total
+// before either. Amounts are in Currency; a breakdown in another currency
+// than the default one records the Conversion its prices went through.
+type PriceBreakdown struct {
+	Pages              int                           `bson:"pages" json:"pages"`
+	PricePerPage       float64                       `bson:"price_per_page" json:"price_per_page"`
+	UrgencyMultiplier  float64                       `bson:"urgency_multiplier" json:"urgency_multiplier"`
+	StyleMultiplier    float64                       `bson:"style_multiplier" json:"style_multiplier"`
+	LanguageMultiplier float64                       `bson:"language_multiplier" json:"language_multiplier"`
+	Items              []LineItem                    `bson:"items" json:"items"`
+	Subtotal           float64                       `bson:"subtotal,omitempty" json:"subtotal,omitempty"`
+	Promotion          *promomodels.AppliedPromotion `bson:"promotion,omitempty" json:"promotion,omitempty"`
+	Tax                *taxmodels.AppliedTax         `bson:"tax,omitempty" json:"tax,omitempty"`
+	Total              float64                       `bson:"total" json:"total"`
+	Currency           string                        `bson:"currency" json:"currency"`
+	Conversion         *currencymodels.Conversion    `bson:"conversion,omitempty" json:"conversion,omitempty"`
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type PriceRateService struct {
+	col *mongo.Collection
+}
+
+func NewPriceRateService(db *mongo.Database) *PriceRateService {
+	return &PriceRateService{col: db.Collection("price_rates")}
+}
+
+// ValidateRate checks that a rate targets something the quote engine understands
+func ValidateRate(rate *models.PriceRate) error {
+	switch rate.Dimension {
+	case models.DimensionOrderLevel, models.DimensionOrderPages, models.DimensionOrderUrgency,
+		models.DimensionOrderStyle, models.DimensionOrderLanguage:
+		if rate.RefID == nil || rate.RefID.IsZero() {
+			return errors.New("ref_id is required for " + rate.Dimension + " rates")
+		}
+		rate.AddOn = ""
+		rate.Kind = ""
+	case models.DimensionAddOn:
+		if !isKnownAddOn(rate.AddOn) {
+			return errors.New("unknown add_on: " + rate.AddOn)
+		}
+		if rate.Kind == "" {
+			rate.Kind = models.AddOnKindFlat
+		}
+		if rate.Kind != models.AddOnKindFlat && rate.Kind != models.AddOnKindPerPage && rate.Kind != models.AddOnKindPercent {
+			return errors.New("kind must be one of flat, per_page, percent")
+		}
+		rate.RefID = nil
+	default:
+		return errors.New("unknown dimension: " + rate.Dimension)
+	}
+	return validateValue(rate.Dimension, rate.Value)
+}
+
+// validateValue checks a rate's value. Order pages options have no page
+// count of their own; their rate is it, so it must be a whole number of pages.
+func validateValue(dimension string, value float64) error {
+	if value < 0 {
+		return errors.New("value must not be negative")
+	}
+	if dimension == models.DimensionOrderPages && (value < 1 || value != math.Trunc(value)) {
+		return errors.New("value of order_pages rates is a page count and must be a whole number of at least 1")
+	}
+	return nil
+}
+
+func (s *PriceRateService) Create(rate *models.PriceRate) error {
+	if err := ValidateRate(rate); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.col.FindOne(ctx, rateKey(rate)).Err() == nil {
+		return errors.New("a rate already exists for this " + rate.Dimension)
+	}
+	rate.ID = primitive.NewObjectID()
+	rate.UpdatedAt = time.Now()
+	_, err := s.col.InsertOne(ctx, rate)
+	return err
+}
+
+func (s *PriceRateService) List() ([]models.PriceRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cur, err := s.col.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var rates []models.PriceRate
+	if err := cur.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (s *PriceRateService) GetByID(id primitive.ObjectID) (*models.PriceRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var rate models.PriceRate
+	err := s.col.FindOne(ctx, bson.M{"_id": id}).Decode(&rate)
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// Update only allows the value and add-on kind to change; the rate's target is fixed
+func (s *PriceRateService) Update(id primitive.ObjectID, value float64, kind string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var rate models.PriceRate
+	if err := s.col.FindOne(ctx, bson.M{"_id": id}).Decode(&rate); err != nil {
+		return err
+	}
+	if err := validateValue(rate.Dimension, value); err != nil {
+		return err
+	}
+	set := bson.M{"value": value, "updated_at": time.Now()}
+	if kind != "" {
+		if kind != models.AddOnKindFlat && kind != models.AddOnKindPerPage && kind != models.AddOnKindPercent {
+			return errors.New("kind must be one of flat, per_page, percent")
+		}
+		set["kind"] = kind
+	}
+	res, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *PriceRateService) Delete(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func rateKey(rate *models.PriceRate) bson.M {
+	if rate.Dimension == models.DimensionAddOn {
+		return bson.M{"dimension": rate.Dimension, "add_on": rate.AddOn}
+	}
+	return bson.M{"dimension": rate.Dimension, "ref_id": rate.RefID}
+}
+
+func isKnownAddOn(code string) bool {
+	switch code {
+	case models.AddOnHighPriority, models.AddOnTopWriter, models.AddOnPlagarismReport,
+		models.AddOnOnePageSummary, models.AddOnExtraQualityCheck, models.AddOnInitialDraft,
+		models.AddOnSmsUpdate, models.AddOnFullTextCopySources, models.AddOnSamePaperFromAnotherWriter:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateRate(t *testing.T) {
+	id := primitive.NewObjectID()
+	for _, tc := range []struct {
+		name    string
+		rate    models.PriceRate
+		wantErr bool
+	}{
+		{"level", models.PriceRate{Dimension: models.DimensionOrderLevel, RefID: &id, Value: 12.5}, false},
+		{"level without ref", models.PriceRate{Dimension: models.DimensionOrderLevel, Value: 12.5}, true},
+		{"negative value", models.PriceRate{Dimension: models.DimensionOrderUrgency, RefID: &id, Value: -1}, true},
+		{"whole page count", models.PriceRate{Dimension: models.DimensionOrderPages, RefID: &id, Value: 5}, false},
+		{"fractional page count", models.PriceRate{Dimension: models.DimensionOrderPages, RefID: &id, Value: 2.5}, true},
+		{"no pages", models.PriceRate{Dimension: models.DimensionOrderPages, RefID: &id, Value: 0}, true},
+		{"add-on", models.PriceRate{Dimension: models.DimensionAddOn, AddOn: models.AddOnTopWriter, Kind: models.AddOnKindPercent, Value: 25}, false},
+		{"unknown add-on", models.PriceRate{Dimension: models.DimensionAddOn, AddOn: "ghost_writer", Value: 25}, true},
+		{"unknown kind", models.PriceRate{Dimension: models.DimensionAddOn, AddOn: models.AddOnTopWriter, Kind: "daily", Value: 25}, true},
+		{"unknown dimension", models.PriceRate{Dimension: "order_font", RefID: &id, Value: 1}, true},
+	} {
+		rate := tc.rate
+		if err := ValidateRate(&rate); (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	currencymodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/models"
+	currencyservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	ordermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	promomodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	promoservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/services"
+	taxmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+	taxservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrRateNotConfigured is returned when an order references something that has no price
+var ErrRateNotConfigured = errors.New("no price configured")
+
+// QuoteService computes order prices from the price_rates table. Clients never
+// supply a price; everything comes from here.
+type QuoteService struct {
+	rates         *mongo.Collection
+	promotions    *promoservices.PromotionService
+	taxes         *taxservices.TaxService
+	exchangeRates *currencyservices.ExchangeRateService
+}
+
+func NewQuoteService(db *mongo.Database) *QuoteService {
+	return &QuoteService{
+		rates:         db.Collection("price_rates"),
+		promotions:    promoservices.NewPromotionService(db),
+		taxes:         taxservices.NewTaxService(db),
+		exchangeRates: currencyservices.NewExchangeRateService(db),
+	}
+}
+
+// Quote prices a request against the current rate table, less the discount
+// of its promo code if it has one, plus the tax of the billing country.
+// Prices and promotions are in the default currency; a quote in another
+// currency is converted at the current exchange rate before tax is added.
+// Per-user caps are only checked when an order is created.
+func (s *QuoteService) Quote(req *models.QuoteRequest) (*models.PriceBreakdown, error) {
+	currency := money.DefaultCurrency()
+	if req.Currency != "" {
+		var err error
+		if currency, err = money.NormalizeCurrency(req.Currency); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cur, err := s.rates.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var rates []models.PriceRate
+	if err := cur.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	breakdown, err := ComputeBreakdown(req, rates)
+	if err != nil {
+		return nil, err
+	}
+	if req.PromoCode != "" {
+		promotion, err := s.promotions.Lookup(req.PromoCode)
+		if err != nil {
+			return nil, err
+		}
+		applied, err := promoservices.Apply(promotion, promoservices.Cart{
+			OrderTypeID:  req.OrderTypeID,
+			OrderLevelID: req.OrderLevelID,
+			Subtotal:     breakdown.Total,
+		}, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		ApplyDiscount(breakdown, applied)
+	}
+	if currency != breakdown.Currency {
+		conversion, err := s.exchangeRates.Rate(breakdown.Currency, currency, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		ConvertBreakdown(breakdown, conversion)
+	}
+	tax, err := s.taxes.Calculate(req.Billing, breakdown.Total, breakdown.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if tax != nil {
+		ApplyTax(breakdown, tax)
+	}
+	return breakdown, nil
+}
+
+// QuoteOrder prices an order using its lookup IDs and add-on flags
+func (s *QuoteService) QuoteOrder(order *ordermodels.Order) (*models.PriceBreakdown, error) {
+	return s.Quote(QuoteRequestFromOrder(order))
+}
+
+// QuoteRequestFromOrder extracts the pricing inputs from an order
+func QuoteRequestFromOrder(order *ordermodels.Order) *models.QuoteRequest {
+	return &models.QuoteRequest{
+		OrderTypeID:                order.OrderTypeID,
+		OrderLevelID:               order.OrderLevelID,
+		OrderPagesID:               order.OrderPagesID,
+		OrderUrgencyID:             order.OrderUrgencyID,
+		OrderStyleID:               order.OrderStyleID,
+		OrderLanguageID:            order.OrderLanguageID,
+		IsHighPriority:             order.IsHighPriority,
+		TopWriter:                  order.TopWriter,
+		PlagarismReport:            order.PlagarismReport,
+		OnePageSummary:             order.OnePageSummary,
+		ExtraQualityCheck:          order.ExtraQualityCheck,
+		InitialDraft:               order.InitialDraft,
+		SmsUpdate:                  order.SmsUpdate,
+		FullTextCopySources:        order.FullTextCopySources,
+		SamePaperFromAnotherWriter: order.SamePaperFromAnotherWriter,
+		PromoCode:                  order.PromoCode,
+		Billing:                    order.Billing,
+		Currency:                   order.Currency,
+	}
+}
+
+// ComputeBreakdown is the pricing formula:
+//
+//	pages * price_per_page(level) * urgency * style * language + add-ons
+//
+// Level, pages and urgency must have a rate. The page count of an order
+// pages option is its rate, a whole number of pages. Style and language
+// default to a multiplier of 1 when the admin has not priced them. Every line item is
+// rounded to the minor unit of the default currency, the one rates are in,
+// so the items always sum to the total.
+func ComputeBreakdown(req *models.QuoteRequest, rates []models.PriceRate) (*models.PriceBreakdown, error) {
+	byRef := map[string]models.PriceRate{}
+	addOns := map[string]models.PriceRate{}
+	for _, r := range rates {
+		if r.Dimension == models.DimensionAddOn {
+			addOns[r.AddOn] = r
+		} else if r.RefID != nil {
+			byRef[r.Dimension+":"+r.RefID.Hex()] = r
+		}
+	}
+	lookup := func(dimension, id string) (models.PriceRate, bool) {
+		r, ok := byRef[dimension+":"+id]
+		return r, ok
+	}
+
+	level, ok := lookup(models.DimensionOrderLevel, req.OrderLevelID.Hex())
+	if !ok {
+		return nil, fmt.Errorf("%w for order level %s", ErrRateNotConfigured, req.OrderLevelID.Hex())
+	}
+	pagesRate, ok := lookup(models.DimensionOrderPages, req.OrderPagesID.Hex())
+	if !ok {
+		return nil, fmt.Errorf("%w for order pages %s", ErrRateNotConfigured, req.OrderPagesID.Hex())
+	}
+	urgency, ok := lookup(models.DimensionOrderUrgency, req.OrderUrgencyID.Hex())
+	if !ok {
+		return nil, fmt.Errorf("%w for order urgency %s", ErrRateNotConfigured, req.OrderUrgencyID.Hex())
+	}
+	styleMultiplier := 1.0
+	if style, ok := lookup(models.DimensionOrderStyle, req.OrderStyleID.Hex()); ok {
+		styleMultiplier = style.Value
+	}
+	languageMultiplier := 1.0
+	if language, ok := lookup(models.DimensionOrderLanguage, req.OrderLanguageID.Hex()); ok {
+		languageMultiplier = language.Value
+	}
+
+	pages := int(pagesRate.Value)
+	if pages < 1 || float64(pages) != pagesRate.Value {
+		return nil, fmt.Errorf("%w: order pages %s has no whole page count", ErrRateNotConfigured, req.OrderPagesID.Hex())
+	}
+
+	breakdown := &models.PriceBreakdown{
+		Pages:              pages,
+		PricePerPage:       level.Value,
+		UrgencyMultiplier:  urgency.Value,
+		StyleMultiplier:    styleMultiplier,
+		LanguageMultiplier: languageMultiplier,
+		Currency:           money.DefaultCurrency(),
+	}
+	base := level.Value * float64(pages)
+	addItem(breakdown, "pages", pagesDescription(pages, level.Value, breakdown.Currency), base)
+	afterUrgency := base * urgency.Value
+	if urgency.Value != 1 {
+		addItem(breakdown, "urgency", fmt.Sprintf("Urgency x%.2f", urgency.Value), afterUrgency-base)
+	}
+	afterStyle := afterUrgency * styleMultiplier
+	if styleMultiplier != 1 {
+		addItem(breakdown, "style", fmt.Sprintf("Style x%.2f", styleMultiplier), afterStyle-afterUrgency)
+	}
+	subtotal := afterStyle * languageMultiplier
+	if languageMultiplier != 1 {
+		addItem(breakdown, "language", fmt.Sprintf("Language x%.2f", languageMultiplier), subtotal-afterStyle)
+	}
+
+	for _, code := range req.AddOns() {
+		rate, ok := addOns[code]
+		if !ok {
+			return nil, fmt.Errorf("%w for add-on %s", ErrRateNotConfigured, code)
+		}
+		var amount float64
+		switch rate.Kind {
+		case models.AddOnKindPerPage:
+			amount = rate.Value * float64(pages)
+		case models.AddOnKindPercent:
+			amount = subtotal * rate.Value / 100
+		default:
+			amount = rate.Value
+		}
+		addItem(breakdown, code, "Add-on: "+code, amount)
+	}
+	return breakdown, nil
+}
+
+// ApplyDiscount takes a promotion's discount off a computed breakdown
+func ApplyDiscount(b *models.PriceBreakdown, applied *promomodels.AppliedPromotion) {
+	b.Subtotal = b.Total
+	b.Promotion = applied
+	addItem(b, "discount", "Promotion "+applied.Code, -applied.Amount)
+}
+
+// ConvertBreakdown converts a breakdown to conversion.To line by line, so the
+// converted items still sum to the total. The promotion's discount is
+// converted with it; multipliers and percentages are unaffected.
+func ConvertBreakdown(b *models.PriceBreakdown, conversion *currencymodels.Conversion) {
+	convert := func(amount float64) float64 {
+		return money.FromMajor(amount, b.Currency).Convert(conversion.To, conversion.Rate).Major()
+	}
+	items := b.Items
+	b.Items = nil
+	b.Total = 0
+	b.Currency = conversion.To
+	b.Conversion = conversion
+	b.PricePerPage = convert(b.PricePerPage)
+	for _, item := range items {
+		if item.Code == "pages" {
+			item.Description = pagesDescription(b.Pages, b.PricePerPage, b.Currency)
+		}
+		addItem(b, item.Code, item.Description, convert(item.Amount))
+	}
+	if b.Promotion != nil {
+		promotion := *b.Promotion
+		promotion.Amount = 0
+		for _, item := range b.Items {
+			if item.Code == "discount" {
+				promotion.Amount = -item.Amount
+			}
+		}
+		b.Promotion = &promotion
+		b.Subtotal = money.Round(b.Total+promotion.Amount, b.Currency)
+	}
+}
+
+// ApplyTax adds the tax on the discounted total. Reverse charged orders get
+// no line item, only the tax record.
+func ApplyTax(b *models.PriceBreakdown, tax *taxmodels.AppliedTax) {
+	if b.Subtotal == 0 {
+		b.Subtotal = b.Total
+	}
+	b.Tax = tax
+	if tax.Amount != 0 {
+		addItem(b, "tax", fmt.Sprintf("%s %.4g%%", tax.Name, tax.Rate), tax.Amount)
+	}
+}
+
+// addItem appends a rounded line item and keeps the total in step
+func addItem(b *models.PriceBreakdown, code, description string, amount float64) {
+	amount = money.Round(amount, b.Currency)
+	b.Items = append(b.Items, models.LineItem{Code: code, Description: description, Amount: amount})
+	b.Total = money.Round(b.Total+amount, b.Currency)
+}
+
+func pagesDescription(pages int, pricePerPage float64, currency string) string {
+	return fmt.Sprintf("%d page(s) at %s", pages, money.FormatMinor(money.ToMinor(pricePerPage, currency), currency))
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// quoteFixture is a request referencing one entry of every lookup and the
+// rates that price them
+type quoteFixture struct {
+	req   *models.QuoteRequest
+	rates map[string]models.PriceRate
+}
+
+func newQuoteFixture() quoteFixture {
+	req := &models.QuoteRequest{
+		OrderLevelID:    primitive.NewObjectID(),
+		OrderPagesID:    primitive.NewObjectID(),
+		OrderUrgencyID:  primitive.NewObjectID(),
+		OrderStyleID:    primitive.NewObjectID(),
+		OrderLanguageID: primitive.NewObjectID(),
+	}
+	ref := func(dimension string, id primitive.ObjectID, value float64) models.PriceRate {
+		return models.PriceRate{Dimension: dimension, RefID: &id, Value: value}
+	}
+	return quoteFixture{req: req, rates: map[string]models.PriceRate{
+		models.DimensionOrderLevel:   ref(models.DimensionOrderLevel, req.OrderLevelID, 10),
+		models.DimensionOrderPages:   ref(models.DimensionOrderPages, req.OrderPagesID, 3),
+		models.DimensionOrderUrgency: ref(models.DimensionOrderUrgency, req.OrderUrgencyID, 1),
+	}}
+}
+
+func (f quoteFixture) set(dimension string, value float64) {
+	ids := map[string]primitive.ObjectID{
+		models.DimensionOrderLevel:    f.req.OrderLevelID,
+		models.DimensionOrderPages:    f.req.OrderPagesID,
+		models.DimensionOrderUrgency:  f.req.OrderUrgencyID,
+		models.DimensionOrderStyle:    f.req.OrderStyleID,
+		models.DimensionOrderLanguage: f.req.OrderLanguageID,
+	}
+	id := ids[dimension]
+	f.rates[dimension] = models.PriceRate{Dimension: dimension, RefID: &id, Value: value}
+}
+
+func (f quoteFixture) addOn(code, kind string, value float64) {
+	f.rates[code] = models.PriceRate{Dimension: models.DimensionAddOn, AddOn: code, Kind: kind, Value: value}
+}
+
+func (f quoteFixture) list() []models.PriceRate {
+	var rates []models.PriceRate
+	for _, rate := range f.rates {
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+func TestComputeBreakdown(t *testing.T) {
+	t.Setenv("PAYMENT_CURRENCY", "USD")
+	for _, tc := range []struct {
+		name      string
+		configure func(f quoteFixture)
+		wantItems []models.LineItem
+		wantTotal float64
+		wantErr   bool
+	}{
+		{
+			name:      "pages only",
+			configure: func(f quoteFixture) {},
+			wantItems: []models.LineItem{{Code: "pages", Amount: 30}},
+			wantTotal: 30,
+		},
+		{
+			name: "multipliers apply in turn",
+			configure: func(f quoteFixture) {
+				f.set(models.DimensionOrderUrgency, 1.5)
+				f.set(models.DimensionOrderStyle, 1.1)
+				f.set(models.DimensionOrderLanguage, 2)
+			},
+			wantItems: []models.LineItem{
+				{Code: "pages", Amount: 30},
+				{Code: "urgency", Amount: 15},
+				{Code: "style", Amount: 4.5},
+				{Code: "language", Amount: 49.5},
+			},
+			wantTotal: 99,
+		},
+		{
+			name: "flat add-on",
+			configure: func(f quoteFixture) {
+				f.req.TopWriter = true
+				f.addOn(models.AddOnTopWriter, models.AddOnKindFlat, 5)
+			},
+			wantItems: []models.LineItem{{Code: "pages", Amount: 30}, {Code: models.AddOnTopWriter, Amount: 5}},
+			wantTotal: 35,
+		},
+		{
+			name: "per page add-on",
+			configure: func(f quoteFixture) {
+				f.req.SmsUpdate = true
+				f.addOn(models.AddOnSmsUpdate, models.AddOnKindPerPage, 2)
+			},
+			wantItems: []models.LineItem{{Code: "pages", Amount: 30}, {Code: models.AddOnSmsUpdate, Amount: 6}},
+			wantTotal: 36,
+		},
+		{
+			name: "percent add-on is taken of the subtotal after multipliers",
+			configure: func(f quoteFixture) {
+				f.set(models.DimensionOrderUrgency, 1.5)
+				f.req.IsHighPriority = true
+				f.addOn(models.AddOnHighPriority, models.AddOnKindPercent, 10)
+			},
+			wantItems: []models.LineItem{
+				{Code: "pages", Amount: 30},
+				{Code: "urgency", Amount: 15},
+				{Code: models.AddOnHighPriority, Amount: 4.5},
+			},
+			wantTotal: 49.5,
+		},
+		{
+			name: "add-on without kind is flat",
+			configure: func(f quoteFixture) {
+				f.req.InitialDraft = true
+				f.addOn(models.AddOnInitialDraft, "", 7)
+			},
+			wantItems: []models.LineItem{{Code: "pages", Amount: 30}, {Code: models.AddOnInitialDraft, Amount: 7}},
+			wantTotal: 37,
+		},
+		{
+			name: "items are rounded and sum to the total",
+			configure: func(f quoteFixture) {
+				f.set(models.DimensionOrderLevel, 3.333)
+				f.set(models.DimensionOrderUrgency, 1.15)
+				f.req.PlagarismReport = true
+				f.addOn(models.AddOnPlagarismReport, models.AddOnKindPercent, 12.5)
+			},
+			// 9.999, 1.49985 and 12.5% of 11.49885 = 1.43736
+			wantItems: []models.LineItem{
+				{Code: "pages", Amount: 10},
+				{Code: "urgency", Amount: 1.5},
+				{Code: models.AddOnPlagarismReport, Amount: 1.44},
+			},
+			wantTotal: 12.94,
+		},
+		{
+			name:      "missing level rate",
+			configure: func(f quoteFixture) { delete(f.rates, models.DimensionOrderLevel) },
+			wantErr:   true,
+		},
+		{
+			name:      "missing pages rate",
+			configure: func(f quoteFixture) { delete(f.rates, models.DimensionOrderPages) },
+			wantErr:   true,
+		},
+		{
+			name:      "missing urgency rate",
+			configure: func(f quoteFixture) { delete(f.rates, models.DimensionOrderUrgency) },
+			wantErr:   true,
+		},
+		{
+			name:      "missing add-on rate",
+			configure: func(f quoteFixture) { f.req.OnePageSummary = true },
+			wantErr:   true,
+		},
+		{
+			name:      "no pages",
+			configure: func(f quoteFixture) { f.set(models.DimensionOrderPages, 0) },
+			wantErr:   true,
+		},
+		{
+			name:      "fractional pages",
+			configure: func(f quoteFixture) { f.set(models.DimensionOrderPages, 2.5) },
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newQuoteFixture()
+			tc.configure(f)
+			breakdown, err := ComputeBreakdown(f.req, f.list())
+			if tc.wantErr {
+				if !errors.Is(err, ErrRateNotConfigured) {
+					t.Fatalf("err = %v, want ErrRateNotConfigured", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(breakdown.Items) != len(tc.wantItems) {
+				t.Fatalf("items = %+v, want %+v", breakdown.Items, tc.wantItems)
+			}
+			var sum float64
+			for i, item := range breakdown.Items {
+				if item.Code != tc.wantItems[i].Code || item.Amount != tc.wantItems[i].Amount {
+					t.Errorf("item %d = %s %v, want %s %v", i, item.Code, item.Amount, tc.wantItems[i].Code, tc.wantItems[i].Amount)
+				}
+				sum += item.Amount
+			}
+			if breakdown.Total != tc.wantTotal {
+				t.Errorf("total = %v, want %v", breakdown.Total, tc.wantTotal)
+			}
+			if breakdown.Currency != "USD" {
+				t.Errorf("currency = %s, want USD", breakdown.Currency)
+			}
+			if diff := sum - breakdown.Total; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("items sum to %v, total is %v", sum, breakdown.Total)
+			}
+		})
+	}
+}
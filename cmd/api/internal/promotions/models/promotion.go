@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Discount kinds
+const (
+	KindPercentage = "percentage" // Value is a percentage of the order subtotal
+	KindFixed      = "fixed"      // Value is an amount taken off the order subtotal
+)
+
+// Promotion is a discount code marketing hands out (promotions collection).
+// Zero caps mean unlimited; empty OrderTypeIDs/OrderLevelIDs mean any.
+// e.g., {"code": "SPRING10", "kind": "percentage", "value": 10, "max_redemptions": 500, "max_per_user": 1}
+type Promotion struct {
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Code           string               `bson:"code" json:"code" binding:"required"` // stored upper case
+	Description    string               `bson:"description,omitempty" json:"description,omitempty"`
+	Kind           string               `bson:"kind" json:"kind" binding:"required"`
+	Value          float64              `bson:"value" json:"value"`
+	MinOrderValue  float64              `bson:"min_order_value,omitempty" json:"min_order_value,omitempty"`
+	StartsAt       *time.Time           `bson:"starts_at,omitempty" json:"starts_at,omitempty"`
+	EndsAt         *time.Time           `bson:"ends_at,omitempty" json:"ends_at,omitempty"`
+	MaxRedemptions int64                `bson:"max_redemptions" json:"max_redemptions"`
+	MaxPerUser     int64                `bson:"max_per_user" json:"max_per_user"`
+	OrderTypeIDs   []primitive.ObjectID `bson:"order_type_ids,omitempty" json:"order_type_ids,omitempty"`
+	OrderLevelIDs  []primitive.ObjectID `bson:"order_level_ids,omitempty" json:"order_level_ids,omitempty"`
+	Active         bool                 `bson:"active" json:"active"`
+	Redemptions    int64                `bson:"redemptions" json:"redemptions"` // maintained by the service
+	CreatedAt      time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// AppliedPromotion is the discount a promotion gave one quote or order
+// e.g., {"promotion_id": ObjectId, "code": "SPRING10", "kind": "percentage", "value": 10, "amount": 4.25}
+type AppliedPromotion struct {
+	PromotionID primitive.ObjectID `bson:"promotion_id" json:"promotion_id"`
+	Code        string             `bson:"code" json:"code"`
+	Kind        string             `bson:"kind" json:"kind"`
+	Value       float64            `bson:"value" json:"value"`
+	Amount      float64            `bson:"amount" json:"amount"` // taken off the subtotal
+}
+
+// Redemption records one use of a promotion by an order (promotion_redemptions collection)
+// e.g., {"promotion_id": ObjectId, "code": "SPRING10", "user_id": ObjectId, "order_id": ObjectId, "amount": 4.25}
+type Redemption struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	PromotionID primitive.ObjectID `bson:"promotion_id" json:"promotion_id"`
+	Code        string             `bson:"code" json:"code"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	OrderID     primitive.ObjectID `bson:"order_id" json:"order_id"`
+	Amount      float64            `bson:"amount" json:"amount"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryPromotionRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryPromotionRepository keeps promotions in store, for tests
+func NewMemoryPromotionRepository(store *database.MemoryStore) PromotionRepository {
+	return &memoryPromotionRepository{store: store}
+}
+
+func (r *memoryPromotionRepository) Insert(ctx context.Context, p *models.Promotion) error {
+	return r.store.Insert("promotions", p)
+}
+
+func (r *memoryPromotionRepository) FindOne(ctx context.Context, filter bson.M) (*models.Promotion, error) {
+	var p models.Promotion
+	if err := r.store.FindOne("promotions", filter, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *memoryPromotionRepository) Find(ctx context.Context, opts FindOptions) ([]models.Promotion, error) {
+	promotions := []models.Promotion{}
+	findOpts := database.FindOptions{
+		Sort:  bson.D{{Key: "created_at", Value: -1}},
+		Skip:  opts.Skip,
+		Limit: opts.Limit,
+	}
+	err := r.store.Find("promotions", bson.M{}, findOpts, &promotions)
+	return promotions, err
+}
+
+func (r *memoryPromotionRepository) Count(ctx context.Context) (int64, error) {
+	return r.store.Count("promotions", bson.M{}), nil
+}
+
+func (r *memoryPromotionRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) (int64, error) {
+	return r.store.UpdateOne("promotions", bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *memoryPromotionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.store.DeleteOne("promotions", bson.M{"_id": id})
+	return err
+}
+
+func (r *memoryPromotionRepository) IncrementRedemptions(ctx context.Context, id primitive.ObjectID, max int64) (bool, error) {
+	matched, err := r.store.UpdateOne("promotions", redemptionFilter(id, max), bson.M{"$inc": bson.M{"redemptions": 1}})
+	return matched > 0, err
+}
+
+type memoryUsageRepository struct {
+	store *database.MemoryStore
+	// mu makes creating a counter and counting on it one step, like an upsert
+	mu sync.Mutex
+}
+
+// NewMemoryUsageRepository keeps promotion usage counters in store, for tests
+func NewMemoryUsageRepository(store *database.MemoryStore) UsageRepository {
+	return &memoryUsageRepository{store: store}
+}
+
+func (r *memoryUsageRepository) Increment(ctx context.Context, promotionID, userID primitive.ObjectID, max int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := usageID(promotionID, userID)
+	err := r.store.FindOne("promotion_usage", bson.M{"_id": id}, &bson.M{})
+	if err == mongo.ErrNoDocuments {
+		return true, r.store.Insert("promotion_usage", bson.M{"_id": id, "count": 1, "promotion_id": promotionID, "user_id": userID})
+	}
+	if err != nil {
+		return false, err
+	}
+	filter := bson.M{"_id": id}
+	if max > 0 {
+		filter["count"] = bson.M{"$lt": max}
+	}
+	matched, err := r.store.UpdateOne("promotion_usage", filter, bson.M{"$inc": bson.M{"count": 1}})
+	return matched > 0, err
+}
+
+type memoryRedemptionRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryRedemptionRepository keeps promotion redemptions in store, for tests
+func NewMemoryRedemptionRepository(store *database.MemoryStore) RedemptionRepository {
+	return &memoryRedemptionRepository{store: store}
+}
+
+func (r *memoryRedemptionRepository) Insert(ctx context.Context, redemption *models.Redemption) error {
+	return r.store.Insert("promotion_redemptions", redemption)
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoPromotionRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoPromotionRepository(db *mongo.Database) PromotionRepository {
+	return &mongoPromotionRepository{col: db.Collection("promotions")}
+}
+
+func (r *mongoPromotionRepository) Insert(ctx context.Context, p *models.Promotion) error {
+	_, err := r.col.InsertOne(ctx, p)
+	return err
+}
+
+func (r *mongoPromotionRepository) FindOne(ctx context.Context, filter bson.M) (*models.Promotion, error) {
+	var p models.Promotion
+	if err := r.col.FindOne(ctx, filter).Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *mongoPromotionRepository) Find(ctx context.Context, opts FindOptions) ([]models.Promotion, error) {
+	findOpts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	cur, err := r.col.Find(ctx, bson.M{}, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	promotions := []models.Promotion{}
+	if err := cur.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+func (r *mongoPromotionRepository) Count(ctx context.Context) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{})
+}
+
+func (r *mongoPromotionRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) (int64, error) {
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func (r *mongoPromotionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoPromotionRepository) IncrementRedemptions(ctx context.Context, id primitive.ObjectID, max int64) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, redemptionFilter(id, max), bson.M{"$inc": bson.M{"redemptions": 1}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+type mongoUsageRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoUsageRepository(db *mongo.Database) UsageRepository {
+	return &mongoUsageRepository{col: db.Collection("promotion_usage")}
+}
+
+func (r *mongoUsageRepository) Increment(ctx context.Context, promotionID, userID primitive.ObjectID, max int64) (bool, error) {
+	// At the cap the filter no longer matches and the upsert collides with
+	// the existing counter
+	filter := bson.M{"_id": usageID(promotionID, userID)}
+	if max > 0 {
+		filter["count"] = bson.M{"$lt": max}
+	}
+	_, err := r.col.UpdateOne(ctx, filter,
+		bson.M{"$inc": bson.M{"count": 1}, "$setOnInsert": bson.M{"promotion_id": promotionID, "user_id": userID}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type mongoRedemptionRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoRedemptionRepository(db *mongo.Database) RedemptionRepository {
+	return &mongoRedemptionRepository{col: db.Collection("promotion_redemptions")}
+}
+
+func (r *mongoRedemptionRepository) Insert(ctx context.Context, redemption *models.Redemption) error {
+	_, err := r.col.InsertOne(ctx, redemption)
+	return err
+}
@@ -0,0 +1,61 @@
+// Package repository stores promotions and their redemptions. The MongoDB
+// implementations are used by the API and the in-memory ones by tests; a
+// missing promotion gives mongo.ErrNoDocuments from both.
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindOptions pages a listing of promotions, newest first; a zero Limit
+// returns every promotion
+type FindOptions struct {
+	Skip  int64
+	Limit int64
+}
+
+// PromotionRepository stores the promotions collection
+type PromotionRepository interface {
+	Insert(ctx context.Context, p *models.Promotion) error
+	FindOne(ctx context.Context, filter bson.M) (*models.Promotion, error)
+	Find(ctx context.Context, opts FindOptions) ([]models.Promotion, error)
+	Count(ctx context.Context) (int64, error)
+	// Update sets fields of the promotion and returns how many matched
+	Update(ctx context.Context, id primitive.ObjectID, set bson.M) (int64, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// IncrementRedemptions counts one redemption of an active promotion
+	// that has fewer than max (no cap when 0), in a single conditional
+	// update. It reports false when the promotion is inactive or at the cap.
+	IncrementRedemptions(ctx context.Context, id primitive.ObjectID, max int64) (bool, error)
+}
+
+// UsageRepository stores the promotion_usage collection: one counter per
+// promotion and user
+type UsageRepository interface {
+	// Increment counts one use of a promotion by a user that used it fewer
+	// than max times (no cap when 0), atomically. It reports false at the cap.
+	Increment(ctx context.Context, promotionID, userID primitive.ObjectID, max int64) (bool, error)
+}
+
+// RedemptionRepository stores the promotion_redemptions collection
+type RedemptionRepository interface {
+	Insert(ctx context.Context, r *models.Redemption) error
+}
+
+// usageID keys the usage counter of a promotion by a user
+func usageID(promotionID, userID primitive.ObjectID) string {
+	return promotionID.Hex() + ":" + userID.Hex()
+}
+
+// redemptionFilter matches a promotion that can be redeemed once more
+func redemptionFilter(id primitive.ObjectID, max int64) bson.M {
+	filter := bson.M{"_id": id, "active": true}
+	if max > 0 {
+		filter["redemptions"] = bson.M{"$lt": max}
+	}
+	return filter
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrPromotionNotFound      = errors.New("promotion code not found")
+	ErrPromotionNotApplicable = errors.New("promotion code does not apply to this order")
+	ErrPromotionExhausted     = errors.New("promotion code has reached its usage limit")
+)
+
+// Cart is what a promotion is checked against, priced in the default currency
+type Cart struct {
+	OrderTypeID  primitive.ObjectID
+	OrderLevelID primitive.ObjectID
+	Subtotal     float64
+}
+
+// PromotionService manages discount codes and counts their redemptions
+type PromotionService struct {
+	promotions  repository.PromotionRepository
+	usage       repository.UsageRepository
+	redemptions repository.RedemptionRepository
+}
+
+// PromotionServiceDeps are the stores a PromotionService works with; see
+// NewPromotionServiceWith
+type PromotionServiceDeps struct {
+	Promotions  repository.PromotionRepository
+	Usage       repository.UsageRepository
+	Redemptions repository.RedemptionRepository
+}
+
+func NewPromotionService(db *mongo.Database) *PromotionService {
+	return NewPromotionServiceWith(PromotionServiceDeps{
+		Promotions:  repository.NewMongoPromotionRepository(db),
+		Usage:       repository.NewMongoUsageRepository(db),
+		Redemptions: repository.NewMongoRedemptionRepository(db),
+	})
+}
+
+// NewPromotionServiceWith builds the service on deps, e.g. in-memory stores in tests
+func NewPromotionServiceWith(deps PromotionServiceDeps) *PromotionService {
+	return &PromotionService{
+		promotions:  deps.Promotions,
+		usage:       deps.Usage,
+		redemptions: deps.Redemptions,
+	}
+}
+
+// NormalizeCode makes codes case and whitespace insensitive
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidatePromotion checks the admin supplied fields of a promotion
+func ValidatePromotion(p *models.Promotion) error {
+	p.Code = NormalizeCode(p.Code)
+	if p.Code == "" {
+		return errors.New("code is required")
+	}
+	switch p.Kind {
+	case models.KindPercentage:
+		if p.Value <= 0 || p.Value > 100 {
+			return errors.New("a percentage must be greater than 0 and at most 100")
+		}
+	case models.KindFixed:
+		if p.Value <= 0 {
+			return errors.New("a fixed discount must be greater than 0")
+		}
+	default:
+		return errors.New("kind must be one of percentage, fixed")
+	}
+	if p.MinOrderValue < 0 || p.MaxRedemptions < 0 || p.MaxPerUser < 0 {
+		return errors.New("min_order_value and usage caps must not be negative")
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+func (s *PromotionService) Create(p *models.Promotion) error {
+	if err := ValidatePromotion(p); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.promotions.FindOne(ctx, bson.M{"code": p.Code}); err == nil {
+		return errors.New("a promotion already exists with code " + p.Code)
+	}
+	now := time.Now()
+	p.ID = primitive.NewObjectID()
+	p.Redemptions = 0
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	return s.promotions.Insert(ctx, p)
+}
+
+// List returns promotions, newest first
+func (s *PromotionService) List(page, pageSize int) ([]models.Promotion, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	total, err := s.promotions.Count(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	promotions, err := s.promotions.Find(ctx, repository.FindOptions{
+		Skip:  int64((page - 1) * pageSize),
+		Limit: int64(pageSize),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return promotions, total, nil
+}
+
+func (s *PromotionService) GetByID(id primitive.ObjectID) (*models.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := s.promotions.FindOne(ctx, bson.M{"_id": id})
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPromotionNotFound
+	}
+	return p, err
+}
+
+// Update replaces the admin editable fields; the redemption counter is kept
+func (s *PromotionService) Update(id primitive.ObjectID, p *models.Promotion) error {
+	if err := ValidatePromotion(p); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.promotions.FindOne(ctx, bson.M{"code": p.Code, "_id": bson.M{"$ne": id}}); err == nil {
+		return errors.New("a promotion already exists with code " + p.Code)
+	}
+	matched, err := s.promotions.Update(ctx, id, bson.M{
+		"code":            p.Code,
+		"description":     p.Description,
+		"kind":            p.Kind,
+		"value":           p.Value,
+		"min_order_value": p.MinOrderValue,
+		"starts_at":       p.StartsAt,
+		"ends_at":         p.EndsAt,
+		"max_redemptions": p.MaxRedemptions,
+		"max_per_user":    p.MaxPerUser,
+		"order_type_ids":  p.OrderTypeIDs,
+		"order_level_ids": p.OrderLevelIDs,
+		"active":          p.Active,
+		"updated_at":      time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrPromotionNotFound
+	}
+	return nil
+}
+
+func (s *PromotionService) Delete(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.promotions.Delete(ctx, id)
+}
+
+// Lookup finds an active promotion by code
+func (s *PromotionService) Lookup(code string) (*models.Promotion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := s.promotions.FindOne(ctx, bson.M{"code": NormalizeCode(code), "active": true})
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPromotionNotFound
+	}
+	return p, err
+}
+
+// Apply works out the discount p gives cart at now, or why it does not apply.
+// The discount never exceeds the subtotal.
+func Apply(p *models.Promotion, cart Cart, now time.Time) (*models.AppliedPromotion, error) {
+	switch {
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return nil, fmt.Errorf("%w: not valid before %s", ErrPromotionNotApplicable, p.StartsAt.Format(time.RFC3339))
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return nil, fmt.Errorf("%w: expired", ErrPromotionNotApplicable)
+	case cart.Subtotal < p.MinOrderValue:
+		return nil, fmt.Errorf("%w: minimum order value is %.2f", ErrPromotionNotApplicable, p.MinOrderValue)
+	case len(p.OrderTypeIDs) > 0 && !containsID(p.OrderTypeIDs, cart.OrderTypeID):
+		return nil, fmt.Errorf("%w: not valid for this order type", ErrPromotionNotApplicable)
+	case len(p.OrderLevelIDs) > 0 && !containsID(p.OrderLevelIDs, cart.OrderLevelID):
+		return nil, fmt.Errorf("%w: not valid for this order level", ErrPromotionNotApplicable)
+	case p.MaxRedemptions > 0 && p.Redemptions >= p.MaxRedemptions:
+		return nil, ErrPromotionExhausted
+	}
+	amount := p.Value
+	if p.Kind == models.KindPercentage {
+		amount = cart.Subtotal * p.Value / 100
+	}
+	amount = math.Min(money.Round(amount, money.DefaultCurrency()), cart.Subtotal)
+	return &models.AppliedPromotion{
+		PromotionID: p.ID,
+		Code:        p.Code,
+		Kind:        p.Kind,
+		Value:       p.Value,
+		Amount:      amount,
+	}, nil
+}
+
+// Redeem counts one use of an applied promotion by userID's order. Both caps
+// are enforced by the filters of the increments themselves, so concurrent
+// checkouts can never redeem more than allowed. Run it inside the transaction
+// that creates the order: a redemption refused by the per-user cap has
+// already been counted against the global one.
+func (s *PromotionService) Redeem(ctx context.Context, applied *models.AppliedPromotion, userID, orderID primitive.ObjectID) error {
+	p, err := s.promotions.FindOne(ctx, bson.M{"_id": applied.PromotionID, "active": true})
+	if err == mongo.ErrNoDocuments {
+		return ErrPromotionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	counted, err := s.promotions.IncrementRedemptions(ctx, p.ID, p.MaxRedemptions)
+	if err != nil {
+		return err
+	}
+	if !counted {
+		return ErrPromotionExhausted
+	}
+	counted, err = s.usage.Increment(ctx, p.ID, userID, p.MaxPerUser)
+	if err != nil {
+		return err
+	}
+	if !counted {
+		return fmt.Errorf("%w: already used %d time(s)", ErrPromotionExhausted, p.MaxPerUser)
+	}
+
+	return s.redemptions.Insert(ctx, &models.Redemption{
+		ID:          primitive.NewObjectID(),
+		PromotionID: p.ID,
+		Code:        p.Code,
+		UserID:      userID,
+		OrderID:     orderID,
+		Amount:      applied.Amount,
+		CreatedAt:   time.Now(),
+	})
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newPromotion stores an active 10% promotion with the given caps
+func newPromotion(t *testing.T, maxRedemptions, maxPerUser int64) (*database.MemoryStore, *PromotionService, *models.AppliedPromotion) {
+	t.Helper()
+	store := database.NewMemoryStore()
+	s := NewPromotionServiceWith(PromotionServiceDeps{
+		Promotions:  repository.NewMemoryPromotionRepository(store),
+		Usage:       repository.NewMemoryUsageRepository(store),
+		Redemptions: repository.NewMemoryRedemptionRepository(store),
+	})
+	p := &models.Promotion{
+		Code:           "spring10",
+		Kind:           models.KindPercentage,
+		Value:          10,
+		MaxRedemptions: maxRedemptions,
+		MaxPerUser:     maxPerUser,
+		Active:         true,
+	}
+	if err := s.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	return store, s, &models.AppliedPromotion{PromotionID: p.ID, Code: p.Code, Kind: p.Kind, Value: p.Value, Amount: 4.25}
+}
+
+// redeem runs Redeem in a transaction, like the order checkout does
+func redeem(store *database.MemoryStore, s *PromotionService, applied *models.AppliedPromotion, userID primitive.ObjectID) error {
+	return store.WithTransaction(context.Background(), func(ctx context.Context) error {
+		return s.Redeem(ctx, applied, userID, primitive.NewObjectID())
+	})
+}
+
+// checkRedemptions compares the promotion's counter and stored redemptions with want
+func checkRedemptions(t *testing.T, store *database.MemoryStore, s *PromotionService, applied *models.AppliedPromotion, want int64) {
+	t.Helper()
+	p, err := s.GetByID(applied.PromotionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Redemptions != want {
+		t.Errorf("promotion counts %d redemptions, want %d", p.Redemptions, want)
+	}
+	if n := store.Count("promotion_redemptions", bson.M{"promotion_id": applied.PromotionID}); n != want {
+		t.Errorf("%d redemptions stored, want %d", n, want)
+	}
+}
+
+func TestRedeemGlobalCap(t *testing.T) {
+	store, s, applied := newPromotion(t, 2, 0)
+	for i := 0; i < 2; i++ {
+		if err := redeem(store, s, applied, primitive.NewObjectID()); err != nil {
+			t.Fatalf("redemption %d: %v", i+1, err)
+		}
+	}
+	if err := redeem(store, s, applied, primitive.NewObjectID()); !errors.Is(err, ErrPromotionExhausted) {
+		t.Errorf("third redemption = %v, want ErrPromotionExhausted", err)
+	}
+	checkRedemptions(t, store, s, applied, 2)
+
+	p, _ := s.GetByID(applied.PromotionID)
+	if _, err := Apply(p, Cart{Subtotal: 100}, p.CreatedAt); !errors.Is(err, ErrPromotionExhausted) {
+		t.Errorf("Apply of an exhausted promotion = %v, want ErrPromotionExhausted", err)
+	}
+}
+
+func TestRedeemPerUserCap(t *testing.T) {
+	store, s, applied := newPromotion(t, 0, 2)
+	user := primitive.NewObjectID()
+	for i := 0; i < 2; i++ {
+		if err := redeem(store, s, applied, user); err != nil {
+			t.Fatalf("redemption %d: %v", i+1, err)
+		}
+	}
+	if err := redeem(store, s, applied, user); !errors.Is(err, ErrPromotionExhausted) {
+		t.Errorf("third redemption by one user = %v, want ErrPromotionExhausted", err)
+	}
+	if err := redeem(store, s, applied, primitive.NewObjectID()); err != nil {
+		t.Errorf("redemption by another user = %v", err)
+	}
+	// The refused redemption rolled back its global count
+	checkRedemptions(t, store, s, applied, 3)
+}
+
+func TestRedeemRequiresActivePromotion(t *testing.T) {
+	store, s, applied := newPromotion(t, 0, 0)
+	p, _ := s.GetByID(applied.PromotionID)
+	p.Active = false
+	if err := s.Update(p.ID, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := redeem(store, s, applied, primitive.NewObjectID()); !errors.Is(err, ErrPromotionNotFound) {
+		t.Errorf("Redeem of an inactive promotion = %v, want ErrPromotionNotFound", err)
+	}
+	checkRedemptions(t, store, s, applied, 0)
+}
+
+func TestConcurrentRedemptionsRespectGlobalCap(t *testing.T) {
+	store, s, applied := newPromotion(t, 5, 0)
+
+	const checkouts = 20
+	var wg sync.WaitGroup
+	errs := make([]error, checkouts)
+	for i := 0; i < checkouts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// No transaction: the conditional increment alone holds the cap
+			errs[i] = s.Redeem(context.Background(), applied, primitive.NewObjectID(), primitive.NewObjectID())
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrPromotionExhausted):
+			t.Errorf("Redeem = %v, want nil or ErrPromotionExhausted", err)
+		}
+	}
+	if succeeded != 5 {
+		t.Errorf("%d of %d concurrent redemptions succeeded, want the cap of 5", succeeded, checkouts)
+	}
+	checkRedemptions(t, store, s, applied, 5)
+}
+
+func TestConcurrentRedemptionsRespectPerUserCap(t *testing.T) {
+	store, s, applied := newPromotion(t, 0, 1)
+	user := primitive.NewObjectID()
+
+	const checkouts = 10
+	var wg sync.WaitGroup
+	errs := make([]error, checkouts)
+	for i := 0; i < checkouts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = redeem(store, s, applied, user)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrPromotionExhausted):
+			t.Errorf("Redeem = %v, want nil or ErrPromotionExhausted", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d of %d concurrent redemptions by one user succeeded, want 1", succeeded, checkouts)
+	}
+	checkRedemptions(t, store, s, applied, 1)
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaxRate is the sales tax or VAT charged to clients billed in a country, or
+// in one region of it (tax_rates collection). A rate without a region is the
+// country's default. ReverseCharge marks rates that business clients with a
+// valid VAT ID do not pay, e.g. VAT between EU member states.
+// e.g., {"country": "DE", "name": "VAT", "rate": 19, "reverse_charge": true}
+// e.g., {"country": "US", "region": "NY", "name": "Sales tax", "rate": 4}
+type TaxRate struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Country       string             `bson:"country" json:"country" binding:"required"` // ISO 3166-1 alpha-2, stored upper case
+	Region        string             `bson:"region,omitempty" json:"region,omitempty"`
+	Name          string             `bson:"name" json:"name"`
+	Rate          float64            `bson:"rate" json:"rate"` // percent
+	ReverseCharge bool               `bson:"reverse_charge" json:"reverse_charge"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Billing is who a client is billed as. It is saved on the user and may be
+// overridden per order at checkout.
+// e.g., {"country": "FR", "company": "Acme SARL", "vat_id": "FR40303265045"}
+type Billing struct {
+	Country string `bson:"country" json:"country"`
+	Region  string `bson:"region,omitempty" json:"region,omitempty"`
+	Company string `bson:"company,omitempty" json:"company,omitempty"`
+	VATID   string `bson:"vat_id,omitempty" json:"vat_id,omitempty"`
+	Address string `bson:"address,omitempty" json:"address,omitempty"`
+}
+
+// AppliedTax is the tax charged on one quote or order. A reverse charged
+// order keeps the rate it would have paid, with a zero amount.
+// e.g., {"country": "DE", "name": "VAT", "rate": 19, "taxable": 42.5, "amount": 8.08}
+type AppliedTax struct {
+	Country       string  `bson:"country" json:"country"`
+	Region        string  `bson:"region,omitempty" json:"region,omitempty"`
+	Name          string  `bson:"name" json:"name"`
+	Rate          float64 `bson:"rate" json:"rate"`
+	Taxable       float64 `bson:"taxable" json:"taxable"`
+	Amount        float64 `bson:"amount" json:"amount"`
+	ReverseCharge bool    `bson:"reverse_charge,omitempty" json:"reverse_charge,omitempty"`
+	VATID         string  `bson:"vat_id,omitempty" json:"vat_id,omitempty"`
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrTaxRateNotFound = errors.New("tax rate not found")
+
+// TaxService keeps the tax rate table and works out the tax of an order.
+// The seller's own country comes from TAX_HOME_COUNTRY; domestic business
+// clients are never reverse charged.
+type TaxService struct {
+	col         *mongo.Collection
+	homeCountry string
+}
+
+func NewTaxService(db *mongo.Database) *TaxService {
+	return &TaxService{
+		col:         db.Collection("tax_rates"),
+		homeCountry: strings.ToUpper(os.Getenv("TAX_HOME_COUNTRY")),
+	}
+}
+
+// ValidateTaxRate checks the admin supplied fields of a rate
+func ValidateTaxRate(r *models.TaxRate) error {
+	r.Country = strings.ToUpper(strings.TrimSpace(r.Country))
+	r.Region = strings.ToUpper(strings.TrimSpace(r.Region))
+	r.Name = strings.TrimSpace(r.Name)
+	if !countryPattern.MatchString(r.Country) {
+		return ErrInvalidCountry
+	}
+	if r.Name == "" {
+		r.Name = "VAT"
+	}
+	if r.Rate < 0 || r.Rate > 100 {
+		return errors.New("rate must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+func (s *TaxService) Create(r *models.TaxRate) error {
+	if err := ValidateTaxRate(r); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.col.FindOne(ctx, bson.M{"country": r.Country, "region": regionFilter(r.Region)}).Err() == nil {
+		return errors.New("a tax rate already exists for " + place(r.Country, r.Region))
+	}
+	r.ID = primitive.NewObjectID()
+	r.UpdatedAt = time.Now()
+	_, err := s.col.InsertOne(ctx, r)
+	return err
+}
+
+// List returns the rate table sorted by country and region
+func (s *TaxService) List(page, pageSize int) ([]models.TaxRate, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	total, err := s.col.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetSort(bson.D{{Key: "country", Value: 1}, {Key: "region", Value: 1}})
+	cur, err := s.col.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	rates := []models.TaxRate{}
+	if err := cur.All(ctx, &rates); err != nil {
+		return nil, 0, err
+	}
+	return rates, total, nil
+}
+
+func (s *TaxService) GetByID(id primitive.ObjectID) (*models.TaxRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var r models.TaxRate
+	if err := s.col.FindOne(ctx, bson.M{"_id": id}).Decode(&r); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTaxRateNotFound
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *TaxService) Update(id primitive.ObjectID, r *models.TaxRate) error {
+	if err := ValidateTaxRate(r); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.col.FindOne(ctx, bson.M{"country": r.Country, "region": regionFilter(r.Region), "_id": bson.M{"$ne": id}}).Err() == nil {
+		return errors.New("a tax rate already exists for " + place(r.Country, r.Region))
+	}
+	res, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"country":        r.Country,
+		"region":         r.Region,
+		"name":           r.Name,
+		"rate":           r.Rate,
+		"reverse_charge": r.ReverseCharge,
+		"updated_at":     time.Now(),
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrTaxRateNotFound
+	}
+	return nil
+}
+
+func (s *TaxService) Delete(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// Calculate works out the tax on taxable, an amount in currency, for a client
+// billed as billing. The region's rate is preferred over the country's; a
+// country without a rate is not taxed and gives a nil result.
+func (s *TaxService) Calculate(billing *models.Billing, taxable float64, currency string) (*models.AppliedTax, error) {
+	if billing == nil || billing.Country == "" {
+		return nil, nil
+	}
+	if err := NormalizeBilling(billing); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := options.FindOne().SetSort(bson.D{{Key: "region", Value: -1}})
+	var rate models.TaxRate
+	err := s.col.FindOne(ctx, bson.M{
+		"country": billing.Country,
+		"region":  bson.M{"$in": bson.A{billing.Region, "", nil}},
+	}, opts).Decode(&rate)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Compute(&rate, billing, taxable, currency, s.homeCountry), nil
+}
+
+// Compute applies rate to taxable, rounding to the minor unit of currency.
+// Business clients with a VAT ID are reverse charged when the rate allows it
+// and they are not in homeCountry.
+func Compute(rate *models.TaxRate, billing *models.Billing, taxable float64, currency, homeCountry string) *models.AppliedTax {
+	applied := &models.AppliedTax{
+		Country: rate.Country,
+		Region:  rate.Region,
+		Name:    rate.Name,
+		Rate:    rate.Rate,
+		Taxable: taxable,
+		VATID:   billing.VATID,
+	}
+	if rate.ReverseCharge && billing.VATID != "" && billing.Country != homeCountry {
+		applied.ReverseCharge = true
+		return applied
+	}
+	applied.Amount = money.Round(taxable*rate.Rate/100, currency)
+	return applied
+}
+
+// regionFilter matches a country's default rate whether region was stored empty or not at all
+func regionFilter(region string) interface{} {
+	if region == "" {
+		return bson.M{"$in": bson.A{"", nil}}
+	}
+	return region
+}
+
+func place(country, region string) string {
+	if region == "" {
+		return country
+	}
+	return country + "-" + region
+}
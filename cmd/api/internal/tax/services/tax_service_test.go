@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+)
+
+func TestCompute(t *testing.T) {
+	vat := &models.TaxRate{Country: "DE", Name: "VAT", Rate: 19, ReverseCharge: true}
+	salesTax := &models.TaxRate{Country: "US", Region: "NY", Name: "Sales tax", Rate: 4}
+	for _, tc := range []struct {
+		name          string
+		rate          *models.TaxRate
+		billing       models.Billing
+		taxable       float64
+		currency      string
+		homeCountry   string
+		wantAmount    float64
+		reverseCharge bool
+	}{
+		{"consumer", vat, models.Billing{Country: "DE"}, 42.5, "EUR", "FR", 8.08, false},
+		{"business abroad is reverse charged", vat, models.Billing{Country: "DE", VATID: "DE123456789"}, 42.5, "EUR", "FR", 0, true},
+		{"business at home pays", vat, models.Billing{Country: "DE", VATID: "DE123456789"}, 42.5, "EUR", "DE", 8.08, false},
+		{"rate without reverse charge", salesTax, models.Billing{Country: "US", Region: "NY", VATID: "123456"}, 99.99, "USD", "", 4, false},
+		{"rounds half up", vat, models.Billing{Country: "DE"}, 0.5, "EUR", "", 0.1, false},
+		{"zero-decimal currency", vat, models.Billing{Country: "DE"}, 1234, "JPY", "", 234, false},
+		{"three-decimal currency", vat, models.Billing{Country: "DE"}, 10.005, "KWD", "", 1.901, false},
+		{"zero rate", &models.TaxRate{Country: "GB", Name: "VAT", Rate: 0}, models.Billing{Country: "GB"}, 50, "GBP", "", 0, false},
+	} {
+		billing := tc.billing
+		applied := Compute(tc.rate, &billing, tc.taxable, tc.currency, tc.homeCountry)
+		if applied.Amount != tc.wantAmount || applied.ReverseCharge != tc.reverseCharge {
+			t.Errorf("%s: amount %v reverse charge %v, want %v %v", tc.name, applied.Amount, applied.ReverseCharge, tc.wantAmount, tc.reverseCharge)
+		}
+		if applied.Rate != tc.rate.Rate || applied.Taxable != tc.taxable || applied.Country != tc.rate.Country || applied.VATID != billing.VATID {
+			t.Errorf("%s: applied = %+v does not record the rate and billing", tc.name, applied)
+		}
+	}
+}
+
+func TestValidateTaxRate(t *testing.T) {
+	rate := models.TaxRate{Country: " de ", Region: " by ", Rate: 19}
+	if err := ValidateTaxRate(&rate); err != nil {
+		t.Fatal(err)
+	}
+	if rate.Country != "DE" || rate.Region != "BY" || rate.Name != "VAT" {
+		t.Errorf("rate = %+v, want country DE, region BY and name VAT", rate)
+	}
+	for _, bad := range []models.TaxRate{
+		{Country: "Germany", Rate: 19},
+		{Country: "DE", Rate: -1},
+		{Country: "DE", Rate: 101},
+	} {
+		if err := ValidateTaxRate(&bad); err == nil {
+			t.Errorf("ValidateTaxRate(%+v) accepted an invalid rate", bad)
+		}
+	}
+}
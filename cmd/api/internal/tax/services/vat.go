@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+)
+
+var (
+	ErrInvalidCountry = errors.New("country must be an ISO 3166-1 alpha-2 code")
+	ErrInvalidVATID   = errors.New("VAT ID is not valid")
+)
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// vatFormats are the VAT ID formats of the EU member states and the UK,
+// without the country prefix. Only the format is checked, not whether the
+// number was issued.
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`),
+	"GB": regexp.MustCompile(`^(\d{9}|\d{12}|GD\d{3}|HA\d{3})$`),
+	"GR": regexp.MustCompile(`^\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^\d{2,10}$`),
+	"SE": regexp.MustCompile(`^\d{12}$`),
+	"SI": regexp.MustCompile(`^\d{8}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+}
+
+// otherVATFormat is accepted for countries without a known format
+var otherVATFormat = regexp.MustCompile(`^[A-Z0-9]{4,20}$`)
+
+// vatPrefixes are the VAT ID prefixes that differ from the ISO country code
+var vatPrefixes = map[string]string{"GR": "EL"}
+
+// NormalizeBilling upper-cases the country and region and checks the VAT ID
+// format for the country, storing it as e.g. "DE123456789"
+func NormalizeBilling(b *models.Billing) error {
+	b.Country = strings.ToUpper(strings.TrimSpace(b.Country))
+	b.Region = strings.ToUpper(strings.TrimSpace(b.Region))
+	if !countryPattern.MatchString(b.Country) {
+		return ErrInvalidCountry
+	}
+	if strings.TrimSpace(b.VATID) == "" {
+		b.VATID = ""
+		return nil
+	}
+	vatID, err := NormalizeVATID(b.Country, b.VATID)
+	if err != nil {
+		return err
+	}
+	b.VATID = vatID
+	return nil
+}
+
+// NormalizeVATID strips separators and the country prefix from id, checks it
+// against the country's format and returns it with the prefix
+func NormalizeVATID(country, id string) (string, error) {
+	prefix := country
+	if p, ok := vatPrefixes[country]; ok {
+		prefix = p
+	}
+	id = strings.ToUpper(id)
+	id = strings.NewReplacer(" ", "", "-", "", ".", "").Replace(id)
+	id = strings.TrimPrefix(id, prefix)
+
+	format, ok := vatFormats[country]
+	if !ok {
+		format = otherVATFormat
+	}
+	if !format.MatchString(id) {
+		return "", fmt.Errorf("%w for %s", ErrInvalidVATID, country)
+	}
+	return prefix + id, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+)
+
+func TestNormalizeVATID(t *testing.T) {
+	for _, tc := range []struct {
+		country string
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{"DE", "123456789", "DE123456789", false},
+		{"DE", "de 123 456 789", "DE123456789", false},
+		{"DE", "DE-123.456.789", "DE123456789", false},
+		{"DE", "12345678", "", true},
+		{"FR", "FR40303265045", "FR40303265045", false},
+		{"FR", "IO303265045", "", true},
+		{"AT", "U12345678", "ATU12345678", false},
+		{"AT", "12345678", "", true},
+		{"NL", "123456789B01", "NL123456789B01", false},
+		{"NL", "123456789A01", "", true},
+		{"IE", "1234567WA", "IE1234567WA", false},
+		{"IE", "1A23456B", "IE1A23456B", false},
+		{"GB", "GD123", "GBGD123", false},
+		{"GB", "123456789012", "GB123456789012", false},
+		{"GR", "EL123456789", "EL123456789", false},
+		{"GR", "123456789", "EL123456789", false},
+		{"GR", "GR123456789", "", true},
+		{"CH", "CHE-123.456.789", "CHE123456789", false},
+		{"US", "12", "", true},
+	} {
+		got, err := NormalizeVATID(tc.country, tc.id)
+		if tc.wantErr {
+			if !errors.Is(err, ErrInvalidVATID) {
+				t.Errorf("NormalizeVATID(%s, %q) = %q, %v, want ErrInvalidVATID", tc.country, tc.id, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("NormalizeVATID(%s, %q) = %q, %v, want %q", tc.country, tc.id, got, err, tc.want)
+		}
+	}
+}
+
+func TestNormalizeBilling(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		billing models.Billing
+		want    models.Billing
+		wantErr error
+	}{
+		{
+			name:    "upper-cases country and region",
+			billing: models.Billing{Country: " us ", Region: "ny"},
+			want:    models.Billing{Country: "US", Region: "NY"},
+		},
+		{
+			name:    "normalizes the VAT ID",
+			billing: models.Billing{Country: "de", Company: "Acme GmbH", VATID: "123 456 789"},
+			want:    models.Billing{Country: "DE", Company: "Acme GmbH", VATID: "DE123456789"},
+		},
+		{
+			name:    "blank VAT ID is dropped",
+			billing: models.Billing{Country: "DE", VATID: "  "},
+			want:    models.Billing{Country: "DE"},
+		},
+		{
+			name:    "invalid country",
+			billing: models.Billing{Country: "DEU"},
+			wantErr: ErrInvalidCountry,
+		},
+		{
+			name:    "missing country",
+			billing: models.Billing{VATID: "DE123456789"},
+			wantErr: ErrInvalidCountry,
+		},
+		{
+			name:    "VAT ID of another format",
+			billing: models.Billing{Country: "DE", VATID: "FR40303265045"},
+			wantErr: ErrInvalidVATID,
+		},
+	} {
+		billing := tc.billing
+		err := NormalizeBilling(&billing)
+		if tc.wantErr != nil {
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s: err = %v, want %v", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || billing != tc.want {
+			t.Errorf("%s: billing = %+v, %v, want %+v", tc.name, billing, err, tc.want)
+		}
+	}
+}
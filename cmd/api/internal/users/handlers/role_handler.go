@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
 	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type RoleHandler struct {
@@ -24,7 +26,7 @@ func (h *RoleHandler) Create(c *gin.Context) {
 		return
 	}
 	if err := h.service.Create(&role); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondRoleError(c, err, err.Error())
 		return
 	}
 	c.JSON(http.StatusCreated, role)
@@ -65,7 +67,7 @@ func (h *RoleHandler) Update(c *gin.Context) {
 		return
 	}
 	if err := h.service.Update(id, update); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondRoleError(c, err, err.Error())
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Role updated"})
@@ -83,3 +85,66 @@ func (h *RoleHandler) Delete(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
 }
+
+// ListPermissions lists every permission a role can be granted
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": models.Permissions})
+}
+
+type grantPermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required,min=1"`
+}
+
+// GrantPermissions adds permissions to a role
+func (h *RoleHandler) GrantPermissions(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	var req grantPermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.GrantPermissions(id, req.Permissions); err != nil {
+		respondRoleError(c, err, "Failed to grant permissions")
+		return
+	}
+	h.respondRole(c, id)
+}
+
+// RevokePermission takes a permission away from a role
+func (h *RoleHandler) RevokePermission(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	if err := h.service.RevokePermission(id, c.Param("permission")); err != nil {
+		respondRoleError(c, err, "Failed to revoke permission")
+		return
+	}
+	h.respondRole(c, id)
+}
+
+func (h *RoleHandler) respondRole(c *gin.Context, id primitive.ObjectID) {
+	role, err := h.service.GetByID(id)
+	if err != nil {
+		respondRoleError(c, err, "Failed to load role")
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+func respondRoleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, userservices.ErrUnknownPermission), errors.Is(err, userservices.ErrPermissionsField),
+		errors.Is(err, userservices.ErrRequireMFAField):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -1,71 +1,124 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	currencyservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/models"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
+	pricingmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/models"
+	pricingservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/services"
+	promoservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/services"
+	taxmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+	taxservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/services"
 	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Quoter prices an order from the rate tables, e.g. a QuoteService
+type Quoter interface {
+	QuoteOrder(order *models.Order) (*pricingmodels.PriceBreakdown, error)
+}
+
+// CreateOrderRequest holds the fields a client chooses when placing an order.
+// The ID, price, status, writer, submission and feedback are the server's.
+// Currency is the one to be charged in and defaults to the one prices are
+// configured in; billing details default to the client's saved ones.
+type CreateOrderRequest struct {
+	OrderTypeID                primitive.ObjectID `json:"order_type_id"`
+	Title                      string             `json:"title"`
+	Description                string             `json:"description"`
+	OrderLevelID               primitive.ObjectID `json:"order_level_id" binding:"required"`
+	OrderPagesID               primitive.ObjectID `json:"order_pages_id" binding:"required"`
+	OrderUrgencyID             primitive.ObjectID `json:"order_urgency_id" binding:"required"`
+	OrderStyleID               primitive.ObjectID `json:"order_style_id" binding:"required"`
+	OrderLanguageID            primitive.ObjectID `json:"order_language_id" binding:"required"`
+	IsHighPriority             bool               `json:"is_high_priority"`
+	TopWriter                  bool               `json:"top_writer"`
+	PlagarismReport            bool               `json:"plagarism_report"`
+	OnePageSummary             bool               `json:"one_page_summary"`
+	ExtraQualityCheck          bool               `json:"extra_quality_check"`
+	InitialDraft               bool               `json:"initial_draft"`
+	SmsUpdate                  bool               `json:"sms_update"`
+	FullTextCopySources        bool               `json:"full_text_copy_sources"`
+	SamePaperFromAnotherWriter bool               `json:"same_paper_from_another_writer"`
+	PreferredWriterNumber      *string            `json:"preferred_writer_number,omitempty"`
+	OriginalOrderFile          *string            `json:"original_order_file,omitempty"`
+	PromoCode                  string             `json:"promo_code"`
+	Billing                    *taxmodels.Billing `json:"billing,omitempty"`
+	Currency                   string             `json:"currency,omitempty"`
+}
+
+// order is the new order of user the request describes
+func (r *CreateOrderRequest) order(userID primitive.ObjectID) models.Order {
+	return models.Order{
+		UserID:                     userID,
+		OrderTypeID:                r.OrderTypeID,
+		Title:                      r.Title,
+		Description:                r.Description,
+		OrderLevelID:               r.OrderLevelID,
+		OrderPagesID:               r.OrderPagesID,
+		OrderUrgencyID:             r.OrderUrgencyID,
+		OrderStyleID:               r.OrderStyleID,
+		OrderLanguageID:            r.OrderLanguageID,
+		IsHighPriority:             r.IsHighPriority,
+		TopWriter:                  r.TopWriter,
+		PlagarismReport:            r.PlagarismReport,
+		OnePageSummary:             r.OnePageSummary,
+		ExtraQualityCheck:          r.ExtraQualityCheck,
+		InitialDraft:               r.InitialDraft,
+		SmsUpdate:                  r.SmsUpdate,
+		FullTextCopySources:        r.FullTextCopySources,
+		SamePaperFromAnotherWriter: r.SamePaperFromAnotherWriter,
+		PreferredWriterNumber:      r.PreferredWriterNumber,
+		OriginalOrderFile:          r.OriginalOrderFile,
+		PromoCode:                  r.PromoCode,
+		Billing:                    r.Billing,
+		Currency:                   r.Currency,
+	}
+}
+
 type UserHandler struct {
 	orderService    *services.OrderService
+	orderEnricher   *services.OrderEnricher
+	quoteService    Quoter
 	userService     *userservices.UserService
 	userRoleService *userservices.UserRoleService
 	roleService     *userservices.RoleService
 }
 
-func NewUserHandler(client *mongo.Client, dbName string) *UserHandler {
-	db := client.Database(dbName)
+// NewUserHandlerWith builds the handler on already built services
+func NewUserHandlerWith(orderService *services.OrderService, orderEnricher *services.OrderEnricher, quoter Quoter,
+	userService *userservices.UserService, userRoleService *userservices.UserRoleService, roleService *userservices.RoleService) *UserHandler {
 	return &UserHandler{
-		orderService:    services.NewOrderService(db),
-		userService:     userservices.NewUserService(db),
-		userRoleService: userservices.NewUserRoleService(db),
-		roleService:     userservices.NewRoleService(db),
+		orderService:    orderService,
+		orderEnricher:   orderEnricher,
+		quoteService:    quoter,
+		userService:     userService,
+		userRoleService: userRoleService,
+		roleService:     roleService,
 	}
 }
 
 func (h *UserHandler) CreateOrder(c *gin.Context) {
-	userIDInterface, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in token/context"})
-		return
-	}
-	userID, ok := userIDInterface.(string)
+	userOID, ok := userIDFromContext(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID in context is not a string"})
-		return
-	}
-	userOID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
 		return
 	}
 
-	var order models.Order
-	if err := c.ShouldBindJSON(&order); err != nil {
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Printf("[DEBUG] Incoming order payload: %+v\n", order)
-	// Validate is_high_priority is present in the request (required)
-	if c.Request.Method == "POST" && c.FullPath() == "/api/orders" {
-		if c.PostForm("is_high_priority") == "" && !order.IsHighPriority {
-			// If not present in JSON, and not set to true, default to false
-			order.IsHighPriority = false
-		}
-	}
-	// Enforce that is_high_priority is present (even if false)
-	if c.Request.Method == "POST" && c.FullPath() == "/api/orders" && (order.IsHighPriority != true && order.IsHighPriority != false) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "is_high_priority is required (true or false)"})
-		return
-	}
-	order.UserID = userOID
-	order.WriterID = nil // Set WriterID to nil so it is omitted or null in JSON if not assigned
+	order := req.order(userOID)
 	// Ensure OrderTypeID is provided and valid
 	if order.OrderTypeID.IsZero() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "OrderTypeID is required"})
@@ -81,20 +134,62 @@ func (h *UserHandler) CreateOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "OrderStyleID is required"})
 		return
 	}
-	// Set default values for new boolean fields
-	order.TopWriter = false
-	order.PlagarismReport = false
-	order.OnePageSummary = false
-	order.ExtraQualityCheck = false
-	order.InitialDraft = false
-	order.SmsUpdate = false
-	order.FullTextCopySources = false
-	order.SamePaperFromAnotherWriter = false
-	order.Status = "pending_payment" // Initial status
-	order.NoOfSources = 0
+	// Archived or deleted lookups would otherwise surface as a missing rate
+	if err := h.orderService.ValidateReferences(&order); err != nil {
+		if !respondReferenceError(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate order", "details": err.Error()})
+		}
+		return
+	}
+
+	// Tax follows the billing details given at checkout, else the saved ones
+	if order.Billing == nil {
+		user, err := h.userService.GetUserByID(userOID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load billing details"})
+			return
+		}
+		if err == nil {
+			order.Billing = user.Billing
+		}
+	}
+
+	// Never trust a client supplied price, always quote it from the rate tables
+	breakdown, err := h.quoteService.QuoteOrder(&order)
+	if err != nil {
+		switch {
+		case errors.Is(err, pricingservices.ErrRateNotConfigured), errors.Is(err, taxservices.ErrInvalidCountry),
+			errors.Is(err, money.ErrInvalidCurrency):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, promoservices.ErrPromotionNotFound), errors.Is(err, promoservices.ErrPromotionNotApplicable),
+			errors.Is(err, taxservices.ErrInvalidVATID), errors.Is(err, currencyservices.ErrNoExchangeRate):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, promoservices.ErrPromotionExhausted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price order", "details": err.Error()})
+		}
+		return
+	}
+	order.Price = breakdown.Total
+	order.Currency = breakdown.Currency
+	order.PriceBreakdown = breakdown
+	if breakdown.Promotion != nil {
+		order.PromoCode = breakdown.Promotion.Code
+	}
 
 	if err := h.orderService.CreateOrder(&order); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order", "details": err.Error()})
+		if respondReferenceError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, promoservices.ErrPromotionNotFound):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, promoservices.ErrPromotionExhausted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order", "details": err.Error()})
+		}
 		return
 	}
 
@@ -102,15 +197,9 @@ func (h *UserHandler) CreateOrder(c *gin.Context) {
 }
 
 func (h *UserHandler) GetUserOrders(c *gin.Context) {
-	userIDInterface, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found"})
-		return
-	}
-	userID := userIDInterface.(string)
-	userOID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+	userOID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
 		return
 	}
 
@@ -141,18 +230,10 @@ func (h *UserHandler) GetUserOrders(c *gin.Context) {
 		return
 	}
 	// Enrich order details with related names
-	orderLevelService := services.NewOrderLevelService(h.orderService.GetDB())
-	orders = services.PopulateOrderLevelNames(orders, orderLevelService)
-	orderPagesService := services.NewOrderPagesService(h.orderService.GetDB())
-	orders = services.PopulateOrderPagesNames(orders, orderPagesService)
-	orderUrgencyService := services.NewOrderUrgencyService(h.orderService.GetDB())
-	orders = services.PopulateOrderUrgencyNames(orders, orderUrgencyService)
-	orderStyleService := services.NewOrderStyleService(h.orderService.GetDB())
-	orders = services.PopulateOrderStyleNames(orders, orderStyleService)
-	orderLanguageService := services.NewOrderLanguageService(h.orderService.GetDB())
-	orders = services.PopulateOrderLanguageNames(orders, orderLanguageService)
-	userService := userservices.NewUserService(h.orderService.GetDB())
-	orders = services.PopulateWriterNames(orders, userService)
+	if err := h.orderEnricher.Enrich(orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order details"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"orders":    orders,
@@ -210,3 +291,129 @@ func (h *UserHandler) ListUsersByRole(c *gin.Context) {
 		"page_size": pageSize,
 	})
 }
+
+// Me returns the profile of the logged in user as stored now, with the
+// roles they hold; access tokens only name the user
+func (h *UserHandler) Me(c *gin.Context) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	user, err := h.userService.GetUserByID(principal.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	user.Password = ""
+	user.Roles = principal.Roles
+	c.JSON(http.StatusOK, user)
+}
+
+// GetBilling returns the billing details saved for the logged in user
+func (h *UserHandler) GetBilling(c *gin.Context) {
+	userOID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	user, err := h.userService.GetUserByID(userOID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.Billing == nil {
+		c.JSON(http.StatusOK, taxmodels.Billing{})
+		return
+	}
+	c.JSON(http.StatusOK, user.Billing)
+}
+
+// UpdateBilling saves the country, company and VAT ID orders are taxed by
+// when checkout does not give any
+func (h *UserHandler) UpdateBilling(c *gin.Context) {
+	userOID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	var billing taxmodels.Billing
+	if err := c.ShouldBindJSON(&billing); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := taxservices.NormalizeBilling(&billing); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.userService.UpdateBilling(userOID, &billing); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save billing details"})
+		return
+	}
+	c.JSON(http.StatusOK, billing)
+}
+
+// GetPayoutCurrency returns the currency the writer's earnings are paid out
+// in; writers who never chose one are paid in the default currency
+func (h *UserHandler) GetPayoutCurrency(c *gin.Context) {
+	userOID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	user, err := h.userService.GetUserByID(userOID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	currency := user.PayoutCurrency
+	if currency == "" {
+		currency = money.DefaultCurrency()
+	}
+	c.JSON(http.StatusOK, gin.H{"payout_currency": currency})
+}
+
+// UpdatePayoutCurrency sets the currency the writer's next payouts are
+// converted to. Payouts already made are not affected.
+func (h *UserHandler) UpdatePayoutCurrency(c *gin.Context) {
+	userOID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	var req struct {
+		PayoutCurrency string `json:"payout_currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currency, err := money.NormalizeCurrency(req.PayoutCurrency)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.userService.UpdatePayoutCurrency(userOID, currency); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payout currency"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"payout_currency": currency})
+}
+
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	return principal.UserID, true
+}
+
+// respondReferenceError answers an order referring to a missing or archived
+// lookup with 422; other errors are left to the caller
+func respondReferenceError(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrUnknownReference) && !errors.Is(err, services.ErrArchivedReference) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	return true
+}
@@ -0,0 +1,96 @@
+package models
+
+// Permissions name what a role allows. Routes require permissions rather
+// than role names, so what a role can do is changed by granting and revoking
+// permissions on it.
+const (
+	PermOrdersPlace    = "orders:place"
+	PermFilesUpload    = "files:upload"
+	PermWalletUse      = "wallet:use"
+	PermAccountManage  = "account:manage"
+	PermOrdersRead     = "orders:read"
+	PermOrdersAssign   = "orders:assign"
+	PermOrdersWork     = "orders:work"
+	PermPaymentsRefund = "payments:refund"
+	PermInvoicesRead   = "invoices:read"
+	PermInvoicesWrite  = "invoices:write"
+	PermCatalogRead    = "catalog:read"
+	PermCatalogWrite   = "catalog:write"
+	PermPricingRead    = "pricing:read"
+	PermPricingWrite   = "pricing:write"
+	PermLedgerRead     = "ledger:read"
+	PermPayoutsRead    = "payouts:read"
+	PermPayoutsWrite   = "payouts:write"
+	PermUsersRead      = "users:read"
+	PermUsersWrite     = "users:write"
+	PermRolesRead      = "roles:read"
+	PermRolesWrite     = "roles:write"
+)
+
+// Permission describes a permission for the admin API
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions lists every permission a role can be granted
+var Permissions = []Permission{
+	{PermOrdersPlace, "Place, pay for and review own orders, and read their invoices"},
+	{PermFilesUpload, "Upload files for orders"},
+	{PermWalletUse, "Read and top up own store credit wallet"},
+	{PermAccountManage, "Manage own profile, billing details, sessions and two-factor authentication"},
+	{PermOrdersRead, "List all orders and their history"},
+	{PermOrdersAssign, "Assign orders to writers"},
+	{PermOrdersWork, "Accept, work on and submit assigned orders, and see own earnings"},
+	{PermPaymentsRefund, "Refund paid orders"},
+	{PermInvoicesRead, "Read every invoice"},
+	{PermInvoicesWrite, "Issue credit notes"},
+	{PermCatalogRead, "Read order types, levels, pages, urgency, styles and languages"},
+	{PermCatalogWrite, "Manage order types, levels, pages, urgency, styles and languages"},
+	{PermPricingRead, "Read price rates, promotions, tax rates and exchange rates"},
+	{PermPricingWrite, "Manage price rates, promotions, tax rates and exchange rates"},
+	{PermLedgerRead, "Read ledger accounts and the trial balance"},
+	{PermPayoutsRead, "Read commission rates and payout batches"},
+	{PermPayoutsWrite, "Manage commission rates and payout batches"},
+	{PermUsersRead, "List users and writers"},
+	{PermUsersWrite, "Create, update and delete writer accounts"},
+	{PermRolesRead, "Read roles, permissions and role assignments"},
+	{PermRolesWrite, "Manage roles, their permissions and role assignments"},
+}
+
+// Built-in roles. The super admin holds every permission without being
+// granted any.
+const (
+	RoleUser       = "user"
+	RoleWriter     = "writer"
+	RoleAdmin      = "admin"
+	RoleSuperAdmin = "super_admin"
+)
+
+// DefaultPermissions are given to the built-in roles when they are seeded,
+// matching what each role could do before permissions existed
+var DefaultPermissions = map[string][]string{
+	RoleUser:       {PermOrdersPlace, PermFilesUpload, PermWalletUse, PermAccountManage},
+	RoleWriter:     {PermOrdersWork, PermFilesUpload, PermAccountManage},
+	RoleAdmin:      PermissionNames(),
+	RoleSuperAdmin: {},
+}
+
+// PermissionNames returns the names of every permission
+func PermissionNames() []string {
+	names := make([]string, len(Permissions))
+	for i, p := range Permissions {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// IsPermission tells whether name is a known permission
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
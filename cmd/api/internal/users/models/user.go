@@ -1,25 +1,37 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	taxmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type User struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Email      string             `bson:"email" json:"email" binding:"required"`
-	Username   string             `bson:"username" json:"username" binding:"required"`
-	FirstName  string             `bson:"first_name" json:"first_name" binding:"required"`
-	LastName   string             `bson:"last_name" json:"last_name" binding:"required"`
-	Password   string             `bson:"password" json:"password" binding:"required"`
-	Tier       string             `bson:"tier,omitempty" json:"tier,omitempty"`
-	Roles      []string           `bson:"-" json:"roles,omitempty"`
-	UserNumber string             `bson:"user_number" json:"user_number"`
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Email          string             `bson:"email" json:"email" binding:"required"`
+	Username       string             `bson:"username" json:"username" binding:"required"`
+	FirstName      string             `bson:"first_name" json:"first_name" binding:"required"`
+	LastName       string             `bson:"last_name" json:"last_name" binding:"required"`
+	Password       string             `bson:"password" json:"password" binding:"required"`
+	Tier           string             `bson:"tier,omitempty" json:"tier,omitempty"`
+	Roles          []string           `bson:"-" json:"roles,omitempty"`
+	UserNumber     string             `bson:"user_number" json:"user_number"`
+	Billing        *taxmodels.Billing `bson:"billing,omitempty" json:"billing,omitempty"`
+	PayoutCurrency string             `bson:"payout_currency,omitempty" json:"payout_currency,omitempty"`
+	EmailVerified  bool               `bson:"email_verified" json:"email_verified"`
+	TokenVersion   int                `bson:"token_version" json:"-"` // bumped to revoke every access token of the user
 }
 
 // Role struct for roles collection
-// Each role has an ID and a role name
-// e.g., {"_id": ObjectId, "name": "admin"}
+// Each role has an ID, a role name and the permissions it grants
+// e.g., {"_id": ObjectId, "name": "admin", "permissions": ["orders:assign"]}
 type Role struct {
-	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Name string             `bson:"name" json:"name" binding:"required"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string             `bson:"name" json:"name" binding:"required"`
+	Permissions []string           `bson:"permissions" json:"permissions"`
+	RequireMFA  bool               `bson:"require_mfa" json:"require_mfa"` // holders must sign in with a second factor
+	// Default permissions a built-in role has been given, so each is only
+	// given once and stays revoked when taken away
+	SeededPermissions []string `bson:"seeded_permissions,omitempty" json:"-"`
 }
 
 // UserRole struct for user_roles collection
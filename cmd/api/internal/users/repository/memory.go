@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryUserRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryUserRepository keeps users in store, for tests
+func NewMemoryUserRepository(store *database.MemoryStore) UserRepository {
+	return &memoryUserRepository{store: store}
+}
+
+func (r *memoryUserRepository) Insert(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	return r.store.Insert("users", user)
+}
+
+func (r *memoryUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(bson.M{"_id": id})
+}
+
+func (r *memoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(bson.M{"email": email})
+}
+
+func (r *memoryUserRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	users := []models.User{}
+	err := r.store.Find("users", bson.M{"_id": bson.M{"$in": ids}}, database.FindOptions{}, &users)
+	return users, err
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	_, err := r.store.UpdateOne("users", bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+func (r *memoryUserRepository) RevokeTokens(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.store.UpdateOne("users", bson.M{"_id": id}, revokeTokensUpdate())
+	return err
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.store.DeleteOne("users", bson.M{"_id": id})
+	return err
+}
+
+func (r *memoryUserRepository) findOne(filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := r.store.FindOne("users", filter, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+type memoryRoleRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryRoleRepository keeps roles in store, for tests
+func NewMemoryRoleRepository(store *database.MemoryStore) RoleRepository {
+	return &memoryRoleRepository{store: store}
+}
+
+func (r *memoryRoleRepository) Insert(ctx context.Context, role *models.Role) error {
+	if role.ID.IsZero() {
+		role.ID = primitive.NewObjectID()
+	}
+	return r.store.Insert("roles", role)
+}
+
+func (r *memoryRoleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Role, error) {
+	return r.findOne(bson.M{"_id": id})
+}
+
+func (r *memoryRoleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	return r.findOne(bson.M{"name": name})
+}
+
+func (r *memoryRoleRepository) List(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	err := r.store.Find("roles", bson.M{}, database.FindOptions{}, &roles)
+	return roles, err
+}
+
+func (r *memoryRoleRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	_, err := r.store.UpdateOne("roles", bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+func (r *memoryRoleRepository) AddPermissions(ctx context.Context, id primitive.ObjectID, permissions []string) error {
+	return r.updateMatched(id, addPermissionsUpdate(permissions))
+}
+
+func (r *memoryRoleRepository) RemovePermission(ctx context.Context, id primitive.ObjectID, permission string) error {
+	return r.updateMatched(id, removePermissionUpdate(permission))
+}
+
+func (r *memoryRoleRepository) updateMatched(id primitive.ObjectID, update bson.M) error {
+	matched, err := r.store.UpdateOne("roles", bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *memoryRoleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.store.DeleteOne("roles", bson.M{"_id": id})
+	return err
+}
+
+func (r *memoryRoleRepository) findOne(filter bson.M) (*models.Role, error) {
+	var role models.Role
+	if err := r.store.FindOne("roles", filter, &role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+type memoryUserRoleRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryUserRoleRepository keeps user roles in store, for tests
+func NewMemoryUserRoleRepository(store *database.MemoryStore) UserRoleRepository {
+	return &memoryUserRoleRepository{store: store}
+}
+
+func (r *memoryUserRoleRepository) Insert(ctx context.Context, userRole *models.UserRole) error {
+	if userRole.ID.IsZero() {
+		userRole.ID = primitive.NewObjectID()
+	}
+	return r.store.Insert("user_roles", userRole)
+}
+
+func (r *memoryUserRoleRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.UserRole, error) {
+	return r.find(bson.M{"user_id": userID})
+}
+
+func (r *memoryUserRoleRepository) FindByRoleID(ctx context.Context, roleID primitive.ObjectID) ([]models.UserRole, error) {
+	return r.find(bson.M{"role_id": roleID})
+}
+
+func (r *memoryUserRoleRepository) List(ctx context.Context) ([]models.UserRole, error) {
+	return r.find(bson.M{})
+}
+
+func (r *memoryUserRoleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.store.DeleteOne("user_roles", bson.M{"_id": id})
+	return err
+}
+
+func (r *memoryUserRoleRepository) find(filter bson.M) ([]models.UserRole, error) {
+	var userRoles []models.UserRole
+	err := r.store.Find("user_roles", filter, database.FindOptions{}, &userRoles)
+	return userRoles, err
+}
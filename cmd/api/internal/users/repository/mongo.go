@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoUserRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoUserRepository(db *mongo.Database) UserRepository {
+	return &mongoUserRepository{col: db.Collection("users")}
+}
+
+func (r *mongoUserRepository) Insert(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	_, err := r.col.InsertOne(ctx, user)
+	return err
+}
+
+func (r *mongoUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	cur, err := r.col.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	users := []models.User{}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+func (r *mongoUserRepository) RevokeTokens(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, revokeTokensUpdate())
+	return err
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := r.col.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+type mongoRoleRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoRoleRepository(db *mongo.Database) RoleRepository {
+	return &mongoRoleRepository{col: db.Collection("roles")}
+}
+
+func (r *mongoRoleRepository) Insert(ctx context.Context, role *models.Role) error {
+	if role.ID.IsZero() {
+		role.ID = primitive.NewObjectID()
+	}
+	_, err := r.col.InsertOne(ctx, role)
+	return err
+}
+
+func (r *mongoRoleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Role, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoRoleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	return r.findOne(ctx, bson.M{"name": name})
+}
+
+func (r *mongoRoleRepository) List(ctx context.Context) ([]models.Role, error) {
+	cur, err := r.col.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var roles []models.Role
+	if err := cur.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *mongoRoleRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+func (r *mongoRoleRepository) AddPermissions(ctx context.Context, id primitive.ObjectID, permissions []string) error {
+	return r.updateMatched(ctx, id, addPermissionsUpdate(permissions))
+}
+
+func (r *mongoRoleRepository) RemovePermission(ctx context.Context, id primitive.ObjectID, permission string) error {
+	return r.updateMatched(ctx, id, removePermissionUpdate(permission))
+}
+
+// updateMatched updates a role, giving mongo.ErrNoDocuments when it is missing
+func (r *mongoRoleRepository) updateMatched(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *mongoRoleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoRoleRepository) findOne(ctx context.Context, filter bson.M) (*models.Role, error) {
+	var role models.Role
+	if err := r.col.FindOne(ctx, filter).Decode(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+type mongoUserRoleRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoUserRoleRepository(db *mongo.Database) UserRoleRepository {
+	return &mongoUserRoleRepository{col: db.Collection("user_roles")}
+}
+
+func (r *mongoUserRoleRepository) Insert(ctx context.Context, userRole *models.UserRole) error {
+	if userRole.ID.IsZero() {
+		userRole.ID = primitive.NewObjectID()
+	}
+	_, err := r.col.InsertOne(ctx, userRole)
+	return err
+}
+
+func (r *mongoUserRoleRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.UserRole, error) {
+	return r.find(ctx, bson.M{"user_id": userID})
+}
+
+func (r *mongoUserRoleRepository) FindByRoleID(ctx context.Context, roleID primitive.ObjectID) ([]models.UserRole, error) {
+	return r.find(ctx, bson.M{"role_id": roleID})
+}
+
+func (r *mongoUserRoleRepository) List(ctx context.Context) ([]models.UserRole, error) {
+	return r.find(ctx, bson.M{})
+}
+
+func (r *mongoUserRoleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoUserRoleRepository) find(ctx context.Context, filter bson.M) ([]models.UserRole, error) {
+	cur, err := r.col.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var userRoles []models.UserRole
+	if err := cur.All(ctx, &userRoles); err != nil {
+		return nil, err
+	}
+	return userRoles, nil
+}
+
+func addPermissionsUpdate(permissions []string) bson.M {
+	return bson.M{"$addToSet": bson.M{"permissions": bson.M{"$each": permissions}}}
+}
+
+func removePermissionUpdate(permission string) bson.M {
+	return bson.M{"$pull": bson.M{"permissions": permission}}
+}
+
+func revokeTokensUpdate() bson.M {
+	return bson.M{"$inc": bson.M{"token_version": 1}}
+}
@@ -0,0 +1,50 @@
+// Package repository stores users, roles and the links between them. Each
+// store has a MongoDB implementation, used by the API, and an in-memory one
+// for tests. Lookups of a missing document return mongo.ErrNoDocuments from
+// both, so callers can keep checking for it.
+package repository
+
+import (
+	"context"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserRepository stores the users collection
+type UserRepository interface {
+	// Insert stores a new user, giving it an ID when it has none
+	Insert(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByIDs returns the users among ids that exist
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error)
+	Update(ctx context.Context, id primitive.ObjectID, set bson.M) error
+	// RevokeTokens bumps the token version of a user, so access tokens
+	// issued before are refused
+	RevokeTokens(ctx context.Context, id primitive.ObjectID) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// RoleRepository stores the roles collection
+type RoleRepository interface {
+	Insert(ctx context.Context, role *models.Role) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Role, error)
+	FindByName(ctx context.Context, name string) (*models.Role, error)
+	List(ctx context.Context) ([]models.Role, error)
+	Update(ctx context.Context, id primitive.ObjectID, set bson.M) error
+	// AddPermissions grants permissions to a role, skipping ones it already has
+	AddPermissions(ctx context.Context, id primitive.ObjectID, permissions []string) error
+	RemovePermission(ctx context.Context, id primitive.ObjectID, permission string) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// UserRoleRepository stores the user_roles collection
+type UserRoleRepository interface {
+	Insert(ctx context.Context, userRole *models.UserRole) error
+	FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.UserRole, error)
+	FindByRoleID(ctx context.Context, roleID primitive.ObjectID) ([]models.UserRole, error)
+	List(ctx context.Context) ([]models.UserRole, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
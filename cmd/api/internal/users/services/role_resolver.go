@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// roleCacheTTL bounds how long a change made by another API instance takes
+// to apply
+const roleCacheTTL = 30 * time.Second
+
+// RoleResolver tells which roles and permissions a user holds right now, so
+// authorization follows changes without waiting for a new login
+type RoleResolver struct {
+	userRoles *UserRoleService
+	roles     *RoleService
+}
+
+func NewRoleResolver(userRoles *UserRoleService, roles *RoleService) *RoleResolver {
+	return &RoleResolver{userRoles: userRoles, roles: roles}
+}
+
+// Resolve returns the names of the roles granted to a user and the
+// permissions they give. The super admin role gives every permission.
+func (r *RoleResolver) Resolve(userID primitive.ObjectID) ([]string, []string, error) {
+	roleIDs, err := r.userRoles.grants.Get(userID)
+	if err != nil {
+		return nil, nil, errors.New("failed to fetch user roles")
+	}
+	byID, err := r.roles.table.Get(struct{}{})
+	if err != nil {
+		return nil, nil, errors.New("failed to fetch user roles")
+	}
+
+	names := []string{}
+	permissions := []string{}
+	seen := map[string]bool{}
+	for _, id := range roleIDs {
+		// A grant of a deleted role gives nothing
+		role, ok := byID[id]
+		if !ok {
+			continue
+		}
+		names = append(names, role.Name)
+		granted := role.Permissions
+		if role.Name == models.RoleSuperAdmin {
+			granted = models.PermissionNames()
+		}
+		for _, p := range granted {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return names, permissions, nil
+}
+
+// RoleNames returns the names of the roles granted to a user
+func (r *RoleResolver) RoleNames(userID primitive.ObjectID) ([]string, error) {
+	names, _, err := r.Resolve(userID)
+	return names, err
+}
+
+// RequiresMFA tells whether a role granted to a user requires signing in
+// with a second factor
+func (r *RoleResolver) RequiresMFA(userID primitive.ObjectID) (bool, error) {
+	roleIDs, err := r.userRoles.grants.Get(userID)
+	if err != nil {
+		return false, errors.New("failed to fetch user roles")
+	}
+	byID, err := r.roles.table.Get(struct{}{})
+	if err != nil {
+		return false, errors.New("failed to fetch user roles")
+	}
+	for _, id := range roleIDs {
+		if byID[id].RequireMFA {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -2,82 +2,207 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/cache"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	// ErrPermissionsField is returned by Update, since permissions are
+	// granted and revoked one by one
+	ErrPermissionsField = errors.New("permissions are changed through the role permission endpoints")
+	ErrRequireMFAField  = errors.New("require_mfa must be true or false")
+)
+
 type RoleService struct {
-	col *mongo.Collection
+	roles repository.RoleRepository
+	// table keeps every role with its permissions; there are few of them
+	table *cache.Cache[struct{}, map[primitive.ObjectID]models.Role]
 }
 
 func NewRoleService(db *mongo.Database) *RoleService {
-	return &RoleService{col: db.Collection("roles")}
+	return NewRoleServiceWith(repository.NewMongoRoleRepository(db))
+}
+
+// NewRoleServiceWith builds the service on any role store, e.g. an in-memory
+// one in tests. Roles are cached per service, so a process shares one.
+func NewRoleServiceWith(roles repository.RoleRepository) *RoleService {
+	table := cache.New(roleCacheTTL, func(ctx context.Context, _ struct{}) (map[primitive.ObjectID]models.Role, error) {
+		list, err := roles.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[primitive.ObjectID]models.Role, len(list))
+		for _, role := range list {
+			byID[role.ID] = role
+		}
+		return byID, nil
+	})
+	return &RoleService{roles: roles, table: table}
 }
 
 func (s *RoleService) Create(role *models.Role) error {
+	if err := checkPermissions(role.Permissions); err != nil {
+		return err
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
 	role.ID = primitive.NewObjectID()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := s.col.InsertOne(ctx, role)
-	return err
+	if err := s.roles.Insert(ctx, role); err != nil {
+		return err
+	}
+	s.table.Invalidate()
+	return nil
 }
 
 func (s *RoleService) GetByID(id primitive.ObjectID) (*models.Role, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	var role models.Role
-	err := s.col.FindOne(ctx, bson.M{"_id": id}).Decode(&role)
-	if err != nil {
-		return nil, err
-	}
-	return &role, nil
+	return s.roles.FindByID(ctx, id)
 }
 
 // Add an exported method to RoleService to get role by name
 func (s *RoleService) GetByName(name string) (*models.Role, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	var role models.Role
-	err := s.col.FindOne(ctx, bson.M{"name": name}).Decode(&role)
-	if err != nil {
-		return nil, err
-	}
-	return &role, nil
+	return s.roles.FindByName(ctx, name)
 }
 
 func (s *RoleService) List() ([]models.Role, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cur, err := s.col.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
+	return s.roles.List(ctx)
+}
+
+func (s *RoleService) Update(id primitive.ObjectID, update bson.M) error {
+	if _, ok := update["permissions"]; ok {
+		return ErrPermissionsField
 	}
-	defer cur.Close(ctx)
-	var roles []models.Role
-	for cur.Next(ctx) {
-		var r models.Role
-		if err := cur.Decode(&r); err != nil {
-			return nil, err
+	if v, ok := update["require_mfa"]; ok {
+		if _, isBool := v.(bool); !isBool {
+			return ErrRequireMFAField
 		}
-		roles = append(roles, r)
 	}
-	return roles, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.roles.Update(ctx, id, update); err != nil {
+		return err
+	}
+	s.table.Invalidate()
+	return nil
 }
 
-func (s *RoleService) Update(id primitive.ObjectID, update bson.M) error {
+// GrantPermissions adds permissions to a role; ones it has are left alone
+func (s *RoleService) GrantPermissions(id primitive.ObjectID, permissions []string) error {
+	if err := checkPermissions(permissions); err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
-	return err
+	if err := s.roles.AddPermissions(ctx, id, permissions); err != nil {
+		return err
+	}
+	s.table.Invalidate()
+	return nil
+}
+
+// RevokePermission takes a permission away from a role
+func (s *RoleService) RevokePermission(id primitive.ObjectID, permission string) error {
+	if err := checkPermissions([]string{permission}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.roles.RemovePermission(ctx, id, permission); err != nil {
+		return err
+	}
+	s.table.Invalidate()
+	return nil
 }
 
 func (s *RoleService) Delete(id primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+	if err := s.roles.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.table.Invalidate()
+	return nil
+}
+
+// SeedDefaults creates the built-in roles that are missing and gives the
+// others each default permission they have not been given yet, e.g. ones
+// added since they were created. Permissions revoked since are left alone.
+func (s *RoleService) SeedDefaults() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, name := range []string{models.RoleUser, models.RoleWriter, models.RoleAdmin, models.RoleSuperAdmin} {
+		permissions := models.DefaultPermissions[name]
+		role, err := s.roles.FindByName(ctx, name)
+		if err == mongo.ErrNoDocuments {
+			role = &models.Role{Name: name, Permissions: permissions, SeededPermissions: permissions}
+			if err := s.roles.Insert(ctx, role); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		unseeded := missing(permissions, role.SeededPermissions)
+		if len(unseeded) == 0 {
+			continue
+		}
+		// Roles stored before permissions existed have none to add to
+		update := bson.M{"seeded_permissions": permissions}
+		if role.Permissions == nil {
+			update["permissions"] = unseeded
+		} else if err := s.roles.AddPermissions(ctx, role.ID, unseeded); err != nil {
+			return err
+		}
+		if err := s.roles.Update(ctx, role.ID, update); err != nil {
+			return err
+		}
+	}
+	s.table.Invalidate()
+	return nil
+}
+
+// missing returns the names in want that are not in have
+func missing(want, have []string) []string {
+	var out []string
+	for _, name := range want {
+		found := false
+		for _, h := range have {
+			if h == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func checkPermissions(permissions []string) error {
+	for _, name := range permissions {
+		if !models.IsPermission(name) {
+			return fmt.Errorf("%w: %s", ErrUnknownPermission, name)
+		}
+	}
+	return nil
 }
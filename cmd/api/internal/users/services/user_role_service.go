@@ -4,88 +4,76 @@ import (
 	"context"
 	"time"
 
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/cache"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserRoleService struct {
-	col *mongo.Collection
+	userRoles repository.UserRoleRepository
+	// grants keeps the IDs of the roles granted to each user. Revoking only
+	// knows the ID of the user_roles entry, so every change clears it all.
+	grants *cache.Cache[primitive.ObjectID, []primitive.ObjectID]
 }
 
 func NewUserRoleService(db *mongo.Database) *UserRoleService {
-	return &UserRoleService{col: db.Collection("user_roles")}
+	return NewUserRoleServiceWith(repository.NewMongoUserRoleRepository(db))
+}
+
+// NewUserRoleServiceWith builds the service on any user role store, e.g. an
+// in-memory one in tests. Grants are cached per service, so a process shares one.
+func NewUserRoleServiceWith(userRoles repository.UserRoleRepository) *UserRoleService {
+	grants := cache.New(roleCacheTTL, func(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+		list, err := userRoles.FindByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		roleIDs := make([]primitive.ObjectID, len(list))
+		for i, grant := range list {
+			roleIDs[i] = grant.RoleID
+		}
+		return roleIDs, nil
+	})
+	return &UserRoleService{userRoles: userRoles, grants: grants}
 }
 
 func (s *UserRoleService) Create(userRole *models.UserRole) error {
 	userRole.ID = primitive.NewObjectID()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := s.col.InsertOne(ctx, userRole)
-	return err
+	if err := s.userRoles.Insert(ctx, userRole); err != nil {
+		return err
+	}
+	s.grants.Invalidate()
+	return nil
 }
 
 func (s *UserRoleService) GetByUserID(userID primitive.ObjectID) ([]models.UserRole, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cur, err := s.col.Find(ctx, bson.M{"user_id": userID})
-	if err != nil {
-		return nil, err
-	}
-	defer cur.Close(ctx)
-	var userRoles []models.UserRole
-	for cur.Next(ctx) {
-		var ur models.UserRole
-		if err := cur.Decode(&ur); err != nil {
-			return nil, err
-		}
-		userRoles = append(userRoles, ur)
-	}
-	return userRoles, nil
+	return s.userRoles.FindByUserID(ctx, userID)
 }
 
 func (s *UserRoleService) GetByRoleID(roleID primitive.ObjectID) ([]models.UserRole, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cur, err := s.col.Find(ctx, bson.M{"role_id": roleID})
-	if err != nil {
-		return nil, err
-	}
-	defer cur.Close(ctx)
-	var userRoles []models.UserRole
-	for cur.Next(ctx) {
-		var ur models.UserRole
-		if err := cur.Decode(&ur); err != nil {
-			return nil, err
-		}
-		userRoles = append(userRoles, ur)
-	}
-	return userRoles, nil
+	return s.userRoles.FindByRoleID(ctx, roleID)
 }
 
 func (s *UserRoleService) List() ([]models.UserRole, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cur, err := s.col.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	defer cur.Close(ctx)
-	var userRoles []models.UserRole
-	for cur.Next(ctx) {
-		var ur models.UserRole
-		if err := cur.Decode(&ur); err != nil {
-			return nil, err
-		}
-		userRoles = append(userRoles, ur)
-	}
-	return userRoles, nil
+	return s.userRoles.List(ctx)
 }
 
 func (s *UserRoleService) Delete(id primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+	if err := s.userRoles.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.grants.Invalidate()
+	return nil
 }
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"time"
 
+	taxmodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/models"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/repository"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,21 +15,23 @@ import (
 )
 
 type UserService struct {
-	userCollection *mongo.Collection
+	users repository.UserRepository
 }
 
 func NewUserService(db *mongo.Database) *UserService {
-	return &UserService{
-		userCollection: db.Collection("users"),
-	}
+	return NewUserServiceWith(repository.NewMongoUserRepository(db))
+}
+
+// NewUserServiceWith builds the service on any user store, e.g. an in-memory one in tests
+func NewUserServiceWith(users repository.UserRepository) *UserService {
+	return &UserService{users: users}
 }
 
 func (s *UserService) CreateUser(user *models.User, userRoleService *UserRoleService, roleService *RoleService, roleID ...primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	existingUser := s.userCollection.FindOne(ctx, bson.M{"email": user.Email})
-	if existingUser.Err() == nil {
+	if _, err := s.users.FindByEmail(ctx, user.Email); err == nil {
 		return errors.New("email already exists")
 	}
 
@@ -36,9 +40,9 @@ func (s *UserService) CreateUser(user *models.User, userRoleService *UserRoleSer
 		return err
 	}
 	user.Password = string(hashedPassword)
+	user.EmailVerified = false
 
-	res, err := s.userCollection.InsertOne(ctx, user)
-	if err != nil {
+	if err := s.users.Insert(ctx, user); err != nil {
 		return err
 	}
 
@@ -55,9 +59,8 @@ func (s *UserService) CreateUser(user *models.User, userRoleService *UserRoleSer
 	}
 
 	// Create user_roles document
-	userID := res.InsertedID.(primitive.ObjectID)
 	userRoleDoc := &models.UserRole{
-		UserID: userID,
+		UserID: user.ID,
 		RoleID: assignedRole.ID,
 	}
 	if err := userRoleService.Create(userRoleDoc); err != nil {
@@ -71,9 +74,22 @@ func (s *UserService) GetUserByID(id primitive.ObjectID) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var user models.User
-	err := s.userCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
-	return &user, err
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return &models.User{}, err
+	}
+	return user, nil
+}
+
+// GetUsersByIDs loads several users in one query; unknown IDs are left out
+func (s *UserService) GetUsersByIDs(ids []primitive.ObjectID) ([]models.User, error) {
+	users := []models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.users.FindByIDs(ctx, ids)
 }
 
 // Deprecated: This method is no longer valid as roles are managed via user_roles
@@ -108,10 +124,8 @@ func (s *UserService) GetUsersByRole(roleName string, userRoleService *UserRoleS
 	}
 	var users []models.User
 	for _, ur := range userRoles {
-		var user models.User
-		err := s.userCollection.FindOne(ctx, bson.M{"_id": ur.UserID}).Decode(&user)
-		if err == nil {
-			users = append(users, user)
+		if user, err := s.users.FindByID(ctx, ur.UserID); err == nil {
+			users = append(users, *user)
 		}
 	}
 	return users, nil
@@ -132,10 +146,8 @@ func (s *UserService) GetUsersByRolePaginated(roleName string, userRoleService *
 	}
 	var users []models.User
 	for _, ur := range userRoles {
-		var user models.User
-		err := s.userCollection.FindOne(ctx, bson.M{"_id": ur.UserID}).Decode(&user)
-		if err == nil {
-			users = append(users, user)
+		if user, err := s.users.FindByID(ctx, ur.UserID); err == nil {
+			users = append(users, *user)
 		}
 	}
 	total := int64(len(users))
@@ -156,7 +168,15 @@ func (s *UserService) UpdateUser(user *models.User) error {
 
 	update := bson.M{}
 	if user.Email != "" {
-		update["email"] = user.Email
+		current, err := s.users.FindByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if current.Email != user.Email {
+			update["email"] = user.Email
+			// The new address is not confirmed yet
+			update["email_verified"] = false
+		}
 	}
 	if user.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
@@ -167,13 +187,64 @@ func (s *UserService) UpdateUser(user *models.User) error {
 		// Remove roles update logic since roles are now managed via user_roles
 	}
 
-	_, err := s.userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": update})
-	return err
+	return s.users.Update(ctx, user.ID, update)
+}
+
+// UpdateBilling replaces the user's billing details
+func (s *UserService) UpdateBilling(id primitive.ObjectID, billing *taxmodels.Billing) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.users.Update(ctx, id, bson.M{"billing": billing})
+}
+
+// UpdatePayoutCurrency sets the currency a writer's earnings are paid out in
+func (s *UserService) UpdatePayoutCurrency(id primitive.ObjectID, currency string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.users.Update(ctx, id, bson.M{"payout_currency": currency})
+}
+
+// IsEmailVerified tells whether the user confirmed owning their email address
+func (s *UserService) IsEmailVerified(id primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
+
+// TokenVersion returns the token version of a user; access tokens carrying
+// an older one were revoked
+func (s *UserService) TokenVersion(id primitive.ObjectID) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
 }
 
 func (s *UserService) DeleteUser(id primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_, err := s.userCollection.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+	return s.users.Delete(ctx, id)
+}
+
+// MigrateEmailVerified marks users registered before email verification
+// existed as verified, so they are not locked out of ordering. It only
+// touches users without the flag, so running it on every start is safe.
+func MigrateEmailVerified(db *mongo.Database) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	res, err := db.Collection("users").UpdateMany(ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
 }
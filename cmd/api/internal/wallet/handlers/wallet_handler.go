@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TopUpRequest represents the expected payload for adding store credit
+// amount: in major units, e.g. 25.00
+// method and payment_info: as for order payments; "wallet" is not accepted
+
+type TopUpRequest struct {
+	Amount      float64                `json:"amount" binding:"required,gt=0"`
+	Method      string                 `json:"method" binding:"required,oneof=paypal mastercard simulator"`
+	PaymentInfo map[string]interface{} `json:"payment_info" binding:"required"`
+}
+
+type WalletHandler struct {
+	service *services.WalletService
+}
+
+func NewWalletHandler(service *services.WalletService) *WalletHandler {
+	return &WalletHandler{service: service}
+}
+
+// GetWallet returns the logged in user's balance
+func (h *WalletHandler) GetWallet(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	wallet, err := h.service.Get(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load wallet"})
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+// TopUp charges the user through a payment gateway and adds the amount to their wallet
+func (h *WalletHandler) TopUp(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	var req TopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.service.TopUp(userID, req.Amount, req.Method, req.PaymentInfo)
+	if err != nil {
+		switch {
+		case errors.Is(err, gateways.ErrUnknownMethod), errors.Is(err, services.ErrInvalidAmount):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, gateways.ErrDeclined):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment declined"})
+		case errors.Is(err, gateways.ErrTimeout):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Payment provider did not respond, please check your wallet before retrying"})
+		case errors.Is(err, services.ErrAmountMismatch):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Top-up failed"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, tx)
+}
+
+// ListTransactions returns the user's wallet history, newest first (paginated)
+func (h *WalletHandler) ListTransactions(c *gin.Context) {
+	userID, ok := userIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+		return
+	}
+	page := 1
+	pageSize := 10
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("page_size"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	transactions, total, err := h.service.Transactions(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load wallet transactions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": transactions,
+		"total":        total,
+		"page":         page,
+		"page_size":    pageSize,
+	})
+}
+
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	return principal.UserID, true
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Wallet is a client's store credit balance (wallets collection), keyed by user ID.
+// Amounts are in minor units (cents).
+// e.g., {"_id": ObjectId, "balance": 2500, "currency": "USD"}
+type Wallet struct {
+	UserID    primitive.ObjectID `bson:"_id" json:"user_id"`
+	Balance   int64              `bson:"balance" json:"balance"`
+	Currency  string             `bson:"currency" json:"currency"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Wallet transaction kinds
+const (
+	TransactionKindTopUp   = "top_up"  // paid in through a payment gateway
+	TransactionKindPayment = "payment" // spent on an order
+	TransactionKindRefund  = "refund"  // an order refund returned as store credit
+)
+
+// Transaction is one movement of a wallet's balance (wallet_transactions collection).
+// Amount is positive for credits and negative for debits.
+// e.g., {"user_id": ObjectId, "kind": "payment", "amount": -4250, "balance_after": 750, "reference": "64b..."}
+type Transaction struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID       primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Kind         string              `bson:"kind" json:"kind"`
+	Amount       int64               `bson:"amount" json:"amount"`
+	BalanceAfter int64               `bson:"balance_after" json:"balance_after"`
+	Currency     string              `bson:"currency" json:"currency"`
+	Reference    string              `bson:"reference,omitempty" json:"reference,omitempty"` // gateway transaction, payment or refund ID
+	OrderID      *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+}
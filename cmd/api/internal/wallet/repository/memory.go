@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryWalletRepository struct {
+	store *database.MemoryStore
+	// mu makes each balance change and the read of its result one step,
+	// like FindOneAndUpdate
+	mu sync.Mutex
+}
+
+// NewMemoryWalletRepository keeps wallets in store, for tests
+func NewMemoryWalletRepository(store *database.MemoryStore) WalletRepository {
+	return &memoryWalletRepository{store: store}
+}
+
+func (r *memoryWalletRepository) FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Wallet, error) {
+	var wallet models.Wallet
+	if err := r.store.FindOne("wallets", bson.M{"_id": userID}, &wallet); err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+func (r *memoryWalletRepository) Debit(ctx context.Context, userID primitive.ObjectID, amount int64, currency string, at time.Time) (*models.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matched, err := r.store.UpdateOne("wallets", debitFilter(userID, amount, currency),
+		bson.M{"$inc": bson.M{"balance": -amount}, "$set": bson.M{"updated_at": at}})
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return r.FindByUser(ctx, userID)
+}
+
+func (r *memoryWalletRepository) Credit(ctx context.Context, userID primitive.ObjectID, amount int64, currency string, at time.Time) (*models.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matched, err := r.store.UpdateOne("wallets", bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"balance": amount}, "$set": bson.M{"updated_at": at}})
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		wallet := &models.Wallet{UserID: userID, Balance: amount, Currency: currency, UpdatedAt: at}
+		if err := r.store.Insert("wallets", wallet); err != nil {
+			return nil, err
+		}
+	}
+	return r.FindByUser(ctx, userID)
+}
+
+type memoryTransactionRepository struct {
+	store *database.MemoryStore
+}
+
+// NewMemoryTransactionRepository keeps wallet transactions in store, for tests
+func NewMemoryTransactionRepository(store *database.MemoryStore) TransactionRepository {
+	return &memoryTransactionRepository{store: store}
+}
+
+func (r *memoryTransactionRepository) Insert(ctx context.Context, tx *models.Transaction) error {
+	return r.store.Insert("wallet_transactions", tx)
+}
+
+func (r *memoryTransactionRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, opts FindOptions) ([]models.Transaction, error) {
+	transactions := []models.Transaction{}
+	findOpts := database.FindOptions{Sort: newestFirst, Skip: opts.Skip, Limit: opts.Limit}
+	err := r.store.Find("wallet_transactions", bson.M{"user_id": userID}, findOpts, &transactions)
+	return transactions, err
+}
+
+func (r *memoryTransactionRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.store.Count("wallet_transactions", bson.M{"user_id": userID}), nil
+}
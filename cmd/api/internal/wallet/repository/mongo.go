@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoWalletRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoWalletRepository(db *mongo.Database) WalletRepository {
+	return &mongoWalletRepository{col: db.Collection("wallets")}
+}
+
+func (r *mongoWalletRepository) FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Wallet, error) {
+	var wallet models.Wallet
+	if err := r.col.FindOne(ctx, bson.M{"_id": userID}).Decode(&wallet); err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+func (r *mongoWalletRepository) Debit(ctx context.Context, userID primitive.ObjectID, amount int64, currency string, at time.Time) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := r.col.FindOneAndUpdate(ctx,
+		debitFilter(userID, amount, currency),
+		bson.M{"$inc": bson.M{"balance": -amount}, "$set": bson.M{"updated_at": at}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&wallet)
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+func (r *mongoWalletRepository) Credit(ctx context.Context, userID primitive.ObjectID, amount int64, currency string, at time.Time) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := r.col.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$inc":         bson.M{"balance": amount},
+			"$set":         bson.M{"updated_at": at},
+			"$setOnInsert": bson.M{"currency": currency},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&wallet)
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// debitFilter matches the wallet of userID when it can pay amount in currency
+func debitFilter(userID primitive.ObjectID, amount int64, currency string) bson.M {
+	return bson.M{"_id": userID, "currency": currency, "balance": bson.M{"$gte": amount}}
+}
+
+type mongoTransactionRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoTransactionRepository(db *mongo.Database) TransactionRepository {
+	return &mongoTransactionRepository{col: db.Collection("wallet_transactions")}
+}
+
+func (r *mongoTransactionRepository) Insert(ctx context.Context, tx *models.Transaction) error {
+	_, err := r.col.InsertOne(ctx, tx)
+	return err
+}
+
+func (r *mongoTransactionRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, opts FindOptions) ([]models.Transaction, error) {
+	findOpts := options.Find().SetSort(newestFirst)
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	cur, err := r.col.Find(ctx, bson.M{"user_id": userID}, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	transactions := []models.Transaction{}
+	if err := cur.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (r *mongoTransactionRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// newestFirst orders transactions made in the same instant by insertion
+var newestFirst = bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
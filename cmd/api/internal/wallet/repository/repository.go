@@ -0,0 +1,40 @@
+// Package repository stores wallets and their transactions. The MongoDB
+// implementations are used by the API and the in-memory ones by tests; a
+// missing wallet gives mongo.ErrNoDocuments from both.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WalletRepository stores the wallets collection. Balance changes are single
+// atomic updates, so parallel payments cannot spend the same credit twice.
+type WalletRepository interface {
+	FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Wallet, error)
+	// Debit takes amount off the user's wallet if it holds currency and at
+	// least amount, and returns the wallet as updated. A missing wallet, a
+	// low balance and another currency all give mongo.ErrNoDocuments.
+	Debit(ctx context.Context, userID primitive.ObjectID, amount int64, currency string, at time.Time) (*models.Wallet, error)
+	// Credit adds amount to the user's wallet, creating it in currency on
+	// first use, and returns the wallet as updated. An existing wallet keeps
+	// its currency, whatever currency says.
+	Credit(ctx context.Context, userID primitive.ObjectID, amount int64, currency string, at time.Time) (*models.Wallet, error)
+}
+
+// FindOptions pages a listing of transactions, newest first; a zero Limit
+// returns every transaction
+type FindOptions struct {
+	Skip  int64
+	Limit int64
+}
+
+// TransactionRepository stores the wallet_transactions collection
+type TransactionRepository interface {
+	Insert(ctx context.Context, tx *models.Transaction) error
+	ListByUser(ctx context.Context, userID primitive.ObjectID, opts FindOptions) ([]models.Transaction, error)
+	CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
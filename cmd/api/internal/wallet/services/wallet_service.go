@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/money"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient wallet balance")
+	ErrInvalidAmount     = errors.New("amount must be greater than zero")
+	ErrCurrencyMismatch  = errors.New("wallet holds a different currency")
+	ErrAmountMismatch    = errors.New("captured amount does not match the top-up")
+)
+
+// WalletService keeps clients' store credit. Every balance change is a single
+// atomic update on the wallet document plus a transaction record, so parallel
+// payments can never spend the same credit twice.
+type WalletService struct {
+	wallets      repository.WalletRepository
+	transactions repository.TransactionRepository
+	tx           database.Transactor
+	ledger       *ledgerservices.LedgerService
+	gateways     *gateways.Registry
+	currency     string
+}
+
+// WalletServiceDeps are the stores and services a WalletService works with;
+// see NewWalletServiceWith
+type WalletServiceDeps struct {
+	Wallets      repository.WalletRepository
+	Transactions repository.TransactionRepository
+	Transactor   database.Transactor
+	Ledger       *ledgerservices.LedgerService
+	Gateways     *gateways.Registry
+}
+
+func NewWalletService(db *mongo.Database, registry *gateways.Registry) *WalletService {
+	return NewWalletServiceWith(WalletServiceDeps{
+		Wallets:      repository.NewMongoWalletRepository(db),
+		Transactions: repository.NewMongoTransactionRepository(db),
+		Transactor:   database.NewMongoTransactor(db.Client()),
+		Ledger:       ledgerservices.NewLedgerService(db),
+		Gateways:     registry,
+	})
+}
+
+// NewWalletServiceWith builds the service on deps, e.g. in-memory stores and
+// a simulated gateway in tests
+func NewWalletServiceWith(deps WalletServiceDeps) *WalletService {
+	return &WalletService{
+		wallets:      deps.Wallets,
+		transactions: deps.Transactions,
+		tx:           deps.Transactor,
+		ledger:       deps.Ledger,
+		gateways:     deps.Gateways,
+		currency:     money.DefaultCurrency(),
+	}
+}
+
+// Get returns the user's wallet; users who never had credit get an empty one
+func (s *WalletService) Get(userID primitive.ObjectID) (*models.Wallet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wallet, err := s.wallets.FindByUser(ctx, userID)
+	if err == mongo.ErrNoDocuments {
+		return &models.Wallet{UserID: userID, Currency: s.currency}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// TopUp charges amount (major units) through the gateway for method and adds
+// it to the user's wallet. If the credit cannot be recorded the charge is refunded.
+func (s *WalletService) TopUp(userID primitive.ObjectID, amount float64, method string, info map[string]interface{}) (*models.Transaction, error) {
+	minor := money.ToMinor(amount, s.currency)
+	if minor <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	gateway, err := s.gateways.Get(method)
+	if err != nil {
+		return nil, err
+	}
+	// Gateways talk to the network, give them longer than a database call
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	auth, err := gateway.Authorize(ctx, gateways.AuthorizeRequest{
+		Reference: "wallet-" + userID.Hex(),
+		Amount:    amount,
+		Currency:  s.currency,
+		Info:      info,
+	})
+	if err != nil {
+		return nil, err
+	}
+	captured, err := gateway.Capture(ctx, auth.TransactionID, amount, s.currency)
+	if err != nil {
+		if _, voidErr := gateway.Void(ctx, auth.TransactionID); voidErr != nil {
+			log.Printf("wallet: failed to void authorization %s: %v", auth.TransactionID, voidErr)
+		}
+		return nil, err
+	}
+	if money.ToMinor(captured.Amount, s.currency) != minor {
+		s.refundQuietly(ctx, gateway, captured)
+		return nil, ErrAmountMismatch
+	}
+
+	var tx *models.Transaction
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if tx, err = s.Credit(ctx, userID, minor, s.currency, models.TransactionKindTopUp, captured.TransactionID, nil); err != nil {
+			return err
+		}
+		return s.ledger.PostWalletTopUp(ctx, tx.ID.Hex(), userID, minor, s.currency)
+	})
+	if err != nil {
+		s.refundQuietly(ctx, gateway, captured)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Debit takes amount (minor units) out of the user's wallet, failing with
+// ErrInsufficientFunds rather than going negative and with
+// ErrCurrencyMismatch when the wallet holds another currency. Run it inside
+// the transaction that records what the money was spent on.
+func (s *WalletService) Debit(ctx context.Context, userID primitive.ObjectID, amount int64, currency, kind, reference string, orderID *primitive.ObjectID) (*models.Transaction, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	wallet, err := s.wallets.Debit(ctx, userID, amount, currency, time.Now())
+	if err == mongo.ErrNoDocuments {
+		if current, err := s.wallets.FindByUser(ctx, userID); err == nil && current.Currency != currency {
+			return nil, ErrCurrencyMismatch
+		}
+		return nil, ErrInsufficientFunds
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.record(ctx, wallet, kind, -amount, reference, orderID)
+}
+
+// Credit adds amount (minor units) to the user's wallet, creating it on first
+// use. Run it inside the transaction that records where the money came from.
+func (s *WalletService) Credit(ctx context.Context, userID primitive.ObjectID, amount int64, currency, kind, reference string, orderID *primitive.ObjectID) (*models.Transaction, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	wallet, err := s.wallets.Credit(ctx, userID, amount, currency, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if wallet.Currency != currency {
+		// Returning the error aborts the caller's transaction and with it the increment
+		return nil, ErrCurrencyMismatch
+	}
+	return s.record(ctx, wallet, kind, amount, reference, orderID)
+}
+
+func (s *WalletService) record(ctx context.Context, wallet *models.Wallet, kind string, amount int64, reference string, orderID *primitive.ObjectID) (*models.Transaction, error) {
+	tx := &models.Transaction{
+		ID:           primitive.NewObjectID(),
+		UserID:       wallet.UserID,
+		Kind:         kind,
+		Amount:       amount,
+		BalanceAfter: wallet.Balance,
+		Currency:     wallet.Currency,
+		Reference:    reference,
+		OrderID:      orderID,
+		CreatedAt:    wallet.UpdatedAt,
+	}
+	if err := s.transactions.Insert(ctx, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Transactions returns the user's wallet history, newest first
+func (s *WalletService) Transactions(userID primitive.ObjectID, page, pageSize int) ([]models.Transaction, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	total, err := s.transactions.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	transactions, err := s.transactions.ListByUser(ctx, userID, repository.FindOptions{
+		Skip:  int64((page - 1) * pageSize),
+		Limit: int64(pageSize),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return transactions, total, nil
+}
+
+func (s *WalletService) refundQuietly(ctx context.Context, gateway gateways.PaymentGateway, captured *gateways.Result) {
+	if _, err := gateway.Refund(ctx, captured.TransactionID, captured.Amount, captured.Currency); err != nil {
+		log.Printf("wallet: failed to refund top-up %s: %v", captured.TransactionID, err)
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	ledgermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/models"
+	ledgerrepository "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/repository"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/models"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newWallets(t *testing.T) (*WalletService, *ledgerservices.LedgerService) {
+	t.Helper()
+	t.Setenv("PAYMENT_CURRENCY", "USD")
+	store := database.NewMemoryStore()
+	ledger := ledgerservices.NewLedgerServiceWith(ledgerrepository.NewMemoryJournalEntryRepository(store))
+	return NewWalletServiceWith(WalletServiceDeps{
+		Wallets:      repository.NewMemoryWalletRepository(store),
+		Transactions: repository.NewMemoryTransactionRepository(store),
+		Transactor:   store,
+		Ledger:       ledger,
+		Gateways:     gateways.NewRegistry(gateways.NewSimulator(gateways.DefaultSimulatorConfig())),
+	}), ledger
+}
+
+func TestConcurrentDebitsNeverOverdraw(t *testing.T) {
+	s, _ := newWallets(t)
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+	if _, err := s.Credit(ctx, user, 1000, "USD", models.TransactionKindRefund, "refund-1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	const debits = 25
+	var wg sync.WaitGroup
+	errs := make([]error, debits)
+	for i := 0; i < debits; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.Debit(ctx, user, 100, "USD", models.TransactionKindPayment, primitive.NewObjectID().Hex(), nil)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrInsufficientFunds):
+			t.Errorf("Debit = %v, want nil or ErrInsufficientFunds", err)
+		}
+	}
+	if succeeded != 10 {
+		t.Errorf("%d debits of 100 succeeded on a balance of 1000, want 10", succeeded)
+	}
+	wallet, err := s.Get(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Balance != 0 {
+		t.Errorf("balance = %d, want 0", wallet.Balance)
+	}
+
+	// Every debit saw its own balance, so no two report the same one
+	transactions, total, err := s.Transactions(user, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 11 {
+		t.Errorf("%d transactions, want the credit and 10 debits", total)
+	}
+	seen := map[int64]bool{}
+	for _, tx := range transactions {
+		if tx.Kind != models.TransactionKindPayment {
+			continue
+		}
+		if tx.Amount != -100 || tx.BalanceAfter < 0 || seen[tx.BalanceAfter] {
+			t.Errorf("debit transaction %+v", tx)
+		}
+		seen[tx.BalanceAfter] = true
+	}
+}
+
+func TestDebitErrors(t *testing.T) {
+	s, _ := newWallets(t)
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+
+	if _, err := s.Debit(ctx, user, 100, "USD", models.TransactionKindPayment, "p1", nil); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Debit without a wallet = %v, want ErrInsufficientFunds", err)
+	}
+	if _, err := s.Credit(ctx, user, 500, "USD", models.TransactionKindRefund, "r1", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		amount   int64
+		currency string
+		want     error
+	}{
+		{501, "USD", ErrInsufficientFunds},
+		{100, "EUR", ErrCurrencyMismatch},
+		{0, "USD", ErrInvalidAmount},
+		{-100, "USD", ErrInvalidAmount},
+	} {
+		if _, err := s.Debit(ctx, user, tc.amount, tc.currency, models.TransactionKindPayment, "p2", nil); !errors.Is(err, tc.want) {
+			t.Errorf("Debit(%d %s) = %v, want %v", tc.amount, tc.currency, err, tc.want)
+		}
+	}
+	// The refund that credits the wallet rolls back with the mismatch
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.Credit(ctx, user, 100, "EUR", models.TransactionKindRefund, "r2", nil)
+		return err
+	})
+	if !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Credit in EUR = %v, want ErrCurrencyMismatch", err)
+	}
+
+	tx, err := s.Debit(ctx, user, 500, "USD", models.TransactionKindPayment, "p3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.BalanceAfter != 0 || tx.Amount != -500 {
+		t.Errorf("debit of the whole balance = %+v", tx)
+	}
+}
+
+func TestTopUp(t *testing.T) {
+	s, ledger := newWallets(t)
+	user := primitive.NewObjectID()
+
+	tx, err := s.TopUp(user, 25, "simulator", map[string]interface{}{"card_number": "4111111111111111"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Amount != 2500 || tx.BalanceAfter != 2500 || tx.Kind != models.TransactionKindTopUp {
+		t.Errorf("top-up transaction = %+v", tx)
+	}
+	balances, err := ledger.AccountBalances(ledgermodels.WalletAccount(user.Hex()))
+	if err != nil || len(balances) != 1 || balances[0].Balance != 2500 {
+		t.Errorf("wallet ledger account = %+v, %v; want a balance of 2500", balances, err)
+	}
+
+	if _, err := s.TopUp(user, 25, "simulator", map[string]interface{}{"card_number": "4000000000000002"}); !errors.Is(err, gateways.ErrDeclined) {
+		t.Errorf("TopUp with a declined card = %v, want ErrDeclined", err)
+	}
+	if _, err := s.TopUp(user, 0, "simulator", nil); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("TopUp of 0 = %v, want ErrInvalidAmount", err)
+	}
+	if wallet, _ := s.Get(user); wallet.Balance != 2500 {
+		t.Errorf("balance = %d after failed top-ups, want 2500", wallet.Balance)
+	}
+}
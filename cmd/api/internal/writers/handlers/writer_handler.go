@@ -7,20 +7,16 @@ import (
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type WriterHandler struct {
-	service *services.UserService
-	db      *mongo.Database
+	service         *services.UserService
+	userRoleService *services.UserRoleService
+	roleService     *services.RoleService
 }
 
-func NewWriterHandler(client *mongo.Client, dbName string) *WriterHandler {
-	db := client.Database(dbName)
-	return &WriterHandler{
-		service: services.NewUserService(db),
-		db:      db,
-	}
+func NewWriterHandler(service *services.UserService, userRoleService *services.UserRoleService, roleService *services.RoleService) *WriterHandler {
+	return &WriterHandler{service: service, userRoleService: userRoleService, roleService: roleService}
 }
 
 func (h *WriterHandler) CreateWriter(c *gin.Context) {
@@ -29,14 +25,12 @@ func (h *WriterHandler) CreateWriter(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	roleService := services.NewRoleService(h.db)
-	userRoleService := services.NewUserRoleService(h.db)
-	writerRole, err := roleService.GetByName("writer")
+	writerRole, err := h.roleService.GetByName("writer")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Writer role not found. Please create it first."})
 		return
 	}
-	if err := h.service.CreateUser(&user, userRoleService, roleService, writerRole.ID); err != nil {
+	if err := h.service.CreateUser(&user, h.userRoleService, h.roleService, writerRole.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create writer account"})
 		return
 	}
@@ -44,9 +38,7 @@ func (h *WriterHandler) CreateWriter(c *gin.Context) {
 }
 
 func (h *WriterHandler) ListWriters(c *gin.Context) {
-	userRoleService := services.NewUserRoleService(h.db)
-	roleService := services.NewRoleService(h.db)
-	writers, err := h.service.GetUsersByRole("writer", userRoleService, roleService)
+	writers, err := h.service.GetUsersByRole("writer", h.userRoleService, h.roleService)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list writers"})
 		return
@@ -8,39 +8,61 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	ahandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/handlers"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/keys"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/middleware"
+	authservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/auth/services"
+	currencyhandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/handlers"
+	currencyservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/currency/services"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/database"
+	invoicehandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/handlers"
+	invoiceservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/invoices/services"
+	lhandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/handlers"
+	ledgerservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/ledger/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/mail"
 	ohandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/handlers"
 	"github.com/nduhiu17/treasure-shop/cmd/api/internal/orders/services"
+	"github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/gateways"
+	payhandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/payments/handlers"
+	pohandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/handlers"
+	payoutservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/payouts/services"
+	phandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/handlers"
+	pricingservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/pricing/services"
+	promohandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/handlers"
+	promoservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/promotions/services"
+	taxhandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/handlers"
+	taxservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/tax/services"
 	uhandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/handlers"
 	userrolehandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/handlers"
+	usermodels "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/models"
 	userservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/users/services"
+	wallethandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/handlers"
+	walletservices "github.com/nduhiu17/treasure-shop/cmd/api/internal/wallet/services"
 	whandlers "github.com/nduhiu17/treasure-shop/cmd/api/internal/writers/handlers"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func registerRoleRoutes(r *gin.Engine, db *mongo.Database) {
-	roleService := userservices.NewRoleService(db)
+func registerRoleRoutes(r *gin.Engine, roleService *userservices.RoleService, userRoleService *userservices.UserRoleService, roleResolver middleware.RoleResolver, versions middleware.TokenVersions, signing *keys.Set) {
 	roleHandler := userrolehandlers.NewRoleHandler(roleService)
-	userRoleService := userservices.NewUserRoleService(db)
 	userRoleHandler := userrolehandlers.NewUserRoleHandler(userRoleService)
 
 	admin := r.Group("/api/admin")
-	admin.Use(middleware.AuthMiddleware())
+	admin.Use(middleware.AuthMiddleware(roleResolver, versions, signing))
 	{
-		admin.POST("/roles", roleHandler.Create)
-		admin.GET("/roles", roleHandler.List)
-		admin.GET("/roles/:id", roleHandler.GetByID)
-		admin.PUT("/roles/:id", roleHandler.Update)
-		admin.DELETE("/roles/:id", roleHandler.Delete)
-
-		admin.POST("/user-roles", userRoleHandler.Create)
-		admin.GET("/user-roles", userRoleHandler.List)
-		admin.GET("/user-roles/user/:user_id", userRoleHandler.GetByUserID)
-		admin.POST("/user-roles/assign", userRoleHandler.AssignRoleToUser)
-		admin.DELETE("/user-roles/:id", userRoleHandler.Delete)
+		admin.POST("/roles", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.Create)
+		admin.GET("/roles", middleware.RequirePermission(usermodels.PermRolesRead), roleHandler.List)
+		admin.GET("/roles/:id", middleware.RequirePermission(usermodels.PermRolesRead), roleHandler.GetByID)
+		admin.PUT("/roles/:id", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.Update)
+		admin.DELETE("/roles/:id", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.Delete)
+		admin.GET("/permissions", middleware.RequirePermission(usermodels.PermRolesRead), roleHandler.ListPermissions)
+		admin.POST("/roles/:id/permissions", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.GrantPermissions)
+		admin.DELETE("/roles/:id/permissions/:permission", middleware.RequirePermission(usermodels.PermRolesWrite), roleHandler.RevokePermission)
+
+		admin.POST("/user-roles", middleware.RequirePermission(usermodels.PermRolesWrite), userRoleHandler.Create)
+		admin.GET("/user-roles", middleware.RequirePermission(usermodels.PermRolesRead), userRoleHandler.List)
+		admin.GET("/user-roles/user/:user_id", middleware.RequirePermission(usermodels.PermRolesRead), userRoleHandler.GetByUserID)
+		admin.POST("/user-roles/assign", middleware.RequirePermission(usermodels.PermRolesWrite), userRoleHandler.AssignRoleToUser)
+		admin.DELETE("/user-roles/:id", middleware.RequirePermission(usermodels.PermRolesWrite), userRoleHandler.Delete)
 	}
 }
 
@@ -58,6 +80,14 @@ func main() {
 	if dbName == "" {
 		log.Fatal("DB_NAME environment variable not set")
 	}
+	signingKeys, err := keys.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading JWT signing keys: %v", err)
+	}
+	emailSecret, err := authservices.EmailSecretFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 	client, err := database.ConnectMongoDB(mongoURI)
 	if err != nil {
 		log.Fatalf("Error connecting to MongoDB: %v", err)
@@ -65,13 +95,60 @@ func main() {
 	defer database.DisconnectMongoDB(client)
 
 	db := client.Database(dbName)
+	// Orders placed before orders carried a currency were all in the default one
+	if migrated, err := currencyservices.MigrateDefaultCurrency(db); err != nil {
+		log.Fatalf("Error migrating order currencies: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Set the default currency on %d existing orders", migrated)
+	}
+	// Users registered before email verification are treated as verified
+	if migrated, err := userservices.MigrateEmailVerified(db); err != nil {
+		log.Fatalf("Error migrating email verification: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Marked %d existing users as verified", migrated)
+	}
+	if err := services.BackfillLookups(db); err != nil {
+		log.Fatalf("Error backfilling order lookups: %v", err)
+	}
+	// Role services cache roles and grants, so every consumer gets these two
+	// and sees changes made through them at once
 	roleService := userservices.NewRoleService(db)
 	userRoleService := userservices.NewUserRoleService(db)
+	userService := userservices.NewUserService(db)
+	roleResolver := userservices.NewRoleResolver(userRoleService, roleService)
+	// Built-in roles get the permissions that match what they could do before
+	if err := roleService.SeedDefaults(); err != nil {
+		log.Fatalf("Error seeding roles: %v", err)
+	}
 	orderLevelService := services.NewOrderLevelService(db)
 	orderPagesService := services.NewOrderPagesService(db)
 	orderUrgencyService := services.NewOrderUrgencyService(db)
 	orderStyleService := services.NewOrderStyleService(db)
 	orderLanguageService := services.NewOrderLanguageService(db)
+	orderService := services.NewOrderService(db, userRoleService, roleService)
+	// The enricher reads names through the same catalog services the admin
+	// routes write through, so renames show at once
+	orderEnricher := services.NewOrderEnricherWith(orderLevelService, orderPagesService, orderUrgencyService,
+		orderStyleService, orderLanguageService, userService)
+	priceRateService := pricingservices.NewPriceRateService(db)
+	quoteService := pricingservices.NewQuoteService(db)
+	promotionService := promoservices.NewPromotionService(db)
+	taxService := taxservices.NewTaxService(db)
+	exchangeRateService := currencyservices.NewExchangeRateService(db)
+	ledgerService := ledgerservices.NewLedgerService(db)
+	commissionService := payoutservices.NewCommissionService(db)
+	earningService := payoutservices.NewEarningService(db)
+	payoutService := payoutservices.NewPayoutService(db)
+	paymentGateways := gateways.NewRegistryFromEnv()
+	log.Printf("Payment methods enabled: %v", paymentGateways.Methods())
+	walletService := walletservices.NewWalletService(db, paymentGateways)
+	invoiceService := invoiceservices.NewInvoiceService(db)
+	// Orders paid before invoicing get their invoice, dated as of the payment
+	if issued, err := invoiceService.BackfillInvoices(); err != nil {
+		log.Fatalf("Error backfilling invoices: %v", err)
+	} else if issued > 0 {
+		log.Printf("Issued invoices for %d orders paid before invoicing", issued)
+	}
 
 	r := gin.New()
 	r.Use(gin.Logger())
@@ -87,15 +164,32 @@ func main() {
 	}))
 
 	// Initialize Handlers (you'll need to pass in services and database client)
-	authHandler := ahandlers.NewAuthHandler(client, dbName, userRoleService, roleService)
-	userHandler := uhandlers.NewUserHandler(client, dbName)
-	writerHandler := whandlers.NewWriterHandler(client, dbName)
-	orderHandler := ohandlers.NewOrderHandler(client, dbName)
+	mailer := mail.NewMailerFromEnv()
+	authService := authservices.NewAuthService(db, userRoleService, roleService, mailer, signingKeys, emailSecret)
+	authHandler := ahandlers.NewAuthHandlerWith(authService, userRoleService, roleService)
+	jwksHandler := ahandlers.NewJWKSHandler(signingKeys)
+	userHandler := uhandlers.NewUserHandlerWith(orderService, orderEnricher, quoteService, userService, userRoleService, roleService)
+	writerHandler := whandlers.NewWriterHandler(userService, userRoleService, roleService)
+	orderHandler := ohandlers.NewOrderHandlerWith(orderService, orderEnricher)
+	paymentHandler := ohandlers.NewPaymentHandler(client, dbName, paymentGateways)
+	webhookHandler := payhandlers.NewWebhookHandler(client, dbName, paymentGateways)
+	refundHandler := ohandlers.NewRefundHandler(client, dbName, paymentGateways)
 	orderLevelHandler := ohandlers.NewOrderLevelHandler(orderLevelService)
 	orderPagesHandler := ohandlers.NewOrderPagesHandler(orderPagesService)
 	orderUrgencyHandler := ohandlers.NewOrderUrgencyHandler(orderUrgencyService)
 	orderStyleHandler := ohandlers.NewOrderStyleHandler(orderStyleService)
 	orderLanguageHandler := ohandlers.NewOrderLanguageHandler(orderLanguageService)
+	priceRateHandler := phandlers.NewPriceRateHandler(priceRateService)
+	ledgerHandler := lhandlers.NewLedgerHandler(ledgerService)
+	commissionRateHandler := pohandlers.NewCommissionRateHandler(commissionService)
+	earningsHandler := pohandlers.NewEarningsHandler(earningService)
+	payoutBatchHandler := pohandlers.NewPayoutBatchHandler(payoutService)
+	quoteHandler := phandlers.NewQuoteHandler(quoteService)
+	promotionHandler := promohandlers.NewPromotionHandler(promotionService)
+	taxRateHandler := taxhandlers.NewTaxRateHandler(taxService)
+	exchangeRateHandler := currencyhandlers.NewExchangeRateHandler(exchangeRateService)
+	walletHandler := wallethandlers.NewWalletHandler(walletService)
+	invoiceHandler := invoicehandlers.NewInvoiceHandler(invoiceService)
 
 	// OrderType Service/Handler
 	orderTypeCol := client.Database(dbName).Collection("order_types")
@@ -106,7 +200,17 @@ func main() {
 	// Public Routes
 	r.POST("/auth/register", authHandler.Register)
 	r.POST("/auth/login", authHandler.Login)
-	r.POST("/auth/logout", ahandlers.LogoutHandler)
+	r.POST("/auth/login/mfa", authHandler.CompleteLogin)
+	r.POST("/auth/mfa/enroll", authHandler.EnrollDuringLogin)
+	r.POST("/auth/refresh", authHandler.Refresh)
+	r.POST("/auth/logout", authHandler.Logout)
+	r.POST("/auth/password/forgot", authHandler.ForgotPassword)
+	r.POST("/auth/password/reset", authHandler.ResetPassword)
+	r.POST("/auth/verify-email", authHandler.VerifyEmail)
+	r.POST("/auth/verify-email/resend", authHandler.ResendVerification)
+
+	// Public keys for other services to verify access tokens with
+	r.GET("/.well-known/jwks.json", jwksHandler.Get)
 
 	// Serve OpenAPI YAML directly
 	r.StaticFile("/openapi.yaml", "./openapi.yaml")
@@ -139,94 +243,190 @@ func main() {
 	// Unpaginated OrderType endpoint
 	r.GET("/api/order-types/all", orderTypeService.ListAll)
 
+	// Public price quote (itemized breakdown)
+	r.POST("/api/quote", quoteHandler.Quote)
+
+	// Public currency list and display conversion
+	r.GET("/api/currencies", exchangeRateHandler.Currencies)
+	r.GET("/api/currencies/convert", exchangeRateHandler.Convert)
+
+	// Payment provider notifications (authenticated by HMAC signature, not JWT)
+	r.POST("/webhooks/payments/:provider", webhookHandler.Receive)
+
 	// Protected Routes
 	protected := r.Group("/api")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(roleResolver, userService, signingKeys))
 	{
 		// S3 file upload endpoint (must be authenticated)
-		protected.POST("/upload", ohandlers.S3UploadHandler)
+		protected.POST("/upload", middleware.RequirePermission(usermodels.PermFilesUpload), ohandlers.S3UploadHandler)
 
 		// User Routes
-		protected.POST("/orders", userHandler.CreateOrder)
-		protected.GET("/orders/me", userHandler.GetUserOrders)
-
-		// Payment endpoint for orders (PayPal or Mastercard)
-		protected.POST("/orders/pay", ohandlers.PayForOrderHandler)
+		protected.POST("/orders", middleware.RequirePermission(usermodels.PermOrdersPlace), middleware.RequireVerifiedEmail(userService), userHandler.CreateOrder)
+		protected.GET("/orders/me", middleware.RequirePermission(usermodels.PermOrdersPlace), userHandler.GetUserOrders)
+
+		// Profile of the logged in user
+		protected.GET("/me", middleware.RequirePermission(usermodels.PermAccountManage), userHandler.Me)
+		// Billing details orders are taxed by
+		protected.GET("/me/billing", middleware.RequirePermission(usermodels.PermAccountManage), userHandler.GetBilling)
+		protected.PUT("/me/billing", middleware.RequirePermission(usermodels.PermAccountManage), userHandler.UpdateBilling)
+		// Devices the user is signed in on
+		protected.GET("/me/sessions", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.ListSessions)
+		protected.DELETE("/me/sessions/:id", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.RevokeSession)
+		protected.POST("/me/mfa", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.StartMFA)
+		protected.POST("/me/mfa/confirm", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.ConfirmMFA)
+		protected.POST("/me/mfa/disable", middleware.RequirePermission(usermodels.PermAccountManage), authHandler.DisableMFA)
+
+		// Payment endpoint for orders (PayPal, Mastercard or the local simulator)
+		protected.POST("/orders/pay", middleware.RequirePermission(usermodels.PermOrdersPlace), middleware.RequireVerifiedEmail(userService), paymentHandler.PayForOrder)
+
+		// Invoice of a paid order as PDF or HTML (owner or admin)
+		protected.GET("/orders/:id/invoice", middleware.RequireAnyPermission(usermodels.PermOrdersPlace, usermodels.PermInvoicesRead), invoiceHandler.GetOrderInvoice)
+
+		// Store credit wallet of the logged in user
+		protected.GET("/wallet", middleware.RequirePermission(usermodels.PermWalletUse), walletHandler.GetWallet)
+		protected.POST("/wallet/top-up", middleware.RequirePermission(usermodels.PermWalletUse), walletHandler.TopUp)
+		protected.GET("/wallet/transactions", middleware.RequirePermission(usermodels.PermWalletUse), walletHandler.ListTransactions)
 
 		// Writer Routes (Admin protected)
 		writers := protected.Group("/writers")
-		writers.Use(middleware.AdminRoleMiddleware())
 		{
-			writers.POST("/", writerHandler.CreateWriter)
-			writers.GET("/", writerHandler.ListWriters)
-			writers.GET("/:id", writerHandler.GetWriterByID)
-			writers.PUT("/:id", writerHandler.UpdateWriter)
-			writers.DELETE("/:id", writerHandler.DeleteWriter)
+			writers.POST("/", middleware.RequirePermission(usermodels.PermUsersWrite), writerHandler.CreateWriter)
+			writers.GET("/", middleware.RequirePermission(usermodels.PermUsersRead), writerHandler.ListWriters)
+			writers.GET("/:id", middleware.RequirePermission(usermodels.PermUsersRead), writerHandler.GetWriterByID)
+			writers.PUT("/:id", middleware.RequirePermission(usermodels.PermUsersWrite), writerHandler.UpdateWriter)
+			writers.DELETE("/:id", middleware.RequirePermission(usermodels.PermUsersWrite), writerHandler.DeleteWriter)
 		}
 
 		// Admin Routes
 		admin := protected.Group("/admin")
-		admin.Use(middleware.AdminRoleMiddleware())
 		{
-			admin.GET("/orders", orderHandler.ListOrders)
-			admin.GET("/orders/submitted", orderHandler.ListSubmittedOrders)
-			admin.PUT("/orders/:id/assign", orderHandler.AssignOrder)
+			admin.GET("/orders", middleware.RequirePermission(usermodels.PermOrdersRead), orderHandler.ListOrders)
+			admin.GET("/orders/submitted", middleware.RequirePermission(usermodels.PermOrdersRead), orderHandler.ListSubmittedOrders)
+			admin.PUT("/orders/:id/assign", middleware.RequirePermission(usermodels.PermOrdersAssign), orderHandler.AssignOrder)
+			admin.GET("/orders/:id/events", middleware.RequirePermission(usermodels.PermOrdersRead), orderHandler.GetOrderHistory)
+			admin.POST("/orders/:id/refunds", middleware.RequirePermission(usermodels.PermPaymentsRefund), refundHandler.RefundOrder)
 
 			// OrderType CRUD (admin only)
-			admin.POST("/order-types", orderTypeService.Create)
-			admin.GET("/order-types/:id", orderTypeService.GetByID)
-			admin.PUT("/order-types/:id", orderTypeService.Update)
-			admin.DELETE("/order-types/:id", orderTypeService.Delete)
+			admin.POST("/order-types", middleware.RequirePermission(usermodels.PermCatalogWrite), orderTypeService.Create)
+			admin.GET("/order-types/:id", middleware.RequirePermission(usermodels.PermCatalogRead), orderTypeService.GetByID)
+			admin.PUT("/order-types/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderTypeService.Update)
+			admin.DELETE("/order-types/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderTypeService.Delete)
+			admin.POST("/order-types/:id/archive", middleware.RequirePermission(usermodels.PermCatalogWrite), orderTypeService.Archive)
+			admin.POST("/order-types/:id/restore", middleware.RequirePermission(usermodels.PermCatalogWrite), orderTypeService.Restore)
 
 			// OrderLevel CRUD (admin only)
-			admin.POST("/order-levels", orderLevelHandler.Create)
-			admin.PUT("/order-levels/:id", orderLevelHandler.Update)
-			admin.DELETE("/order-levels/:id", orderLevelHandler.Delete)
+			admin.POST("/order-levels", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLevelHandler.Create)
+			admin.PUT("/order-levels/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLevelHandler.Update)
+			admin.DELETE("/order-levels/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLevelHandler.Delete)
+			admin.POST("/order-levels/:id/archive", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLevelHandler.Archive)
+			admin.POST("/order-levels/:id/restore", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLevelHandler.Restore)
 
 			// OrderPages CRUD (admin only)
-			admin.POST("/order-pages", orderPagesHandler.Create)
-			admin.PUT("/order-pages/:id", orderPagesHandler.Update)
-			admin.DELETE("/order-pages/:id", orderPagesHandler.Delete)
+			admin.POST("/order-pages", middleware.RequirePermission(usermodels.PermCatalogWrite), orderPagesHandler.Create)
+			admin.PUT("/order-pages/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderPagesHandler.Update)
+			admin.DELETE("/order-pages/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderPagesHandler.Delete)
+			admin.POST("/order-pages/:id/archive", middleware.RequirePermission(usermodels.PermCatalogWrite), orderPagesHandler.Archive)
+			admin.POST("/order-pages/:id/restore", middleware.RequirePermission(usermodels.PermCatalogWrite), orderPagesHandler.Restore)
 
 			// OrderUrgency CRUD (admin only)
-			admin.POST("/order-urgency", orderUrgencyHandler.Create)
-			admin.PUT("/order-urgency/:id", orderUrgencyHandler.Update)
-			admin.DELETE("/order-urgency/:id", orderUrgencyHandler.Delete)
+			admin.POST("/order-urgency", middleware.RequirePermission(usermodels.PermCatalogWrite), orderUrgencyHandler.Create)
+			admin.PUT("/order-urgency/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderUrgencyHandler.Update)
+			admin.DELETE("/order-urgency/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderUrgencyHandler.Delete)
+			admin.POST("/order-urgency/:id/archive", middleware.RequirePermission(usermodels.PermCatalogWrite), orderUrgencyHandler.Archive)
+			admin.POST("/order-urgency/:id/restore", middleware.RequirePermission(usermodels.PermCatalogWrite), orderUrgencyHandler.Restore)
 
 			// OrderStyle CRUD (admin only)
-			admin.POST("/order-styles", orderStyleHandler.Create)
-			admin.PUT("/order-styles/:id", orderStyleHandler.Update)
-			admin.DELETE("/order-styles/:id", orderStyleHandler.Delete)
+			admin.POST("/order-styles", middleware.RequirePermission(usermodels.PermCatalogWrite), orderStyleHandler.Create)
+			admin.PUT("/order-styles/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderStyleHandler.Update)
+			admin.DELETE("/order-styles/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderStyleHandler.Delete)
+			admin.POST("/order-styles/:id/archive", middleware.RequirePermission(usermodels.PermCatalogWrite), orderStyleHandler.Archive)
+			admin.POST("/order-styles/:id/restore", middleware.RequirePermission(usermodels.PermCatalogWrite), orderStyleHandler.Restore)
 
 			// OrderLanguage CRUD (admin only)
-			admin.POST("/order-languages", orderLanguageHandler.Create)
-			admin.PUT("/order-languages/:id", orderLanguageHandler.Update)
-			admin.DELETE("/order-languages/:id", orderLanguageHandler.Delete)
+			admin.POST("/order-languages", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLanguageHandler.Create)
+			admin.PUT("/order-languages/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLanguageHandler.Update)
+			admin.DELETE("/order-languages/:id", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLanguageHandler.Delete)
+			admin.POST("/order-languages/:id/archive", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLanguageHandler.Archive)
+			admin.POST("/order-languages/:id/restore", middleware.RequirePermission(usermodels.PermCatalogWrite), orderLanguageHandler.Restore)
+
+			// Price rate tables (admin only)
+			admin.POST("/price-rates", middleware.RequirePermission(usermodels.PermPricingWrite), priceRateHandler.Create)
+			admin.GET("/price-rates", middleware.RequirePermission(usermodels.PermPricingRead), priceRateHandler.List)
+			admin.GET("/price-rates/:id", middleware.RequirePermission(usermodels.PermPricingRead), priceRateHandler.GetByID)
+			admin.PUT("/price-rates/:id", middleware.RequirePermission(usermodels.PermPricingWrite), priceRateHandler.Update)
+			admin.DELETE("/price-rates/:id", middleware.RequirePermission(usermodels.PermPricingWrite), priceRateHandler.Delete)
+
+			// Discount codes (admin only)
+			admin.POST("/promotions", middleware.RequirePermission(usermodels.PermPricingWrite), promotionHandler.Create)
+			admin.GET("/promotions", middleware.RequirePermission(usermodels.PermPricingRead), promotionHandler.List)
+			admin.GET("/promotions/:id", middleware.RequirePermission(usermodels.PermPricingRead), promotionHandler.GetByID)
+			admin.PUT("/promotions/:id", middleware.RequirePermission(usermodels.PermPricingWrite), promotionHandler.Update)
+			admin.DELETE("/promotions/:id", middleware.RequirePermission(usermodels.PermPricingWrite), promotionHandler.Delete)
+
+			// Tax rates per country and region (admin only)
+			admin.POST("/tax-rates", middleware.RequirePermission(usermodels.PermPricingWrite), taxRateHandler.Create)
+			admin.GET("/tax-rates", middleware.RequirePermission(usermodels.PermPricingRead), taxRateHandler.List)
+			admin.GET("/tax-rates/:id", middleware.RequirePermission(usermodels.PermPricingRead), taxRateHandler.GetByID)
+			admin.PUT("/tax-rates/:id", middleware.RequirePermission(usermodels.PermPricingWrite), taxRateHandler.Update)
+			admin.DELETE("/tax-rates/:id", middleware.RequirePermission(usermodels.PermPricingWrite), taxRateHandler.Delete)
+
+			// Exchange rates for quotes and payouts in other currencies
+			admin.POST("/exchange-rates", middleware.RequirePermission(usermodels.PermPricingWrite), exchangeRateHandler.Create)
+			admin.GET("/exchange-rates", middleware.RequirePermission(usermodels.PermPricingRead), exchangeRateHandler.List)
+			admin.GET("/exchange-rates/:id", middleware.RequirePermission(usermodels.PermPricingRead), exchangeRateHandler.GetByID)
+			admin.DELETE("/exchange-rates/:id", middleware.RequirePermission(usermodels.PermPricingWrite), exchangeRateHandler.Delete)
+
+			// Ledger reports for finance (admin only)
+			admin.GET("/ledger/accounts", middleware.RequirePermission(usermodels.PermLedgerRead), ledgerHandler.ListAccounts)
+			admin.GET("/ledger/accounts/:code", middleware.RequirePermission(usermodels.PermLedgerRead), ledgerHandler.GetAccount)
+			admin.GET("/ledger/trial-balance", middleware.RequirePermission(usermodels.PermLedgerRead), ledgerHandler.TrialBalance)
+
+			// Invoices and credit notes (admin only)
+			admin.GET("/invoices", middleware.RequirePermission(usermodels.PermInvoicesRead), invoiceHandler.List)
+			admin.GET("/invoices/:id", middleware.RequirePermission(usermodels.PermInvoicesRead), invoiceHandler.GetByID)
+			admin.POST("/invoices/:id/credit-notes", middleware.RequirePermission(usermodels.PermInvoicesWrite), invoiceHandler.CreateCreditNote)
+
+			// Writer commission rates and payouts (admin only)
+			admin.POST("/commission-rates", middleware.RequirePermission(usermodels.PermPayoutsWrite), commissionRateHandler.Create)
+			admin.GET("/commission-rates", middleware.RequirePermission(usermodels.PermPayoutsRead), commissionRateHandler.List)
+			admin.GET("/commission-rates/:id", middleware.RequirePermission(usermodels.PermPayoutsRead), commissionRateHandler.GetByID)
+			admin.PUT("/commission-rates/:id", middleware.RequirePermission(usermodels.PermPayoutsWrite), commissionRateHandler.Update)
+			admin.DELETE("/commission-rates/:id", middleware.RequirePermission(usermodels.PermPayoutsWrite), commissionRateHandler.Delete)
+			admin.POST("/payout-batches", middleware.RequirePermission(usermodels.PermPayoutsWrite), payoutBatchHandler.Create)
+			admin.GET("/payout-batches", middleware.RequirePermission(usermodels.PermPayoutsRead), payoutBatchHandler.List)
+			admin.GET("/payout-batches/:id", middleware.RequirePermission(usermodels.PermPayoutsRead), payoutBatchHandler.GetByID)
+			admin.POST("/payout-batches/:id/reverse", middleware.RequirePermission(usermodels.PermPayoutsWrite), payoutBatchHandler.Reverse)
+			admin.GET("/payout-batches/:id/export.csv", middleware.RequirePermission(usermodels.PermPayoutsRead), payoutBatchHandler.ExportCSV)
 
 			// List users by role (admin/super_admin only)
-			admin.GET("/users", userHandler.ListUsersByRole)
+			admin.GET("/users", middleware.RequirePermission(usermodels.PermUsersRead), userHandler.ListUsersByRole)
+
+			// Lift lockouts from failed logins
+			admin.DELETE("/users/:id/lockout", middleware.RequirePermission(usermodels.PermUsersWrite), authHandler.UnlockUser)
+			admin.DELETE("/lockouts/ips/:ip", middleware.RequirePermission(usermodels.PermUsersWrite), authHandler.UnlockIP)
 		}
 
 		// Writer Specific Routes
 		writer := protected.Group("/writer")
-		writer.Use(middleware.WriterRoleMiddleware())
 		{
-			writer.POST("/orders/:id/submit", orderHandler.SubmitOrder)
-			writer.PUT("/orders/:id/assignment-response", orderHandler.WriterAcceptAssignment)
-			writer.GET("/orders/:writer_id", orderHandler.GetOrdersByWriter)
+			writer.POST("/orders/:id/submit", middleware.RequirePermission(usermodels.PermOrdersWork), orderHandler.SubmitOrder)
+			writer.PUT("/orders/:id/assignment-response", middleware.RequirePermission(usermodels.PermOrdersWork), orderHandler.WriterAcceptAssignment)
+			writer.GET("/orders/:writer_id", middleware.RequirePermission(usermodels.PermOrdersWork), orderHandler.GetOrdersByWriter)
+			writer.GET("/earnings", middleware.RequirePermission(usermodels.PermOrdersWork), earningsHandler.MyEarnings)
+			writer.GET("/payout-currency", middleware.RequirePermission(usermodels.PermOrdersWork), userHandler.GetPayoutCurrency)
+			writer.PUT("/payout-currency", middleware.RequirePermission(usermodels.PermOrdersWork), userHandler.UpdatePayoutCurrency)
 
 		}
 		// Order Review Routes (User protected for approval/feedback)
 		orderReview := protected.Group("/orders/:id/review")
-		orderReview.Use(middleware.AuthMiddleware())
 		{
-			orderReview.PUT("/approve", orderHandler.ApproveOrder)
-			orderReview.PUT("/feedback", orderHandler.ProvideFeedback)
+			orderReview.PUT("/approve", middleware.RequirePermission(usermodels.PermOrdersPlace), orderHandler.ApproveOrder)
+			orderReview.PUT("/feedback", middleware.RequirePermission(usermodels.PermOrdersPlace), orderHandler.ProvideFeedback)
 		}
 	}
 
 	// Register role and user_role admin routes
-	registerRoleRoutes(r, client.Database(dbName))
+	registerRoleRoutes(r, roleService, userRoleService, roleResolver, userService, signingKeys)
 
 	port := os.Getenv("PORT")
 	if port == "" {